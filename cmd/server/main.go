@@ -24,6 +24,9 @@ func main() {
 
 	application := app.New(log, cfg)
 	go application.GRPCSrv.MustRun()
+	if application.HTTPSrv != nil {
+		go application.HTTPSrv.MustRun()
+	}
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
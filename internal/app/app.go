@@ -2,21 +2,35 @@ package app
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"time"
 
 	"github.com/grigory222/go-chat-server/internal/config"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+	"github.com/grigory222/go-chat-server/internal/lib/lockout"
+	"github.com/grigory222/go-chat-server/internal/lib/mailer"
+	"github.com/grigory222/go-chat-server/internal/lib/oidc"
+	"github.com/grigory222/go-chat-server/internal/lib/passhash"
+	"github.com/grigory222/go-chat-server/internal/lib/ratelimit"
 	"github.com/grigory222/go-chat-server/internal/services/auth"
 	"github.com/grigory222/go-chat-server/internal/services/chat"
 	"github.com/grigory222/go-chat-server/internal/storage"
+	"github.com/grigory222/go-chat-server/internal/storage/localfs"
 	"github.com/grigory222/go-chat-server/internal/storage/postgres"
 
 	grpcapp "github.com/grigory222/go-chat-server/internal/app/grpc"
+	httpapp "github.com/grigory222/go-chat-server/internal/app/http"
 )
 
 type App struct {
-	GRPCSrv *grpcapp.App
-	Storage storage.Storage
+	GRPCSrv     *grpcapp.App
+	HTTPSrv     *httpapp.App
+	Storage     storage.Storage
+	Auth        *auth.Service
+	Thumbnailer *chat.Thumbnailer
+	Scheduler   *chat.Scheduler
+	Janitor     *chat.Janitor
 }
 
 func New(log *slog.Logger, cfg *config.Config) *App {
@@ -28,20 +42,206 @@ func New(log *slog.Logger, cfg *config.Config) *App {
 		panic("failed to init storage: " + err.Error())
 	}
 
+	blobStore, err := localfs.New(cfg.Attachments.Dir)
+	if err != nil {
+		panic("failed to init blob store: " + err.Error())
+	}
+
 	publisher := chat.NewPublisher(log)
 
-	authService := auth.New(log, pgStorage, cfg.AccessTokenTTL, cfg.RefreshTokenTTL, cfg.JwtSecret)
-	chatService := chat.New(log, pgStorage, publisher)
+	keys, err := loadKeys(cfg)
+	if err != nil {
+		panic("failed to load jwt keys: " + err.Error())
+	}
+
+	mail, err := newMailer(cfg.Mail)
+	if err != nil {
+		panic("failed to init mailer: " + err.Error())
+	}
+
+	oidcLogin, err := newOIDC(cfg.OIDC)
+	if err != nil {
+		panic("failed to init oidc: " + err.Error())
+	}
+
+	verification := cfg.EmailVerification
+	switch verification.Require {
+	case "", config.RequireVerifiedLogin, config.RequireVerifiedCreateChat:
+	default:
+		panic("unknown email_verification.require: " + verification.Require)
+	}
+
+	// Отзыв сессии закрывает ее стримы, открытые на этом экземпляре
+	sessionStreams := interceptors.NewSessionStreams()
+	authService := auth.New(log, pgStorage, cfg.AccessTokenTTL, cfg.RefreshTokenTTL, keys, sessionStreams, auth.Options{
+		Mail: auth.Mail{
+			Mailer:        mail,
+			ResetTokenTTL: cfg.Mail.ResetTokenTTL,
+			ResetInterval: cfg.Mail.ResetInterval,
+			ResetURL:      cfg.Mail.ResetURL,
+		},
+		Verification: auth.Verification{
+			TokenTTL:         verification.TokenTTL,
+			ResendInterval:   verification.ResendInterval,
+			URL:              verification.URL,
+			RequiredForLogin: verification.Require == config.RequireVerifiedLogin,
+		},
+		MFA: auth.MFA{
+			Issuer:       cfg.MFA.Issuer,
+			ChallengeTTL: cfg.MFA.ChallengeTTL,
+		},
+		LoginProtection: auth.LoginProtection{
+			Account: newLockout(cfg.LoginProtection.Account),
+			IP:      newLockout(cfg.LoginProtection.IP),
+		},
+		Hasher: passhash.NewArgon2id(passhash.Argon2Params{
+			Memory:      cfg.PasswordHash.Memory,
+			Iterations:  cfg.PasswordHash.Iterations,
+			Parallelism: cfg.PasswordHash.Parallelism,
+			KeyLen:      cfg.PasswordHash.KeyLen,
+		}, cfg.PasswordHash.MemoryBudget),
+		OIDC: oidcLogin,
+	})
+	limits := cfg.RateLimit
+	chatService := chat.New(log, pgStorage, publisher, cfg.Chat.MaxPins, chat.SendLimits{
+		PerUser: ratelimit.New(limits.UserMessages.Rate, limits.UserMessages.Burst),
+		PerChat: ratelimit.New(limits.ChatMessages.Rate, limits.ChatMessages.Burst),
+	})
+	scheduler := chat.NewScheduler(log, chatService, cfg.Chat.SchedulerInterval, cfg.Chat.SchedulerBatch)
+	scheduler.Start()
+	janitor := chat.NewJanitor(
+		log,
+		pgStorage,
+		blobStore,
+		publisher,
+		cfg.Chat.PurgeInterval,
+		cfg.Chat.ExpireInterval,
+		cfg.Chat.PurgeBatch,
+	)
+	janitor.Start()
+	thumbnailer := chat.NewThumbnailer(
+		log,
+		pgStorage,
+		blobStore,
+		publisher,
+		cfg.Attachments.ThumbnailSizes,
+		cfg.Attachments.ThumbnailMaxPixels,
+		cfg.Attachments.ThumbnailWorkers,
+		cfg.Attachments.ThumbnailQueue,
+	)
+	thumbnailer.Start()
+	attachmentService := chat.NewAttachmentService(log, pgStorage, blobStore, cfg.Attachments.MaxSize, thumbnailer)
+
+	rateLimits := &interceptors.RateLimits{
+		User:    ratelimit.New(limits.User.Rate, limits.User.Burst),
+		Methods: make(map[string]*ratelimit.Limiter, len(limits.Methods)),
+	}
+	for method, limit := range limits.Methods {
+		rateLimits.Methods[method] = ratelimit.New(limit.Rate, limit.Burst)
+	}
 
-	grpcApp := grpcapp.New(log, cfg.GRPC.Port, authService, chatService, cfg.JwtSecret)
+	grpcApp := grpcapp.New(
+		log,
+		cfg.GRPC.Port,
+		authService,
+		chatService,
+		attachmentService,
+		cfg.Attachments.ChunkSize,
+		verification.Require == config.RequireVerifiedCreateChat,
+		keys,
+		&interceptors.Sessions{Checker: authService, Streams: sessionStreams},
+		rateLimits,
+	)
+
+	// Сервер JWKS запускается, только если задан http.port
+	var httpApp *httpapp.App
+	if cfg.HTTP.Port != 0 {
+		httpApp = httpapp.New(log, cfg.HTTP.Port, keys)
+	}
 
 	return &App{
-		GRPCSrv: grpcApp,
-		Storage: pgStorage,
+		GRPCSrv:     grpcApp,
+		HTTPSrv:     httpApp,
+		Storage:     pgStorage,
+		Auth:        authService,
+		Thumbnailer: thumbnailer,
+		Scheduler:   scheduler,
+		Janitor:     janitor,
 	}
 }
 
+// loadKeys загружает ключи подписи токенов. Без jwt.signing_key используется HS256 секрет.
+func loadKeys(cfg *config.Config) (*auth.KeySet, error) {
+	if cfg.JWT.SigningKey == "" {
+		if cfg.JwtSecret == "" {
+			return nil, errors.New("either jwt_secret or jwt.signing_key is required")
+		}
+		return auth.NewHMACKeySet(string(cfg.JwtSecret)), nil
+	}
+
+	verification := make([]auth.KeyFile, 0, len(cfg.JWT.VerificationKeys))
+	for _, k := range cfg.JWT.VerificationKeys {
+		verification = append(verification, auth.KeyFile{ID: k.ID, Path: k.Path})
+	}
+	return auth.LoadKeySet(auth.KeyFile{ID: cfg.JWT.KeyID, Path: cfg.JWT.SigningKey}, verification)
+}
+
+// newMailer выбирает SMTP, если задан сервер, иначе сохраняет письма в локальный outbox.
+func newMailer(cfg config.Mail) (mailer.Mailer, error) {
+	if cfg.SMTP.Host != "" {
+		return mailer.NewSMTP(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, string(cfg.SMTP.Password), cfg.From), nil
+	}
+	return mailer.NewOutbox(cfg.OutboxDir, cfg.From)
+}
+
+// newOIDC настраивает вход через OpenID провайдера, если задан oidc.issuer. Провайдер
+// запрашивается при первом входе, поэтому его недоступность не мешает запуску.
+func newOIDC(cfg config.OIDC) (auth.OIDC, error) {
+	if cfg.Issuer == "" {
+		return auth.OIDC{}, nil
+	}
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return auth.OIDC{}, errors.New("oidc.client_id and oidc.redirect_url are required")
+	}
+
+	provider := oidc.New(oidc.Config{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: string(cfg.ClientSecret),
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+	})
+	return auth.OIDC{Provider: provider, StateTTL: cfg.StateTTL}, nil
+}
+
+func newLockout(cfg config.Lockout) *lockout.Guard {
+	return lockout.New(lockout.Config{
+		FreeAttempts:    cfg.FreeAttempts,
+		BaseDelay:       cfg.BaseDelay,
+		MaxDelay:        cfg.MaxDelay,
+		LockoutAttempts: cfg.LockoutAttempts,
+		LockoutDuration: cfg.LockoutDuration,
+		ResetAfter:      cfg.ResetAfter,
+	})
+}
+
 func (a *App) Stop() {
 	a.GRPCSrv.Stop()
+	if a.HTTPSrv != nil {
+		a.HTTPSrv.Stop()
+	}
+	// Дожидаемся фоновых задач до закрытия хранилища
+	if a.Scheduler != nil {
+		a.Scheduler.Stop()
+	}
+	if a.Janitor != nil {
+		a.Janitor.Stop()
+	}
+	if a.Thumbnailer != nil {
+		a.Thumbnailer.Stop()
+	}
+	if a.Auth != nil {
+		a.Auth.Wait()
+	}
 	a.Storage.Close()
 }
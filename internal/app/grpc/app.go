@@ -5,6 +5,7 @@ import (
 	"github.com/grigory222/go-chat-server/internal/grpc/authgrpc"
 	"github.com/grigory222/go-chat-server/internal/grpc/chatgrpc"
 	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+	"github.com/grigory222/go-chat-server/internal/services/auth"
 	"google.golang.org/grpc"
 	"log/slog"
 	"net"
@@ -16,18 +17,32 @@ type App struct {
 	port       int
 }
 
-func New(log *slog.Logger, port int, authService authgrpc.AuthService, chatService chatgrpc.ChatService, jwtSecret string) *App {
-
-	unaryAuthInterceptor := interceptors.NewAuthInterceptor(log, jwtSecret)
-	streamAuthInterceptor := interceptors.NewAuthStreamInterceptor(log, jwtSecret)
+func New(
+	log *slog.Logger,
+	port int,
+	authService authgrpc.AuthService,
+	chatService chatgrpc.ChatService,
+	attachmentService chatgrpc.AttachmentService,
+	chunkSize int,
+	requireVerifiedEmail bool,
+	keys *auth.KeySet,
+	sessions *interceptors.Sessions,
+	rateLimits *interceptors.RateLimits,
+) *App {
+
+	unaryAuthInterceptor := interceptors.NewAuthInterceptor(log, keys, sessions)
+	streamAuthInterceptor := interceptors.NewAuthStreamInterceptor(log, keys, sessions)
+	// Лимиты идут после аутентификации: им нужен ID пользователя из контекста
+	unaryRateLimitInterceptor := interceptors.NewRateLimitInterceptor(log, rateLimits)
+	streamRateLimitInterceptor := interceptors.NewRateLimitStreamInterceptor(log, rateLimits)
 
 	gRPCServer := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(unaryAuthInterceptor),
-		grpc.ChainStreamInterceptor(streamAuthInterceptor),
+		grpc.ChainUnaryInterceptor(unaryAuthInterceptor, unaryRateLimitInterceptor),
+		grpc.ChainStreamInterceptor(streamAuthInterceptor, streamRateLimitInterceptor),
 	)
 
 	authgrpc.Register(gRPCServer, log, authService)
-	chatgrpc.Register(gRPCServer, log, chatService)
+	chatgrpc.Register(gRPCServer, log, chatService, attachmentService, chunkSize, requireVerifiedEmail)
 
 	return &App{
 		log:        log,
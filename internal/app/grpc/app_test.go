@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+	"github.com/grigory222/go-chat-server/internal/lib/passhash"
 	"github.com/grigory222/go-chat-server/internal/services/auth"
 	"github.com/grigory222/go-chat-server/internal/services/chat"
 	"github.com/stretchr/testify/mock"
@@ -45,18 +47,26 @@ func (m *MockStorage) UserByID(ctx context.Context, id int64) (*models.User, err
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
-func (m *MockStorage) CreateChat(ctx context.Context, name string) (int64, error) {
-	args := m.Called(ctx, name)
+func (m *MockStorage) CreateChat(ctx context.Context, name, chatType string) (int64, error) {
+	args := m.Called(ctx, name, chatType)
 	return args.Get(0).(int64), args.Error(1)
 }
 
-func (m *MockStorage) AddUserToChat(ctx context.Context, chatID, userID int64) error {
-	args := m.Called(ctx, chatID, userID)
+func (m *MockStorage) AddUserToChat(ctx context.Context, chatID, userID int64, role models.ChatRole) error {
+	args := m.Called(ctx, chatID, userID, role)
 	return args.Error(0)
 }
 
-func (m *MockStorage) SaveMessage(ctx context.Context, chatID, userID int64, text string) (*models.Message, error) {
-	args := m.Called(ctx, chatID, userID, text)
+func (m *MockStorage) SaveMessage(ctx context.Context, chatID, userID int64, text, idempotencyKey string, attachmentIDs []int64, ttl time.Duration, claimSlowModeSlot bool) (*models.Message, error) {
+	args := m.Called(ctx, chatID, userID, text, idempotencyKey, attachmentIDs, ttl, claimSlowModeSlot)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Message), args.Error(1)
+}
+
+func (m *MockStorage) MessageByIdempotencyKey(ctx context.Context, chatID, userID int64, idempotencyKey string) (*models.Message, error) {
+	args := m.Called(ctx, chatID, userID, idempotencyKey)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -76,6 +86,400 @@ func (m *MockStorage) IsUserInChat(ctx context.Context, userID, chatID int64) (b
 	return args.Bool(0), args.Error(1)
 }
 
+func (m *MockStorage) SearchMessages(ctx context.Context, userID int64, query string, filter models.SearchFilter, limit, offset uint64) ([]*models.SearchResult, error) {
+	args := m.Called(ctx, userID, query, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.SearchResult), args.Error(1)
+}
+
+func (m *MockStorage) SaveAttachment(ctx context.Context, attachment *models.Attachment) (int64, error) {
+	args := m.Called(ctx, attachment)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) AttachmentByID(ctx context.Context, id int64) (*models.Attachment, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Attachment), args.Error(1)
+}
+
+func (m *MockStorage) MessageByID(ctx context.Context, id int64) (*models.Message, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Message), args.Error(1)
+}
+
+func (m *MockStorage) SaveThumbnail(ctx context.Context, thumbnail *models.Thumbnail) error {
+	args := m.Called(ctx, thumbnail)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ChatMemberRole(ctx context.Context, chatID, userID int64) (models.ChatRole, error) {
+	args := m.Called(ctx, chatID, userID)
+	return args.Get(0).(models.ChatRole), args.Error(1)
+}
+
+func (m *MockStorage) PinMessage(ctx context.Context, chatID, messageID, pinnedBy int64, maxPins int) (bool, error) {
+	args := m.Called(ctx, chatID, messageID, pinnedBy, maxPins)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) UnpinMessage(ctx context.Context, chatID, messageID int64) (bool, error) {
+	args := m.Called(ctx, chatID, messageID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) PinnedMessages(ctx context.Context, chatID int64) ([]*models.Message, error) {
+	args := m.Called(ctx, chatID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Message), args.Error(1)
+}
+
+func (m *MockStorage) SaveScheduledMessage(ctx context.Context, chatID, userID int64, text string, sendAt time.Time) (*models.ScheduledMessage, error) {
+	args := m.Called(ctx, chatID, userID, text, sendAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ScheduledMessage), args.Error(1)
+}
+
+func (m *MockStorage) ScheduledMessages(ctx context.Context, userID, chatID int64) ([]*models.ScheduledMessage, error) {
+	args := m.Called(ctx, userID, chatID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.ScheduledMessage), args.Error(1)
+}
+
+func (m *MockStorage) UpdateScheduledMessage(ctx context.Context, id, userID int64, text string, sendAt time.Time) (*models.ScheduledMessage, error) {
+	args := m.Called(ctx, id, userID, text, sendAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ScheduledMessage), args.Error(1)
+}
+
+func (m *MockStorage) DeleteScheduledMessage(ctx context.Context, id, userID int64) error {
+	args := m.Called(ctx, id, userID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ClaimDueScheduledMessages(ctx context.Context, lease time.Duration, limit int) ([]*models.ScheduledMessage, error) {
+	args := m.Called(ctx, lease, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.ScheduledMessage), args.Error(1)
+}
+
+func (m *MockStorage) FinishScheduledMessage(ctx context.Context, id, messageID int64) error {
+	args := m.Called(ctx, id, messageID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RetentionPolicy(ctx context.Context, chatID int64) (*models.RetentionPolicy, error) {
+	args := m.Called(ctx, chatID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RetentionPolicy), args.Error(1)
+}
+
+func (m *MockStorage) SetRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy, actorID int64) error {
+	args := m.Called(ctx, policy, actorID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ActiveRetentionPolicies(ctx context.Context) ([]*models.RetentionPolicy, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.RetentionPolicy), args.Error(1)
+}
+
+func (m *MockStorage) PurgeExpiredMessages(ctx context.Context, chatID int64, limit int) (*models.PurgeBatch, error) {
+	args := m.Called(ctx, chatID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PurgeBatch), args.Error(1)
+}
+
+func (m *MockStorage) SavePurgeRun(ctx context.Context, run *models.PurgeRun) error {
+	args := m.Called(ctx, run)
+	return args.Error(0)
+}
+
+func (m *MockStorage) DeleteExpiredMessages(ctx context.Context, limit int) (*models.PurgeBatch, error) {
+	args := m.Called(ctx, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PurgeBatch), args.Error(1)
+}
+
+func (m *MockStorage) SlowMode(ctx context.Context, chatID int64) (time.Duration, error) {
+	args := m.Called(ctx, chatID)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *MockStorage) SetSlowMode(ctx context.Context, chatID int64, interval time.Duration) error {
+	args := m.Called(ctx, chatID, interval)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ChatByID(ctx context.Context, chatID int64) (*models.Chat, error) {
+	args := m.Called(ctx, chatID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Chat), args.Error(1)
+}
+
+func (m *MockStorage) ChatMember(ctx context.Context, chatID, userID int64) (*models.ChatMember, error) {
+	args := m.Called(ctx, chatID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ChatMember), args.Error(1)
+}
+
+func (m *MockStorage) ModerationSettings(ctx context.Context, chatID int64) (*models.ModerationSettings, error) {
+	args := m.Called(ctx, chatID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ModerationSettings), args.Error(1)
+}
+
+func (m *MockStorage) SetModerationSettings(ctx context.Context, settings *models.ModerationSettings) error {
+	args := m.Called(ctx, settings)
+	return args.Error(0)
+}
+
+func (m *MockStorage) IsServerAdmin(ctx context.Context, userID int64) (bool, error) {
+	args := m.Called(ctx, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) CreateReport(ctx context.Context, messageID, reporterID int64, reason string) (*models.Report, error) {
+	args := m.Called(ctx, messageID, reporterID, reason)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Report), args.Error(1)
+}
+
+func (m *MockStorage) ReportByID(ctx context.Context, id int64) (*models.Report, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Report), args.Error(1)
+}
+
+func (m *MockStorage) Reports(ctx context.Context, filter models.ReportFilter, limit, offset uint64) ([]*models.Report, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Report), args.Error(1)
+}
+
+func (m *MockStorage) ClaimReport(ctx context.Context, id, moderatorID int64, claimTTL time.Duration) (*models.Report, error) {
+	args := m.Called(ctx, id, moderatorID, claimTTL)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Report), args.Error(1)
+}
+
+func (m *MockStorage) ResolveReport(ctx context.Context, res *models.ReportResolution) (*models.Report, error) {
+	args := m.Called(ctx, res)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Report), args.Error(1)
+}
+
+func (m *MockStorage) ModerationAudit(ctx context.Context, chatID int64, limit, offset uint64) ([]*models.AuditEntry, error) {
+	args := m.Called(ctx, chatID, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.AuditEntry), args.Error(1)
+}
+
+func (m *MockStorage) SetMemberMute(ctx context.Context, chatID, userID, moderatorID int64, until *time.Time) error {
+	args := m.Called(ctx, chatID, userID, moderatorID, until)
+	return args.Error(0)
+}
+
+func (m *MockStorage) CreateSession(ctx context.Context, session *models.Session, refreshID string) error {
+	args := m.Called(ctx, session, refreshID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RotateRefreshToken(ctx context.Context, sessionID, oldID, newID string, expiresAt time.Time) error {
+	args := m.Called(ctx, sessionID, oldID, newID, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockStorage) Sessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Session), args.Error(1)
+}
+
+func (m *MockStorage) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	args := m.Called(ctx, sessionID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RevokeUserSessions(ctx context.Context, userID int64) ([]string, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) ChangePassword(ctx context.Context, userID int64, passHash, keepSessionID string) ([]string, error) {
+	args := m.Called(ctx, userID, passHash, keepSessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) CreatePasswordResetToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userID, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ResetPassword(ctx context.Context, tokenHash, passHash string) (int64, []string, error) {
+	args := m.Called(ctx, tokenHash, passHash)
+	return args.Get(0).(int64), args.Get(1).([]string), args.Error(2)
+}
+
+func (m *MockStorage) CreateEmailVerificationToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userID, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockStorage) EmailVerificationSentAt(ctx context.Context, userID int64) (time.Time, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockStorage) VerifyEmail(ctx context.Context, tokenHash string) (int64, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) SaveTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	args := m.Called(ctx, userID, secret)
+	return args.Error(0)
+}
+
+func (m *MockStorage) TOTPByUserID(ctx context.Context, userID int64) (*models.TOTP, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TOTP), args.Error(1)
+}
+
+func (m *MockStorage) EnableTOTP(ctx context.Context, userID, step int64, recoveryHashes []string) error {
+	args := m.Called(ctx, userID, step, recoveryHashes)
+	return args.Error(0)
+}
+
+func (m *MockStorage) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	args := m.Called(ctx, userID, step)
+	return args.Error(0)
+}
+
+func (m *MockStorage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	args := m.Called(ctx, userID, codeHash)
+	return args.Error(0)
+}
+
+func (m *MockStorage) DisableTOTP(ctx context.Context, userID int64) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockStorage) UpdatePasswordHash(ctx context.Context, userID int64, oldHash, newHash string) error {
+	args := m.Called(ctx, userID, oldHash, newHash)
+	return args.Error(0)
+}
+
+func (m *MockStorage) CreateOIDCState(ctx context.Context, state *models.OIDCState) error {
+	args := m.Called(ctx, state)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ConsumeOIDCState(ctx context.Context, stateHash string) (*models.OIDCState, error) {
+	args := m.Called(ctx, stateHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OIDCState), args.Error(1)
+}
+
+func (m *MockStorage) UserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	args := m.Called(ctx, issuer, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockStorage) LinkIdentity(ctx context.Context, userID int64, issuer, subject string) ([]string, error) {
+	args := m.Called(ctx, userID, issuer, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) SaveOIDCUser(ctx context.Context, name, email, issuer, subject string) (int64, error) {
+	args := m.Called(ctx, name, email, issuer, subject)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockStorage) DeleteOrphanBlob(ctx context.Context, key string, deleteBlob func(context.Context, string) error) (bool, error) {
+	args := m.Called(ctx, key, deleteBlob)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) SetMemberRole(ctx context.Context, chatID, userID, ownerID int64, role models.ChatRole) error {
+	args := m.Called(ctx, chatID, userID, ownerID, role)
+	return args.Error(0)
+}
+
+func (m *MockStorage) PasswordResetSentAt(ctx context.Context, userID int64) (time.Time, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
 func (m *MockStorage) Close() {}
 
 type GRPCAppTestSuite struct {
@@ -95,10 +499,12 @@ func (s *GRPCAppTestSuite) SetupSuite() {
 	// Setup mock expectations in tests
 
 	publisher := chat.NewPublisher(log)
-	authService := auth.New(log, storageMock, time.Hour, time.Hour, "secret")
-	chatService := chat.New(log, storageMock, publisher)
+	authService := auth.New(log, storageMock, time.Hour, time.Hour, auth.NewHMACKeySet("secret"), nil, auth.Options{
+		Hasher: passhash.NewArgon2id(passhash.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, KeyLen: 32}, 0),
+	})
+	chatService := chat.New(log, storageMock, publisher, 10, chat.SendLimits{})
 
-	s.app = New(log, 0, authService, chatService, "secret")
+	s.app = New(log, 0, authService, chatService, chat.NewAttachmentService(log, storageMock, nil, 1024, nil), 64*1024, false, auth.NewHMACKeySet("secret"), nil, &interceptors.RateLimits{})
 
 	go func() {
 		if err := s.app.gRPCServer.Serve(s.lis); err != nil {
@@ -129,9 +535,11 @@ func (s *GRPCAppTestSuite) TestStartAndStop() {
 	log := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	storageMock := new(MockStorage)
 	publisher := chat.NewPublisher(log)
-	authService := auth.New(log, storageMock, time.Hour, time.Hour, "secret")
-	chatService := chat.New(log, storageMock, publisher)
-	app := New(log, 9999, authService, chatService, "secret")
+	authService := auth.New(log, storageMock, time.Hour, time.Hour, auth.NewHMACKeySet("secret"), nil, auth.Options{
+		Hasher: passhash.NewArgon2id(passhash.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, KeyLen: 32}, 0),
+	})
+	chatService := chat.New(log, storageMock, publisher, 10, chat.SendLimits{})
+	app := New(log, 9999, authService, chatService, nil, 64*1024, false, auth.NewHMACKeySet("secret"), nil, &interceptors.RateLimits{})
 
 	go func() {
 		// Since we're not in a real network environment, Run will error out
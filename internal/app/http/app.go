@@ -0,0 +1,78 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/http/jwks"
+	"github.com/grigory222/go-chat-server/internal/services/auth"
+)
+
+// shutdownTimeout - сколько ждать завершения текущих запросов при остановке.
+const shutdownTimeout = 5 * time.Second
+
+// App - служебный HTTP сервер. Сейчас публикует только JWKS.
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+}
+
+func New(log *slog.Logger, port int, keys *auth.KeySet) *App {
+	mux := http.NewServeMux()
+	mux.Handle(jwks.Path, jwks.New(log, keys))
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		port: port,
+	}
+}
+
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "httpapp.Run"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("port", a.port),
+	)
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("HTTP server is running", slog.String("addr", l.Addr().String()))
+
+	if err := a.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *App) Stop() {
+	const op = "httpapp.Stop"
+
+	a.log.With(slog.String("op", op)).Info("stopping HTTP server", slog.Int("port", a.port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		a.log.Error("failed to stop HTTP server", slog.Any("err", err))
+	}
+}
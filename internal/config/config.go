@@ -2,6 +2,7 @@ package config
 
 import (
 	"flag"
+	"log/slog"
 	"os"
 	"time"
 
@@ -9,29 +10,227 @@ import (
 )
 
 type Config struct {
-	Env             string        `yaml:"env" env-default:"local"`
-	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env-required:"true"`
-	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-required:"true"`
-	JwtSecret       string        `yaml:"jwt_secret" env-required:"true"`
-	GRPC            `yaml:"grpc"`
-	Postgres        Postgres `yaml:"postgres"`
+	Env               string        `yaml:"env" env-default:"local"`
+	AccessTokenTTL    time.Duration `yaml:"access_token_ttl" env-required:"true"`
+	RefreshTokenTTL   time.Duration `yaml:"refresh_token_ttl" env-required:"true"`
+	JwtSecret         Secret        `yaml:"jwt_secret"`
+	JWT               JWT           `yaml:"jwt"`
+	GRPC              `yaml:"grpc"`
+	HTTP              HTTP              `yaml:"http"`
+	Mail              Mail              `yaml:"mail"`
+	EmailVerification EmailVerification `yaml:"email_verification"`
+	MFA               MFA               `yaml:"mfa"`
+	Postgres          Postgres          `yaml:"postgres"`
+	Attachments       Attachments       `yaml:"attachments"`
+	Chat              Chat              `yaml:"chat"`
+	RateLimit         RateLimit         `yaml:"rate_limit"`
+	LoginProtection   LoginProtection   `yaml:"login_protection"`
+	PasswordHash      PasswordHash      `yaml:"password_hash"`
+	OIDC              OIDC              `yaml:"oidc"`
 }
 
+// Secret - пароль или ключ из конфига. При выводе в лог (в том числе всего Config)
+// и при форматировании через fmt значение скрывается; само значение - string(s).
+type Secret string
+
+const redacted = "[REDACTED]"
+
+func (s Secret) String() string { return redacted }
+
+// LogValue скрывает значение, когда секрет логируется отдельно.
+func (s Secret) LogValue() slog.Value { return slog.StringValue(redacted) }
+
+// MarshalText скрывает значение в JSON логах, где Config сериализуется целиком.
+func (s Secret) MarshalText() ([]byte, error) { return []byte(redacted), nil }
+
 type GRPC struct {
 	Port    int           `yaml:"port"`
 	Timeout time.Duration `yaml:"timeout"`
 }
 
+// JWT - асимметричные ключи подписи токенов в PEM файлах: Ed25519 (EdDSA) или RSA (RS256).
+// Если signing_key не задан, токены подписываются HS256 секретом jwt_secret.
+type JWT struct {
+	// SigningKey - закрытый ключ, которым подписываются новые токены
+	SigningKey string `yaml:"signing_key"`
+	// KeyID - kid ключа подписи; по умолчанию JWK thumbprint открытого ключа
+	KeyID string `yaml:"key_id"`
+	// VerificationKeys - дополнительные ключи проверки, например предыдущий ключ при ротации
+	VerificationKeys []JWTKey `yaml:"verification_keys"`
+}
+
+type JWTKey struct {
+	ID   string `yaml:"id"`
+	Path string `yaml:"path"`
+}
+
+// HTTP - служебный HTTP сервер с JWKS (/.well-known/jwks.json). Порт 0 отключает сервер.
+type HTTP struct {
+	Port int `yaml:"port"`
+}
+
+// Mail - письма пользователям. Если smtp.host не задан, письма сохраняются файлами в outbox_dir.
+type Mail struct {
+	// From - адрес отправителя, например "go-chat <no-reply@example.com>"
+	From      string `yaml:"from" env-default:"go-chat <no-reply@localhost>"`
+	OutboxDir string `yaml:"outbox_dir" env-default:"./data/outbox"`
+	SMTP      SMTP   `yaml:"smtp"`
+	// ResetTokenTTL - срок действия ссылки сброса пароля
+	ResetTokenTTL time.Duration `yaml:"reset_token_ttl" env-default:"1h"`
+	// ResetInterval - письмо сброса пароля не чаще раза за интервал
+	ResetInterval time.Duration `yaml:"reset_interval" env-default:"1m"`
+	// ResetURL - шаблон ссылки сброса пароля, {token} заменяется токеном
+	ResetURL string `yaml:"reset_url"`
+}
+
+// Значения EmailVerification.Require.
+const (
+	RequireVerifiedLogin      = "login"
+	RequireVerifiedCreateChat = "create_chat"
+)
+
+// EmailVerification - подтверждение email по ссылке из письма, отправляемого при регистрации.
+type EmailVerification struct {
+	// TokenTTL - срок действия ссылки подтверждения
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"24h"`
+	// ResendInterval - повторное письмо не чаще раза за интервал
+	ResendInterval time.Duration `yaml:"resend_interval" env-default:"1m"`
+	// URL - шаблон ссылки подтверждения, {token} заменяется токеном
+	URL string `yaml:"url"`
+	// Require - что запрещено без подтвержденного email: "login", "create_chat"
+	// или ничего (пустое значение)
+	Require string `yaml:"require"`
+}
+
+// MFA - двухфакторная аутентификация по TOTP, включается пользователем.
+type MFA struct {
+	// Issuer - название сервиса в приложении-аутентификаторе
+	Issuer string `yaml:"issuer" env-default:"go-chat"`
+	// ChallengeTTL - сколько действует токен второго шага входа
+	ChallengeTTL time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password Secret `yaml:"password" env:"SMTP_PASSWORD"`
+}
+
 type Postgres struct {
 	Host           string        `yaml:"host" env-required:"true"`
 	Port           int           `yaml:"port" env-default:"5432"`
 	User           string        `yaml:"user" env-required:"true"`
-	Password       string        `yaml:"password" env-required:"true"`
+	Password       Secret        `yaml:"password" env-required:"true"`
 	DBName         string        `yaml:"dbname" env-required:"true"`
 	SSLMode        string        `yaml:"sslmode" env-default:"disable"`
 	MaxConns       int32         `yaml:"max_conns" env-default:"10"`
 	MinConns       int32         `yaml:"min_conns" env-default:"2"`
 	ConnectTimeout time.Duration `yaml:"connect_timeout" env-default:"5s"`
+	// SearchConfig - конфигурация полнотекстового поиска Postgres (russian, english, simple, ...)
+	SearchConfig string `yaml:"search_config" env-default:"simple"`
+}
+
+type Attachments struct {
+	// Dir - корневая директория локального blob-хранилища
+	Dir string `yaml:"dir" env-default:"./data/attachments"`
+	// MaxSize - максимальный размер одного файла в байтах
+	MaxSize int64 `yaml:"max_size" env-default:"20971520"`
+	// ChunkSize - максимальный размер чанка при загрузке и размер чанка при скачивании
+	ChunkSize int `yaml:"chunk_size" env-default:"65536"`
+	// ThumbnailSizes - максимальные размеры большей стороны превью изображений в пикселях
+	ThumbnailSizes []int `yaml:"thumbnail_sizes" env-default:"128,512"`
+	// ThumbnailMaxPixels - для изображений с большим числом пикселей превью не строятся
+	// (декодирование занимает около 4 байт памяти на пиксель); 0 - без ограничения
+	ThumbnailMaxPixels int64 `yaml:"thumbnail_max_pixels" env-default:"40000000"`
+	// ThumbnailWorkers - число фоновых воркеров генерации превью
+	ThumbnailWorkers int `yaml:"thumbnail_workers" env-default:"2"`
+	// ThumbnailQueue - размер очереди задач; при переполнении превью для файла не строятся
+	ThumbnailQueue int `yaml:"thumbnail_queue" env-default:"64"`
+}
+
+type Chat struct {
+	// MaxPins - максимальное число закрепленных сообщений в одном чате
+	MaxPins int `yaml:"max_pins" env-default:"50"`
+	// SchedulerInterval - период опроса очереди отложенных сообщений
+	SchedulerInterval time.Duration `yaml:"scheduler_interval" env-default:"1s"`
+	// SchedulerBatch - сколько созревших отложенных сообщений забирается за один запрос
+	SchedulerBatch int `yaml:"scheduler_batch" env-default:"100"`
+	// PurgeInterval - период удаления сообщений по сроку хранения
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+	// PurgeBatch - сколько сообщений удаляется в одной транзакции
+	PurgeBatch int `yaml:"purge_batch" env-default:"500"`
+	// ExpireInterval - период удаления исчезающих сообщений с истекшим TTL
+	ExpireInterval time.Duration `yaml:"expire_interval" env-default:"5s"`
+}
+
+// RateLimit - лимиты частоты запросов (token bucket). Лимит с rate: 0 отключен.
+type RateLimit struct {
+	// User - все RPC одного пользователя; для публичных методов ключом служит IP клиента
+	User Limit `yaml:"user"`
+	// Methods - лимиты отдельных RPC на пользователя, ключ - имя метода (SendMessage, Login, ...)
+	Methods map[string]Limit `yaml:"methods"`
+	// UserMessages - сообщения одного пользователя во все чаты (JoinChat и SendMessage)
+	UserMessages Limit `yaml:"user_messages"`
+	// ChatMessages - сообщения всех участников в один чат
+	ChatMessages Limit `yaml:"chat_messages"`
+}
+
+type Limit struct {
+	// Rate - запросов в секунду
+	Rate float64 `yaml:"rate"`
+	// Burst - допустимый всплеск запросов сверх Rate
+	Burst int `yaml:"burst"`
+}
+
+// LoginProtection - защита Login и VerifyMFA от перебора: после неудачных попыток следующие
+// задерживаются, а затем блокируются. Пороги без base_delay и lockout_attempts отключены.
+type LoginProtection struct {
+	// Account - неудачи по одному email
+	Account Lockout `yaml:"account"`
+	// IP - неудачи с одного IP клиента по любым email
+	IP Lockout `yaml:"ip"`
+}
+
+type Lockout struct {
+	// FreeAttempts - сколько неудач подряд проходит без задержки
+	FreeAttempts int `yaml:"free_attempts"`
+	// BaseDelay - первая задержка, дальше она удваивается до MaxDelay
+	BaseDelay time.Duration `yaml:"base_delay"`
+	MaxDelay  time.Duration `yaml:"max_delay"`
+	// LockoutAttempts - после стольких неудач вход блокируется на LockoutDuration
+	LockoutAttempts int           `yaml:"lockout_attempts"`
+	LockoutDuration time.Duration `yaml:"lockout_duration"`
+	// ResetAfter - через сколько без неудач счетчик обнуляется
+	ResetAfter time.Duration `yaml:"reset_after"`
+}
+
+// PasswordHash - параметры argon2id для новых хэшей паролей. Хэши bcrypt и хэши
+// с другими параметрами пересчитываются при следующем входе пользователя.
+type PasswordHash struct {
+	// Memory - память в KiB
+	Memory      uint32 `yaml:"memory" env-default:"65536"`
+	Iterations  uint32 `yaml:"iterations" env-default:"3"`
+	Parallelism uint8  `yaml:"parallelism" env-default:"2"`
+	// KeyLen - длина хэша в байтах
+	KeyLen uint32 `yaml:"key_len" env-default:"32"`
+	// MemoryBudget - память в KiB на все одновременные вычисления хэшей;
+	// вычисления сверх бюджета ждут очереди
+	MemoryBudget uint32 `yaml:"memory_budget" env-default:"1048576"`
+}
+
+// OIDC - вход через OpenID провайдера компании. Пустой issuer отключает вход.
+type OIDC struct {
+	// Issuer - адрес провайдера; настройки берутся из его /.well-known/openid-configuration
+	Issuer   string `yaml:"issuer"`
+	ClientID string `yaml:"client_id"`
+	// ClientSecret - секрет клиента; не задается, если клиент зарегистрирован как публичный
+	ClientSecret Secret `yaml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	// RedirectURL - адрес возврата с кодом авторизации, зарегистрированный у провайдера
+	RedirectURL string   `yaml:"redirect_url"`
+	Scopes      []string `yaml:"scopes" env-default:"openid,email,profile"`
+	// StateTTL - сколько ждать возврата пользователя со страницы провайдера
+	StateTTL time.Duration `yaml:"state_ttl" env-default:"10m"`
 }
 
 func MustLoad() *Config {
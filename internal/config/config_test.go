@@ -1,8 +1,11 @@
 package config
 
 import (
+	"bytes"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -41,3 +44,22 @@ func TestMustLoad_PanicWhenFileMissing(t *testing.T) {
 	}()
 	MustLoad()
 }
+
+func TestSecretsAreRedactedInLogs(t *testing.T) {
+	cfg := &Config{JwtSecret: "jwt-value", Postgres: Postgres{Password: "pg-value"}}
+	cfg.Mail.SMTP.Password = "smtp-value"
+	cfg.OIDC.ClientSecret = "oidc-value"
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("text", slog.Any("cfg", cfg))
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("json", slog.Any("cfg", cfg), slog.Any("secret", cfg.OIDC.ClientSecret))
+
+	for _, secret := range []string{"jwt-value", "pg-value", "smtp-value", "oidc-value"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Fatalf("secret %q leaked into logs: %s", secret, buf.String())
+		}
+	}
+	if string(cfg.OIDC.ClientSecret) != "oidc-value" {
+		t.Fatalf("secret value must stay available to the code")
+	}
+}
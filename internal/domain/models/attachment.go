@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Attachment - метаданные загруженного файла. Содержимое лежит в blob-хранилище под ключом SHA256.
+type Attachment struct {
+	ID         int64
+	ChatID     int64
+	UploaderID int64
+	// MessageID равен 0, пока вложение не прикреплено к сообщению
+	MessageID int64
+	Name      string
+	MimeType  string
+	Size      int64
+	SHA256    string
+	// Width и Height заполнены только для изображений
+	Width      int
+	Height     int
+	Thumbnails []*Thumbnail
+	CreatedAt  time.Time
+}
+
+// Thumbnail - уменьшенная копия изображения-вложения, хранится в blob-хранилище под ключом SHA256.
+type Thumbnail struct {
+	ID           int64
+	AttachmentID int64
+	Width        int
+	Height       int
+	MimeType     string
+	Size         int64
+	SHA256       string
+}
@@ -2,6 +2,14 @@ package models
 
 import "time"
 
+// Типы чатов
+const (
+	ChatTypePublic = "public"
+	// ChatTypeChannel - канал объявлений: пишут только владелец и администраторы,
+	// остальные участники подписываются и читают
+	ChatTypeChannel = "channel"
+)
+
 type Chat struct {
 	ID        int64
 	Name      string
@@ -9,6 +17,34 @@ type Chat struct {
 	CreatedAt time.Time
 }
 
+// ChatMember - участие пользователя в чате вместе с типом чата.
+type ChatMember struct {
+	ChatID   int64
+	UserID   int64
+	Role     ChatRole
+	ChatType string
+	// MutedUntil - окончание мута, nil если участник не заглушен
+	MutedUntil *time.Time
+	// SlowMode - интервал медленного режима чата, 0 - выключен
+	SlowMode time.Duration
+}
+
+// SlowModeApplies сообщает, ограничивает ли медленный режим чата участника:
+// владелец и администраторы пишут без ограничения.
+func (m *ChatMember) SlowModeApplies() bool {
+	return m.SlowMode > 0 && !m.Role.CanManage()
+}
+
+// Muted сообщает, заглушен ли участник в момент now.
+func (m *ChatMember) Muted(now time.Time) bool {
+	return m.MutedUntil != nil && now.Before(*m.MutedUntil)
+}
+
+// CanPost сообщает, может ли участник писать в чат.
+func (m *ChatMember) CanPost() bool {
+	return m.ChatType != ChatTypeChannel || m.Role.CanManage()
+}
+
 type Message struct {
 	ID        int64
 	ChatID    int64
@@ -16,4 +52,65 @@ type Message struct {
 	UserName  string
 	Text      string
 	CreatedAt time.Time
+	Pinned    bool
+	// ExpiresAt - момент исчезновения сообщения, nil для обычных сообщений
+	ExpiresAt *time.Time
+
+	Attachments []*Attachment
+}
+
+// ChatRole - роль участника в чате.
+type ChatRole string
+
+const (
+	RoleOwner  ChatRole = "owner"
+	RoleAdmin  ChatRole = "admin"
+	RoleMember ChatRole = "member"
+)
+
+// CanManage сообщает, может ли роль управлять чатом (закреплять сообщения и т.п.).
+func (r ChatRole) CanManage() bool {
+	return r == RoleOwner || r == RoleAdmin
+}
+
+// Outranks сообщает, стоит ли роль выше other: владелец выше администратора,
+// администратор выше участника.
+func (r ChatRole) Outranks(other ChatRole) bool {
+	return roleRank(r) > roleRank(other)
+}
+
+func roleRank(r ChatRole) int {
+	switch r {
+	case RoleOwner:
+		return 2
+	case RoleAdmin:
+		return 1
+	}
+	return 0
+}
+
+// ScheduledMessage - сообщение, которое планировщик отправит в чат в момент SendAt.
+type ScheduledMessage struct {
+	ID        int64
+	ChatID    int64
+	UserID    int64
+	Text      string
+	SendAt    time.Time
+	CreatedAt time.Time
+}
+
+// SearchFilter ограничивает выборку полнотекстового поиска.
+// Нулевые значения полей означают отсутствие фильтра.
+type SearchFilter struct {
+	ChatID   int64
+	AuthorID int64
+	From     time.Time
+	To       time.Time
+}
+
+// SearchResult - найденное сообщение с релевантностью и подсвеченным фрагментом.
+type SearchResult struct {
+	Message *Message
+	Rank    float32
+	Snippet string
 }
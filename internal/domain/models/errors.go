@@ -1,11 +1,117 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
-	ErrUserNotFound       = errors.New("user not found")
-	ErrUserExists         = errors.New("user already exists")
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrChatNotFound       = errors.New("chat not found")
-	ErrAccessDenied       = errors.New("access denied")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrUserExists          = errors.New("user already exists")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrChatNotFound        = errors.New("chat not found")
+	ErrAccessDenied        = errors.New("access denied")
+	ErrNotChatMember       = errors.New("user is not a chat member")
+	ErrReadOnlyChat        = errors.New("only chat admins can post in this channel")
+	ErrNotChannel          = errors.New("chat is not a channel")
+	ErrPinLimitReached     = errors.New("pinned messages limit reached")
+	ErrScheduledNotFound   = errors.New("scheduled message not found")
+	ErrMessageNotFound     = errors.New("message not found")
+	ErrMessageExists       = errors.New("message already exists")
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrAttachmentTooLarge  = errors.New("attachment too large")
+	ErrInvalidImage        = errors.New("image metadata is malformed")
+	ErrBlobNotFound        = errors.New("blob not found")
+	ErrRateLimited         = errors.New("rate limit exceeded")
+	ErrSlowMode            = errors.New("slow mode is enabled")
+	ErrMessageRejected     = errors.New("message rejected")
+	ErrInvalidModeration   = errors.New("invalid moderation settings")
+	ErrReportNotFound      = errors.New("report not found")
+	ErrReportExists        = errors.New("message already reported")
+	ErrReportClaimed       = errors.New("report is claimed by another moderator")
+	ErrReportResolved      = errors.New("report already resolved")
+	ErrBannedFromChat      = errors.New("user is banned from chat")
+	ErrMuted               = errors.New("user is muted in chat")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrResetTokenInvalid   = errors.New("password reset token is invalid or expired")
+	ErrVerifyTokenInvalid  = errors.New("email verification token is invalid or expired")
+	ErrEmailNotVerified    = errors.New("email is not verified")
+	ErrTOTPNotFound        = errors.New("two-factor authentication is not set up")
+	ErrTOTPAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrTOTPCodeInvalid     = errors.New("two-factor code is invalid")
+	ErrMFARequired         = errors.New("two-factor authentication required")
+	ErrOIDCDisabled        = errors.New("single sign-on is not configured")
+	ErrOIDCStateInvalid    = errors.New("single sign-on state is invalid or expired")
+	ErrOIDCEmailUnverified = errors.New("identity provider has not verified the email")
 )
+
+// RateLimitError - превышен лимит частоты запросов. Повторить можно через RetryAfter.
+// errors.Is(err, ErrRateLimited) срабатывает и для обернутой ошибки.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrRateLimited, e.RetryAfter)
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// MFARequiredError - пароль верный, но у пользователя включена 2FA. Вход завершается
+// вызовом VerifyMFA с ChallengeToken и кодом. Токен не попадает в текст ошибки и логи.
+// errors.Is(err, ErrMFARequired) срабатывает и для обернутой ошибки.
+type MFARequiredError struct {
+	ChallengeToken string
+}
+
+func (e *MFARequiredError) Error() string {
+	return ErrMFARequired.Error()
+}
+
+func (e *MFARequiredError) Is(target error) bool {
+	return target == ErrMFARequired
+}
+
+// SlowModeError - в чате включен медленный режим и пользователь писал недавно.
+// Следующее сообщение можно отправить не раньше RetryAt.
+type SlowModeError struct {
+	RetryAt time.Time
+}
+
+func (e *SlowModeError) Error() string {
+	return fmt.Sprintf("%s, next message allowed at %s", ErrSlowMode, e.RetryAt.UTC().Format(time.RFC3339))
+}
+
+func (e *SlowModeError) Is(target error) bool {
+	return target == ErrSlowMode
+}
+
+// MessageRejectedError - сообщение отклонено фильтрами чата, Reason объясняет причину.
+type MessageRejectedError struct {
+	Reason string
+}
+
+func (e *MessageRejectedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrMessageRejected, e.Reason)
+}
+
+func (e *MessageRejectedError) Is(target error) bool {
+	return target == ErrMessageRejected
+}
+
+// MutedError - участник заглушен в чате и не может писать до Until.
+type MutedError struct {
+	Until time.Time
+}
+
+func (e *MutedError) Error() string {
+	return fmt.Sprintf("%s until %s", ErrMuted, e.Until.UTC().Format(time.RFC3339))
+}
+
+func (e *MutedError) Is(target error) bool {
+	return target == ErrMuted
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// FilterAction - что делать с сообщением, попавшим под фильтр.
+type FilterAction string
+
+const (
+	// FilterReject - отклонить сообщение
+	FilterReject FilterAction = "reject"
+	// FilterReplace - заменить совпадение (запрещенные слова маскируются звездочками)
+	FilterReplace FilterAction = "replace"
+)
+
+// FilterRule - правило модерации по регулярному выражению.
+type FilterRule struct {
+	Pattern string
+	Action  FilterAction
+	// Replacement - замена совпадения для FilterReplace, поддерживает ссылки на группы ($1)
+	Replacement string
+}
+
+// ModerationSettings - настройки фильтров сообщений чата.
+// Нулевые значения выключают соответствующий фильтр.
+type ModerationSettings struct {
+	ChatID            int64
+	BannedWords       []string
+	BannedWordsAction FilterAction
+	Rules             []FilterRule
+	BlockLinks        bool
+	// MaxLength - максимальная длина текста в символах, 0 - без ограничения
+	MaxLength int
+}
+
+// Validate проверяет настройки: действия, шаблоны регулярных выражений и то,
+// что каждое запрещенное слово - одно слово без пробелов и знаков препинания.
+func (s *ModerationSettings) Validate() error {
+	if s.MaxLength < 0 {
+		return fmt.Errorf("%w: max_length must not be negative", ErrInvalidModeration)
+	}
+	if !s.BannedWordsAction.valid() {
+		return fmt.Errorf("%w: unknown banned words action %q", ErrInvalidModeration, s.BannedWordsAction)
+	}
+	for _, word := range s.BannedWords {
+		if word == "" || strings.IndexFunc(word, func(r rune) bool { return !IsWordRune(r) }) >= 0 {
+			return fmt.Errorf("%w: banned word %q must be a single word", ErrInvalidModeration, word)
+		}
+	}
+	for i, rule := range s.Rules {
+		if !rule.Action.valid() {
+			return fmt.Errorf("%w: rule %d: unknown action %q", ErrInvalidModeration, i+1, rule.Action)
+		}
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("%w: rule %d: %v", ErrInvalidModeration, i+1, err)
+		}
+	}
+	return nil
+}
+
+// valid сообщает, известно ли действие. Пустое действие означает FilterReject.
+func (a FilterAction) valid() bool {
+	return a == "" || a == FilterReject || a == FilterReplace
+}
+
+// IsWordRune сообщает, может ли символ входить в слово для фильтра запрещенных слов.
+func IsWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// OIDCState - начатый вход через OpenID провайдера. Хранится до возврата пользователя
+// с кодом авторизации и погашается при первом использовании.
+type OIDCState struct {
+	// StateHash - SHA-256 параметра state, который уходит провайдеру
+	StateHash string
+	// CodeChallenge - S256 от code_verifier, который держит у себя клиент
+	CodeChallenge string
+	// Nonce - ожидаемое значение nonce в ID токене
+	Nonce     string
+	ExpiresAt time.Time
+}
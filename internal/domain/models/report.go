@@ -0,0 +1,99 @@
+package models
+
+import "time"
+
+// ReportStatus - состояние жалобы в очереди модерации.
+type ReportStatus string
+
+const (
+	ReportOpen     ReportStatus = "open"
+	ReportClaimed  ReportStatus = "claimed"
+	ReportResolved ReportStatus = "resolved"
+)
+
+// Resolution - решение модератора по жалобе.
+type Resolution string
+
+const (
+	// ResolutionDismiss - жалоба отклонена, сообщение остается
+	ResolutionDismiss Resolution = "dismiss"
+	// ResolutionDeleteMessage - сообщение удаляется
+	ResolutionDeleteMessage Resolution = "delete_message"
+	// ResolutionMuteUser - автор не может писать в чат до MuteUntil
+	ResolutionMuteUser Resolution = "mute_user"
+	// ResolutionBanUser - автор исключается из чата без права вернуться
+	ResolutionBanUser Resolution = "ban_user"
+)
+
+// Valid сообщает, известно ли решение.
+func (r Resolution) Valid() bool {
+	switch r {
+	case ResolutionDismiss, ResolutionDeleteMessage, ResolutionMuteUser, ResolutionBanUser:
+		return true
+	}
+	return false
+}
+
+// Report - жалоба пользователя на сообщение. Текст и автор сообщения сохраняются
+// на момент жалобы, чтобы модератор видел их и после удаления сообщения.
+type Report struct {
+	ID          int64
+	MessageID   int64
+	ChatID      int64
+	ReporterID  int64
+	AuthorID    int64
+	Reason      string
+	MessageText string
+	Status      ReportStatus
+	ClaimedBy   int64
+	ClaimedAt   *time.Time
+	Resolution  Resolution
+	ResolvedBy  int64
+	ResolvedAt  *time.Time
+	CreatedAt   time.Time
+}
+
+// ReportFilter ограничивает выборку очереди модерации. Нулевые ChatID и ModeratorID
+// означают отсутствие фильтра, пустой Status - нерешенные жалобы (open и claimed).
+type ReportFilter struct {
+	ChatID int64
+	Status ReportStatus
+	// ModeratorID - только чаты, где пользователь владелец или администратор
+	ModeratorID int64
+}
+
+// ReportResolution - решение модератора, которое хранилище применяет вместе с закрытием жалобы.
+type ReportResolution struct {
+	ReportID    int64
+	ModeratorID int64
+	Resolution  Resolution
+	// MuteUntil - окончание мута для ResolutionMuteUser
+	MuteUntil time.Time
+	// ClaimTTL - через сколько захват другого модератора считается брошенным
+	ClaimTTL time.Duration
+}
+
+// Действия в журнале модерации
+const (
+	AuditReportCreated     = "report_created"
+	AuditReportClaimed     = "report_claimed"
+	AuditReportResolved    = "report_resolved"
+	AuditMemberMuted       = "member_muted"
+	AuditMemberUnmuted     = "member_unmuted"
+	AuditMemberRoleChanged = "member_role_changed"
+	AuditLegalHoldSet      = "legal_hold_set"
+	AuditLegalHoldReleased = "legal_hold_released"
+)
+
+// AuditEntry - запись журнала модерации. Нулевые ID означают, что поле к действию не относится.
+type AuditEntry struct {
+	ID           int64
+	ActorID      int64
+	ChatID       int64
+	ReportID     int64
+	TargetUserID int64
+	MessageID    int64
+	Action       string
+	Details      string
+	CreatedAt    time.Time
+}
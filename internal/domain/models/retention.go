@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// RetentionPolicy - срок хранения сообщений чата.
+// RetentionDays = 0 означает бессрочное хранение, LegalHold приостанавливает удаление.
+type RetentionPolicy struct {
+	ChatID        int64
+	RetentionDays int
+	LegalHold     bool
+}
+
+// PurgeBatch - результат удаления одной порции устаревших сообщений.
+type PurgeBatch struct {
+	Messages    int
+	Attachments int
+	// OrphanBlobs - ключи blob-ов, на которые после удаления больше никто не ссылается
+	OrphanBlobs []string
+	// Deleted - удаленные или скрытые под legal hold сообщения (заполнены только ID и ChatID),
+	// если вызывающему нужно оповестить подписчиков
+	Deleted []*Message
+}
+
+// PurgeRun - запись аудита об удалении по сроку хранения в одном чате.
+type PurgeRun struct {
+	ChatID             int64
+	RetentionDays      int
+	StartedAt          time.Time
+	FinishedAt         time.Time
+	MessagesDeleted    int
+	AttachmentsDeleted int
+	BlobsDeleted       int
+	Error              string
+}
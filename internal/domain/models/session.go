@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Session - сессия входа: семейство refresh токенов, выданных по одному Login.
+// При каждом обновлении refresh токен заменяется новым, а сессия продлевается.
+type Session struct {
+	ID         string
+	UserID     int64
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
+
+// ClientInfo - устройство, с которого выполнен вход: user agent и IP адрес клиента.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
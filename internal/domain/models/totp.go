@@ -0,0 +1,11 @@
+package models
+
+// TOTP - второй фактор пользователя (RFC 6238). Пока Enabled = false, секрет выдан,
+// но не подтвержден первым кодом и при входе не проверяется.
+type TOTP struct {
+	UserID  int64
+	Secret  string
+	Enabled bool
+	// LastStep - шаг последнего принятого кода; коды с шагом не больше него отклоняются
+	LastStep int64
+}
@@ -5,4 +5,6 @@ type User struct {
 	Name         string
 	Email        string
 	PasswordHash string
+	// EmailVerified - пользователь подтвердил email по ссылке из письма
+	EmailVerified bool
 }
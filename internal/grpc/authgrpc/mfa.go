@@ -0,0 +1,121 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) EnrollTOTP(ctx context.Context, req *chatpb.EnrollTOTPRequest) (*chatpb.EnrollTOTPResponse, error) {
+	const op = "authgrpc.EnrollTOTP"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	userID, _, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Делегируем вызов сервису
+	secret, uri, err := s.auth.EnrollTOTP(ctx, userID)
+	if err != nil {
+		return nil, mfaError(log, err)
+	}
+
+	return &chatpb.EnrollTOTPResponse{Secret: secret, OtpauthUri: uri}, nil
+}
+
+func (s *serverAPI) ConfirmTOTP(ctx context.Context, req *chatpb.ConfirmTOTPRequest) (*chatpb.ConfirmTOTPResponse, error) {
+	const op = "authgrpc.ConfirmTOTP"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	userID, _, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	// 2. Делегируем вызов сервису
+	recoveryCodes, err := s.auth.ConfirmTOTP(ctx, userID, req.GetCode())
+	if err != nil {
+		return nil, mfaError(log, err)
+	}
+
+	return &chatpb.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *serverAPI) DisableTOTP(ctx context.Context, req *chatpb.DisableTOTPRequest) (*chatpb.DisableTOTPResponse, error) {
+	const op = "authgrpc.DisableTOTP"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	userID, _, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	// 2. Делегируем вызов сервису
+	if err := s.auth.DisableTOTP(ctx, userID, req.GetCode()); err != nil {
+		return nil, mfaError(log, err)
+	}
+
+	return &chatpb.DisableTOTPResponse{}, nil
+}
+
+func (s *serverAPI) VerifyMFA(ctx context.Context, req *chatpb.VerifyMFARequest) (*chatpb.VerifyMFAResponse, error) {
+	const op = "authgrpc.VerifyMFA"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetMfaToken() == "" || req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "mfa_token and code are required")
+	}
+
+	// 2. Делегируем вызов сервису
+	accessToken, refreshToken, user, err := s.auth.VerifyMFA(ctx, req.GetMfaToken(), req.GetCode(), clientInfo(ctx))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials):
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired mfa token")
+		case errors.Is(err, models.ErrTOTPCodeInvalid), errors.Is(err, models.ErrTOTPNotFound):
+			return nil, status.Error(codes.Unauthenticated, "invalid two-factor code")
+		default:
+			log.Error("failed to verify second factor", slog.Any("err", err))
+			return nil, status.Error(codes.Internal, "failed to login")
+		}
+	}
+
+	log.Info("user logged in with second factor", slog.Int64("user_id", user.Id))
+
+	return &chatpb.VerifyMFAResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		User:         user,
+	}, nil
+}
+
+// mfaError преобразует ошибки настройки 2FA в gRPC статусы.
+func mfaError(log *slog.Logger, err error) error {
+	switch {
+	case errors.Is(err, models.ErrTOTPCodeInvalid):
+		return status.Error(codes.InvalidArgument, "two-factor code is invalid")
+	case errors.Is(err, models.ErrTOTPAlreadyEnabled):
+		return status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+	case errors.Is(err, models.ErrTOTPNotFound):
+		return status.Error(codes.FailedPrecondition, "two-factor authentication is not set up")
+	default:
+		log.Error("failed to update two-factor settings", slog.Any("err", err))
+		return status.Error(codes.Internal, "failed to update two-factor settings")
+	}
+}
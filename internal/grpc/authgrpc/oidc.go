@@ -0,0 +1,78 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/oidc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) StartOIDCLogin(ctx context.Context, req *chatpb.StartOIDCLoginRequest) (*chatpb.StartOIDCLoginResponse, error) {
+	const op = "authgrpc.StartOIDCLogin"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if !oidc.ValidChallenge(req.GetCodeChallenge()) {
+		return nil, status.Error(codes.InvalidArgument, "code_challenge must be S256 of the code verifier in base64url")
+	}
+
+	// 2. Делегируем вызов сервису
+	authURL, state, err := s.auth.StartOIDCLogin(ctx, req.GetCodeChallenge())
+	if err != nil {
+		return nil, oidcError(log, err)
+	}
+
+	return &chatpb.StartOIDCLoginResponse{AuthorizationUrl: authURL, State: state}, nil
+}
+
+func (s *serverAPI) FinishOIDCLogin(ctx context.Context, req *chatpb.FinishOIDCLoginRequest) (*chatpb.FinishOIDCLoginResponse, error) {
+	const op = "authgrpc.FinishOIDCLogin"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetState() == "" || req.GetCode() == "" || req.GetCodeVerifier() == "" {
+		return nil, status.Error(codes.InvalidArgument, "state, code and code_verifier are required")
+	}
+
+	// 2. Делегируем вызов сервису
+	accessToken, refreshToken, user, err := s.auth.FinishOIDCLogin(ctx, req.GetState(), req.GetCode(), req.GetCodeVerifier(), clientInfo(ctx))
+	// Как и после Login: при включенной 2FA вход завершается вызовом VerifyMFA
+	var mfaErr *models.MFARequiredError
+	if errors.As(err, &mfaErr) {
+		log.Info("second factor required")
+		return &chatpb.FinishOIDCLoginResponse{MfaRequired: true, MfaToken: mfaErr.ChallengeToken}, nil
+	}
+	if err != nil {
+		return nil, oidcError(log, err)
+	}
+
+	log.Info("user logged in with oidc", slog.Int64("user_id", user.Id))
+
+	return &chatpb.FinishOIDCLoginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		User:         user,
+	}, nil
+}
+
+// oidcError преобразует ошибки входа через OpenID провайдера в gRPC статусы.
+func oidcError(log *slog.Logger, err error) error {
+	switch {
+	case errors.Is(err, models.ErrOIDCDisabled):
+		return status.Error(codes.Unimplemented, "single sign-on is not configured")
+	case errors.Is(err, models.ErrOIDCStateInvalid):
+		return status.Error(codes.Unauthenticated, "single sign-on state is invalid or expired, start again")
+	case errors.Is(err, models.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, "single sign-on failed")
+	case errors.Is(err, models.ErrOIDCEmailUnverified):
+		return status.Error(codes.FailedPrecondition, "identity provider has not verified the email")
+	default:
+		log.Error("failed to login with oidc", slog.Any("err", err))
+		return status.Error(codes.Internal, "failed to login")
+	}
+}
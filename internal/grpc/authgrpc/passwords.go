@@ -0,0 +1,81 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) ChangePassword(ctx context.Context, req *chatpb.ChangePasswordRequest) (*chatpb.ChangePasswordResponse, error) {
+	const op = "authgrpc.ChangePassword"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	userID, sessionID, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetCurrentPassword() == "" || req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "current_password and new_password are required")
+	}
+
+	// 2. Делегируем вызов сервису
+	revoked, err := s.auth.ChangePassword(ctx, userID, sessionID, req.GetCurrentPassword(), req.GetNewPassword())
+	if err != nil {
+		return nil, passwordError(log, err)
+	}
+
+	return &chatpb.ChangePasswordResponse{RevokedSessions: int32(revoked)}, nil
+}
+
+func (s *serverAPI) RequestPasswordReset(ctx context.Context, req *chatpb.RequestPasswordResetRequest) (*chatpb.RequestPasswordResetResponse, error) {
+	const op = "authgrpc.RequestPasswordReset"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	// 2. Делегируем вызов сервису. Ответ одинаков для зарегистрированных и неизвестных адресов
+	if err := s.auth.RequestPasswordReset(ctx, req.GetEmail()); err != nil {
+		return nil, passwordError(log, err)
+	}
+
+	return &chatpb.RequestPasswordResetResponse{}, nil
+}
+
+func (s *serverAPI) ConfirmPasswordReset(ctx context.Context, req *chatpb.ConfirmPasswordResetRequest) (*chatpb.ConfirmPasswordResetResponse, error) {
+	const op = "authgrpc.ConfirmPasswordReset"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetToken() == "" || req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token and new_password are required")
+	}
+
+	// 2. Делегируем вызов сервису
+	if err := s.auth.ConfirmPasswordReset(ctx, req.GetToken(), req.GetNewPassword()); err != nil {
+		return nil, passwordError(log, err)
+	}
+
+	return &chatpb.ConfirmPasswordResetResponse{}, nil
+}
+
+// passwordError преобразует ошибки смены и сброса пароля в gRPC статусы.
+func passwordError(log *slog.Logger, err error) error {
+	switch {
+	case errors.Is(err, models.ErrInvalidCredentials):
+		return status.Error(codes.PermissionDenied, "current password is incorrect")
+	case errors.Is(err, models.ErrResetTokenInvalid):
+		return status.Error(codes.InvalidArgument, "reset token is invalid or expired")
+	default:
+		log.Error("failed to update password", slog.Any("err", err))
+		return status.Error(codes.Internal, "failed to update password")
+	}
+}
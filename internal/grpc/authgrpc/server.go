@@ -12,9 +12,24 @@ import (
 )
 
 type AuthService interface {
-	Login(ctx context.Context, email, password string) (accessToken, refreshToken string, user *chatpb.User, err error)
+	Login(ctx context.Context, email, password string, client models.ClientInfo) (accessToken, refreshToken string, user *chatpb.User, err error)
 	Register(ctx context.Context, name, email, password string) (user *chatpb.User, err error)
-	RefreshToken(ctx context.Context, refreshToken string) (newAccessToken string, err error)
+	RefreshToken(ctx context.Context, refreshToken string) (accessToken, newRefreshToken string, err error)
+	Logout(ctx context.Context, userID int64, sessionID string) error
+	LogoutAll(ctx context.Context, userID int64) (int, error)
+	ListSessions(ctx context.Context, userID int64, currentSessionID string) ([]*chatpb.Session, error)
+	RevokeSession(ctx context.Context, userID int64, sessionID string) error
+	ChangePassword(ctx context.Context, userID int64, sessionID, currentPassword, newPassword string) (int, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ConfirmPasswordReset(ctx context.Context, token, newPassword string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerificationEmail(ctx context.Context, email string) error
+	EnrollTOTP(ctx context.Context, userID int64) (secret, uri string, err error)
+	ConfirmTOTP(ctx context.Context, userID int64, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID int64, code string) error
+	VerifyMFA(ctx context.Context, challengeToken, code string, client models.ClientInfo) (accessToken, refreshToken string, user *chatpb.User, err error)
+	StartOIDCLogin(ctx context.Context, codeChallenge string) (authURL, state string, err error)
+	FinishOIDCLogin(ctx context.Context, state, code, codeVerifier string, client models.ClientInfo) (accessToken, refreshToken string, user *chatpb.User, err error)
 }
 
 type serverAPI struct {
@@ -40,14 +55,24 @@ func (s *serverAPI) Login(ctx context.Context, req *chatpb.LoginRequest) (*chatp
 		return nil, status.Error(codes.InvalidArgument, "email and password are required")
 	}
 
-	accessToken, refreshToken, user, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword())
+	accessToken, refreshToken, user, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), clientInfo(ctx))
+	// Пароль верный, но включена 2FA: вход завершается вызовом VerifyMFA
+	var mfaErr *models.MFARequiredError
+	if errors.As(err, &mfaErr) {
+		log.Info("second factor required")
+		return &chatpb.LoginResponse{MfaRequired: true, MfaToken: mfaErr.ChallengeToken}, nil
+	}
 	if err != nil {
-		// Сервис может вернуть ошибку, что пользователь не найден.
-		// Мы преобразуем ее в gRPC-статус Unauthenticated.
-		if errors.Is(err, models.ErrUserNotFound) {
+		// Сервис не различает неизвестного пользователя и неверный пароль.
+		// Мы преобразуем эту ошибку в gRPC-статус Unauthenticated.
+		if errors.Is(err, models.ErrInvalidCredentials) || errors.Is(err, models.ErrUserNotFound) {
 			log.Warn("user not found or invalid credentials")
 			return nil, status.Error(codes.Unauthenticated, "invalid credentials")
 		}
+		if errors.Is(err, models.ErrEmailNotVerified) {
+			log.Warn("email is not verified")
+			return nil, status.Error(codes.FailedPrecondition, "email is not verified")
+		}
 		log.Error("failed to login user", slog.Any("err", err))
 		return nil, status.Error(codes.Internal, "failed to login")
 	}
@@ -96,9 +121,9 @@ func (s *serverAPI) RefreshToken(ctx context.Context, req *chatpb.RefreshTokenRe
 		return nil, status.Error(codes.InvalidArgument, "refresh token is required")
 	}
 
-	accessToken, err := s.auth.RefreshToken(ctx, req.GetRefreshToken())
+	accessToken, refreshToken, err := s.auth.RefreshToken(ctx, req.GetRefreshToken())
 	if err != nil {
-		// Сервис возвращает ошибку, если токен невалиден или пользователь не найден
+		// Сервис возвращает ошибку, если токен невалиден, уже использован или пользователь не найден
 		if errors.Is(err, models.ErrInvalidCredentials) {
 			log.Warn("invalid refresh token provided")
 			return nil, status.Error(codes.Unauthenticated, "invalid or expired refresh token")
@@ -110,6 +135,7 @@ func (s *serverAPI) RefreshToken(ctx context.Context, req *chatpb.RefreshTokenRe
 	log.Info("token refreshed successfully")
 
 	return &chatpb.RefreshTokenResponse{
-		AccessToken: accessToken,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
 	}, nil
 }
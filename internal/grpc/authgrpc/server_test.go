@@ -3,13 +3,20 @@ package authgrpc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"os"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
 	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
@@ -21,17 +28,97 @@ type fakeAuthService struct {
 	regUser          *chatpb.User
 	regErr           error
 	refreshAccess    string
+	refreshRefresh   string
 	refreshErr       error
+	loginClient      models.ClientInfo
+	sessions         []*chatpb.Session
+	sessionErr       error
+	lastUserID       int64
+	lastSessionID    string
+	passwordErr      error
+	lastPassword     string
+	lastToken        string
+	lastEmail        string
+	verifyErr        error
+	mfaErr           error
+	lastCode         string
+	oidcErr          error
 }
 
-func (f *fakeAuthService) Login(ctx context.Context, email, password string) (string, string, *chatpb.User, error) {
+func (f *fakeAuthService) Login(ctx context.Context, email, password string, client models.ClientInfo) (string, string, *chatpb.User, error) {
+	f.loginClient = client
 	return f.loginRespAccess, f.loginRespRefresh, f.loginUser, f.loginErr
 }
 func (f *fakeAuthService) Register(ctx context.Context, name, email, password string) (*chatpb.User, error) {
 	return f.regUser, f.regErr
 }
-func (f *fakeAuthService) RefreshToken(ctx context.Context, refreshToken string) (string, error) {
-	return f.refreshAccess, f.refreshErr
+func (f *fakeAuthService) RefreshToken(ctx context.Context, refreshToken string) (string, string, error) {
+	return f.refreshAccess, f.refreshRefresh, f.refreshErr
+}
+
+func (f *fakeAuthService) Logout(ctx context.Context, userID int64, sessionID string) error {
+	f.lastUserID, f.lastSessionID = userID, sessionID
+	return f.sessionErr
+}
+func (f *fakeAuthService) LogoutAll(ctx context.Context, userID int64) (int, error) {
+	f.lastUserID = userID
+	return len(f.sessions), f.sessionErr
+}
+func (f *fakeAuthService) ListSessions(ctx context.Context, userID int64, currentSessionID string) ([]*chatpb.Session, error) {
+	f.lastUserID, f.lastSessionID = userID, currentSessionID
+	return f.sessions, f.sessionErr
+}
+func (f *fakeAuthService) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	f.lastUserID, f.lastSessionID = userID, sessionID
+	return f.sessionErr
+}
+
+func (f *fakeAuthService) ChangePassword(ctx context.Context, userID int64, sessionID, currentPassword, newPassword string) (int, error) {
+	f.lastUserID, f.lastSessionID, f.lastPassword = userID, sessionID, newPassword
+	return 2, f.passwordErr
+}
+func (f *fakeAuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	f.lastEmail = email
+	return f.passwordErr
+}
+func (f *fakeAuthService) ConfirmPasswordReset(ctx context.Context, token, newPassword string) error {
+	f.lastToken, f.lastPassword = token, newPassword
+	return f.passwordErr
+}
+
+func (f *fakeAuthService) VerifyEmail(ctx context.Context, token string) error {
+	f.lastToken = token
+	return f.verifyErr
+}
+func (f *fakeAuthService) ResendVerificationEmail(ctx context.Context, email string) error {
+	f.lastEmail = email
+	return f.verifyErr
+}
+
+func (f *fakeAuthService) EnrollTOTP(ctx context.Context, userID int64) (string, string, error) {
+	f.lastUserID = userID
+	return "SECRET", "otpauth://totp/go-chat:bob?secret=SECRET", f.mfaErr
+}
+func (f *fakeAuthService) ConfirmTOTP(ctx context.Context, userID int64, code string) ([]string, error) {
+	f.lastUserID, f.lastCode = userID, code
+	return []string{"aaaa-bbbb-cccc-dddd"}, f.mfaErr
+}
+func (f *fakeAuthService) DisableTOTP(ctx context.Context, userID int64, code string) error {
+	f.lastUserID, f.lastCode = userID, code
+	return f.mfaErr
+}
+func (f *fakeAuthService) VerifyMFA(ctx context.Context, challengeToken, code string, client models.ClientInfo) (string, string, *chatpb.User, error) {
+	f.lastToken, f.lastCode = challengeToken, code
+	return f.loginRespAccess, f.loginRespRefresh, f.loginUser, f.mfaErr
+}
+
+func (f *fakeAuthService) StartOIDCLogin(ctx context.Context, codeChallenge string) (string, string, error) {
+	f.lastCode = codeChallenge
+	return "https://idp.example.com/authorize?state=st", "st", f.oidcErr
+}
+func (f *fakeAuthService) FinishOIDCLogin(ctx context.Context, state, code, codeVerifier string, client models.ClientInfo) (string, string, *chatpb.User, error) {
+	f.lastToken, f.lastCode, f.loginClient = state, code, client
+	return f.loginRespAccess, f.loginRespRefresh, f.loginUser, f.oidcErr
 }
 
 func logger() *slog.Logger { return slog.New(slog.NewTextHandler(os.Stdout, nil)) }
@@ -47,6 +134,21 @@ func TestAuthLoginHandler(t *testing.T) {
 	if _, err := api.Login(context.Background(), &chatpb.LoginRequest{Email: "e", Password: "p"}); status.Code(err) != codes.Unauthenticated {
 		t.Fatalf("expected unauthenticated")
 	}
+	// Wrong password
+	api.auth.(*fakeAuthService).loginErr = models.ErrInvalidCredentials
+	if _, err := api.Login(context.Background(), &chatpb.LoginRequest{Email: "e", Password: "p"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected unauthenticated, got %v", err)
+	}
+	// Email is not verified
+	api.auth.(*fakeAuthService).loginErr = models.ErrEmailNotVerified
+	if _, err := api.Login(context.Background(), &chatpb.LoginRequest{Email: "e", Password: "p"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected failed precondition, got %v", err)
+	}
+	// Second factor required: no tokens, only the challenge
+	api.auth.(*fakeAuthService).loginErr = fmt.Errorf("wrapped: %w", &models.MFARequiredError{ChallengeToken: "challenge"})
+	if resp, err := api.Login(context.Background(), &chatpb.LoginRequest{Email: "e", Password: "p"}); err != nil || !resp.GetMfaRequired() || resp.GetMfaToken() != "challenge" || resp.AccessToken != "" {
+		t.Fatalf("expected mfa challenge: %v %+v", err, resp)
+	}
 	// Internal
 	api.auth.(*fakeAuthService).loginErr = errors.New("db")
 	if _, err := api.Login(context.Background(), &chatpb.LoginRequest{Email: "e", Password: "p"}); status.Code(err) != codes.Internal {
@@ -83,7 +185,7 @@ func TestAuthRegisterHandler(t *testing.T) {
 }
 
 func TestAuthRefreshHandler(t *testing.T) {
-	api := &serverAPI{auth: &fakeAuthService{refreshAccess: "new"}, log: logger()}
+	api := &serverAPI{auth: &fakeAuthService{refreshAccess: "new", refreshRefresh: "rotated"}, log: logger()}
 	// Invalid
 	if _, err := api.RefreshToken(context.Background(), &chatpb.RefreshTokenRequest{RefreshToken: ""}); status.Code(err) != codes.InvalidArgument {
 		t.Fatalf("expected invalid argument")
@@ -100,7 +202,239 @@ func TestAuthRefreshHandler(t *testing.T) {
 	}
 	// Success
 	api.auth.(*fakeAuthService).refreshErr = nil
-	if resp, err := api.RefreshToken(context.Background(), &chatpb.RefreshTokenRequest{RefreshToken: "x"}); err != nil || resp.AccessToken == "" {
+	if resp, err := api.RefreshToken(context.Background(), &chatpb.RefreshTokenRequest{RefreshToken: "x"}); err != nil || resp.AccessToken == "" || resp.RefreshToken != "rotated" {
 		t.Fatalf("unexpected: %v %v", err, resp)
 	}
 }
+
+func TestLoginPassesClientInfo(t *testing.T) {
+	fake := &fakeAuthService{loginUser: &chatpb.User{Id: 1}}
+	api := &serverAPI{auth: fake, log: logger()}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-agent", strings.Repeat("ж", 200)))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 5555}})
+
+	if _, err := api.Login(ctx, &chatpb.LoginRequest{Email: "e", Password: "p"}); err != nil {
+		t.Fatalf("unexpected: %v", err)
+	}
+	if fake.loginClient.IP != "10.0.0.7" {
+		t.Fatalf("expected peer ip without port, got %q", fake.loginClient.IP)
+	}
+	if len(fake.loginClient.UserAgent) > maxUserAgentLen || !utf8.ValidString(fake.loginClient.UserAgent) {
+		t.Fatalf("user agent must be truncated to valid utf-8: %d bytes", len(fake.loginClient.UserAgent))
+	}
+}
+
+func TestSessionHandlers(t *testing.T) {
+	fake := &fakeAuthService{sessions: []*chatpb.Session{{Id: "s1", Current: true}, {Id: "s2"}}}
+	api := &serverAPI{auth: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(7))
+	ctx = context.WithValue(ctx, interceptors.SessionIDKey, "s1")
+
+	// Missing auth context
+	if _, err := api.Logout(context.Background(), &chatpb.LogoutRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected unauthenticated, got %v", err)
+	}
+
+	if _, err := api.Logout(ctx, &chatpb.LogoutRequest{}); err != nil || fake.lastUserID != 7 || fake.lastSessionID != "s1" {
+		t.Fatalf("logout must end the current session: %v %d %q", err, fake.lastUserID, fake.lastSessionID)
+	}
+
+	resp, err := api.ListSessions(ctx, &chatpb.ListSessionsRequest{})
+	if err != nil || len(resp.GetSessions()) != 2 || fake.lastSessionID != "s1" {
+		t.Fatalf("unexpected list: %v %v", err, resp)
+	}
+
+	all, err := api.LogoutAll(ctx, &chatpb.LogoutAllRequest{})
+	if err != nil || all.GetRevoked() != 2 {
+		t.Fatalf("unexpected logout all: %v %v", err, all)
+	}
+
+	if _, err := api.RevokeSession(ctx, &chatpb.RevokeSessionRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	if _, err := api.RevokeSession(ctx, &chatpb.RevokeSessionRequest{SessionId: "s2"}); err != nil || fake.lastSessionID != "s2" {
+		t.Fatalf("unexpected revoke: %v %q", err, fake.lastSessionID)
+	}
+
+	fake.sessionErr = models.ErrSessionNotFound
+	if _, err := api.RevokeSession(ctx, &chatpb.RevokeSessionRequest{SessionId: "other"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	fake.sessionErr = errors.New("db")
+	if _, err := api.ListSessions(ctx, &chatpb.ListSessionsRequest{}); status.Code(err) != codes.Internal {
+		t.Fatalf("expected internal, got %v", err)
+	}
+}
+
+func TestPasswordHandlers(t *testing.T) {
+	fake := &fakeAuthService{}
+	api := &serverAPI{auth: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(7))
+	ctx = context.WithValue(ctx, interceptors.SessionIDKey, "s1")
+
+	if _, err := api.ChangePassword(ctx, &chatpb.ChangePasswordRequest{CurrentPassword: "old"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	resp, err := api.ChangePassword(ctx, &chatpb.ChangePasswordRequest{CurrentPassword: "old", NewPassword: "new"})
+	if err != nil || resp.GetRevokedSessions() != 2 || fake.lastSessionID != "s1" || fake.lastPassword != "new" {
+		t.Fatalf("unexpected change: %v %v", err, resp)
+	}
+	fake.passwordErr = models.ErrInvalidCredentials
+	if _, err := api.ChangePassword(ctx, &chatpb.ChangePasswordRequest{CurrentPassword: "bad", NewPassword: "new"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+
+	fake.passwordErr = nil
+	if _, err := api.RequestPasswordReset(context.Background(), &chatpb.RequestPasswordResetRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	if _, err := api.RequestPasswordReset(context.Background(), &chatpb.RequestPasswordResetRequest{Email: "a@b.c"}); err != nil || fake.lastEmail != "a@b.c" {
+		t.Fatalf("unexpected reset request: %v", err)
+	}
+
+	if _, err := api.ConfirmPasswordReset(context.Background(), &chatpb.ConfirmPasswordResetRequest{Token: "t"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	fake.passwordErr = models.ErrResetTokenInvalid
+	if _, err := api.ConfirmPasswordReset(context.Background(), &chatpb.ConfirmPasswordResetRequest{Token: "t", NewPassword: "p"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for bad token, got %v", err)
+	}
+	fake.passwordErr = errors.New("db")
+	if _, err := api.ConfirmPasswordReset(context.Background(), &chatpb.ConfirmPasswordResetRequest{Token: "t", NewPassword: "p"}); status.Code(err) != codes.Internal {
+		t.Fatalf("expected internal, got %v", err)
+	}
+}
+
+func TestVerificationHandlers(t *testing.T) {
+	fake := &fakeAuthService{}
+	api := &serverAPI{auth: fake, log: logger()}
+	ctx := context.Background()
+
+	if _, err := api.VerifyEmail(ctx, &chatpb.VerifyEmailRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	if _, err := api.VerifyEmail(ctx, &chatpb.VerifyEmailRequest{Token: "t"}); err != nil || fake.lastToken != "t" {
+		t.Fatalf("unexpected verify: %v", err)
+	}
+	if _, err := api.ResendVerificationEmail(ctx, &chatpb.ResendVerificationEmailRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	if _, err := api.ResendVerificationEmail(ctx, &chatpb.ResendVerificationEmailRequest{Email: "a@b.c"}); err != nil || fake.lastEmail != "a@b.c" {
+		t.Fatalf("unexpected resend: %v", err)
+	}
+
+	fake.verifyErr = models.ErrVerifyTokenInvalid
+	if _, err := api.VerifyEmail(ctx, &chatpb.VerifyEmailRequest{Token: "t"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for bad token, got %v", err)
+	}
+	fake.verifyErr = errors.New("db")
+	if _, err := api.ResendVerificationEmail(ctx, &chatpb.ResendVerificationEmailRequest{Email: "a@b.c"}); status.Code(err) != codes.Internal {
+		t.Fatalf("expected internal, got %v", err)
+	}
+}
+
+func TestMFAHandlers(t *testing.T) {
+	fake := &fakeAuthService{loginRespAccess: "a", loginRespRefresh: "r", loginUser: &chatpb.User{Id: 7}}
+	api := &serverAPI{auth: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(7))
+	ctx = context.WithValue(ctx, interceptors.SessionIDKey, "s1")
+
+	if _, err := api.EnrollTOTP(context.Background(), &chatpb.EnrollTOTPRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected unauthenticated, got %v", err)
+	}
+	if resp, err := api.EnrollTOTP(ctx, &chatpb.EnrollTOTPRequest{}); err != nil || resp.GetSecret() != "SECRET" || resp.GetOtpauthUri() == "" {
+		t.Fatalf("unexpected enroll: %v %+v", err, resp)
+	}
+	if _, err := api.ConfirmTOTP(ctx, &chatpb.ConfirmTOTPRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	if resp, err := api.ConfirmTOTP(ctx, &chatpb.ConfirmTOTPRequest{Code: "123456"}); err != nil || len(resp.GetRecoveryCodes()) != 1 || fake.lastCode != "123456" {
+		t.Fatalf("unexpected confirm: %v %+v", err, resp)
+	}
+	if _, err := api.DisableTOTP(ctx, &chatpb.DisableTOTPRequest{Code: "123456"}); err != nil {
+		t.Fatalf("unexpected disable error: %v", err)
+	}
+
+	if _, err := api.VerifyMFA(context.Background(), &chatpb.VerifyMFARequest{MfaToken: "t"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	resp, err := api.VerifyMFA(context.Background(), &chatpb.VerifyMFARequest{MfaToken: "t", Code: "123456"})
+	if err != nil || resp.GetAccessToken() != "a" || resp.GetRefreshToken() != "r" || resp.GetUser().GetId() != 7 {
+		t.Fatalf("unexpected verify: %v %+v", err, resp)
+	}
+
+	cases := []struct {
+		err  error
+		call func() error
+		code codes.Code
+	}{
+		{models.ErrTOTPCodeInvalid, func() error { _, err := api.ConfirmTOTP(ctx, &chatpb.ConfirmTOTPRequest{Code: "1"}); return err }, codes.InvalidArgument},
+		{models.ErrTOTPAlreadyEnabled, func() error { _, err := api.EnrollTOTP(ctx, &chatpb.EnrollTOTPRequest{}); return err }, codes.FailedPrecondition},
+		{models.ErrTOTPNotFound, func() error { _, err := api.DisableTOTP(ctx, &chatpb.DisableTOTPRequest{Code: "1"}); return err }, codes.FailedPrecondition},
+		{errors.New("db"), func() error { _, err := api.DisableTOTP(ctx, &chatpb.DisableTOTPRequest{Code: "1"}); return err }, codes.Internal},
+		{models.ErrInvalidCredentials, func() error {
+			_, err := api.VerifyMFA(ctx, &chatpb.VerifyMFARequest{MfaToken: "t", Code: "1"})
+			return err
+		}, codes.Unauthenticated},
+		{models.ErrTOTPCodeInvalid, func() error {
+			_, err := api.VerifyMFA(ctx, &chatpb.VerifyMFARequest{MfaToken: "t", Code: "1"})
+			return err
+		}, codes.Unauthenticated},
+	}
+	for _, c := range cases {
+		fake.mfaErr = c.err
+		if err := c.call(); status.Code(err) != c.code {
+			t.Fatalf("%v: expected %v, got %v", c.err, c.code, err)
+		}
+	}
+}
+
+func TestOIDCHandlers(t *testing.T) {
+	fake := &fakeAuthService{loginRespAccess: "a", loginRespRefresh: "r", loginUser: &chatpb.User{Id: 7}}
+	api := &serverAPI{auth: fake, log: logger()}
+	ctx := context.Background()
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if _, err := api.StartOIDCLogin(ctx, &chatpb.StartOIDCLoginRequest{CodeChallenge: "plain-verifier"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	start, err := api.StartOIDCLogin(ctx, &chatpb.StartOIDCLoginRequest{CodeChallenge: challenge})
+	if err != nil || start.GetState() != "st" || start.GetAuthorizationUrl() == "" || fake.lastCode != challenge {
+		t.Fatalf("unexpected start: %v %+v", err, start)
+	}
+
+	if _, err := api.FinishOIDCLogin(ctx, &chatpb.FinishOIDCLoginRequest{State: "st", Code: "c"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+	finish := &chatpb.FinishOIDCLoginRequest{State: "st", Code: "c", CodeVerifier: "v"}
+	resp, err := api.FinishOIDCLogin(ctx, finish)
+	if err != nil || resp.GetAccessToken() != "a" || resp.GetRefreshToken() != "r" || resp.GetUser().GetId() != 7 || resp.GetMfaRequired() {
+		t.Fatalf("unexpected finish: %v %+v", err, resp)
+	}
+
+	fake.oidcErr = fmt.Errorf("wrapped: %w", &models.MFARequiredError{ChallengeToken: "mfa"})
+	if resp, err := api.FinishOIDCLogin(ctx, finish); err != nil || !resp.GetMfaRequired() || resp.GetMfaToken() != "mfa" || resp.GetAccessToken() != "" {
+		t.Fatalf("expected mfa step: %v %+v", err, resp)
+	}
+
+	cases := []struct {
+		err  error
+		code codes.Code
+	}{
+		{models.ErrOIDCDisabled, codes.Unimplemented},
+		{models.ErrOIDCStateInvalid, codes.Unauthenticated},
+		{models.ErrInvalidCredentials, codes.Unauthenticated},
+		{models.ErrOIDCEmailUnverified, codes.FailedPrecondition},
+		{errors.New("db"), codes.Internal},
+	}
+	for _, c := range cases {
+		fake.oidcErr = c.err
+		if _, err := api.FinishOIDCLogin(ctx, finish); status.Code(err) != c.code {
+			t.Fatalf("%v: expected %v, got %v", c.err, c.code, err)
+		}
+	}
+	fake.oidcErr = models.ErrOIDCDisabled
+	if _, err := api.StartOIDCLogin(ctx, &chatpb.StartOIDCLoginRequest{CodeChallenge: challenge}); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected unimplemented, got %v", err)
+	}
+}
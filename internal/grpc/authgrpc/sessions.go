@@ -0,0 +1,144 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// maxUserAgentLen ограничивает сохраняемый user agent, чтобы клиент не раздувал список сессий.
+const maxUserAgentLen = 256
+
+func (s *serverAPI) Logout(ctx context.Context, req *chatpb.LogoutRequest) (*chatpb.LogoutResponse, error) {
+	const op = "authgrpc.Logout"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	userID, sessionID, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Делегируем вызов сервису
+	if err := s.auth.Logout(ctx, userID, sessionID); err != nil {
+		return nil, sessionError(log, err, "failed to logout")
+	}
+
+	return &chatpb.LogoutResponse{}, nil
+}
+
+func (s *serverAPI) LogoutAll(ctx context.Context, req *chatpb.LogoutAllRequest) (*chatpb.LogoutAllResponse, error) {
+	const op = "authgrpc.LogoutAll"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	userID, _, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Делегируем вызов сервису
+	revoked, err := s.auth.LogoutAll(ctx, userID)
+	if err != nil {
+		return nil, sessionError(log, err, "failed to logout")
+	}
+
+	return &chatpb.LogoutAllResponse{Revoked: int32(revoked)}, nil
+}
+
+func (s *serverAPI) ListSessions(ctx context.Context, req *chatpb.ListSessionsRequest) (*chatpb.ListSessionsResponse, error) {
+	const op = "authgrpc.ListSessions"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	userID, sessionID, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Делегируем вызов сервису
+	sessions, err := s.auth.ListSessions(ctx, userID, sessionID)
+	if err != nil {
+		return nil, sessionError(log, err, "failed to list sessions")
+	}
+
+	return &chatpb.ListSessionsResponse{Sessions: sessions}, nil
+}
+
+func (s *serverAPI) RevokeSession(ctx context.Context, req *chatpb.RevokeSessionRequest) (*chatpb.RevokeSessionResponse, error) {
+	const op = "authgrpc.RevokeSession"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	userID, _, err := sessionFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetSessionId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id is required")
+	}
+
+	// 2. Делегируем вызов сервису
+	if err := s.auth.RevokeSession(ctx, userID, req.GetSessionId()); err != nil {
+		return nil, sessionError(log, err, "failed to revoke session")
+	}
+
+	return &chatpb.RevokeSessionResponse{}, nil
+}
+
+// sessionFromContext возвращает пользователя и сессию, которые добавил перехватчик аутентификации.
+func sessionFromContext(ctx context.Context) (userID int64, sessionID string, err error) {
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		return 0, "", status.Error(codes.Unauthenticated, "missing user context")
+	}
+	sessionID, ok = ctx.Value(interceptors.SessionIDKey).(string)
+	if !ok || sessionID == "" {
+		return 0, "", status.Error(codes.Unauthenticated, "missing session context")
+	}
+	return userID, sessionID, nil
+}
+
+// sessionError преобразует ошибки управления сессиями в gRPC статусы.
+func sessionError(log *slog.Logger, err error, internalMsg string) error {
+	switch {
+	case errors.Is(err, models.ErrSessionNotFound):
+		return status.Error(codes.NotFound, "session not found")
+	default:
+		log.Error(internalMsg, slog.Any("err", err))
+		return status.Error(codes.Internal, internalMsg)
+	}
+}
+
+// clientInfo описывает устройство клиента по заголовку user-agent и адресу соединения.
+func clientInfo(ctx context.Context) models.ClientInfo {
+	var client models.ClientInfo
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ua := md.Get("user-agent"); len(ua) > 0 {
+			client.UserAgent = ua[0]
+			if len(client.UserAgent) > maxUserAgentLen {
+				// Обрезка может разрезать символ, а Postgres не примет невалидный UTF-8
+				client.UserAgent = strings.ToValidUTF8(client.UserAgent[:maxUserAgentLen], "")
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		client.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(client.IP); err == nil {
+			client.IP = host
+		}
+	}
+
+	return client
+}
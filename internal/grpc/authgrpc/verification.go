@@ -0,0 +1,58 @@
+package authgrpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *serverAPI) VerifyEmail(ctx context.Context, req *chatpb.VerifyEmailRequest) (*chatpb.VerifyEmailResponse, error) {
+	const op = "authgrpc.VerifyEmail"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	// 2. Делегируем вызов сервису
+	if err := s.auth.VerifyEmail(ctx, req.GetToken()); err != nil {
+		return nil, verificationError(log, err)
+	}
+
+	return &chatpb.VerifyEmailResponse{}, nil
+}
+
+func (s *serverAPI) ResendVerificationEmail(ctx context.Context, req *chatpb.ResendVerificationEmailRequest) (*chatpb.ResendVerificationEmailResponse, error) {
+	const op = "authgrpc.ResendVerificationEmail"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	// 2. Делегируем вызов сервису. Ответ одинаков для неизвестных, подтвержденных
+	// и слишком часто запрашиваемых адресов
+	if err := s.auth.ResendVerificationEmail(ctx, req.GetEmail()); err != nil {
+		return nil, verificationError(log, err)
+	}
+
+	return &chatpb.ResendVerificationEmailResponse{}, nil
+}
+
+// verificationError преобразует ошибки подтверждения email в gRPC статусы.
+func verificationError(log *slog.Logger, err error) error {
+	switch {
+	case errors.Is(err, models.ErrVerifyTokenInvalid):
+		return status.Error(codes.InvalidArgument, "verification token is invalid or expired")
+	default:
+		log.Error("failed to verify email", slog.Any("err", err))
+		return status.Error(codes.Internal, "failed to verify email")
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"errors"
 	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
 	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"io"
 	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
 	"google.golang.org/grpc"
@@ -16,21 +20,58 @@ import (
 // ChatService - интерфейс, который определяет потребитель (хендлер).
 // Он полностью описывает, что нам нужно от сервисного слоя.
 type ChatService interface {
-	CreateChat(ctx context.Context, name string, userID int64) (*chatpb.Chat, error)
+	GetSlowMode(ctx context.Context, chatID int64) (time.Duration, error)
+	SetSlowMode(ctx context.Context, chatID int64, interval time.Duration) error
+	CreateChat(ctx context.Context, name, chatType string, userID int64) (*chatpb.Chat, error)
+	SubscribeChannel(ctx context.Context, chatID int64) (*chatpb.Chat, error)
 	GetHistory(ctx context.Context, chatID int64, limit, offset uint64) ([]*chatpb.Message, error)
 	JoinChat(stream chatpb.ChatService_JoinChatServer) error
+	SendMessage(ctx context.Context, chatID int64, text, idempotencyKey string, attachmentIDs []int64, ttl time.Duration) (*chatpb.Message, error)
+	SearchMessages(ctx context.Context, query string, filter models.SearchFilter, limit, offset uint64) ([]*chatpb.SearchResult, error)
+	PinMessage(ctx context.Context, chatID, messageID int64) (*chatpb.Message, error)
+	UnpinMessage(ctx context.Context, chatID, messageID int64) error
+	GetPinnedMessages(ctx context.Context, chatID int64) ([]*chatpb.Message, error)
+	ScheduleMessage(ctx context.Context, chatID int64, text string, sendAt time.Time) (*chatpb.ScheduledMessage, error)
+	ListScheduledMessages(ctx context.Context, chatID int64) ([]*chatpb.ScheduledMessage, error)
+	UpdateScheduledMessage(ctx context.Context, id int64, text string, sendAt time.Time) (*chatpb.ScheduledMessage, error)
+	CancelScheduledMessage(ctx context.Context, id int64) error
+	GetRetentionPolicy(ctx context.Context, chatID int64) (*chatpb.RetentionPolicy, error)
+	SetRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) (*chatpb.RetentionPolicy, error)
+	GetModerationSettings(ctx context.Context, chatID int64) (*chatpb.ModerationSettings, error)
+	SetModerationSettings(ctx context.Context, settings *models.ModerationSettings) (*chatpb.ModerationSettings, error)
+	ReportMessage(ctx context.Context, messageID int64, reason string) (*chatpb.Report, error)
+	ListReports(ctx context.Context, chatID int64, status models.ReportStatus, limit, offset uint64) ([]*chatpb.Report, error)
+	ClaimReport(ctx context.Context, reportID int64) (*chatpb.Report, error)
+	ResolveReport(ctx context.Context, reportID int64, resolution models.Resolution, muteFor time.Duration) (*chatpb.Report, error)
+	ListModerationAudit(ctx context.Context, chatID int64, limit, offset uint64) ([]*chatpb.AuditEntry, error)
+	MuteMember(ctx context.Context, chatID, userID int64, duration time.Duration) (time.Time, error)
+	UnmuteMember(ctx context.Context, chatID, userID int64) error
+	SetMemberRole(ctx context.Context, chatID, userID int64, role models.ChatRole) error
+}
+
+// AttachmentService - загрузка и скачивание вложений.
+type AttachmentService interface {
+	Upload(ctx context.Context, chatID int64, name, mimeType string, r io.Reader) (*chatpb.Attachment, error)
+	Open(ctx context.Context, attachmentID, thumbnailID int64) (*chatpb.Attachment, io.ReadCloser, error)
 }
 
 type serverAPI struct {
 	chatpb.UnimplementedChatServiceServer
-	log  *slog.Logger
-	chat ChatService
+	log         *slog.Logger
+	chat        ChatService
+	attachments AttachmentService
+	chunkSize   int
+	// requireVerifiedEmail - создавать чаты могут только пользователи с подтвержденным email
+	requireVerifiedEmail bool
 }
 
-func Register(gRPC *grpc.Server, log *slog.Logger, chat ChatService) {
+func Register(gRPC *grpc.Server, log *slog.Logger, chat ChatService, attachments AttachmentService, chunkSize int, requireVerifiedEmail bool) {
 	chatpb.RegisterChatServiceServer(gRPC, &serverAPI{
-		log:  log,
-		chat: chat,
+		log:                  log,
+		chat:                 chat,
+		attachments:          attachments,
+		chunkSize:            chunkSize,
+		requireVerifiedEmail: requireVerifiedEmail,
 	})
 }
 
@@ -43,17 +84,28 @@ func (s *serverAPI) CreateChat(ctx context.Context, req *chatpb.CreateChatReques
 	if !ok {
 		return nil, status.Error(codes.Unauthenticated, "missing user context")
 	}
+	// Флаг берется из access токена: после подтверждения email токен нужно обновить
+	if verified, _ := ctx.Value(interceptors.EmailVerifiedKey).(bool); s.requireVerifiedEmail && !verified {
+		return nil, status.Error(codes.FailedPrecondition, "email is not verified")
+	}
 
 	// 2. Валидация
 	if req.GetName() == "" {
 		return nil, status.Error(codes.InvalidArgument, "name is required")
 	}
+	chatType := req.GetType()
+	switch chatType {
+	case "":
+		chatType = models.ChatTypePublic
+	case models.ChatTypePublic, models.ChatTypeChannel:
+	default:
+		return nil, status.Error(codes.InvalidArgument, "type must be public or channel")
+	}
 
-	log.Info("creating chat", slog.String("name", req.Name), slog.Int64("user_id", userID))
+	log.Info("creating chat", slog.String("name", req.Name), slog.String("type", chatType), slog.Int64("user_id", userID))
 
 	// 3. Делегируем вызов сервису
-	// TODO: type of chat: private/public
-	chatProto, err := s.chat.CreateChat(ctx, req.GetName(), userID)
+	chatProto, err := s.chat.CreateChat(ctx, req.GetName(), chatType, userID)
 	if err != nil {
 		log.Error("failed to create chat", slog.Any("err", err))
 		return nil, status.Error(codes.Internal, "failed to create chat")
@@ -62,6 +114,35 @@ func (s *serverAPI) CreateChat(ctx context.Context, req *chatpb.CreateChatReques
 	return &chatpb.CreateChatResponse{Chat: chatProto}, nil
 }
 
+func (s *serverAPI) SubscribeChannel(ctx context.Context, req *chatpb.SubscribeChannelRequest) (*chatpb.SubscribeChannelResponse, error) {
+	const op = "grpc.chat.SubscribeChannel"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id is required")
+	}
+
+	// 2. Делегируем вызов сервису
+	chatProto, err := s.chat.SubscribeChannel(ctx, req.GetChatId())
+	if err != nil {
+		log.Error("failed to subscribe to channel", slog.Any("err", err))
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials):
+			return nil, status.Error(codes.Unauthenticated, "missing user context")
+		case errors.Is(err, models.ErrChatNotFound):
+			return nil, status.Error(codes.NotFound, "chat not found")
+		case errors.Is(err, models.ErrNotChannel):
+			return nil, status.Error(codes.FailedPrecondition, "chat is not a channel")
+		case errors.Is(err, models.ErrBannedFromChat):
+			return nil, status.Error(codes.PermissionDenied, "you are banned from this channel")
+		}
+		return nil, status.Error(codes.Internal, "failed to subscribe to channel")
+	}
+
+	return &chatpb.SubscribeChannelResponse{Chat: chatProto}, nil
+}
+
 func (s *serverAPI) GetHistory(ctx context.Context, req *chatpb.GetHistoryRequest) (*chatpb.GetHistoryResponse, error) {
 	const op = "grpc.chat.GetHistory"
 	log := s.log.With(slog.String("op", op))
@@ -94,6 +175,734 @@ func (s *serverAPI) GetHistory(ctx context.Context, req *chatpb.GetHistoryReques
 	return &chatpb.GetHistoryResponse{Messages: messages}, nil
 }
 
+func (s *serverAPI) SendMessage(ctx context.Context, req *chatpb.SendMessageRequest) (*chatpb.SendMessageResponse, error) {
+	const op = "grpc.chat.SendMessage"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id is required")
+	}
+	if req.GetText() == "" && len(req.GetAttachmentIds()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "text or attachments are required")
+	}
+	if req.GetTtlSeconds() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "ttl_seconds must not be negative")
+	}
+
+	log.Info("sending message", slog.Int64("chat_id", req.GetChatId()))
+
+	// 2. Делегируем вызов сервису
+	ttl := time.Duration(req.GetTtlSeconds()) * time.Second
+	msg, err := s.chat.SendMessage(ctx, req.GetChatId(), req.GetText(), req.GetIdempotencyKey(), req.GetAttachmentIds(), ttl)
+	if err != nil {
+		log.Error("failed to send message", slog.Any("err", err))
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			return nil, status.Error(codes.Unauthenticated, "missing user context")
+		}
+		if errors.Is(err, models.ErrAccessDenied) {
+			return nil, status.Error(codes.PermissionDenied, "access denied")
+		}
+		if errors.Is(err, models.ErrReadOnlyChat) {
+			return nil, status.Error(codes.PermissionDenied, "only chat admins can post in this channel")
+		}
+		var mutedErr *models.MutedError
+		if errors.As(err, &mutedErr) {
+			return nil, status.Error(codes.PermissionDenied, mutedErr.Error())
+		}
+		if errors.Is(err, models.ErrAttachmentNotFound) {
+			return nil, status.Error(codes.FailedPrecondition, "attachment not found or already used")
+		}
+		// Повтор запроса с ключом уже исчезнувшего сообщения
+		if errors.Is(err, models.ErrMessageNotFound) {
+			return nil, status.Error(codes.NotFound, "message has expired")
+		}
+		var rejectedErr *models.MessageRejectedError
+		if errors.As(err, &rejectedErr) {
+			return nil, status.Error(codes.InvalidArgument, rejectedErr.Error())
+		}
+		var limitErr *models.RateLimitError
+		if errors.As(err, &limitErr) {
+			_ = grpc.SetTrailer(ctx, interceptors.RetryAfterMD(limitErr.RetryAfter))
+			return nil, interceptors.RateLimitStatus(limitErr.RetryAfter)
+		}
+		var slowErr *models.SlowModeError
+		if errors.As(err, &slowErr) {
+			retryAfter := time.Until(slowErr.RetryAt)
+			_ = grpc.SetTrailer(ctx, interceptors.RetryAfterMD(retryAfter))
+			return nil, status.Errorf(codes.ResourceExhausted, "slow mode is enabled, you can post again in %ds",
+				int64(max(time.Second, retryAfter.Round(time.Second))/time.Second))
+		}
+		return nil, status.Error(codes.Internal, "failed to send message")
+	}
+
+	return &chatpb.SendMessageResponse{Message: msg}, nil
+}
+
+func (s *serverAPI) SearchMessages(ctx context.Context, req *chatpb.SearchMessagesRequest) (*chatpb.SearchMessagesResponse, error) {
+	const op = "grpc.chat.SearchMessages"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetQuery() == "" {
+		return nil, status.Error(codes.InvalidArgument, "query is required")
+	}
+	if req.GetFrom() != 0 && req.GetTo() != 0 && req.GetFrom() > req.GetTo() {
+		return nil, status.Error(codes.InvalidArgument, "from must not be after to")
+	}
+
+	limit := req.GetLimit()
+	if limit <= 0 || limit > 100 {
+		limit = 20 // Default/max limit
+	}
+	offset := req.GetOffset()
+	if offset < 0 {
+		offset = 0
+	}
+
+	filter := models.SearchFilter{
+		ChatID:   req.GetChatId(),
+		AuthorID: req.GetAuthorId(),
+	}
+	if req.GetFrom() != 0 {
+		filter.From = time.Unix(req.GetFrom(), 0)
+	}
+	if req.GetTo() != 0 {
+		filter.To = time.Unix(req.GetTo(), 0)
+	}
+
+	log.Info("searching messages", slog.Int64("chat_id", filter.ChatID))
+
+	// 2. Делегируем вызов сервису
+	results, err := s.chat.SearchMessages(ctx, req.GetQuery(), filter, uint64(limit), uint64(offset))
+	if err != nil {
+		log.Error("failed to search messages", slog.Any("err", err))
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			return nil, status.Error(codes.Unauthenticated, "missing user context")
+		}
+		if errors.Is(err, models.ErrAccessDenied) {
+			return nil, status.Error(codes.PermissionDenied, "access denied")
+		}
+		return nil, status.Error(codes.Internal, "failed to search messages")
+	}
+
+	return &chatpb.SearchMessagesResponse{Results: results}, nil
+}
+
+// PinMessage закрепляет сообщение в чате и возвращает закрепленное сообщение.
+func (s *serverAPI) PinMessage(ctx context.Context, req *chatpb.PinMessageRequest) (*chatpb.PinMessageResponse, error) {
+	const op = "grpc.chat.PinMessage"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 || req.GetMessageId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id and message_id are required")
+	}
+
+	log.Info("pinning message", slog.Int64("chat_id", req.GetChatId()), slog.Int64("message_id", req.GetMessageId()))
+
+	// 2. Делегируем вызов сервису
+	msg, err := s.chat.PinMessage(ctx, req.GetChatId(), req.GetMessageId())
+	if err != nil {
+		log.Error("failed to pin message", slog.Any("err", err))
+		return nil, pinError(err, "failed to pin message")
+	}
+
+	return &chatpb.PinMessageResponse{Message: msg}, nil
+}
+
+func (s *serverAPI) UnpinMessage(ctx context.Context, req *chatpb.UnpinMessageRequest) (*chatpb.UnpinMessageResponse, error) {
+	const op = "grpc.chat.UnpinMessage"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 || req.GetMessageId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id and message_id are required")
+	}
+
+	log.Info("unpinning message", slog.Int64("chat_id", req.GetChatId()), slog.Int64("message_id", req.GetMessageId()))
+
+	// 2. Делегируем вызов сервису
+	if err := s.chat.UnpinMessage(ctx, req.GetChatId(), req.GetMessageId()); err != nil {
+		log.Error("failed to unpin message", slog.Any("err", err))
+		return nil, pinError(err, "failed to unpin message")
+	}
+
+	return &chatpb.UnpinMessageResponse{}, nil
+}
+
+func (s *serverAPI) GetPinnedMessages(ctx context.Context, req *chatpb.GetPinnedMessagesRequest) (*chatpb.GetPinnedMessagesResponse, error) {
+	const op = "grpc.chat.GetPinnedMessages"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id is required")
+	}
+
+	// 2. Делегируем вызов сервису
+	messages, err := s.chat.GetPinnedMessages(ctx, req.GetChatId())
+	if err != nil {
+		log.Error("failed to get pinned messages", slog.Any("err", err))
+		return nil, pinError(err, "failed to get pinned messages")
+	}
+
+	return &chatpb.GetPinnedMessagesResponse{Messages: messages}, nil
+}
+
+// pinError переводит ошибки сервиса закрепов в gRPC статусы.
+func pinError(err error, msg string) error {
+	switch {
+	case errors.Is(err, models.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, "missing user context")
+	case errors.Is(err, models.ErrAccessDenied):
+		return status.Error(codes.PermissionDenied, "access denied")
+	case errors.Is(err, models.ErrChatNotFound):
+		return status.Error(codes.NotFound, "chat not found")
+	case errors.Is(err, models.ErrMessageNotFound):
+		return status.Error(codes.NotFound, "message not found")
+	case errors.Is(err, models.ErrPinLimitReached):
+		return status.Error(codes.FailedPrecondition, "pinned messages limit reached")
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+func (s *serverAPI) ScheduleMessage(ctx context.Context, req *chatpb.ScheduleMessageRequest) (*chatpb.ScheduleMessageResponse, error) {
+	const op = "grpc.chat.ScheduleMessage"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id is required")
+	}
+	sendAt, err := validateScheduled(req.GetText(), req.GetSendAt())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("scheduling message", slog.Int64("chat_id", req.GetChatId()), slog.Time("send_at", sendAt))
+
+	// 2. Делегируем вызов сервису
+	msg, err := s.chat.ScheduleMessage(ctx, req.GetChatId(), req.GetText(), sendAt)
+	if err != nil {
+		log.Error("failed to schedule message", slog.Any("err", err))
+		return nil, scheduledError(err, "failed to schedule message")
+	}
+
+	return &chatpb.ScheduleMessageResponse{ScheduledMessage: msg}, nil
+}
+
+func (s *serverAPI) ListScheduledMessages(ctx context.Context, req *chatpb.ListScheduledMessagesRequest) (*chatpb.ListScheduledMessagesResponse, error) {
+	const op = "grpc.chat.ListScheduledMessages"
+	log := s.log.With(slog.String("op", op))
+
+	messages, err := s.chat.ListScheduledMessages(ctx, req.GetChatId())
+	if err != nil {
+		log.Error("failed to list scheduled messages", slog.Any("err", err))
+		return nil, scheduledError(err, "failed to list scheduled messages")
+	}
+
+	return &chatpb.ListScheduledMessagesResponse{ScheduledMessages: messages}, nil
+}
+
+func (s *serverAPI) UpdateScheduledMessage(ctx context.Context, req *chatpb.UpdateScheduledMessageRequest) (*chatpb.UpdateScheduledMessageResponse, error) {
+	const op = "grpc.chat.UpdateScheduledMessage"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	sendAt, err := validateScheduled(req.GetText(), req.GetSendAt())
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Делегируем вызов сервису
+	msg, err := s.chat.UpdateScheduledMessage(ctx, req.GetId(), req.GetText(), sendAt)
+	if err != nil {
+		log.Error("failed to update scheduled message", slog.Any("err", err))
+		return nil, scheduledError(err, "failed to update scheduled message")
+	}
+
+	return &chatpb.UpdateScheduledMessageResponse{ScheduledMessage: msg}, nil
+}
+
+func (s *serverAPI) CancelScheduledMessage(ctx context.Context, req *chatpb.CancelScheduledMessageRequest) (*chatpb.CancelScheduledMessageResponse, error) {
+	const op = "grpc.chat.CancelScheduledMessage"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	// 2. Делегируем вызов сервису
+	if err := s.chat.CancelScheduledMessage(ctx, req.GetId()); err != nil {
+		log.Error("failed to cancel scheduled message", slog.Any("err", err))
+		return nil, scheduledError(err, "failed to cancel scheduled message")
+	}
+
+	return &chatpb.CancelScheduledMessageResponse{}, nil
+}
+
+// validateScheduled проверяет текст и время отправки отложенного сообщения.
+func validateScheduled(text string, sendAt int64) (time.Time, error) {
+	if text == "" {
+		return time.Time{}, status.Error(codes.InvalidArgument, "text is required")
+	}
+	t := time.Unix(sendAt, 0)
+	if !t.After(time.Now()) {
+		return time.Time{}, status.Error(codes.InvalidArgument, "send_at must be in the future")
+	}
+	return t, nil
+}
+
+// scheduledError переводит ошибки сервиса отложенных сообщений в gRPC статусы.
+func scheduledError(err error, msg string) error {
+	switch {
+	case errors.Is(err, models.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, "missing user context")
+	case errors.Is(err, models.ErrAccessDenied):
+		return status.Error(codes.PermissionDenied, "access denied")
+	case errors.Is(err, models.ErrReadOnlyChat):
+		return status.Error(codes.PermissionDenied, "only chat admins can post in this channel")
+	case errors.Is(err, models.ErrMuted):
+		return status.Error(codes.PermissionDenied, "you are muted in this chat")
+	case errors.Is(err, models.ErrScheduledNotFound):
+		// Не найдено, чужое, уже отправлено или отправляется прямо сейчас
+		return status.Error(codes.NotFound, "scheduled message not found")
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+func (s *serverAPI) GetRetentionPolicy(ctx context.Context, req *chatpb.GetRetentionPolicyRequest) (*chatpb.GetRetentionPolicyResponse, error) {
+	const op = "grpc.chat.GetRetentionPolicy"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id is required")
+	}
+
+	// 2. Делегируем вызов сервису
+	policy, err := s.chat.GetRetentionPolicy(ctx, req.GetChatId())
+	if err != nil {
+		log.Error("failed to get retention policy", slog.Any("err", err))
+		return nil, settingsError(err, "failed to get retention policy")
+	}
+
+	return &chatpb.GetRetentionPolicyResponse{Policy: policy}, nil
+}
+
+func (s *serverAPI) SetRetentionPolicy(ctx context.Context, req *chatpb.SetRetentionPolicyRequest) (*chatpb.SetRetentionPolicyResponse, error) {
+	const op = "grpc.chat.SetRetentionPolicy"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	policy := req.GetPolicy()
+	if policy.GetChatId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "policy.chat_id is required")
+	}
+	if policy.GetRetentionDays() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "retention_days must not be negative")
+	}
+
+	log.Info("setting retention policy",
+		slog.Int64("chat_id", policy.GetChatId()),
+		slog.Int("retention_days", int(policy.GetRetentionDays())),
+		slog.Bool("legal_hold", policy.GetLegalHold()),
+	)
+
+	// 2. Делегируем вызов сервису
+	updated, err := s.chat.SetRetentionPolicy(ctx, &models.RetentionPolicy{
+		ChatID:        policy.GetChatId(),
+		RetentionDays: int(policy.GetRetentionDays()),
+		LegalHold:     policy.GetLegalHold(),
+	})
+	if err != nil {
+		log.Error("failed to set retention policy", slog.Any("err", err))
+		return nil, settingsError(err, "failed to set retention policy")
+	}
+
+	return &chatpb.SetRetentionPolicyResponse{Policy: updated}, nil
+}
+
+// settingsError переводит ошибки настроек чата (срок хранения, медленный режим, фильтры) в gRPC статусы.
+func settingsError(err error, msg string) error {
+	switch {
+	case errors.Is(err, models.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, "missing user context")
+	case errors.Is(err, models.ErrAccessDenied):
+		return status.Error(codes.PermissionDenied, "access denied")
+	case errors.Is(err, models.ErrChatNotFound):
+		return status.Error(codes.NotFound, "chat not found")
+	case errors.Is(err, models.ErrInvalidModeration):
+		return status.Error(codes.InvalidArgument, "invalid moderation settings")
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+// maxSlowMode - максимальный интервал медленного режима
+const maxSlowMode = 24 * time.Hour
+
+func (s *serverAPI) GetSlowMode(ctx context.Context, req *chatpb.GetSlowModeRequest) (*chatpb.GetSlowModeResponse, error) {
+	const op = "grpc.chat.GetSlowMode"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id is required")
+	}
+
+	// 2. Делегируем вызов сервису
+	interval, err := s.chat.GetSlowMode(ctx, req.GetChatId())
+	if err != nil {
+		log.Error("failed to get slow mode", slog.Any("err", err))
+		return nil, settingsError(err, "failed to get slow mode")
+	}
+
+	return &chatpb.GetSlowModeResponse{ChatId: req.GetChatId(), Seconds: int32(interval / time.Second)}, nil
+}
+
+func (s *serverAPI) SetSlowMode(ctx context.Context, req *chatpb.SetSlowModeRequest) (*chatpb.SetSlowModeResponse, error) {
+	const op = "grpc.chat.SetSlowMode"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id is required")
+	}
+	interval := time.Duration(req.GetSeconds()) * time.Second
+	if interval < 0 || interval > maxSlowMode {
+		return nil, status.Errorf(codes.InvalidArgument, "seconds must be between 0 and %d", int(maxSlowMode/time.Second))
+	}
+
+	log.Info("setting slow mode", slog.Int64("chat_id", req.GetChatId()), slog.Duration("interval", interval))
+
+	// 2. Делегируем вызов сервису
+	if err := s.chat.SetSlowMode(ctx, req.GetChatId(), interval); err != nil {
+		log.Error("failed to set slow mode", slog.Any("err", err))
+		return nil, settingsError(err, "failed to set slow mode")
+	}
+
+	return &chatpb.SetSlowModeResponse{ChatId: req.GetChatId(), Seconds: req.GetSeconds()}, nil
+}
+
+// Ограничения размера настроек фильтров
+const (
+	maxBannedWords      = 1000
+	maxFilterRules      = 50
+	maxFilterPatternLen = 512
+)
+
+func (s *serverAPI) GetModerationSettings(ctx context.Context, req *chatpb.GetModerationSettingsRequest) (*chatpb.GetModerationSettingsResponse, error) {
+	const op = "grpc.chat.GetModerationSettings"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id is required")
+	}
+
+	// 2. Делегируем вызов сервису
+	settings, err := s.chat.GetModerationSettings(ctx, req.GetChatId())
+	if err != nil {
+		log.Error("failed to get moderation settings", slog.Any("err", err))
+		return nil, settingsError(err, "failed to get moderation settings")
+	}
+
+	return &chatpb.GetModerationSettingsResponse{Settings: settings}, nil
+}
+
+func (s *serverAPI) SetModerationSettings(ctx context.Context, req *chatpb.SetModerationSettingsRequest) (*chatpb.SetModerationSettingsResponse, error) {
+	const op = "grpc.chat.SetModerationSettings"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	protoSettings := req.GetSettings()
+	if protoSettings.GetChatId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "settings.chat_id is required")
+	}
+	if len(protoSettings.GetBannedWords()) > maxBannedWords {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d banned words are allowed", maxBannedWords)
+	}
+	if len(protoSettings.GetRules()) > maxFilterRules {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d rules are allowed", maxFilterRules)
+	}
+
+	settings := &models.ModerationSettings{
+		ChatID:            protoSettings.GetChatId(),
+		BannedWords:       protoSettings.GetBannedWords(),
+		BannedWordsAction: models.FilterAction(protoSettings.GetBannedWordsAction()),
+		BlockLinks:        protoSettings.GetBlockLinks(),
+		MaxLength:         int(protoSettings.GetMaxLength()),
+	}
+	for _, rule := range protoSettings.GetRules() {
+		if len(rule.GetPattern()) > maxFilterPatternLen {
+			return nil, status.Errorf(codes.InvalidArgument, "rule pattern must be at most %d bytes", maxFilterPatternLen)
+		}
+		settings.Rules = append(settings.Rules, models.FilterRule{
+			Pattern:     rule.GetPattern(),
+			Action:      models.FilterAction(rule.GetAction()),
+			Replacement: rule.GetReplacement(),
+		})
+	}
+	if err := settings.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	log.Info("setting moderation settings", slog.Int64("chat_id", settings.ChatID))
+
+	// 2. Делегируем вызов сервису
+	updated, err := s.chat.SetModerationSettings(ctx, settings)
+	if err != nil {
+		log.Error("failed to set moderation settings", slog.Any("err", err))
+		return nil, settingsError(err, "failed to set moderation settings")
+	}
+
+	return &chatpb.SetModerationSettingsResponse{Settings: updated}, nil
+}
+
+// Ограничения жалоб и решений по ним
+const (
+	maxReportReason = 1000
+	maxMuteDuration = 365 * 24 * time.Hour
+)
+
+func (s *serverAPI) ReportMessage(ctx context.Context, req *chatpb.ReportMessageRequest) (*chatpb.ReportMessageResponse, error) {
+	const op = "grpc.chat.ReportMessage"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetMessageId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "message_id is required")
+	}
+	reason := strings.TrimSpace(req.GetReason())
+	if reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "reason is required")
+	}
+	if utf8.RuneCountInString(reason) > maxReportReason {
+		return nil, status.Errorf(codes.InvalidArgument, "reason must be at most %d characters", maxReportReason)
+	}
+
+	log.Info("reporting message", slog.Int64("message_id", req.GetMessageId()))
+
+	// 2. Делегируем вызов сервису
+	report, err := s.chat.ReportMessage(ctx, req.GetMessageId(), reason)
+	if err != nil {
+		log.Error("failed to report message", slog.Any("err", err))
+		return nil, reportError(err, "failed to report message")
+	}
+
+	return &chatpb.ReportMessageResponse{Report: report}, nil
+}
+
+func (s *serverAPI) ListReports(ctx context.Context, req *chatpb.ListReportsRequest) (*chatpb.ListReportsResponse, error) {
+	const op = "grpc.chat.ListReports"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	reportStatus := models.ReportStatus(req.GetStatus())
+	switch reportStatus {
+	case "", models.ReportOpen, models.ReportClaimed, models.ReportResolved:
+	default:
+		return nil, status.Error(codes.InvalidArgument, "status must be open, claimed or resolved")
+	}
+	if req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "offset must not be negative")
+	}
+	limit := req.GetLimit()
+	if limit <= 0 || limit > 100 {
+		limit = 50 // Default/max limit
+	}
+
+	// 2. Делегируем вызов сервису
+	reports, err := s.chat.ListReports(ctx, req.GetChatId(), reportStatus, uint64(limit), uint64(req.GetOffset()))
+	if err != nil {
+		log.Error("failed to list reports", slog.Any("err", err))
+		return nil, reportError(err, "failed to list reports")
+	}
+
+	return &chatpb.ListReportsResponse{Reports: reports}, nil
+}
+
+func (s *serverAPI) ClaimReport(ctx context.Context, req *chatpb.ClaimReportRequest) (*chatpb.ClaimReportResponse, error) {
+	const op = "grpc.chat.ClaimReport"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetReportId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "report_id is required")
+	}
+
+	// 2. Делегируем вызов сервису
+	report, err := s.chat.ClaimReport(ctx, req.GetReportId())
+	if err != nil {
+		log.Error("failed to claim report", slog.Any("err", err))
+		return nil, reportError(err, "failed to claim report")
+	}
+
+	return &chatpb.ClaimReportResponse{Report: report}, nil
+}
+
+func (s *serverAPI) ResolveReport(ctx context.Context, req *chatpb.ResolveReportRequest) (*chatpb.ResolveReportResponse, error) {
+	const op = "grpc.chat.ResolveReport"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetReportId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "report_id is required")
+	}
+	resolution := models.Resolution(req.GetResolution())
+	if !resolution.Valid() {
+		return nil, status.Error(codes.InvalidArgument, "resolution must be dismiss, delete_message, mute_user or ban_user")
+	}
+	muteFor := time.Duration(req.GetMuteSeconds()) * time.Second
+	if resolution == models.ResolutionMuteUser && (muteFor <= 0 || muteFor > maxMuteDuration) {
+		return nil, status.Errorf(codes.InvalidArgument, "mute_seconds must be between 1 and %d", int64(maxMuteDuration/time.Second))
+	}
+
+	log.Info("resolving report", slog.Int64("report_id", req.GetReportId()), slog.String("resolution", string(resolution)))
+
+	// 2. Делегируем вызов сервису
+	report, err := s.chat.ResolveReport(ctx, req.GetReportId(), resolution, muteFor)
+	if err != nil {
+		log.Error("failed to resolve report", slog.Any("err", err))
+		return nil, reportError(err, "failed to resolve report")
+	}
+
+	return &chatpb.ResolveReportResponse{Report: report}, nil
+}
+
+func (s *serverAPI) ListModerationAudit(ctx context.Context, req *chatpb.ListModerationAuditRequest) (*chatpb.ListModerationAuditResponse, error) {
+	const op = "grpc.chat.ListModerationAudit"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "offset must not be negative")
+	}
+	limit := req.GetLimit()
+	if limit <= 0 || limit > 100 {
+		limit = 50 // Default/max limit
+	}
+
+	// 2. Делегируем вызов сервису
+	entries, err := s.chat.ListModerationAudit(ctx, req.GetChatId(), uint64(limit), uint64(req.GetOffset()))
+	if err != nil {
+		log.Error("failed to list moderation audit", slog.Any("err", err))
+		return nil, reportError(err, "failed to list moderation audit")
+	}
+
+	return &chatpb.ListModerationAuditResponse{Entries: entries}, nil
+}
+
+// reportError переводит ошибки жалоб и очереди модерации в gRPC статусы.
+func reportError(err error, msg string) error {
+	switch {
+	case errors.Is(err, models.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, "missing user context")
+	case errors.Is(err, models.ErrAccessDenied):
+		return status.Error(codes.PermissionDenied, "access denied")
+	case errors.Is(err, models.ErrMessageNotFound):
+		return status.Error(codes.NotFound, "message not found")
+	case errors.Is(err, models.ErrReportNotFound):
+		return status.Error(codes.NotFound, "report not found")
+	case errors.Is(err, models.ErrReportExists):
+		return status.Error(codes.AlreadyExists, "message already reported")
+	case errors.Is(err, models.ErrReportClaimed):
+		return status.Error(codes.FailedPrecondition, "report is claimed by another moderator")
+	case errors.Is(err, models.ErrReportResolved):
+		return status.Error(codes.FailedPrecondition, "report already resolved")
+	case errors.Is(err, models.ErrNotChatMember), errors.Is(err, models.ErrUserNotFound):
+		return status.Error(codes.FailedPrecondition, "message author is no longer a chat member")
+	}
+	return status.Error(codes.Internal, msg)
+}
+
+func (s *serverAPI) MuteMember(ctx context.Context, req *chatpb.MuteMemberRequest) (*chatpb.MuteMemberResponse, error) {
+	const op = "grpc.chat.MuteMember"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 || req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id and user_id are required")
+	}
+	duration := time.Duration(req.GetSeconds()) * time.Second
+	if duration <= 0 || duration > maxMuteDuration {
+		return nil, status.Errorf(codes.InvalidArgument, "seconds must be between 1 and %d", int64(maxMuteDuration/time.Second))
+	}
+
+	log.Info("muting member", slog.Int64("chat_id", req.GetChatId()), slog.Int64("user_id", req.GetUserId()), slog.Duration("duration", duration))
+
+	// 2. Делегируем вызов сервису
+	until, err := s.chat.MuteMember(ctx, req.GetChatId(), req.GetUserId(), duration)
+	if err != nil {
+		log.Error("failed to mute member", slog.Any("err", err))
+		return nil, muteError(err, "failed to mute member")
+	}
+
+	return &chatpb.MuteMemberResponse{MutedUntil: until.Unix()}, nil
+}
+
+func (s *serverAPI) UnmuteMember(ctx context.Context, req *chatpb.UnmuteMemberRequest) (*chatpb.UnmuteMemberResponse, error) {
+	const op = "grpc.chat.UnmuteMember"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 || req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id and user_id are required")
+	}
+
+	log.Info("unmuting member", slog.Int64("chat_id", req.GetChatId()), slog.Int64("user_id", req.GetUserId()))
+
+	// 2. Делегируем вызов сервису
+	if err := s.chat.UnmuteMember(ctx, req.GetChatId(), req.GetUserId()); err != nil {
+		log.Error("failed to unmute member", slog.Any("err", err))
+		return nil, muteError(err, "failed to unmute member")
+	}
+
+	return &chatpb.UnmuteMemberResponse{}, nil
+}
+
+func (s *serverAPI) SetMemberRole(ctx context.Context, req *chatpb.SetMemberRoleRequest) (*chatpb.SetMemberRoleResponse, error) {
+	const op = "grpc.chat.SetMemberRole"
+	log := s.log.With(slog.String("op", op))
+
+	// 1. Валидация
+	if req.GetChatId() == 0 || req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "chat_id and user_id are required")
+	}
+	role := models.ChatRole(req.GetRole())
+	if role != models.RoleAdmin && role != models.RoleMember {
+		return nil, status.Errorf(codes.InvalidArgument, "role must be %q or %q", models.RoleAdmin, models.RoleMember)
+	}
+
+	log.Info("setting member role", slog.Int64("chat_id", req.GetChatId()), slog.Int64("user_id", req.GetUserId()), slog.String("role", string(role)))
+
+	// 2. Делегируем вызов сервису
+	if err := s.chat.SetMemberRole(ctx, req.GetChatId(), req.GetUserId(), role); err != nil {
+		log.Error("failed to set member role", slog.Any("err", err))
+		return nil, muteError(err, "failed to set member role")
+	}
+
+	return &chatpb.SetMemberRoleResponse{}, nil
+}
+
+// muteError переводит ошибки мутов и смены ролей в gRPC статусы.
+func muteError(err error, msg string) error {
+	switch {
+	case errors.Is(err, models.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, "missing user context")
+	case errors.Is(err, models.ErrAccessDenied):
+		return status.Error(codes.PermissionDenied, "access denied")
+	case errors.Is(err, models.ErrNotChatMember):
+		return status.Error(codes.NotFound, "user is not a chat member")
+	}
+	return status.Error(codes.Internal, msg)
+}
+
 // JoinChat для стриминга просто проксирует вызов в сервис.
 // Вся сложная логика стрима инкапсулирована в сервисе.
 func (s *serverAPI) JoinChat(stream chatpb.ChatService_JoinChatServer) error {
@@ -103,3 +912,129 @@ func (s *serverAPI) JoinChat(stream chatpb.ChatService_JoinChatServer) error {
 
 	return s.chat.JoinChat(stream)
 }
+
+// UploadAttachment принимает файл чанками: первое сообщение содержит info, далее - только chunk.
+func (s *serverAPI) UploadAttachment(stream chatpb.ChatService_UploadAttachmentServer) error {
+	const op = "grpc.chat.UploadAttachment"
+	log := s.log.With(slog.String("op", op))
+
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to receive attachment info: %v", err)
+	}
+
+	info := first.GetInfo()
+	if info.GetChatId() == 0 || info.GetName() == "" {
+		return status.Error(codes.InvalidArgument, "info with chat_id and name is required in the first message")
+	}
+	// Остальные чанки проверяет uploadReader, первый приходит вместе с info
+	if len(first.GetChunk()) > s.chunkSize {
+		return status.Errorf(codes.InvalidArgument, "chunk exceeds %d bytes", s.chunkSize)
+	}
+
+	log.Info("uploading attachment", slog.Int64("chat_id", info.GetChatId()))
+
+	r := &uploadReader{stream: stream, maxChunk: s.chunkSize, pending: first.GetChunk()}
+	attachment, err := s.attachments.Upload(stream.Context(), info.GetChatId(), info.GetName(), info.GetMimeType(), r)
+	if err != nil {
+		log.Error("failed to upload attachment", slog.Any("err", err))
+		if errors.Is(err, errChunkTooLarge) {
+			return status.Errorf(codes.InvalidArgument, "chunk exceeds %d bytes", s.chunkSize)
+		}
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			return status.Error(codes.Unauthenticated, "missing user context")
+		}
+		if errors.Is(err, models.ErrAccessDenied) {
+			return status.Error(codes.PermissionDenied, "access denied")
+		}
+		if errors.Is(err, models.ErrAttachmentTooLarge) {
+			return status.Error(codes.InvalidArgument, "attachment too large")
+		}
+		if errors.Is(err, models.ErrInvalidImage) {
+			return status.Error(codes.InvalidArgument, "image metadata is malformed")
+		}
+		return status.Error(codes.Internal, "failed to upload attachment")
+	}
+
+	return stream.SendAndClose(&chatpb.UploadAttachmentResponse{Attachment: attachment})
+}
+
+// DownloadAttachment отдает файл (или его превью, если указан thumbnail_id) чанками,
+// первое сообщение дополнительно содержит метаданные.
+func (s *serverAPI) DownloadAttachment(req *chatpb.DownloadAttachmentRequest, stream chatpb.ChatService_DownloadAttachmentServer) error {
+	const op = "grpc.chat.DownloadAttachment"
+	log := s.log.With(slog.String("op", op), slog.Int64("attachment_id", req.GetAttachmentId()))
+
+	if req.GetAttachmentId() == 0 {
+		return status.Error(codes.InvalidArgument, "attachment_id is required")
+	}
+
+	attachment, rc, err := s.attachments.Open(stream.Context(), req.GetAttachmentId(), req.GetThumbnailId())
+	if err != nil {
+		log.Error("failed to open attachment", slog.Any("err", err))
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			return status.Error(codes.Unauthenticated, "missing user context")
+		}
+		if errors.Is(err, models.ErrAttachmentNotFound) {
+			return status.Error(codes.NotFound, "attachment not found")
+		}
+		if errors.Is(err, models.ErrAccessDenied) {
+			return status.Error(codes.PermissionDenied, "access denied")
+		}
+		return status.Error(codes.Internal, "failed to download attachment")
+	}
+	defer rc.Close()
+
+	resp := &chatpb.DownloadAttachmentResponse{Attachment: attachment}
+	buf := make([]byte, s.chunkSize)
+	for {
+		n, err := rc.Read(buf)
+		if n > 0 {
+			resp.Chunk = buf[:n]
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+			resp = &chatpb.DownloadAttachmentResponse{}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Error("failed to read attachment", slog.Any("err", err))
+			return status.Error(codes.Internal, "failed to read attachment")
+		}
+	}
+
+	// Пустой файл: отправляем хотя бы метаданные
+	if resp.Attachment != nil {
+		return stream.Send(resp)
+	}
+
+	return nil
+}
+
+var errChunkTooLarge = errors.New("upload chunk too large")
+
+// uploadReader превращает клиентский стрим чанков в io.Reader.
+type uploadReader struct {
+	stream   chatpb.ChatService_UploadAttachmentServer
+	maxChunk int
+	pending  []byte
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err // io.EOF - клиент закончил передачу
+		}
+		if len(req.GetChunk()) > r.maxChunk {
+			return 0, errChunkTooLarge
+		}
+		r.pending = req.GetChunk()
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
@@ -1,11 +1,15 @@
 package chatgrpc
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"testing"
+	"time"
 
 	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
 	"github.com/grigory222/go-chat-server/internal/domain/models"
@@ -20,15 +24,179 @@ type fakeChatService struct {
 	histMsgs   []*chatpb.Message
 	histErr    error
 	joinErr    error
+	sendResp   *chatpb.Message
+	sendErr    error
+	searchRes  []*chatpb.SearchResult
+	searchErr  error
+	lastFilter models.SearchFilter
+	lastLimit  uint64
+	pinResp    *chatpb.Message
+	pinErr     error
+	pinnedMsgs []*chatpb.Message
+	schedResp  *chatpb.ScheduledMessage
+	schedErr   error
+	policy     *models.RetentionPolicy
+	policyErr  error
+	slowMode   time.Duration
+	slowErr    error
+
+	lastChatType string
+	subscribeErr error
+
+	moderation    *models.ModerationSettings
+	moderationErr error
+
+	reportErr      error
+	lastReason     string
+	lastStatus     models.ReportStatus
+	lastResolution models.Resolution
+	lastMuteFor    time.Duration
+
+	muteErr  error
+	unmuted  bool
+	lastRole models.ChatRole
 }
 
-func (f *fakeChatService) CreateChat(ctx context.Context, name string, userID int64) (*chatpb.Chat, error) {
+func (f *fakeChatService) GetSlowMode(ctx context.Context, chatID int64) (time.Duration, error) {
+	return f.slowMode, f.slowErr
+}
+func (f *fakeChatService) SetSlowMode(ctx context.Context, chatID int64, interval time.Duration) error {
+	if f.slowErr != nil {
+		return f.slowErr
+	}
+	f.slowMode = interval
+	return nil
+}
+
+func (f *fakeChatService) CreateChat(ctx context.Context, name, chatType string, userID int64) (*chatpb.Chat, error) {
+	f.lastChatType = chatType
 	return f.createResp, f.createErr
 }
+func (f *fakeChatService) SubscribeChannel(ctx context.Context, chatID int64) (*chatpb.Chat, error) {
+	if f.subscribeErr != nil {
+		return nil, f.subscribeErr
+	}
+	return &chatpb.Chat{Id: chatID, Type: models.ChatTypeChannel}, nil
+}
 func (f *fakeChatService) GetHistory(ctx context.Context, chatID int64, limit, offset uint64) ([]*chatpb.Message, error) {
 	return f.histMsgs, f.histErr
 }
 func (f *fakeChatService) JoinChat(stream chatpb.ChatService_JoinChatServer) error { return f.joinErr }
+func (f *fakeChatService) SendMessage(ctx context.Context, chatID int64, text, idempotencyKey string, attachmentIDs []int64, ttl time.Duration) (*chatpb.Message, error) {
+	return f.sendResp, f.sendErr
+}
+
+func (f *fakeChatService) SearchMessages(ctx context.Context, query string, filter models.SearchFilter, limit, offset uint64) ([]*chatpb.SearchResult, error) {
+	f.lastFilter, f.lastLimit = filter, limit
+	return f.searchRes, f.searchErr
+}
+
+func (f *fakeChatService) PinMessage(ctx context.Context, chatID, messageID int64) (*chatpb.Message, error) {
+	return f.pinResp, f.pinErr
+}
+func (f *fakeChatService) UnpinMessage(ctx context.Context, chatID, messageID int64) error {
+	return f.pinErr
+}
+func (f *fakeChatService) GetPinnedMessages(ctx context.Context, chatID int64) ([]*chatpb.Message, error) {
+	return f.pinnedMsgs, f.pinErr
+}
+
+func (f *fakeChatService) ScheduleMessage(ctx context.Context, chatID int64, text string, sendAt time.Time) (*chatpb.ScheduledMessage, error) {
+	return f.schedResp, f.schedErr
+}
+func (f *fakeChatService) ListScheduledMessages(ctx context.Context, chatID int64) ([]*chatpb.ScheduledMessage, error) {
+	if f.schedResp == nil {
+		return nil, f.schedErr
+	}
+	return []*chatpb.ScheduledMessage{f.schedResp}, f.schedErr
+}
+func (f *fakeChatService) UpdateScheduledMessage(ctx context.Context, id int64, text string, sendAt time.Time) (*chatpb.ScheduledMessage, error) {
+	return f.schedResp, f.schedErr
+}
+func (f *fakeChatService) CancelScheduledMessage(ctx context.Context, id int64) error {
+	return f.schedErr
+}
+
+func (f *fakeChatService) GetRetentionPolicy(ctx context.Context, chatID int64) (*chatpb.RetentionPolicy, error) {
+	return &chatpb.RetentionPolicy{ChatId: chatID}, f.policyErr
+}
+func (f *fakeChatService) SetRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) (*chatpb.RetentionPolicy, error) {
+	f.policy = policy
+	if f.policyErr != nil {
+		return nil, f.policyErr
+	}
+	return &chatpb.RetentionPolicy{ChatId: policy.ChatID, RetentionDays: int32(policy.RetentionDays), LegalHold: policy.LegalHold}, nil
+}
+
+func (f *fakeChatService) GetModerationSettings(ctx context.Context, chatID int64) (*chatpb.ModerationSettings, error) {
+	return &chatpb.ModerationSettings{ChatId: chatID}, f.moderationErr
+}
+func (f *fakeChatService) SetModerationSettings(ctx context.Context, settings *models.ModerationSettings) (*chatpb.ModerationSettings, error) {
+	f.moderation = settings
+	if f.moderationErr != nil {
+		return nil, f.moderationErr
+	}
+	return &chatpb.ModerationSettings{ChatId: settings.ChatID, MaxLength: int32(settings.MaxLength)}, nil
+}
+
+func (f *fakeChatService) ReportMessage(ctx context.Context, messageID int64, reason string) (*chatpb.Report, error) {
+	f.lastReason = reason
+	if f.reportErr != nil {
+		return nil, f.reportErr
+	}
+	return &chatpb.Report{Id: 1, MessageId: messageID, Reason: reason, Status: string(models.ReportOpen)}, nil
+}
+func (f *fakeChatService) ListReports(ctx context.Context, chatID int64, status models.ReportStatus, limit, offset uint64) ([]*chatpb.Report, error) {
+	f.lastStatus = status
+	f.lastLimit = limit
+	if f.reportErr != nil {
+		return nil, f.reportErr
+	}
+	return []*chatpb.Report{{Id: 1, ChatId: chatID}}, nil
+}
+func (f *fakeChatService) ClaimReport(ctx context.Context, reportID int64) (*chatpb.Report, error) {
+	if f.reportErr != nil {
+		return nil, f.reportErr
+	}
+	return &chatpb.Report{Id: reportID, Status: string(models.ReportClaimed)}, nil
+}
+func (f *fakeChatService) ResolveReport(ctx context.Context, reportID int64, resolution models.Resolution, muteFor time.Duration) (*chatpb.Report, error) {
+	f.lastResolution = resolution
+	f.lastMuteFor = muteFor
+	if f.reportErr != nil {
+		return nil, f.reportErr
+	}
+	return &chatpb.Report{Id: reportID, Status: string(models.ReportResolved), Resolution: string(resolution)}, nil
+}
+func (f *fakeChatService) ListModerationAudit(ctx context.Context, chatID int64, limit, offset uint64) ([]*chatpb.AuditEntry, error) {
+	f.lastLimit = limit
+	if f.reportErr != nil {
+		return nil, f.reportErr
+	}
+	return []*chatpb.AuditEntry{{Id: 1, ChatId: chatID, Action: models.AuditReportCreated}}, nil
+}
+
+func (f *fakeChatService) MuteMember(ctx context.Context, chatID, userID int64, duration time.Duration) (time.Time, error) {
+	f.lastMuteFor = duration
+	if f.muteErr != nil {
+		return time.Time{}, f.muteErr
+	}
+	return time.Unix(1000, 0).Add(duration), nil
+}
+func (f *fakeChatService) UnmuteMember(ctx context.Context, chatID, userID int64) error {
+	if f.muteErr != nil {
+		return f.muteErr
+	}
+	f.unmuted = true
+	return nil
+}
+func (f *fakeChatService) SetMemberRole(ctx context.Context, chatID, userID int64, role models.ChatRole) error {
+	if f.muteErr != nil {
+		return f.muteErr
+	}
+	f.lastRole = role
+	return nil
+}
 
 func logger() *slog.Logger { return slog.New(slog.NewTextHandler(os.Stdout, nil)) }
 
@@ -53,6 +221,54 @@ func TestCreateChatHandler(t *testing.T) {
 	if resp, err := api.CreateChat(ctx, &chatpb.CreateChatRequest{Name: "Gen"}); err != nil || resp.Chat.Name != "Gen" {
 		t.Fatalf("unexpected: %v %v", err, resp)
 	}
+	if api.chat.(*fakeChatService).lastChatType != models.ChatTypePublic {
+		t.Fatalf("chats must be public by default")
+	}
+	// Chat type
+	if _, err := api.CreateChat(ctx, &chatpb.CreateChatRequest{Name: "News", Type: "secret"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for unknown type")
+	}
+	if _, err := api.CreateChat(ctx, &chatpb.CreateChatRequest{Name: "News", Type: models.ChatTypeChannel}); err != nil || api.chat.(*fakeChatService).lastChatType != models.ChatTypeChannel {
+		t.Fatalf("expected channel to be created: %v", err)
+	}
+}
+
+func TestCreateChatRequiresVerifiedEmail(t *testing.T) {
+	api := &serverAPI{chat: &fakeChatService{createResp: &chatpb.Chat{Id: 1, Name: "Gen"}}, log: logger(), requireVerifiedEmail: true}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+	if _, err := api.CreateChat(ctx, &chatpb.CreateChatRequest{Name: "Gen"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected failed precondition, got %v", err)
+	}
+	ctx = context.WithValue(ctx, interceptors.EmailVerifiedKey, true)
+	if _, err := api.CreateChat(ctx, &chatpb.CreateChatRequest{Name: "Gen"}); err != nil {
+		t.Fatalf("verified user must create chats: %v", err)
+	}
+}
+
+func TestSubscribeChannelHandler(t *testing.T) {
+	fake := &fakeChatService{}
+	api := &serverAPI{chat: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+
+	if _, err := api.SubscribeChannel(ctx, &chatpb.SubscribeChannelRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing chat_id")
+	}
+	fake.subscribeErr = models.ErrNotChannel
+	if _, err := api.SubscribeChannel(ctx, &chatpb.SubscribeChannelRequest{ChatId: 3}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected failed precondition, got %v", err)
+	}
+	fake.subscribeErr = fmt.Errorf("wrapped: %w", models.ErrChatNotFound)
+	if _, err := api.SubscribeChannel(ctx, &chatpb.SubscribeChannelRequest{ChatId: 3}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	fake.subscribeErr = fmt.Errorf("wrapped: %w", models.ErrBannedFromChat)
+	if _, err := api.SubscribeChannel(ctx, &chatpb.SubscribeChannelRequest{ChatId: 3}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied for banned user, got %v", err)
+	}
+	fake.subscribeErr = nil
+	if resp, err := api.SubscribeChannel(ctx, &chatpb.SubscribeChannelRequest{ChatId: 3}); err != nil || resp.Chat.Id != 3 {
+		t.Fatalf("unexpected: %v %v", err, resp)
+	}
 }
 
 func TestGetHistoryHandler(t *testing.T) {
@@ -110,3 +326,600 @@ func TestJoinChatHandler(t *testing.T) {
 		t.Fatalf("expected error to be propagated")
 	}
 }
+
+func TestSendMessageHandler(t *testing.T) {
+	api := &serverAPI{chat: &fakeChatService{}, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+	// Invalid arguments
+	if _, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{Text: "hi"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing chat_id")
+	}
+	if _, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for empty text")
+	}
+	if _, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3, Text: "hi", TtlSeconds: -1}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for negative ttl")
+	}
+	// Attachment not usable
+	api.chat.(*fakeChatService).sendErr = models.ErrAttachmentNotFound
+	if _, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3, AttachmentIds: []int64{4}}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected failed precondition")
+	}
+	// Access denied
+	api.chat.(*fakeChatService).sendErr = models.ErrAccessDenied
+	if _, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3, Text: "hi"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied")
+	}
+	// Channel subscribers cannot post
+	api.chat.(*fakeChatService).sendErr = models.ErrReadOnlyChat
+	if _, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3, Text: "hi"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied for channel subscriber")
+	}
+	// Retry of a message that has already expired
+	api.chat.(*fakeChatService).sendErr = fmt.Errorf("wrapped: %w", models.ErrMessageNotFound)
+	if _, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3, Text: "hi", IdempotencyKey: "k"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected not found for a retry of an expired message, got %v", err)
+	}
+	// Rate limited
+	api.chat.(*fakeChatService).sendErr = fmt.Errorf("wrapped: %w", &models.RateLimitError{RetryAfter: time.Second})
+	if _, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3, Text: "hi"}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected resource exhausted, got %v", err)
+	}
+	api.chat.(*fakeChatService).sendErr = &models.SlowModeError{RetryAt: time.Now().Add(30 * time.Second)}
+	if _, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3, Text: "hi"}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected resource exhausted for slow mode, got %v", err)
+	}
+	// Rejected by chat filters
+	api.chat.(*fakeChatService).sendErr = fmt.Errorf("wrapped: %w", &models.MessageRejectedError{Reason: "message contains a banned word"})
+	_, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3, Text: "hi"})
+	if status.Code(err) != codes.InvalidArgument || status.Convert(err).Message() != "message rejected: message contains a banned word" {
+		t.Fatalf("expected invalid argument with reason, got %v", err)
+	}
+	// Muted by a moderator
+	api.chat.(*fakeChatService).sendErr = fmt.Errorf("wrapped: %w", &models.MutedError{Until: time.Now().Add(time.Hour)})
+	if _, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3, Text: "hi"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied for muted user, got %v", err)
+	}
+	// Internal
+	api.chat.(*fakeChatService).sendErr = errors.New("db")
+	if _, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3, Text: "hi"}); status.Code(err) != codes.Internal {
+		t.Fatalf("expected internal")
+	}
+	// Success
+	api.chat.(*fakeChatService).sendErr = nil
+	api.chat.(*fakeChatService).sendResp = &chatpb.Message{Id: 1, ChatId: 3, Text: "hi"}
+	if resp, err := api.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: 3, Text: "hi", IdempotencyKey: "k"}); err != nil || resp.Message.Id != 1 {
+		t.Fatalf("unexpected: %v %v", err, resp)
+	}
+}
+
+func TestSearchMessagesHandler(t *testing.T) {
+	fake := &fakeChatService{}
+	api := &serverAPI{chat: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+	// Invalid arguments
+	if _, err := api.SearchMessages(ctx, &chatpb.SearchMessagesRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for empty query")
+	}
+	if _, err := api.SearchMessages(ctx, &chatpb.SearchMessagesRequest{Query: "go", From: 20, To: 10}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for inverted range")
+	}
+	// Access denied
+	fake.searchErr = models.ErrAccessDenied
+	if _, err := api.SearchMessages(ctx, &chatpb.SearchMessagesRequest{Query: "go", ChatId: 3}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied")
+	}
+	// Internal
+	fake.searchErr = errors.New("db")
+	if _, err := api.SearchMessages(ctx, &chatpb.SearchMessagesRequest{Query: "go"}); status.Code(err) != codes.Internal {
+		t.Fatalf("expected internal")
+	}
+	// Success, filters are forwarded and limit is clamped
+	fake.searchErr = nil
+	fake.searchRes = []*chatpb.SearchResult{{Message: &chatpb.Message{Id: 1}, Snippet: "<b>go</b>"}}
+	resp, err := api.SearchMessages(ctx, &chatpb.SearchMessagesRequest{Query: "go", ChatId: 3, AuthorId: 7, From: 10, To: 20, Limit: 1000})
+	if err != nil || len(resp.Results) != 1 {
+		t.Fatalf("unexpected: %v %v", err, resp)
+	}
+	if fake.lastFilter.ChatID != 3 || fake.lastFilter.AuthorID != 7 || fake.lastFilter.From.Unix() != 10 || fake.lastFilter.To.Unix() != 20 {
+		t.Fatalf("filter not forwarded: %+v", fake.lastFilter)
+	}
+	if fake.lastLimit != 20 {
+		t.Fatalf("expected default limit 20, got %d", fake.lastLimit)
+	}
+}
+
+type fakeAttachmentService struct {
+	uploaded   []byte
+	uploadResp *chatpb.Attachment
+	uploadErr  error
+	openResp   *chatpb.Attachment
+	content    []byte
+	openErr    error
+}
+
+func (f *fakeAttachmentService) Upload(ctx context.Context, chatID int64, name, mimeType string, r io.Reader) (*chatpb.Attachment, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	f.uploaded = data
+	return f.uploadResp, f.uploadErr
+}
+func (f *fakeAttachmentService) Open(ctx context.Context, attachmentID, thumbnailID int64) (*chatpb.Attachment, io.ReadCloser, error) {
+	if f.openErr != nil {
+		return nil, nil, f.openErr
+	}
+	return f.openResp, io.NopCloser(bytes.NewReader(f.content)), nil
+}
+
+type fakeUploadStream struct {
+	chatpb.ChatService_UploadAttachmentServer
+	ctx   context.Context
+	queue []*chatpb.UploadAttachmentRequest
+	resp  *chatpb.UploadAttachmentResponse
+}
+
+func (f *fakeUploadStream) Context() context.Context { return f.ctx }
+func (f *fakeUploadStream) Recv() (*chatpb.UploadAttachmentRequest, error) {
+	if len(f.queue) == 0 {
+		return nil, io.EOF
+	}
+	r := f.queue[0]
+	f.queue = f.queue[1:]
+	return r, nil
+}
+func (f *fakeUploadStream) SendAndClose(r *chatpb.UploadAttachmentResponse) error {
+	f.resp = r
+	return nil
+}
+
+type fakeDownloadStream struct {
+	chatpb.ChatService_DownloadAttachmentServer
+	ctx  context.Context
+	sent []*chatpb.DownloadAttachmentResponse
+}
+
+func (f *fakeDownloadStream) Context() context.Context { return f.ctx }
+func (f *fakeDownloadStream) Send(r *chatpb.DownloadAttachmentResponse) error {
+	// Copy the chunk: the handler reuses its read buffer
+	f.sent = append(f.sent, &chatpb.DownloadAttachmentResponse{Attachment: r.Attachment, Chunk: append([]byte(nil), r.Chunk...)})
+	return nil
+}
+
+func TestUploadAttachmentHandler(t *testing.T) {
+	fake := &fakeAttachmentService{uploadResp: &chatpb.Attachment{Id: 9}}
+	api := &serverAPI{attachments: fake, log: logger(), chunkSize: 4}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+	info := &chatpb.AttachmentInfo{ChatId: 1, Name: "a.txt"}
+
+	// Missing info
+	stream := &fakeUploadStream{ctx: ctx, queue: []*chatpb.UploadAttachmentRequest{{Chunk: []byte("ab")}}}
+	if err := api.UploadAttachment(stream); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument, got %v", err)
+	}
+
+	// Chunk larger than allowed
+	stream = &fakeUploadStream{ctx: ctx, queue: []*chatpb.UploadAttachmentRequest{{Info: info}, {Chunk: []byte("too long")}}}
+	if err := api.UploadAttachment(stream); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for big chunk, got %v", err)
+	}
+	// The chunk sent along with info is limited too
+	stream = &fakeUploadStream{ctx: ctx, queue: []*chatpb.UploadAttachmentRequest{{Info: info, Chunk: []byte("too long")}}}
+	if err := api.UploadAttachment(stream); status.Code(err) != codes.InvalidArgument || fake.uploaded != nil {
+		t.Fatalf("expected invalid argument for big first chunk, got %v", err)
+	}
+
+	// Success: chunks from the first and following messages are concatenated
+	stream = &fakeUploadStream{ctx: ctx, queue: []*chatpb.UploadAttachmentRequest{{Info: info, Chunk: []byte("he")}, {Chunk: []byte("llo")}}}
+	if err := api.UploadAttachment(stream); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(fake.uploaded) != "hello" || stream.resp.Attachment.Id != 9 {
+		t.Fatalf("unexpected upload: %q %+v", fake.uploaded, stream.resp)
+	}
+
+	// Service errors
+	for err, code := range map[error]codes.Code{
+		models.ErrAccessDenied:       codes.PermissionDenied,
+		models.ErrAttachmentTooLarge: codes.InvalidArgument,
+		models.ErrInvalidImage:       codes.InvalidArgument,
+		errors.New("disk"):           codes.Internal,
+	} {
+		fake.uploadErr = err
+		stream = &fakeUploadStream{ctx: ctx, queue: []*chatpb.UploadAttachmentRequest{{Info: info}}}
+		if got := api.UploadAttachment(stream); status.Code(got) != code {
+			t.Fatalf("expected %v for %v, got %v", code, err, got)
+		}
+	}
+}
+
+func TestDownloadAttachmentHandler(t *testing.T) {
+	fake := &fakeAttachmentService{openResp: &chatpb.Attachment{Id: 9, Name: "a.txt"}, content: []byte("hello")}
+	api := &serverAPI{attachments: fake, log: logger(), chunkSize: 2}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+
+	if err := api.DownloadAttachment(&chatpb.DownloadAttachmentRequest{}, &fakeDownloadStream{ctx: ctx}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument")
+	}
+
+	stream := &fakeDownloadStream{ctx: ctx}
+	if err := api.DownloadAttachment(&chatpb.DownloadAttachmentRequest{AttachmentId: 9}, stream); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []byte
+	for _, r := range stream.sent {
+		got = append(got, r.Chunk...)
+	}
+	if string(got) != "hello" || len(stream.sent) != 3 {
+		t.Fatalf("unexpected chunks: %q in %d messages", got, len(stream.sent))
+	}
+	if stream.sent[0].Attachment.GetId() != 9 || stream.sent[1].Attachment != nil {
+		t.Fatalf("metadata must be sent only in the first message")
+	}
+
+	// Empty file still returns metadata
+	fake.content = nil
+	stream = &fakeDownloadStream{ctx: ctx}
+	if err := api.DownloadAttachment(&chatpb.DownloadAttachmentRequest{AttachmentId: 9}, stream); err != nil || len(stream.sent) != 1 {
+		t.Fatalf("expected metadata for empty file: %v %d", err, len(stream.sent))
+	}
+
+	for err, code := range map[error]codes.Code{
+		models.ErrAttachmentNotFound: codes.NotFound,
+		models.ErrAccessDenied:       codes.PermissionDenied,
+		errors.New("disk"):           codes.Internal,
+	} {
+		fake.openErr = err
+		if got := api.DownloadAttachment(&chatpb.DownloadAttachmentRequest{AttachmentId: 9}, &fakeDownloadStream{ctx: ctx}); status.Code(got) != code {
+			t.Fatalf("expected %v for %v, got %v", code, err, got)
+		}
+	}
+}
+
+func TestPinMessageHandlers(t *testing.T) {
+	fake := &fakeChatService{}
+	api := &serverAPI{chat: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+	// Invalid arguments
+	if _, err := api.PinMessage(ctx, &chatpb.PinMessageRequest{ChatId: 3}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing message_id")
+	}
+	if _, err := api.UnpinMessage(ctx, &chatpb.UnpinMessageRequest{MessageId: 7}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing chat_id")
+	}
+	if _, err := api.GetPinnedMessages(ctx, &chatpb.GetPinnedMessagesRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing chat_id")
+	}
+	// Error mapping
+	cases := []struct {
+		err  error
+		code codes.Code
+	}{
+		{models.ErrAccessDenied, codes.PermissionDenied},
+		{models.ErrMessageNotFound, codes.NotFound},
+		{models.ErrPinLimitReached, codes.FailedPrecondition},
+		{errors.New("db"), codes.Internal},
+	}
+	for _, c := range cases {
+		fake.pinErr = c.err
+		if _, err := api.PinMessage(ctx, &chatpb.PinMessageRequest{ChatId: 3, MessageId: 7}); status.Code(err) != c.code {
+			t.Fatalf("pin: expected %v for %v, got %v", c.code, c.err, err)
+		}
+		if _, err := api.UnpinMessage(ctx, &chatpb.UnpinMessageRequest{ChatId: 3, MessageId: 7}); status.Code(err) != c.code {
+			t.Fatalf("unpin: expected %v for %v, got %v", c.code, c.err, err)
+		}
+	}
+	// Success
+	fake.pinErr = nil
+	fake.pinResp = &chatpb.Message{Id: 7, ChatId: 3, Pinned: true}
+	fake.pinnedMsgs = []*chatpb.Message{fake.pinResp}
+	if resp, err := api.PinMessage(ctx, &chatpb.PinMessageRequest{ChatId: 3, MessageId: 7}); err != nil || !resp.Message.Pinned {
+		t.Fatalf("unexpected: %v %v", err, resp)
+	}
+	if resp, err := api.GetPinnedMessages(ctx, &chatpb.GetPinnedMessagesRequest{ChatId: 3}); err != nil || len(resp.Messages) != 1 {
+		t.Fatalf("unexpected: %v %v", err, resp)
+	}
+}
+
+func TestScheduledMessageHandlers(t *testing.T) {
+	fake := &fakeChatService{}
+	api := &serverAPI{chat: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+	future := time.Now().Add(time.Hour).Unix()
+
+	// Invalid arguments
+	if _, err := api.ScheduleMessage(ctx, &chatpb.ScheduleMessageRequest{Text: "hi", SendAt: future}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing chat_id")
+	}
+	if _, err := api.ScheduleMessage(ctx, &chatpb.ScheduleMessageRequest{ChatId: 3, SendAt: future}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for empty text")
+	}
+	if _, err := api.ScheduleMessage(ctx, &chatpb.ScheduleMessageRequest{ChatId: 3, Text: "hi", SendAt: time.Now().Add(-time.Minute).Unix()}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for past send_at")
+	}
+	if _, err := api.UpdateScheduledMessage(ctx, &chatpb.UpdateScheduledMessageRequest{Text: "hi", SendAt: future}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing id")
+	}
+	if _, err := api.CancelScheduledMessage(ctx, &chatpb.CancelScheduledMessageRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing id")
+	}
+
+	// Error mapping
+	fake.schedErr = models.ErrAccessDenied
+	if _, err := api.ScheduleMessage(ctx, &chatpb.ScheduleMessageRequest{ChatId: 3, Text: "hi", SendAt: future}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+	fake.schedErr = models.ErrScheduledNotFound
+	if _, err := api.UpdateScheduledMessage(ctx, &chatpb.UpdateScheduledMessageRequest{Id: 1, Text: "hi", SendAt: future}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if _, err := api.CancelScheduledMessage(ctx, &chatpb.CancelScheduledMessageRequest{Id: 1}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	fake.schedErr = errors.New("db")
+	if _, err := api.ListScheduledMessages(ctx, &chatpb.ListScheduledMessagesRequest{}); status.Code(err) != codes.Internal {
+		t.Fatalf("expected internal, got %v", err)
+	}
+
+	// Success
+	fake.schedErr = nil
+	fake.schedResp = &chatpb.ScheduledMessage{Id: 1, ChatId: 3, Text: "hi", SendAt: future}
+	if resp, err := api.ScheduleMessage(ctx, &chatpb.ScheduleMessageRequest{ChatId: 3, Text: "hi", SendAt: future}); err != nil || resp.ScheduledMessage.Id != 1 {
+		t.Fatalf("unexpected: %v %v", err, resp)
+	}
+	if resp, err := api.ListScheduledMessages(ctx, &chatpb.ListScheduledMessagesRequest{ChatId: 3}); err != nil || len(resp.ScheduledMessages) != 1 {
+		t.Fatalf("unexpected: %v %v", err, resp)
+	}
+}
+
+func TestRetentionPolicyHandlers(t *testing.T) {
+	fake := &fakeChatService{}
+	api := &serverAPI{chat: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+
+	// Invalid arguments
+	if _, err := api.GetRetentionPolicy(ctx, &chatpb.GetRetentionPolicyRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing chat_id")
+	}
+	if _, err := api.SetRetentionPolicy(ctx, &chatpb.SetRetentionPolicyRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing policy")
+	}
+	if _, err := api.SetRetentionPolicy(ctx, &chatpb.SetRetentionPolicyRequest{Policy: &chatpb.RetentionPolicy{ChatId: 3, RetentionDays: -1}}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for negative retention")
+	}
+
+	// Error mapping
+	fake.policyErr = models.ErrAccessDenied
+	if _, err := api.SetRetentionPolicy(ctx, &chatpb.SetRetentionPolicyRequest{Policy: &chatpb.RetentionPolicy{ChatId: 3, RetentionDays: 30}}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+	fake.policyErr = models.ErrChatNotFound
+	if _, err := api.GetRetentionPolicy(ctx, &chatpb.GetRetentionPolicyRequest{ChatId: 3}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	// Success
+	fake.policyErr = nil
+	resp, err := api.SetRetentionPolicy(ctx, &chatpb.SetRetentionPolicyRequest{Policy: &chatpb.RetentionPolicy{ChatId: 3, RetentionDays: 30, LegalHold: true}})
+	if err != nil || resp.Policy.RetentionDays != 30 || !fake.policy.LegalHold {
+		t.Fatalf("unexpected: %v %v", err, resp)
+	}
+}
+
+func TestSlowModeHandlers(t *testing.T) {
+	fake := &fakeChatService{}
+	api := &serverAPI{chat: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+
+	// Invalid arguments
+	if _, err := api.GetSlowMode(ctx, &chatpb.GetSlowModeRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing chat_id")
+	}
+	if _, err := api.SetSlowMode(ctx, &chatpb.SetSlowModeRequest{ChatId: 3, Seconds: -1}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for negative interval")
+	}
+	if _, err := api.SetSlowMode(ctx, &chatpb.SetSlowModeRequest{ChatId: 3, Seconds: 90000}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for too long interval")
+	}
+
+	// Error mapping
+	fake.slowErr = models.ErrAccessDenied
+	if _, err := api.SetSlowMode(ctx, &chatpb.SetSlowModeRequest{ChatId: 3, Seconds: 30}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+
+	// Success
+	fake.slowErr = nil
+	if _, err := api.SetSlowMode(ctx, &chatpb.SetSlowModeRequest{ChatId: 3, Seconds: 30}); err != nil || fake.slowMode != 30*time.Second {
+		t.Fatalf("unexpected: %v %v", err, fake.slowMode)
+	}
+	resp, err := api.GetSlowMode(ctx, &chatpb.GetSlowModeRequest{ChatId: 3})
+	if err != nil || resp.Seconds != 30 {
+		t.Fatalf("unexpected: %v %v", err, resp)
+	}
+}
+
+func TestModerationSettingsHandlers(t *testing.T) {
+	fake := &fakeChatService{}
+	api := &serverAPI{chat: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+
+	// Invalid arguments
+	if _, err := api.GetModerationSettings(ctx, &chatpb.GetModerationSettingsRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing chat_id")
+	}
+	invalid := []*chatpb.ModerationSettings{
+		{},
+		{ChatId: 3, MaxLength: -1},
+		{ChatId: 3, BannedWordsAction: "ban"},
+		{ChatId: 3, BannedWords: []string{"two words"}},
+		{ChatId: 3, Rules: []*chatpb.FilterRule{{Pattern: "("}}},
+		{ChatId: 3, Rules: []*chatpb.FilterRule{{Pattern: "x", Action: "delete"}}},
+		{ChatId: 3, Rules: make([]*chatpb.FilterRule, maxFilterRules+1)},
+	}
+	for i, settings := range invalid {
+		if _, err := api.SetModerationSettings(ctx, &chatpb.SetModerationSettingsRequest{Settings: settings}); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("case %d: expected invalid argument, got %v", i, err)
+		}
+	}
+	if fake.moderation != nil {
+		t.Fatalf("invalid settings must not reach the service")
+	}
+
+	// Error mapping
+	fake.moderationErr = models.ErrAccessDenied
+	req := &chatpb.SetModerationSettingsRequest{Settings: &chatpb.ModerationSettings{
+		ChatId:            3,
+		BannedWords:       []string{"spam"},
+		BannedWordsAction: "replace",
+		Rules:             []*chatpb.FilterRule{{Pattern: `\d{16}`, Action: "replace", Replacement: "[card]"}},
+		BlockLinks:        true,
+		MaxLength:         500,
+	}}
+	if _, err := api.SetModerationSettings(ctx, req); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+
+	// Success
+	fake.moderationErr = nil
+	resp, err := api.SetModerationSettings(ctx, req)
+	if err != nil || resp.Settings.MaxLength != 500 {
+		t.Fatalf("unexpected: %v %v", err, resp)
+	}
+	got := fake.moderation
+	if got.BannedWordsAction != models.FilterReplace || len(got.Rules) != 1 || got.Rules[0].Replacement != "[card]" || !got.BlockLinks {
+		t.Fatalf("settings not passed to service: %+v", got)
+	}
+}
+
+func TestReportHandlers(t *testing.T) {
+	fake := &fakeChatService{}
+	api := &serverAPI{chat: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+
+	// Invalid arguments
+	if _, err := api.ReportMessage(ctx, &chatpb.ReportMessageRequest{Reason: "spam"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing message_id")
+	}
+	if _, err := api.ReportMessage(ctx, &chatpb.ReportMessageRequest{MessageId: 7, Reason: "   "}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for empty reason")
+	}
+	if _, err := api.ListReports(ctx, &chatpb.ListReportsRequest{Status: "closed"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for unknown status")
+	}
+	if _, err := api.ClaimReport(ctx, &chatpb.ClaimReportRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing report_id")
+	}
+	if _, err := api.ResolveReport(ctx, &chatpb.ResolveReportRequest{ReportId: 1, Resolution: "warn"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for unknown resolution")
+	}
+	if _, err := api.ResolveReport(ctx, &chatpb.ResolveReportRequest{ReportId: 1, Resolution: "mute_user"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for mute without duration")
+	}
+
+	// Success
+	resp, err := api.ReportMessage(ctx, &chatpb.ReportMessageRequest{MessageId: 7, Reason: "  spam  "})
+	if err != nil || resp.Report.MessageId != 7 || fake.lastReason != "spam" {
+		t.Fatalf("unexpected: %v %v %q", err, resp, fake.lastReason)
+	}
+	if _, err := api.ListReports(ctx, &chatpb.ListReportsRequest{Status: "claimed", Limit: 1000}); err != nil || fake.lastStatus != models.ReportClaimed || fake.lastLimit != 50 {
+		t.Fatalf("unexpected list: %v status=%q limit=%d", err, fake.lastStatus, fake.lastLimit)
+	}
+	if _, err := api.ResolveReport(ctx, &chatpb.ResolveReportRequest{ReportId: 1, Resolution: "mute_user", MuteSeconds: 600}); err != nil ||
+		fake.lastResolution != models.ResolutionMuteUser || fake.lastMuteFor != 10*time.Minute {
+		t.Fatalf("unexpected resolve: %v %q %v", err, fake.lastResolution, fake.lastMuteFor)
+	}
+	if audit, err := api.ListModerationAudit(ctx, &chatpb.ListModerationAuditRequest{ChatId: 3}); err != nil || len(audit.Entries) != 1 {
+		t.Fatalf("unexpected audit: %v %v", err, audit)
+	}
+
+	// Error mapping
+	cases := []struct {
+		err  error
+		code codes.Code
+	}{
+		{models.ErrAccessDenied, codes.PermissionDenied},
+		{models.ErrMessageNotFound, codes.NotFound},
+		{models.ErrReportNotFound, codes.NotFound},
+		{models.ErrReportExists, codes.AlreadyExists},
+		{models.ErrReportClaimed, codes.FailedPrecondition},
+		{models.ErrReportResolved, codes.FailedPrecondition},
+		{models.ErrNotChatMember, codes.FailedPrecondition},
+		{errors.New("db"), codes.Internal},
+	}
+	for _, tc := range cases {
+		fake.reportErr = fmt.Errorf("wrapped: %w", tc.err)
+		if _, err := api.ClaimReport(ctx, &chatpb.ClaimReportRequest{ReportId: 1}); status.Code(err) != tc.code {
+			t.Fatalf("%v: expected %v, got %v", tc.err, tc.code, err)
+		}
+	}
+}
+
+func TestMuteHandlers(t *testing.T) {
+	fake := &fakeChatService{}
+	api := &serverAPI{chat: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+
+	// Invalid arguments
+	invalid := []*chatpb.MuteMemberRequest{
+		{UserId: 7, Seconds: 60},
+		{ChatId: 3, Seconds: 60},
+		{ChatId: 3, UserId: 7},
+		{ChatId: 3, UserId: 7, Seconds: int64(maxMuteDuration/time.Second) + 1},
+	}
+	for i, req := range invalid {
+		if _, err := api.MuteMember(ctx, req); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("case %d: expected invalid argument, got %v", i, err)
+		}
+	}
+	if _, err := api.UnmuteMember(ctx, &chatpb.UnmuteMemberRequest{ChatId: 3}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected invalid argument for missing user_id")
+	}
+
+	// Success
+	resp, err := api.MuteMember(ctx, &chatpb.MuteMemberRequest{ChatId: 3, UserId: 7, Seconds: 60})
+	if err != nil || resp.MutedUntil != 1060 || fake.lastMuteFor != time.Minute {
+		t.Fatalf("unexpected: %v %v", err, resp)
+	}
+	if _, err := api.UnmuteMember(ctx, &chatpb.UnmuteMemberRequest{ChatId: 3, UserId: 7}); err != nil || !fake.unmuted {
+		t.Fatalf("unexpected unmute: %v", err)
+	}
+
+	// Error mapping
+	fake.muteErr = fmt.Errorf("wrapped: %w", models.ErrAccessDenied)
+	if _, err := api.MuteMember(ctx, &chatpb.MuteMemberRequest{ChatId: 3, UserId: 7, Seconds: 60}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+	fake.muteErr = fmt.Errorf("wrapped: %w", models.ErrNotChatMember)
+	if _, err := api.UnmuteMember(ctx, &chatpb.UnmuteMemberRequest{ChatId: 3, UserId: 7}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestSetMemberRoleHandler(t *testing.T) {
+	fake := &fakeChatService{}
+	api := &serverAPI{chat: fake, log: logger()}
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+
+	invalid := []*chatpb.SetMemberRoleRequest{
+		{UserId: 7, Role: "admin"},
+		{ChatId: 3, Role: "admin"},
+		{ChatId: 3, UserId: 7},
+		{ChatId: 3, UserId: 7, Role: "owner"},
+	}
+	for i, req := range invalid {
+		if _, err := api.SetMemberRole(ctx, req); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("case %d: expected invalid argument, got %v", i, err)
+		}
+	}
+
+	if _, err := api.SetMemberRole(ctx, &chatpb.SetMemberRoleRequest{ChatId: 3, UserId: 7, Role: "admin"}); err != nil || fake.lastRole != models.RoleAdmin {
+		t.Fatalf("unexpected: %v %v", err, fake.lastRole)
+	}
+
+	fake.muteErr = fmt.Errorf("wrapped: %w", models.ErrAccessDenied)
+	if _, err := api.SetMemberRole(ctx, &chatpb.SetMemberRoleRequest{ChatId: 3, UserId: 7, Role: "member"}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+}
@@ -15,10 +15,17 @@ import (
 // userCtxKey - это ключ для хранения ID пользователя в контексте.
 type userCtxKey string
 
-const UserIDKey = userCtxKey("userID")
+const (
+	UserIDKey = userCtxKey("userID")
+	// SessionIDKey - ключ для ID сессии входа, к которой относится access токен.
+	SessionIDKey = userCtxKey("sessionID")
+	// EmailVerifiedKey - подтвержден ли email пользователя на момент выдачи access токена.
+	EmailVerifiedKey = userCtxKey("emailVerified")
+)
 
 // NewAuthInterceptor создает новый gRPC перехватчик для аутентификации.
-func NewAuthInterceptor(log *slog.Logger, jwtSecret string) grpc.UnaryServerInterceptor {
+// Если sessions не nil, запросы отозванных сессий отклоняются.
+func NewAuthInterceptor(log *slog.Logger, keys *auth.KeySet, sessions *Sessions) grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context,
 		req interface{},
@@ -31,6 +38,17 @@ func NewAuthInterceptor(log *slog.Logger, jwtSecret string) grpc.UnaryServerInte
 			"/chat.AuthService/Login":        true,
 			"/chat.AuthService/Register":     true,
 			"/chat.AuthService/RefreshToken": true,
+			// Сброс пароля нужен как раз тем, кто не может войти
+			"/chat.AuthService/RequestPasswordReset": true,
+			"/chat.AuthService/ConfirmPasswordReset": true,
+			// Подтверждение email может быть обязательным для входа
+			"/chat.AuthService/VerifyEmail":             true,
+			"/chat.AuthService/ResendVerificationEmail": true,
+			// Второй шаг входа: вместо access токена - токен из ответа Login
+			"/chat.AuthService/VerifyMFA": true,
+			// Вход через OpenID провайдера
+			"/chat.AuthService/StartOIDCLogin":  true,
+			"/chat.AuthService/FinishOIDCLogin": true,
 		}
 
 		// Если вызываемый метод публичный, просто пропускаем проверку
@@ -56,22 +74,31 @@ func NewAuthInterceptor(log *slog.Logger, jwtSecret string) grpc.UnaryServerInte
 		}
 		token := strings.TrimPrefix(header, "Bearer ")
 
-		// Валидируем токен
-		userID, err := auth.GetUserID(token, []byte(jwtSecret))
+		// Валидируем токен: refresh токен здесь не принимается
+		claims, err := auth.ParseAccessToken(token, keys)
 		if err != nil {
 			log.Warn("failed to verify token", slog.Any("err", err))
 			return nil, status.Error(codes.Unauthenticated, "invalid access token")
 		}
 
+		if err := sessions.check(ctx, log, claims.SessionID); err != nil {
+			return nil, err
+		}
+
+		userID := claims.UserID
 		log.Debug("user authenticated", slog.Int64("user_id", userID))
 
 		ctx = context.WithValue(ctx, UserIDKey, userID)
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+		ctx = context.WithValue(ctx, EmailVerifiedKey, claims.EmailVerified)
 
 		return handler(ctx, req)
 	}
 }
 
-func NewAuthStreamInterceptor(log *slog.Logger, jwtSecret string) grpc.StreamServerInterceptor {
+// NewAuthStreamInterceptor создает перехватчик аутентификации для стримов.
+// Если sessions не nil, стрим отозванной сессии не открывается, а уже открытый закрывается при отзыве.
+func NewAuthStreamInterceptor(log *slog.Logger, keys *auth.KeySet, sessions *Sessions) grpc.StreamServerInterceptor {
 	return func(
 		srv interface{},
 		ss grpc.ServerStream,
@@ -99,24 +126,77 @@ func NewAuthStreamInterceptor(log *slog.Logger, jwtSecret string) grpc.StreamSer
 		}
 		token := strings.TrimPrefix(header, "Bearer ")
 
-		// 2. Валидируем токен
-		userID, err := auth.GetUserID(token, []byte(jwtSecret))
+		// 2. Валидируем токен: refresh токен здесь не принимается
+		claims, err := auth.ParseAccessToken(token, keys)
 		if err != nil {
 			log.Warn("failed to verify stream token", slog.Any("err", err))
 			return status.Error(codes.Unauthenticated, "invalid access token")
 		}
 
+		// Стрим регистрируется до проверки сессии, чтобы не пропустить отзыв между ними
+		var revoked <-chan struct{}
+		if sessions != nil && sessions.Streams != nil {
+			var untrack func()
+			revoked, untrack = sessions.Streams.track(claims.SessionID)
+			defer untrack()
+		}
+		if err := sessions.check(ss.Context(), log, claims.SessionID); err != nil {
+			return err
+		}
+
+		userID := claims.UserID
 		log.Debug("user authenticated for stream", slog.Int64("user_id", userID))
 
 		// 3. Оборачиваем серверный стрим, чтобы внедрить новый контекст с userID
+		ctx, cancel := context.WithCancel(ss.Context())
+		defer cancel()
+		ctx = context.WithValue(ctx, UserIDKey, userID)
+		ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+		ctx = context.WithValue(ctx, EmailVerifiedKey, claims.EmailVerified)
 		wrappedStream := &wrappedServerStream{
 			ServerStream: ss,
-			ctx:          context.WithValue(ss.Context(), UserIDKey, userID),
+			ctx:          ctx,
 		}
 
 		// 4. Вызываем следующий обработчик с обернутым стримом
-		return handler(srv, wrappedStream)
+		if revoked == nil {
+			return handler(srv, wrappedStream)
+		}
+
+		// При отзыве сессии отменяем контекст обработчика и дожидаемся его возврата:
+		// после завершения RPC стрим использовать нельзя, поэтому обработчик и его
+		// горутины должны выходить по ctx.Done(), а не ждать Recv
+		done := make(chan error, 1)
+		go func() { done <- handler(srv, wrappedStream) }()
+
+		select {
+		case err := <-done:
+			return err
+		case <-revoked:
+			log.Info("stream closed: session revoked", slog.Int64("user_id", userID))
+			cancel()
+			<-done
+			return status.Error(codes.Unauthenticated, "session revoked")
+		}
+	}
+}
+
+// check отклоняет сессию, отозванную после выдачи токена.
+func (s *Sessions) check(ctx context.Context, log *slog.Logger, sessionID string) error {
+	if s == nil || s.Checker == nil {
+		return nil
 	}
+
+	active, err := s.Checker.SessionActive(ctx, sessionID)
+	if err != nil {
+		log.Error("failed to check session", slog.Any("err", err))
+		return status.Error(codes.Internal, "internal error")
+	}
+	if !active {
+		return status.Error(codes.Unauthenticated, "session revoked")
+	}
+
+	return nil
 }
 
 // wrappedServerStream - это обертка над grpc.ServerStream,
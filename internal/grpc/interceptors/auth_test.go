@@ -2,30 +2,36 @@ package interceptors
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"log/slog"
 	"os"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
 	authsvc "github.com/grigory222/go-chat-server/internal/services/auth"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func logger() *slog.Logger { return slog.New(slog.NewTextHandler(os.Stdout, nil)) }
 
 func makeToken(secret []byte, uid int64, ttl time.Duration) string {
-	claims := authsvc.Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl))}, UserID: uid}
-	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	s, _ := tok.SignedString(secret)
-	return s
+	tokens, _ := authsvc.NewTokens(&models.User{ID: uid}, "session", ttl, ttl, authsvc.NewHMACKeySet(string(secret)))
+	return tokens.AccessToken
+}
+
+func makeRefreshToken(secret []byte, uid int64, ttl time.Duration) string {
+	tokens, _ := authsvc.NewTokens(&models.User{ID: uid}, "session", ttl, ttl, authsvc.NewHMACKeySet(string(secret)))
+	return tokens.RefreshToken
 }
 
 func TestUnaryAuthInterceptor_PublicMethodsBypass(t *testing.T) {
 	secret := "secret"
-	interceptor := NewAuthInterceptor(logger(), secret)
+	interceptor := NewAuthInterceptor(logger(), authsvc.NewHMACKeySet(secret), nil)
 	called := false
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) { called = true; return "ok", nil }
 	// No metadata, but method is public
@@ -37,7 +43,7 @@ func TestUnaryAuthInterceptor_PublicMethodsBypass(t *testing.T) {
 
 func TestUnaryAuthInterceptor_ErrorsAndSuccess(t *testing.T) {
 	secret := "secret"
-	interceptor := NewAuthInterceptor(logger(), secret)
+	interceptor := NewAuthInterceptor(logger(), authsvc.NewHMACKeySet(secret), nil)
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
 		// Ensure user id exists
 		if _, ok := ctx.Value(UserIDKey).(int64); !ok {
@@ -65,6 +71,13 @@ func TestUnaryAuthInterceptor_ErrorsAndSuccess(t *testing.T) {
 		t.Fatalf("expected invalid token error")
 	}
 
+	// Refresh token is not a bearer token
+	md = metadata.New(map[string]string{"authorization": "Bearer " + makeRefreshToken([]byte(secret), 77, time.Hour)})
+	ctx = metadata.NewIncomingContext(context.Background(), md)
+	if _, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/chat.ChatService/CreateChat"}, handler); err == nil {
+		t.Fatalf("expected refresh token to be rejected")
+	}
+
 	// Valid token
 	token := makeToken([]byte(secret), 77, time.Minute)
 	md = metadata.New(map[string]string{"authorization": "Bearer " + token})
@@ -84,7 +97,7 @@ func (f *fakeServerStream) Context() context.Context { return f.ctx }
 
 func TestStreamAuthInterceptor(t *testing.T) {
 	secret := "secret"
-	interceptor := NewAuthStreamInterceptor(logger(), secret)
+	interceptor := NewAuthStreamInterceptor(logger(), authsvc.NewHMACKeySet(secret), nil)
 	var gotUID int64
 	handler := func(srv interface{}, ss grpc.ServerStream) error {
 		gotUID, _ = ss.Context().Value(UserIDKey).(int64)
@@ -108,6 +121,12 @@ func TestStreamAuthInterceptor(t *testing.T) {
 		t.Fatalf("expected error invalid token")
 	}
 
+	// Refresh token is not a bearer token
+	md = metadata.New(map[string]string{"authorization": "Bearer " + makeRefreshToken([]byte(secret), 101, time.Hour)})
+	if err := interceptor(nil, &fakeServerStream{ctx: metadata.NewIncomingContext(context.Background(), md)}, &grpc.StreamServerInfo{FullMethod: "/chat.ChatService/JoinChat"}, handler); err == nil {
+		t.Fatalf("expected refresh token to be rejected")
+	}
+
 	// Valid token
 	token := makeToken([]byte(secret), 101, time.Minute)
 	md = metadata.New(map[string]string{"authorization": "Bearer " + token})
@@ -118,3 +137,79 @@ func TestStreamAuthInterceptor(t *testing.T) {
 		t.Fatalf("expected uid 101, got %d", gotUID)
 	}
 }
+
+type fakeSessionChecker struct {
+	revoked map[string]bool
+}
+
+func (f *fakeSessionChecker) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	return !f.revoked[sessionID], nil
+}
+
+func TestUnaryAuthInterceptor_RevokedSession(t *testing.T) {
+	secret := "secret"
+	checker := &fakeSessionChecker{revoked: map[string]bool{}}
+	interceptor := NewAuthInterceptor(logger(), authsvc.NewHMACKeySet(secret), &Sessions{Checker: checker})
+	var gotSession string
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		gotSession, _ = ctx.Value(SessionIDKey).(string)
+		return "ok", nil
+	}
+	md := metadata.New(map[string]string{"authorization": "Bearer " + makeToken([]byte(secret), 77, time.Minute)})
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	info := &grpc.UnaryServerInfo{FullMethod: "/chat.ChatService/CreateChat"}
+
+	if _, err := interceptor(ctx, nil, info, handler); err != nil || gotSession != "session" {
+		t.Fatalf("active session must pass with its id in context: %v %q", err, gotSession)
+	}
+
+	checker.revoked["session"] = true
+	_, err := interceptor(ctx, nil, info, handler)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected unauthenticated for revoked session, got %v", err)
+	}
+}
+
+func TestStreamAuthInterceptor_ClosedOnRevoke(t *testing.T) {
+	secret := "secret"
+	checker := &fakeSessionChecker{revoked: map[string]bool{}}
+	streams := NewSessionStreams()
+	interceptor := NewAuthStreamInterceptor(logger(), authsvc.NewHMACKeySet(secret), &Sessions{Checker: checker, Streams: streams})
+	md := metadata.New(map[string]string{"authorization": "Bearer " + makeToken([]byte(secret), 101, time.Minute)})
+	ss := &fakeServerStream{ctx: metadata.NewIncomingContext(context.Background(), md)}
+	info := &grpc.StreamServerInfo{FullMethod: "/chat.ChatService/JoinChat"}
+
+	// The handler waits like JoinChat until its context is cancelled
+	started := make(chan struct{})
+	var handlerDone atomic.Bool
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		close(started)
+		<-ss.Context().Done()
+		handlerDone.Store(true)
+		return ss.Context().Err()
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- interceptor(nil, ss, info, handler) }()
+	<-started
+
+	streams.CloseSession("session")
+	select {
+	case err := <-result:
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("expected unauthenticated after revoke, got %v", err)
+		}
+		// The stream must not be used after the interceptor returns
+		if !handlerDone.Load() {
+			t.Fatalf("interceptor returned before the handler")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("stream was not closed on revoke")
+	}
+
+	// A revoked session cannot open a new stream
+	checker.revoked["session"] = true
+	if err := interceptor(nil, ss, info, handler); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected unauthenticated for revoked session, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package interceptors
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/lib/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RetryAfterKey - ключ trailer-метаданных с числом секунд, через которое можно повторить запрос.
+const RetryAfterKey = "retry-after"
+
+// RateLimits - лимиты, применяемые перехватчиками. Методы без своего лимита
+// ограничиваются только общим лимитом пользователя; nil-лимитер ничего не ограничивает.
+type RateLimits struct {
+	// User - все RPC одного пользователя
+	User *ratelimit.Limiter
+	// Methods - лимиты на пользователя по короткому имени метода (SendMessage, Login, ...)
+	Methods map[string]*ratelimit.Limiter
+}
+
+// NewRateLimitInterceptor создает unary-перехватчик, ограничивающий частоту вызовов.
+// Должен стоять после перехватчика аутентификации: ключом служит ID пользователя,
+// а для публичных методов - IP клиента.
+func NewRateLimitInterceptor(log *slog.Logger, limits *RateLimits) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if ok, retryAfter := limits.allow(ctx, info.FullMethod); !ok {
+			log.Warn("rate limit exceeded", slog.String("method", info.FullMethod), slog.String("key", clientKey(ctx)))
+			_ = grpc.SetTrailer(ctx, RetryAfterMD(retryAfter))
+			return nil, RateLimitStatus(retryAfter)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// NewRateLimitStreamInterceptor ограничивает частоту открытия стримов.
+// Сообщения внутри JoinChat ограничиваются сервисом чатов.
+func NewRateLimitStreamInterceptor(log *slog.Logger, limits *RateLimits) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if ok, retryAfter := limits.allow(ss.Context(), info.FullMethod); !ok {
+			log.Warn("rate limit exceeded", slog.String("method", info.FullMethod), slog.String("key", clientKey(ss.Context())))
+			ss.SetTrailer(RetryAfterMD(retryAfter))
+			return RateLimitStatus(retryAfter)
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func (l *RateLimits) allow(ctx context.Context, fullMethod string) (bool, time.Duration) {
+	key := clientKey(ctx)
+
+	if ok, retryAfter := l.User.Allow(key); !ok {
+		return false, retryAfter
+	}
+
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	return l.Methods[method].Allow(key)
+}
+
+// clientKey - ключ корзины: пользователь, если он аутентифицирован, иначе IP клиента.
+func clientKey(ctx context.Context) string {
+	if userID, ok := ctx.Value(UserIDKey).(int64); ok {
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "ip:unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return "ip:" + host
+}
+
+// RateLimitStatus возвращает gRPC-ошибку ResourceExhausted для превышенного лимита.
+func RateLimitStatus(retryAfter time.Duration) error {
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %ds", retryAfterSeconds(retryAfter))
+}
+
+// RetryAfterMD возвращает метаданные retry-after (целые секунды, не меньше 1).
+func RetryAfterMD(retryAfter time.Duration) metadata.MD {
+	return metadata.Pairs(RetryAfterKey, strconv.FormatInt(retryAfterSeconds(retryAfter), 10))
+}
+
+func retryAfterSeconds(retryAfter time.Duration) int64 {
+	return max(1, int64(math.Ceil(retryAfter.Seconds())))
+}
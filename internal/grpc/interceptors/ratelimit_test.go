@@ -0,0 +1,111 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/lib/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func okHandler(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+func TestRateLimitInterceptor_PerMethodAndUser(t *testing.T) {
+	limits := &RateLimits{
+		User:    ratelimit.New(1, 3),
+		Methods: map[string]*ratelimit.Limiter{"SendMessage": ratelimit.New(1, 1)},
+	}
+	interceptor := NewRateLimitInterceptor(logger(), limits)
+	send := &grpc.UnaryServerInfo{FullMethod: "/chat.ChatService/SendMessage"}
+	history := &grpc.UnaryServerInfo{FullMethod: "/chat.ChatService/GetHistory"}
+
+	alice := context.WithValue(context.Background(), UserIDKey, int64(1))
+	bob := context.WithValue(context.Background(), UserIDKey, int64(2))
+
+	if _, err := interceptor(alice, nil, send, okHandler); err != nil {
+		t.Fatalf("first call must pass: %v", err)
+	}
+	_, err := interceptor(alice, nil, send, okHandler)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted for method limit, got %v", err)
+	}
+
+	// Method without its own limit is bounded only by the user limit
+	if _, err := interceptor(alice, nil, history, okHandler); err != nil {
+		t.Fatalf("other method must pass: %v", err)
+	}
+	if _, err := interceptor(alice, nil, history, okHandler); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected user limit to be exhausted, got %v", err)
+	}
+
+	// Limits are per user
+	if _, err := interceptor(bob, nil, send, okHandler); err != nil {
+		t.Fatalf("other user must not be limited: %v", err)
+	}
+}
+
+func TestRateLimitInterceptor_PublicMethodsKeyedByIP(t *testing.T) {
+	limits := &RateLimits{Methods: map[string]*ratelimit.Limiter{"Login": ratelimit.New(1, 1)}}
+	interceptor := NewRateLimitInterceptor(logger(), limits)
+	login := &grpc.UnaryServerInfo{FullMethod: "/chat.AuthService/Login"}
+
+	fromIP := func(ip string, port int) context.Context {
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: port}})
+	}
+
+	if _, err := interceptor(fromIP("10.0.0.1", 1000), nil, login, okHandler); err != nil {
+		t.Fatalf("first login must pass: %v", err)
+	}
+	// Same host, different source port
+	if _, err := interceptor(fromIP("10.0.0.1", 2000), nil, login, okHandler); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected login from same IP to be limited, got %v", err)
+	}
+	if _, err := interceptor(fromIP("10.0.0.2", 1000), nil, login, okHandler); err != nil {
+		t.Fatalf("other IP must pass: %v", err)
+	}
+}
+
+type trailerStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	trailer metadata.MD
+}
+
+func (s *trailerStream) Context() context.Context  { return s.ctx }
+func (s *trailerStream) SetTrailer(md metadata.MD) { s.trailer = metadata.Join(s.trailer, md) }
+
+func TestRateLimitStreamInterceptor_SetsRetryAfter(t *testing.T) {
+	limits := &RateLimits{Methods: map[string]*ratelimit.Limiter{"JoinChat": ratelimit.New(0.5, 1)}}
+	interceptor := NewRateLimitStreamInterceptor(logger(), limits)
+	info := &grpc.StreamServerInfo{FullMethod: "/chat.ChatService/JoinChat"}
+	handler := func(srv interface{}, stream grpc.ServerStream) error { return nil }
+
+	ctx := context.WithValue(context.Background(), UserIDKey, int64(1))
+	if err := interceptor(nil, &trailerStream{ctx: ctx}, info, handler); err != nil {
+		t.Fatalf("first stream must open: %v", err)
+	}
+
+	ss := &trailerStream{ctx: ctx}
+	err := interceptor(nil, ss, info, handler)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+	if got := ss.trailer.Get(RetryAfterKey); len(got) != 1 || got[0] != "2" {
+		t.Fatalf("unexpected retry-after trailer: %v", got)
+	}
+}
+
+func TestRetryAfterMDRoundsUp(t *testing.T) {
+	if got := RetryAfterMD(10 * time.Millisecond).Get(RetryAfterKey); got[0] != "1" {
+		t.Fatalf("expected at least 1 second, got %v", got)
+	}
+	if got := RetryAfterMD(2100 * time.Millisecond).Get(RetryAfterKey); got[0] != "3" {
+		t.Fatalf("expected 3 seconds, got %v", got)
+	}
+}
@@ -0,0 +1,67 @@
+package interceptors
+
+import (
+	"context"
+	"sync"
+)
+
+// SessionChecker сообщает, действует ли сессия входа. Access токен отозванной сессии
+// отклоняется, даже если срок его действия еще не истек.
+type SessionChecker interface {
+	SessionActive(ctx context.Context, sessionID string) (bool, error)
+}
+
+// Sessions - проверка сессий в перехватчиках аутентификации.
+// Checker отклоняет запросы отозванных сессий, Streams закрывает уже открытые стримы.
+type Sessions struct {
+	Checker SessionChecker
+	Streams *SessionStreams
+}
+
+// SessionStreams - реестр открытых на этом экземпляре стримов по сессиям входа.
+// Отзыв сессии закрывает ее стримы сразу, не дожидаясь переподключения клиента.
+type SessionStreams struct {
+	mu      sync.Mutex
+	nextID  uint64
+	streams map[string]map[uint64]chan struct{}
+}
+
+func NewSessionStreams() *SessionStreams {
+	return &SessionStreams{streams: make(map[string]map[uint64]chan struct{})}
+}
+
+// track регистрирует стрим сессии. Канал revoked закрывается при отзыве сессии,
+// untrack снимает стрим с учета после его завершения.
+func (s *SessionStreams) track(sessionID string) (revoked <-chan struct{}, untrack func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	id := s.nextID
+	ch := make(chan struct{})
+	if s.streams[sessionID] == nil {
+		s.streams[sessionID] = make(map[uint64]chan struct{})
+	}
+	s.streams[sessionID][id] = ch
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.streams[sessionID], id)
+		if len(s.streams[sessionID]) == 0 {
+			delete(s.streams, sessionID)
+		}
+	}
+}
+
+// CloseSession закрывает все открытые стримы сессии.
+func (s *SessionStreams) CloseSession(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ch := range s.streams[sessionID] {
+		close(ch)
+	}
+	delete(s.streams, sessionID)
+}
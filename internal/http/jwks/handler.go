@@ -0,0 +1,47 @@
+package jwks
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/grigory222/go-chat-server/internal/services/auth"
+)
+
+// Path - стандартный адрес JWKS документа.
+const Path = "/.well-known/jwks.json"
+
+// cacheMaxAge - сколько секунд клиенты могут кэшировать документ. Новый ключ проверки
+// нужно добавить не позже чем за это время до того, как им начнут подписывать токены.
+const cacheMaxAge = "300"
+
+// KeySource - источник открытых ключей проверки токенов.
+type KeySource interface {
+	JWKS() auth.JWKS
+}
+
+// New возвращает обработчик, публикующий открытые ключи проверки токенов,
+// чтобы шлюз и другие сервисы проверяли токены без закрытого ключа.
+func New(log *slog.Logger, keys KeySource) http.Handler {
+	const op = "http.jwks"
+	log = log.With(slog.String("op", op))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := json.Marshal(keys.JWKS())
+		if err != nil {
+			log.Error("failed to encode jwks", slog.Any("err", err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age="+cacheMaxAge)
+		_, _ = w.Write(body)
+	})
+}
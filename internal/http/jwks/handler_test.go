@@ -0,0 +1,37 @@
+package jwks
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/grigory222/go-chat-server/internal/services/auth"
+)
+
+type fakeKeys struct{ set auth.JWKS }
+
+func (f fakeKeys) JWKS() auth.JWKS { return f.set }
+
+func TestHandler(t *testing.T) {
+	keys := fakeKeys{set: auth.JWKS{Keys: []auth.JWK{{Kty: "OKP", Crv: "Ed25519", X: "abc", Kid: "k1", Alg: "EdDSA", Use: "sig"}}}}
+	h := New(slog.New(slog.NewTextHandler(os.Stdout, nil)), keys)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response: %d %v", rec.Code, rec.Header())
+	}
+	var got auth.JWKS
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got.Keys) != 1 || got.Keys[0].Kid != "k1" {
+		t.Fatalf("unexpected body: %s %v", rec.Body.String(), err)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, Path, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+}
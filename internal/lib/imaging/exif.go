@@ -0,0 +1,201 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+const gpsIFDTag = 0x8825
+
+// Размеры типов значений TIFF (индекс - код типа)
+var tiffTypeSize = [...]uint32{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+var (
+	jpegSOI    = []byte{0xFF, 0xD8}
+	exifHeader = []byte("Exif\x00\x00")
+	pngMagic   = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// ErrMalformed - метаданные изображения не удалось разобрать, поэтому нельзя
+// гарантировать, что в файле не осталось GPS-данных.
+var ErrMalformed = errors.New("malformed image metadata")
+
+// StripLocation затирает GPS-теги EXIF в JPEG (APP1) и PNG (eXIf), остальные метаданные
+// (в т.ч. ориентация) сохраняются. Размер файла не меняется, изображение не перекодируется.
+// Возвращает копию данных и признак того, что GPS-данные были найдены. Если структуру
+// метаданных разобрать не удалось, возвращается ErrMalformed.
+func StripLocation(data []byte) ([]byte, bool, error) {
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		return stripJPEG(data)
+	case bytes.HasPrefix(data, pngMagic):
+		return stripPNG(data)
+	default:
+		return data, false, nil
+	}
+}
+
+func stripJPEG(data []byte) ([]byte, bool, error) {
+	out := bytes.Clone(data)
+	stripped := false
+
+	pos := len(jpegSOI)
+	for {
+		// Метаданные идут до начала данных скана; файл, оборвавшийся раньше, не проверить
+		if pos+4 > len(out) || out[pos] != 0xFF {
+			return nil, false, ErrMalformed
+		}
+		marker := out[pos+1]
+		// Заполняющие байты 0xFF перед маркером
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		// Начало данных скана - дальше метаданных нет
+		if marker == 0xDA {
+			break
+		}
+		// Маркеры без длины
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			pos += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(out[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(out) {
+			return nil, false, ErrMalformed
+		}
+
+		segment := out[pos+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) {
+			found, err := zeroGPS(segment[len(exifHeader):])
+			if err != nil {
+				return nil, false, err
+			}
+			stripped = stripped || found
+		}
+
+		pos = end
+	}
+
+	return out, stripped, nil
+}
+
+func stripPNG(data []byte) ([]byte, bool, error) {
+	out := bytes.Clone(data)
+	stripped := false
+
+	pos := len(pngMagic)
+	for {
+		if pos+12 > len(out) {
+			return nil, false, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint32(out[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(out) {
+			return nil, false, ErrMalformed
+		}
+
+		typ := string(out[pos+4 : pos+8])
+		if typ == "eXIf" {
+			found, err := zeroGPS(out[pos+8 : pos+8+length])
+			if err != nil {
+				return nil, false, err
+			}
+			if found {
+				binary.BigEndian.PutUint32(out[pos+8+length:], crc32.ChecksumIEEE(out[pos+4:pos+8+length]))
+				stripped = true
+			}
+		}
+		if typ == "IEND" {
+			break
+		}
+
+		pos = end
+	}
+
+	return out, stripped, nil
+}
+
+// zeroGPS находит GPS IFD в TIFF-структуре EXIF и затирает его записи и значения нулями.
+// Смещения остальных данных не меняются, поэтому EXIF остается валидным.
+func zeroGPS(tiff []byte) (bool, error) {
+	if len(tiff) < 8 {
+		return false, ErrMalformed
+	}
+
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return false, ErrMalformed
+	}
+	if bo.Uint16(tiff[2:]) != 42 {
+		return false, ErrMalformed
+	}
+
+	ifd0 := bo.Uint32(tiff[4:])
+	count, ok := ifdCount(tiff, bo, ifd0)
+	if !ok {
+		return false, ErrMalformed
+	}
+
+	for i := uint32(0); i < count; i++ {
+		entry := ifd0 + 2 + 12*i
+		if bo.Uint16(tiff[entry:]) != gpsIFDTag {
+			continue
+		}
+		if err := zeroIFD(tiff, bo, bo.Uint32(tiff[entry+8:])); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// zeroIFD затирает внешние значения записей IFD, сами записи и выставляет число записей в 0.
+func zeroIFD(tiff []byte, bo binary.ByteOrder, offset uint32) error {
+	count, ok := ifdCount(tiff, bo, offset)
+	if !ok {
+		return ErrMalformed
+	}
+
+	for i := uint32(0); i < count; i++ {
+		entry := offset + 2 + 12*i
+		typ := bo.Uint16(tiff[entry+2:])
+		if int(typ) >= len(tiffTypeSize) {
+			continue
+		}
+		size := uint64(tiffTypeSize[typ]) * uint64(bo.Uint32(tiff[entry+4:]))
+		if size <= 4 {
+			continue // значение хранится прямо в записи
+		}
+		valueOffset := uint64(bo.Uint32(tiff[entry+8:]))
+		if valueOffset+size > uint64(len(tiff)) {
+			return ErrMalformed
+		}
+		clear(tiff[valueOffset : valueOffset+size])
+	}
+
+	clear(tiff[offset+2 : offset+2+12*count])
+	bo.PutUint16(tiff[offset:], 0)
+	return nil
+}
+
+func ifdCount(tiff []byte, bo binary.ByteOrder, offset uint32) (uint32, bool) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0, false
+	}
+	count := uint32(bo.Uint16(tiff[offset:]))
+	if uint64(offset)+2+12*uint64(count) > uint64(len(tiff)) {
+		return 0, false
+	}
+	return count, true
+}
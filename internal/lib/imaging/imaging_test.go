@@ -0,0 +1,176 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// exifWithGPS builds a little-endian TIFF block whose IFD0 points to a GPS IFD
+// holding a GPSLatitude rational triple stored out of line.
+func exifWithGPS() (tiff []byte, latOffset int) {
+	b := make([]byte, 68)
+	le := binary.LittleEndian
+	copy(b, "II")
+	le.PutUint16(b[2:], 42)
+	le.PutUint32(b[4:], 8) // IFD0
+	// IFD0: one entry GPSInfo -> 26
+	le.PutUint16(b[8:], 1)
+	le.PutUint16(b[10:], gpsIFDTag)
+	le.PutUint16(b[12:], 4) // LONG
+	le.PutUint32(b[14:], 1)
+	le.PutUint32(b[18:], 26)
+	// GPS IFD: GPSLatitude, RATIONAL x3 at 44
+	le.PutUint16(b[26:], 1)
+	le.PutUint16(b[28:], 2)
+	le.PutUint16(b[30:], 5)
+	le.PutUint32(b[32:], 3)
+	le.PutUint32(b[36:], 44)
+	for i := 44; i < 68; i++ {
+		b[i] = 0x7F
+	}
+	return b, 44
+}
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	return img
+}
+
+func TestStripLocationJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(8, 8), nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	tiff, latOffset := exifWithGPS()
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(payload)+2))
+	data := append(append(append([]byte{}, buf.Bytes()[:2]...), append(app1, payload...)...), buf.Bytes()[2:]...)
+
+	out, stripped, err := StripLocation(data)
+	if err != nil || !stripped {
+		t.Fatalf("expected GPS data to be found: %v", err)
+	}
+	if len(out) != len(data) {
+		t.Fatalf("size must not change")
+	}
+	start := 2 + 4 + len("Exif\x00\x00")
+	if !bytes.Equal(out[start+latOffset:start+latOffset+24], make([]byte, 24)) {
+		t.Fatalf("latitude values were not cleared")
+	}
+	if binary.LittleEndian.Uint16(out[start+26:]) != 0 {
+		t.Fatalf("GPS IFD entry count must be zero")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("stripped JPEG must stay decodable: %v", err)
+	}
+	// Source slice is not modified
+	if bytes.Equal(out, data) {
+		t.Fatalf("expected a modified copy")
+	}
+}
+
+func TestStripLocationPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(4, 4)); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	tiff, _ := exifWithGPS()
+	chunk := make([]byte, 8, 12+len(tiff))
+	binary.BigEndian.PutUint32(chunk, uint32(len(tiff)))
+	copy(chunk[4:], "eXIf")
+	chunk = append(chunk, tiff...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	data := append(append(append([]byte{}, buf.Bytes()[:33]...), chunk...), buf.Bytes()[33:]...) // after IHDR
+
+	out, stripped, err := StripLocation(data)
+	if err != nil || !stripped {
+		t.Fatalf("expected GPS data to be found: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("stripped PNG must stay decodable (CRC): %v", err)
+	}
+}
+
+func TestStripLocationWithoutExif(t *testing.T) {
+	var buf bytes.Buffer
+	_ = jpeg.Encode(&buf, testImage(4, 4), nil)
+	if _, stripped, err := StripLocation(buf.Bytes()); err != nil || stripped {
+		t.Fatalf("nothing to strip expected: %v", err)
+	}
+	if _, stripped, err := StripLocation([]byte("plain text")); err != nil || stripped {
+		t.Fatalf("non-images must be left alone: %v", err)
+	}
+}
+
+func TestStripLocationMalformed(t *testing.T) {
+	tiff, _ := exifWithGPS()
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(payload)+2))
+	jpegWithExif := append(append([]byte{0xFF, 0xD8}, app1...), payload...)
+
+	cases := map[string][]byte{
+		// Image data Go cannot decode, metadata is still there
+		"truncated before scan": jpegWithExif,
+		"segment past end":      append([]byte{0xFF, 0xD8}, app1[:2]...),
+		"broken tiff header":    append(append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 16}, "Exif\x00\x00XX*\x00\x08\x00\x00\x00"...), 0xFF, 0xDA),
+		"png without IEND":      []byte("\x89PNG\r\n\x1a\n\x00\x00"),
+	}
+	for name, data := range cases {
+		if _, _, err := StripLocation(data); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: expected ErrMalformed, got %v", name, err)
+		}
+	}
+
+	// The GPS pointer leads outside the EXIF block
+	broken := bytes.Clone(tiff)
+	binary.LittleEndian.PutUint32(broken[8+2+8:], 0xFFFF)
+	payload = append([]byte("Exif\x00\x00"), broken...)
+	data := append(append(append([]byte{0xFF, 0xD8}, app1...), payload...), 0xFF, 0xDA)
+	if _, _, err := StripLocation(data); !errors.Is(err, ErrMalformed) {
+		t.Errorf("bad GPS offset: expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	src := testImage(200, 100)
+	th := Thumbnail(src, 50)
+	if b := th.Bounds(); b.Dx() != 50 || b.Dy() != 25 {
+		t.Fatalf("unexpected thumbnail size %v", b)
+	}
+
+	tall := Thumbnail(testImage(10, 40), 20)
+	if b := tall.Bounds(); b.Dx() != 5 || b.Dy() != 20 {
+		t.Fatalf("unexpected thumbnail size %v", b)
+	}
+
+	// Small images are not upscaled
+	small := testImage(10, 10)
+	if Thumbnail(small, 50) != small {
+		t.Fatalf("small image must be returned as is")
+	}
+}
+
+func TestIsSupported(t *testing.T) {
+	for _, m := range []string{"image/jpeg", "image/png", "image/gif"} {
+		if !IsSupported(m) {
+			t.Fatalf("%s must be supported", m)
+		}
+	}
+	if IsSupported("image/webp") || IsSupported("text/plain") {
+		t.Fatalf("unexpected supported type")
+	}
+}
@@ -0,0 +1,70 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+	// Регистрируем декодеры: image.Decode для GIF возвращает первый кадр
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// IsSupported сообщает, умеем ли мы извлекать размеры и строить превью для MIME-типа.
+func IsSupported(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	default:
+		return false
+	}
+}
+
+// Thumbnail уменьшает изображение так, чтобы большая сторона не превышала maxEdge.
+// Изображения меньше maxEdge не увеличиваются. Используется усреднение по площади (box filter).
+func Thumbnail(src image.Image, maxEdge int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxEdge <= 0 || (w <= maxEdge && h <= maxEdge) {
+		return src
+	}
+
+	dw, dh := maxEdge, maxEdge
+	if w >= h {
+		dh = max(1, h*maxEdge/w)
+	} else {
+		dw = max(1, w*maxEdge/h)
+	}
+
+	// Приводим к RGBA (premultiplied), чтобы корректно усреднять прозрачные пиксели
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					bl += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0] = uint8(r / n)
+			d[1] = uint8(g / n)
+			d[2] = uint8(bl / n)
+			d[3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,244 @@
+// Package lockout считает неудачные попытки по ключам (аккаунт, IP) и после порога
+// задерживает следующие попытки: сначала с экспоненциально растущей паузой,
+// затем блокирует ключ целиком на заданное время.
+//
+// Попытка начинается с Begin и завершается ровно одним из Fail, Reset или Done.
+// Пока попытка не завершена, при проверке порогов она считается неудачной: иначе
+// параллельные попытки проходили бы проверку до того, как учтена первая из них,
+// и перебор обходил бы порог.
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval - как часто из памяти выбрасываются ключи, у которых истек счетчик
+const sweepInterval = time.Minute
+
+// Config - пороги для одного вида ключей.
+type Config struct {
+	// FreeAttempts - сколько неудач подряд проходит без задержки
+	FreeAttempts int
+	// BaseDelay - пауза после первой неудачи сверх FreeAttempts; каждая следующая удваивает ее
+	BaseDelay time.Duration
+	// MaxDelay - потолок паузы
+	MaxDelay time.Duration
+	// LockoutAttempts - после стольких неудач ключ блокируется на LockoutDuration,
+	// а счетчик начинается заново. 0 - без блокировки, только паузы
+	LockoutAttempts int
+	LockoutDuration time.Duration
+	// ResetAfter - через сколько после последней неудачи счетчик обнуляется
+	ResetAfter time.Duration
+}
+
+// Guard хранит счетчики в памяти экземпляра. nil-Guard ничего не ограничивает.
+type Guard struct {
+	mu        sync.Mutex
+	cfg       Config
+	entries   map[string]*entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type entry struct {
+	failures int
+	// pending - начатые и еще не завершенные попытки
+	pending      int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// New создает Guard. Если не задан ни один порог, возвращает nil - без ограничений.
+func New(cfg Config) *Guard {
+	if cfg.BaseDelay <= 0 && cfg.LockoutAttempts <= 0 {
+		return nil
+	}
+	return &Guard{
+		cfg:     cfg,
+		entries: make(map[string]*entry),
+		now:     time.Now,
+	}
+}
+
+// Check возвращает, сколько еще ждать до следующей попытки по ключу key; 0 - можно пробовать.
+func (g *Guard) Check(key string) time.Duration {
+	if g == nil {
+		return 0
+	}
+
+	now := g.now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	e, ok := g.entries[key]
+	if !ok || !now.Before(e.blockedUntil) {
+		return 0
+	}
+	return e.blockedUntil.Sub(now)
+}
+
+// Begin начинает попытку по ключу key. Если пробовать пока нельзя, возвращает, сколько еще
+// ждать, и попытку не начинает. Иначе возвращает 0; такую попытку нужно завершить через
+// Fail, Reset или Done.
+func (g *Guard) Begin(key string) time.Duration {
+	if g == nil {
+		return 0
+	}
+
+	now := g.now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.sweep(now)
+
+	e := g.lookup(key, now)
+	if now.Before(e.blockedUntil) {
+		return e.blockedUntil.Sub(now)
+	}
+
+	// Если неудача уже начатых попыток задержит или заблокирует ключ, новая попытка
+	// ждет так же, как ждала бы после них
+	if projected := e.failures + e.pending; projected > 0 {
+		if g.cfg.LockoutAttempts > 0 && projected >= g.cfg.LockoutAttempts {
+			return g.cfg.LockoutDuration
+		}
+		if over := projected - g.cfg.FreeAttempts; over > 0 && g.cfg.BaseDelay > 0 {
+			return g.delay(over)
+		}
+	}
+
+	e.pending++
+	return 0
+}
+
+// Done завершает попытку, начатую Begin, не учитывая ее результат.
+func (g *Guard) Done(key string) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if e, ok := g.entries[key]; ok {
+		e.finish()
+	}
+}
+
+// Fail учитывает неудачную попытку по ключу key и завершает ее, если она начата Begin.
+func (g *Guard) Fail(key string) {
+	if g == nil {
+		return
+	}
+
+	now := g.now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.sweep(now)
+
+	e := g.lookup(key, now)
+	e.finish()
+	e.failures++
+	e.lastFailure = now
+
+	if g.cfg.LockoutAttempts > 0 && e.failures >= g.cfg.LockoutAttempts {
+		e.blockedUntil = now.Add(g.cfg.LockoutDuration)
+		e.failures = 0
+		return
+	}
+	if over := e.failures - g.cfg.FreeAttempts; over > 0 && g.cfg.BaseDelay > 0 {
+		e.blockedUntil = now.Add(g.delay(over))
+	}
+}
+
+// Reset сбрасывает счетчик ключа key после успешной попытки и завершает ее, если она
+// начата Begin. Другие незавершенные попытки по ключу остаются учтенными.
+func (g *Guard) Reset(key string) {
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	e, ok := g.entries[key]
+	if !ok {
+		return
+	}
+	e.finish()
+	if e.pending == 0 {
+		delete(g.entries, key)
+		return
+	}
+	*e = entry{pending: e.pending}
+}
+
+// lookup возвращает счетчик ключа key, создавая новый или обнуляя истекший.
+// Незавершенные попытки при обнулении сохраняются.
+func (g *Guard) lookup(key string, now time.Time) *entry {
+	e, ok := g.entries[key]
+	if !ok {
+		e = &entry{}
+		g.entries[key] = e
+	} else if g.expired(e, now) {
+		*e = entry{pending: e.pending}
+	}
+	return e
+}
+
+// finish снимает со счетчика завершенную попытку.
+func (e *entry) finish() {
+	if e.pending > 0 {
+		e.pending--
+	}
+}
+
+// delay - BaseDelay * 2^(over-1), не больше MaxDelay.
+func (g *Guard) delay(over int) time.Duration {
+	d := g.cfg.BaseDelay
+	// Ограничение на число удвоений защищает от переполнения, если MaxDelay не задан
+	for i := 1; i < over && i < 30; i++ {
+		if g.cfg.MaxDelay > 0 && d >= g.cfg.MaxDelay {
+			break
+		}
+		d *= 2
+	}
+	if g.cfg.MaxDelay > 0 && d > g.cfg.MaxDelay {
+		return g.cfg.MaxDelay
+	}
+	return d
+}
+
+// expired - счетчик ключа пора обнулить: блокировка прошла и неудач давно не было.
+func (g *Guard) expired(e *entry, now time.Time) bool {
+	return !now.Before(e.blockedUntil) && g.cfg.ResetAfter > 0 && now.Sub(e.lastFailure) >= g.cfg.ResetAfter
+}
+
+// sweep удаляет истекшие ключи, чтобы карта не росла с каждым новым email или IP.
+func (g *Guard) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < sweepInterval {
+		return
+	}
+	g.lastSweep = now
+
+	for key, e := range g.entries {
+		if e.pending == 0 && g.expired(e, now) {
+			delete(g.entries, key)
+		}
+	}
+}
+
+// Len возвращает число ключей в памяти.
+func (g *Guard) Len() int {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.entries)
+}
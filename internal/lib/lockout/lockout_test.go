@@ -0,0 +1,142 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestGuard(cfg Config) (*Guard, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	g := New(cfg)
+	g.now = clock.now
+	return g, clock
+}
+
+func TestGuardBackoff(t *testing.T) {
+	g, clock := newTestGuard(Config{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 4 * time.Second, ResetAfter: time.Hour})
+
+	g.Fail("a")
+	g.Fail("a")
+	if wait := g.Check("a"); wait != 0 {
+		t.Fatalf("free attempts must not be delayed, got %v", wait)
+	}
+
+	// Delay doubles with every failure over the free attempts and is capped
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		g.Fail("a")
+		if wait := g.Check("a"); wait != want {
+			t.Fatalf("expected %v, got %v", want, wait)
+		}
+		clock.advance(want)
+		if wait := g.Check("a"); wait != 0 {
+			t.Fatalf("delay must pass, got %v", wait)
+		}
+	}
+
+	// Other keys are independent
+	if wait := g.Check("b"); wait != 0 {
+		t.Fatalf("independent key must not be delayed")
+	}
+
+	// Success resets the counter
+	g.Reset("a")
+	g.Fail("a")
+	if wait := g.Check("a"); wait != 0 {
+		t.Fatalf("counter must be reset, got %v", wait)
+	}
+
+	// So does a long pause without failures
+	g.Fail("a")
+	g.Fail("a")
+	clock.advance(time.Hour)
+	g.Fail("a")
+	if wait := g.Check("a"); wait != 0 {
+		t.Fatalf("counter must expire, got %v", wait)
+	}
+}
+
+func TestGuardLockout(t *testing.T) {
+	g, clock := newTestGuard(Config{FreeAttempts: 10, LockoutAttempts: 3, LockoutDuration: 15 * time.Minute, ResetAfter: time.Hour})
+
+	g.Fail("a")
+	g.Fail("a")
+	if wait := g.Check("a"); wait != 0 {
+		t.Fatalf("must not be locked yet, got %v", wait)
+	}
+	g.Fail("a")
+	if wait := g.Check("a"); wait != 15*time.Minute {
+		t.Fatalf("expected lockout, got %v", wait)
+	}
+
+	// After the lockout the counter starts over
+	clock.advance(15 * time.Minute)
+	g.Fail("a")
+	if wait := g.Check("a"); wait != 0 {
+		t.Fatalf("counter must start over after lockout, got %v", wait)
+	}
+}
+
+func TestGuardSweepAndNil(t *testing.T) {
+	g, clock := newTestGuard(Config{LockoutAttempts: 5, LockoutDuration: time.Minute, ResetAfter: time.Minute})
+	g.Fail("a")
+	g.Fail("b")
+	clock.advance(2 * time.Minute)
+	g.Fail("c")
+	if g.Len() != 1 {
+		t.Fatalf("expired keys must be swept, got %d", g.Len())
+	}
+
+	var disabled *Guard
+	if New(Config{FreeAttempts: 3}) != nil {
+		t.Fatalf("guard without thresholds must be nil")
+	}
+	disabled.Fail("a")
+	disabled.Reset("a")
+	if disabled.Check("a") != 0 || disabled.Len() != 0 {
+		t.Fatalf("nil guard must not limit")
+	}
+}
+
+func TestGuardReservesPendingAttempts(t *testing.T) {
+	g, _ := newTestGuard(Config{FreeAttempts: 10, LockoutAttempts: 3, LockoutDuration: 15 * time.Minute, ResetAfter: time.Hour})
+
+	// Attempts in flight count against the threshold before they finish
+	for i := 0; i < 3; i++ {
+		if wait := g.Begin("a"); wait != 0 {
+			t.Fatalf("attempt %d must start, got %v", i, wait)
+		}
+	}
+	if wait := g.Begin("a"); wait != 15*time.Minute {
+		t.Fatalf("attempt over the threshold must wait, got %v", wait)
+	}
+
+	// An attempt without a verdict frees its slot
+	g.Done("a")
+	if wait := g.Begin("a"); wait != 0 {
+		t.Fatalf("released slot must be reusable, got %v", wait)
+	}
+
+	// A success resets failures but keeps the other attempt in flight
+	g.Fail("a")
+	g.Reset("a")
+	for i := 0; i < 2; i++ {
+		if wait := g.Begin("a"); wait != 0 {
+			t.Fatalf("attempt after success must start, got %v", wait)
+		}
+	}
+	if wait := g.Begin("a"); wait == 0 {
+		t.Fatalf("attempts in flight must still count after a success")
+	}
+
+	g.Fail("a")
+	g.Fail("a")
+	g.Fail("a")
+	if wait := g.Check("a"); wait != 15*time.Minute {
+		t.Fatalf("expected lockout, got %v", wait)
+	}
+}
@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	outbox, err := NewOutbox(dir, "Chat <no-reply@example.com>")
+	if err != nil {
+		t.Fatalf("NewOutbox error: %v", err)
+	}
+
+	msg := Message{To: "alice@example.com", Subject: "Сброс пароля", Body: "token: abc"}
+	if err := outbox.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+	if err := outbox.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 2 {
+		t.Fatalf("expected two messages, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: alice@example.com\r\n") || !strings.HasSuffix(string(data), "\r\n\r\ntoken: abc") {
+		t.Fatalf("unexpected message:\n%s", data)
+	}
+	if strings.Contains(string(data), "Сброс") {
+		t.Fatalf("non-ascii subject must be encoded:\n%s", data)
+	}
+
+	msg.Subject = "hi\r\nBcc: eve@example.com"
+	if err := outbox.Send(context.Background(), msg); err == nil {
+		t.Fatalf("header injection must be rejected")
+	}
+}
+
+// fakeSMTPServer accepts one session and returns the received DATA.
+func fakeSMTPServer(t *testing.T) (addr string, data <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		write := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		write("220 localhost ESMTP")
+		var body strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				write("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				write("354 go ahead")
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					body.WriteString(l)
+				}
+				received <- body.String()
+				write("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				write("221 bye")
+				return
+			default:
+				write("250 ok")
+			}
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+func TestSMTP(t *testing.T) {
+	addr, data := fakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(addr)
+	portNum, _ := strconv.Atoi(port)
+
+	m := NewSMTP(host, portNum, "", "", "no-reply@example.com")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, Message{To: "bob@example.com", Subject: "Hello", Body: "body text"}); err != nil {
+		t.Fatalf("Send error: %v", err)
+	}
+
+	got := <-data
+	if !strings.Contains(got, "Subject: Hello\r\n") || !strings.Contains(got, "body text") {
+		t.Fatalf("unexpected data:\n%s", got)
+	}
+}
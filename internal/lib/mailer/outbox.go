@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Outbox сохраняет письма файлами .eml в директорию вместо отправки.
+// Нужен для локальной разработки и тестов: письмо можно открыть почтовым клиентом.
+type Outbox struct {
+	dir  string
+	from string
+}
+
+// NewOutbox создает директорию dir, если ее нет.
+func NewOutbox(dir, from string) (*Outbox, error) {
+	const op = "mailer.NewOutbox"
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Outbox{dir: dir, from: from}, nil
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	const op = "mailer.Outbox.Send"
+
+	if err := validateHeaders(o.from, msg); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	now := time.Now()
+	// Имя файла упорядочено по времени, суффикс исключает совпадения
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+
+	if err := os.WriteFile(filepath.Join(o.dir, name), render(o.from, msg, now), 0o600); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP отправляет письма через SMTP сервер. Если сервер поддерживает STARTTLS,
+// соединение шифруется; логин и пароль передаются только по зашифрованному соединению.
+type SMTP struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTP(host string, port int, username, password, from string) *SMTP {
+	return &SMTP{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	const op = "mailer.SMTP.Send"
+
+	if err := validateHeaders(s.from, msg); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return fmt.Errorf("%s: invalid sender: %w", op, err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("%s: invalid recipient: %w", op, err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// Срок контекста ограничивает весь диалог с сервером, а не только подключение
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if s.username != "" {
+		// PlainAuth сам откажется передавать пароль без TLS (кроме localhost)
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := w.Write(render(s.from, msg, time.Now())); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := c.Quit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// validateHeaders не дает подставить в заголовки письма перевод строки (header injection).
+func validateHeaders(from string, msg Message) error {
+	for _, v := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return errors.New("line breaks are not allowed in headers")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+// Package oidc - клиент OpenID Connect для входа по authorization code с PKCE (RFC 7636):
+// находит провайдера по issuer (OpenID Connect Discovery), обменивает код на токены
+// и проверяет ID токен ключами из JWKS провайдера.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCodeRejected - провайдер отклонил код авторизации: код истек или уже использован,
+	// не совпал code_verifier или redirect_uri
+	ErrCodeRejected = errors.New("authorization code rejected")
+	// ErrInvalidIDToken - ID токен не прошел проверку подписи или claims
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	// requestTimeout - таймаут запросов к провайдеру, если HTTP клиент не задан
+	requestTimeout = 10 * time.Second
+	// maxResponseSize - ограничение на размер ответов провайдера
+	maxResponseSize = 1 << 20
+	// verifierSize - 256 бит энтропии, 43 символа в base64url
+	verifierSize = 32
+)
+
+// Config - регистрация приложения у провайдера.
+type Config struct {
+	// Issuer - идентификатор провайдера; по нему находится документ discovery
+	Issuer   string
+	ClientID string
+	// ClientSecret - секрет конфиденциального клиента; пустой - публичный клиент, только PKCE
+	ClientSecret string
+	// RedirectURL - адрес, на который провайдер возвращает код авторизации
+	RedirectURL string
+	Scopes      []string
+	// HTTPClient - клиент для запросов к провайдеру; по умолчанию с таймаутом requestTimeout
+	HTTPClient *http.Client
+}
+
+// Identity - пользователь по проверенному ID токену.
+type Identity struct {
+	// Subject - постоянный идентификатор пользователя у провайдера
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider - OpenID провайдер. Документ discovery и ключи загружаются при первом
+// обращении, поэтому недоступный провайдер не мешает запуску сервера.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *metadata
+	keys        map[string]any
+	keysFetched time.Time
+	now         func() time.Time
+}
+
+// metadata - поля документа discovery, нужные для входа.
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+func New(cfg Config) *Provider {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{cfg: cfg, client: client, now: time.Now}
+}
+
+// Issuer возвращает идентификатор провайдера. Вместе с Identity.Subject он однозначно
+// определяет пользователя.
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// AuthCodeURL возвращает адрес страницы входа провайдера. state и nonce связывают ответ
+// провайдера с начатым входом, codeChallenge - S256 от code_verifier клиента.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange обменивает код авторизации на токены и возвращает непроверенный ID токен.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.cfg.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// RFC 6749, 2.3.1: идентификатор и секрет кодируются как в форме
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized:
+		return "", fmt.Errorf("%w: %s %s", ErrCodeRejected, body.Error, body.ErrorDescription)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("token endpoint returned %s", resp.Status)
+	case body.IDToken == "":
+		return "", fmt.Errorf("%w: no id_token in token response", ErrInvalidIDToken)
+	}
+
+	return body.IDToken, nil
+}
+
+// metadata загружает документ discovery при первом обращении.
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.discover(ctx)
+}
+
+// discover вызывается под p.mu. Неудачная загрузка не кэшируется: следующий вход попробует снова.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+discoveryPath, &meta); err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	// OpenID Connect Discovery, 4.3: issuer документа должен точно совпадать с настроенным
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("discovery document misses required endpoints")
+	}
+	if len(meta.CodeChallengeMethods) > 0 && !slices.Contains(meta.CodeChallengeMethods, "S256") {
+		return nil, errors.New("provider does not support PKCE with S256")
+	}
+
+	p.meta = &meta
+	return p.meta, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// NewVerifier возвращает случайный code_verifier для PKCE.
+func NewVerifier() (string, error) {
+	b := make([]byte, verifierSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge возвращает code_challenge метода S256 для verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidChallenge - challenge похож на результат S256: 32 байта в base64url без выравнивания.
+func ValidChallenge(challenge string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(b) == sha256.Size
+}
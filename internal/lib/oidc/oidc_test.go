@@ -0,0 +1,180 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/grigory222/go-chat-server/internal/lib/oidc/oidctest"
+)
+
+const testRedirect = "https://app.example.com/callback"
+
+var bob = oidctest.User{Subject: "bob-sub", Email: "bob@example.com", EmailVerified: true, Name: "Bob"}
+
+func newTestProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	t.Helper()
+	fake := oidctest.New(t, "chat", "s3cr:et")
+	p := New(Config{Issuer: fake.Issuer(), ClientID: "chat", ClientSecret: "s3cr:et", RedirectURL: testRedirect})
+	return fake, p
+}
+
+// signIn runs the flow up to the token exchange and returns the raw ID token and the nonce.
+func signIn(t *testing.T, fake *oidctest.Provider, p *Provider, user oidctest.User) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+	verifier, _ := NewVerifier()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", Challenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL error: %v", err)
+	}
+	code, state, err := fake.Authorize(authURL, user)
+	if err != nil || state != "state-1" {
+		t.Fatalf("Authorize failed: %v %q", err, state)
+	}
+	raw, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange error: %v", err)
+	}
+	return raw, "nonce-1"
+}
+
+func TestLoginFlow(t *testing.T) {
+	fake, p := newTestProvider(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		raw, nonce := signIn(t, fake, p, bob)
+		id, err := p.Verify(ctx, raw, nonce)
+		if err != nil {
+			t.Fatalf("Verify error: %v", err)
+		}
+		if *id != (Identity{Subject: "bob-sub", Email: "bob@example.com", EmailVerified: true, Name: "Bob"}) {
+			t.Fatalf("unexpected identity: %+v", id)
+		}
+	}
+
+	// Discovery and keys are cached
+	if n := fake.Requests("/.well-known/openid-configuration"); n != 1 {
+		t.Fatalf("expected one discovery request, got %d", n)
+	}
+	if n := fake.Requests("/jwks"); n != 1 {
+		t.Fatalf("expected one jwks request, got %d", n)
+	}
+}
+
+func TestExchangeRejected(t *testing.T) {
+	fake, p := newTestProvider(t)
+	ctx := context.Background()
+
+	verifier, _ := NewVerifier()
+	authURL, _ := p.AuthCodeURL(ctx, "s", "n", Challenge(verifier))
+	code, _, _ := fake.Authorize(authURL, bob)
+
+	other, _ := NewVerifier()
+	if _, err := p.Exchange(ctx, code, other); !errors.Is(err, ErrCodeRejected) {
+		t.Fatalf("wrong verifier must be rejected, got %v", err)
+	}
+	if _, err := p.Exchange(ctx, code, verifier); !errors.Is(err, ErrCodeRejected) {
+		t.Fatalf("code must be single-use, got %v", err)
+	}
+
+	wrongSecret := New(Config{Issuer: fake.Issuer(), ClientID: "chat", ClientSecret: "other", RedirectURL: testRedirect})
+	authURL, _ = wrongSecret.AuthCodeURL(ctx, "s", "n", Challenge(verifier))
+	code, _, _ = fake.Authorize(authURL, bob)
+	if _, err := wrongSecret.Exchange(ctx, code, verifier); !errors.Is(err, ErrCodeRejected) {
+		t.Fatalf("wrong client secret must be rejected, got %v", err)
+	}
+}
+
+func TestVerifyRejectsClaims(t *testing.T) {
+	cases := map[string]func(jwt.MapClaims){
+		"audience":   func(c jwt.MapClaims) { c["aud"] = "other" },
+		"issuer":     func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":    func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no subject": func(c jwt.MapClaims) { delete(c, "sub") },
+		"nonce":      func(c jwt.MapClaims) { c["nonce"] = "replayed" },
+		"azp":        func(c jwt.MapClaims) { c["aud"] = []string{"chat", "other"}; c["azp"] = "other" },
+	}
+	for name, tamper := range cases {
+		t.Run(name, func(t *testing.T) {
+			fake, p := newTestProvider(t)
+			fake.Claims = tamper
+			raw, nonce := signIn(t, fake, p, bob)
+			if _, err := p.Verify(context.Background(), raw, nonce); !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+			}
+		})
+	}
+
+	// email_verified as a string is understood
+	fake, p := newTestProvider(t)
+	fake.Claims = func(c jwt.MapClaims) { c["email_verified"] = "true" }
+	raw, nonce := signIn(t, fake, p, oidctest.User{Subject: "s", Email: "a@example.com"})
+	if id, err := p.Verify(context.Background(), raw, nonce); err != nil || !id.EmailVerified {
+		t.Fatalf("string email_verified must be accepted: %v %+v", err, id)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	fake, p := newTestProvider(t)
+	ctx := context.Background()
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	raw, nonce := signIn(t, fake, p, bob)
+	if _, err := p.Verify(ctx, raw, nonce); err != nil {
+		t.Fatalf("Verify error: %v", err)
+	}
+
+	// Unknown kids do not hit the provider more than once per interval
+	fake.RotateKey()
+	raw, nonce = signIn(t, fake, p, bob)
+	if _, err := p.Verify(ctx, raw, nonce); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("expected ErrInvalidIDToken right after the fetch, got %v", err)
+	}
+	if n := fake.Requests("/jwks"); n != 1 {
+		t.Fatalf("jwks must not be refetched yet, got %d requests", n)
+	}
+
+	now = now.Add(keysRefreshInterval)
+	if _, err := p.Verify(ctx, raw, nonce); err != nil {
+		t.Fatalf("rotated key must be picked up: %v", err)
+	}
+}
+
+func TestDiscoveryValidation(t *testing.T) {
+	ctx := context.Background()
+	fake := oidctest.New(t, "chat", "")
+
+	// The issuer must match the discovery document exactly
+	p := New(Config{Issuer: fake.Issuer() + "/", ClientID: "chat", RedirectURL: testRedirect})
+	if _, err := p.AuthCodeURL(ctx, "s", "n", "c"); err == nil {
+		t.Fatalf("issuer mismatch must fail discovery")
+	}
+
+	fake.PKCEMethods = []string{"plain"}
+	p = New(Config{Issuer: fake.Issuer(), ClientID: "chat", RedirectURL: testRedirect})
+	if _, err := p.AuthCodeURL(ctx, "s", "n", "c"); err == nil {
+		t.Fatalf("provider without S256 must be rejected")
+	}
+
+	// A failed discovery is retried
+	fake.PKCEMethods = nil
+	if _, err := p.AuthCodeURL(ctx, "s", "n", "c"); err != nil {
+		t.Fatalf("discovery must be retried: %v", err)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// RFC 7636, Appendix B
+	if got := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Fatalf("unexpected challenge %q", got)
+	}
+	verifier, _ := NewVerifier()
+	if !ValidChallenge(Challenge(verifier)) || ValidChallenge("short") || ValidChallenge(verifier+"!") {
+		t.Fatalf("ValidChallenge misbehaves")
+	}
+}
@@ -0,0 +1,256 @@
+// Package oidctest - OpenID провайдер в памяти процесса для тестов: discovery, JWKS
+// и token endpoint с проверкой PKCE. Вход пользователя на странице провайдера
+// заменяет метод Authorize.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// User - пользователь, который входит у провайдера.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider - тестовый провайдер. Поля меняются до Authorize, которое их использует.
+type Provider struct {
+	ClientID     string
+	ClientSecret string
+	// Claims, если задан, правит claims ID токена перед подписью
+	Claims func(claims jwt.MapClaims)
+	// PKCEMethods - code_challenge_methods_supported в документе discovery
+	PKCEMethods []string
+
+	server *httptest.Server
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	kid    int
+	grants map[string]*grant
+	// requests - число запросов к каждому пути
+	requests map[string]int
+}
+
+type grant struct {
+	user        User
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+// New запускает провайдер; он останавливается в конце теста.
+func New(t testing.TB, clientID, clientSecret string) *Provider {
+	t.Helper()
+
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		PKCEMethods:  []string{"S256"},
+		grants:       make(map[string]*grant),
+		requests:     make(map[string]int),
+	}
+	p.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(p.count(mux))
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// Issuer возвращает адрес провайдера.
+func (p *Provider) Issuer() string {
+	return p.server.URL
+}
+
+// Requests возвращает, сколько раз запрашивался path.
+func (p *Provider) Requests(path string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.requests[path]
+}
+
+// RotateKey заменяет ключ подписи новым ключом с новым kid.
+func (p *Provider) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = key
+	p.kid++
+}
+
+// Authorize проходит вход user на странице провайдера по адресу authURL
+// и возвращает code и state, с которыми провайдер перенаправил бы пользователя.
+func (p *Provider) Authorize(authURL string, user User) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+	switch {
+	case u.Path != "/authorize":
+		return "", "", fmt.Errorf("unexpected path %q", u.Path)
+	case q.Get("response_type") != "code":
+		return "", "", fmt.Errorf("unexpected response_type %q", q.Get("response_type"))
+	case q.Get("client_id") != p.ClientID:
+		return "", "", fmt.Errorf("unknown client %q", q.Get("client_id"))
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		return "", "", fmt.Errorf("pkce is required")
+	case q.Get("redirect_uri") == "" || q.Get("state") == "" || q.Get("nonce") == "":
+		return "", "", fmt.Errorf("redirect_uri, state and nonce are required")
+	}
+
+	code = rand.Text()
+	p.mu.Lock()
+	p.grants[code] = &grant{
+		user:        user,
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+	}
+	p.mu.Unlock()
+
+	return code, q.Get("state"), nil
+}
+
+func (p *Provider) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.requests[r.URL.Path]++
+		p.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                           p.Issuer(),
+		"authorization_endpoint":           p.Issuer() + "/authorize",
+		"token_endpoint":                   p.Issuer() + "/token",
+		"jwks_uri":                         p.Issuer() + "/jwks",
+		"code_challenge_methods_supported": p.PKCEMethods,
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	public := p.key.PublicKey
+	kid := p.kidString()
+	p.mu.Unlock()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": kid,
+		"n":   b64(public.N.Bytes()),
+		"e":   b64(big.NewInt(int64(public.E)).Bytes()),
+	}}})
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	if p.ClientSecret != "" {
+		id, secret, ok := r.BasicAuth()
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		if !ok || id != p.ClientID || secret != p.ClientSecret {
+			oauthError(w, http.StatusUnauthorized, "invalid_client")
+			return
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Код одноразовый, даже если обмен не удался
+	code := r.PostForm.Get("code")
+	g, ok := p.grants[code]
+	delete(p.grants, code)
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != p.ClientID:
+		oauthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	case !ok, g.redirectURI != r.PostForm.Get("redirect_uri"),
+		g.challenge != base64.RawURLEncoding.EncodeToString(sum[:]):
+		oauthError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.Issuer(),
+		"sub":            g.user.Subject,
+		"aud":            p.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.user.Email,
+		"email_verified": g.user.EmailVerified,
+		"name":           g.user.Name,
+	}
+	if p.Claims != nil {
+		p.Claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.kidString()
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) kidString() string {
+	return fmt.Sprintf("key-%d", p.kid)
+}
+
+func oauthError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,137 @@
+package passhash
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	argon2idPrefix = "$argon2id$"
+	saltLen        = 16
+)
+
+// Argon2Params - параметры argon2id (RFC 9106).
+type Argon2Params struct {
+	// Memory - память в KiB
+	Memory uint32
+	// Iterations - число проходов по памяти
+	Iterations uint32
+	// Parallelism - число потоков
+	Parallelism uint8
+	// KeyLen - длина хэша в байтах
+	KeyLen uint32
+}
+
+// Argon2id хэширует пароли argon2id в формате PHC:
+// $argon2id$v=19$m=65536,t=3,p=2$<соль>$<хэш> (base64 без выравнивания).
+// Хэши bcrypt тоже принимаются, но всегда помечаются для пересчета.
+type Argon2id struct {
+	params Argon2Params
+	// memory ограничивает память в KiB, занятую одновременными вычислениями хэшей
+	memory *semaphore.Weighted
+	budget uint32
+}
+
+// NewArgon2id создает хэшер с параметрами params для новых хэшей. Одновременные вычисления
+// занимают не больше memoryBudget KiB: остальные ждут своей очереди. Бюджет меньше
+// params.Memory увеличивается до него, то есть хэши считаются по одному.
+func NewArgon2id(params Argon2Params, memoryBudget uint32) *Argon2id {
+	memoryBudget = max(memoryBudget, params.Memory)
+	return &Argon2id{
+		params: params,
+		memory: semaphore.NewWeighted(int64(memoryBudget)),
+		budget: memoryBudget,
+	}
+}
+
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	p := a.params
+	key, err := a.idKey(password, salt, p)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2id) Verify(hash, password string) (bool, error) {
+	if isBcrypt(hash) {
+		return true, verifyBcrypt(hash, password)
+	}
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return false, ErrUnknownHash
+	}
+
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	actual, err := a.idKey(password, salt, params)
+	if err != nil {
+		return false, err
+	}
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return false, ErrMismatch
+	}
+
+	return params != a.params, nil
+}
+
+// idKey считает ключ argon2id в пределах бюджета памяти. Хэш, которому нужно больше
+// всего бюджета, не считается вовсе.
+func (a *Argon2id) idKey(password string, salt []byte, p Argon2Params) ([]byte, error) {
+	if p.Memory > a.budget {
+		return nil, fmt.Errorf("argon2 memory %d KiB exceeds budget of %d KiB", p.Memory, a.budget)
+	}
+	if err := a.memory.Acquire(context.Background(), int64(p.Memory)); err != nil {
+		return nil, err
+	}
+	defer a.memory.Release(int64(p.Memory))
+
+	return argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLen), nil
+}
+
+// parseArgon2id разбирает хэш в формате PHC.
+func parseArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", соль, хэш
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: unsupported argon2 version %q", ErrUnknownHash, parts[2])
+	}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, fmt.Errorf("%w: invalid argon2 parameters %q", ErrUnknownHash, parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("%w: invalid salt", ErrUnknownHash)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("%w: invalid hash", ErrUnknownHash)
+	}
+	params.KeyLen = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,44 @@
+// Package passhash хэширует пароли пользователей. Хэш несет префикс алгоритма
+// ($argon2id$, $2a$/$2b$/$2y$ у bcrypt), поэтому в базе могут одновременно жить хэши
+// разных алгоритмов и параметров, а устаревшие обновляются при следующем входе.
+package passhash
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrMismatch - пароль не совпадает с хэшем
+	ErrMismatch = errors.New("password does not match")
+	// ErrUnknownHash - хэш без известного префикса или поврежден
+	ErrUnknownHash = errors.New("unknown password hash format")
+)
+
+// Hasher хэширует новые пароли и проверяет сохраненные хэши.
+type Hasher interface {
+	// Hash возвращает хэш пароля с префиксом алгоритма.
+	Hash(password string) (string, error)
+	// Verify проверяет пароль. Неверный пароль - ErrMismatch. needsRehash = true, если хэш
+	// получен другим алгоритмом или с другими параметрами и его стоит пересчитать.
+	Verify(hash, password string) (needsRehash bool, err error)
+}
+
+// isBcrypt - хэш в формате bcrypt, которым сервер хэшировал пароли раньше.
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// verifyBcrypt проверяет пароль по bcrypt хэшу.
+func verifyBcrypt(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatch
+	}
+	if err != nil {
+		return errors.Join(ErrUnknownHash, err)
+	}
+	return nil
+}
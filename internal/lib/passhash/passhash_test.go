@@ -0,0 +1,104 @@
+package passhash
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testParams = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, KeyLen: 32}
+
+func TestArgon2id(t *testing.T) {
+	h := NewArgon2id(testParams, 0)
+
+	// Longer than bcrypt's 72-byte limit: the tail must matter
+	long := strings.Repeat("a", 100)
+	hash, err := h.Hash(long)
+	if err != nil {
+		t.Fatalf("Hash error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected hash format: %s", hash)
+	}
+	if other, _ := h.Hash(long); other == hash {
+		t.Fatalf("hashes must be salted")
+	}
+
+	if rehash, err := h.Verify(hash, long); err != nil || rehash {
+		t.Fatalf("expected match without rehash: %v %v", rehash, err)
+	}
+	if _, err := h.Verify(hash, strings.Repeat("a", 99)+"b"); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+
+	// Stronger parameters mark existing hashes for rehash
+	stronger := NewArgon2id(Argon2Params{Memory: 128, Iterations: 2, Parallelism: 1, KeyLen: 32}, 0)
+	if rehash, err := stronger.Verify(hash, long); err != nil || !rehash {
+		t.Fatalf("weaker hash must need rehash: %v %v", rehash, err)
+	}
+}
+
+func TestVerifyBcrypt(t *testing.T) {
+	h := NewArgon2id(testParams, 0)
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+
+	if rehash, err := h.Verify(string(legacy), "secret"); err != nil || !rehash {
+		t.Fatalf("bcrypt hash must verify and need rehash: %v %v", rehash, err)
+	}
+	if _, err := h.Verify(string(legacy), "wrong"); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	h := NewArgon2id(testParams, 0)
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+	} {
+		if _, err := h.Verify(hash, "secret"); !errors.Is(err, ErrUnknownHash) {
+			t.Fatalf("%q: expected ErrUnknownHash, got %v", hash, err)
+		}
+	}
+}
+
+func TestArgon2idMemoryBudget(t *testing.T) {
+	h := NewArgon2id(testParams, 2*testParams.Memory)
+
+	// Concurrent hashes wait for the budget instead of failing
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hash, err := h.Hash("secret")
+			if err == nil {
+				_, err = h.Verify(hash, "secret")
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// A stored hash that needs more than the whole budget is not computed
+	stronger := NewArgon2id(Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, KeyLen: 32}, 0)
+	hash, _ := stronger.Hash("secret")
+	if _, err := h.Verify(hash, "secret"); err == nil || errors.Is(err, ErrMismatch) {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(rate float64, burst int) (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	l := New(rate, burst)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	l, clock := newTestLimiter(2, 3)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within burst must be allowed", i)
+		}
+	}
+
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatalf("expected request over burst to be rejected")
+	}
+	if wait != 500*time.Millisecond {
+		t.Fatalf("unexpected retry after: %v", wait)
+	}
+
+	// Other keys have their own buckets
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatalf("independent key must be allowed")
+	}
+
+	clock.advance(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatalf("expected a token after refill")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatalf("only one token should have been refilled")
+	}
+
+	// Bucket never holds more than burst
+	clock.advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		l.Allow("a")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatalf("bucket must be capped at burst")
+	}
+}
+
+func TestLimiterSweepsIdleBuckets(t *testing.T) {
+	l, clock := newTestLimiter(1, 1)
+
+	l.Allow("a")
+	l.Allow("b")
+	if l.Len() != 2 {
+		t.Fatalf("expected 2 buckets, got %d", l.Len())
+	}
+
+	clock.advance(2 * sweepInterval)
+	l.Allow("c")
+	if l.Len() != 1 {
+		t.Fatalf("expected refilled buckets to be swept, got %d", l.Len())
+	}
+}
+
+func TestNilLimiterAllowsEverything(t *testing.T) {
+	l := New(0, 10)
+	if l != nil {
+		t.Fatalf("zero rate must disable the limiter")
+	}
+	if ok, wait := l.Allow("a"); !ok || wait != 0 {
+		t.Fatalf("nil limiter must allow requests")
+	}
+}
+
+func TestDefaultBurst(t *testing.T) {
+	l, _ := newTestLimiter(2.5, 0)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within default burst must be allowed", i)
+		}
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatalf("default burst must be ceil(rate)")
+	}
+}
@@ -0,0 +1,64 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed from RFC 6238 Appendix B ("12345678901234567890") in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// Last six digits of the RFC 6238 SHA1 test vectors
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		got, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+		if err != nil || got != want {
+			t.Fatalf("T=%d: got %q (%v), want %q", unix, got, err, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret error: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	code, _ := Code(secret, Step(now))
+
+	if step, ok := Validate(secret, code, now); !ok || step != Step(now) {
+		t.Fatalf("current code must be valid")
+	}
+	// One step of clock drift is tolerated, two are not
+	if _, ok := Validate(secret, code, now.Add(Period)); !ok {
+		t.Fatalf("code from the previous step must be valid")
+	}
+	if _, ok := Validate(secret, code, now.Add(2*Period)); ok {
+		t.Fatalf("code two steps old must be rejected")
+	}
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Validate(secret, bad, now); ok {
+			t.Fatalf("%q must be rejected", bad)
+		}
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("go-chat", "alice@example.com", rfcSecret))
+	if err != nil {
+		t.Fatalf("invalid uri: %v", err)
+	}
+	q := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/go-chat:alice@example.com" ||
+		q.Get("secret") != rfcSecret || q.Get("issuer") != "go-chat" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Fatalf("unexpected uri: %s", u)
+	}
+}
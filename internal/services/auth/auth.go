@@ -5,12 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
 	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/passhash"
 	"github.com/grigory222/go-chat-server/internal/storage"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type Service struct {
@@ -18,7 +19,31 @@ type Service struct {
 	storage         storage.Storage
 	accessTokenTTL  time.Duration
 	refreshTokenTTL time.Duration
-	jwtSecret       []byte
+	keys            *KeySet
+	// streams закрывает открытые стримы отозванных сессий; может быть nil
+	streams      SessionCloser
+	mail         Mail
+	verification Verification
+	mfa          MFA
+	protection   LoginProtection
+	hasher       passhash.Hasher
+	// dummyHash - хэш для сравнения, когда пользователь не найден; считается при первом вызове
+	dummyHash     string
+	dummyHashOnce sync.Once
+	oidc          OIDC
+	// mailing - письма, которые отправляются в фоне
+	mailing sync.WaitGroup
+}
+
+// Options - настройки необязательных функций сервиса: нулевое значение поля отключает
+// соответствующую функцию. Hasher обязателен.
+type Options struct {
+	Mail            Mail
+	Verification    Verification
+	MFA             MFA
+	LoginProtection LoginProtection
+	Hasher          passhash.Hasher
+	OIDC            OIDC
 }
 
 func New(
@@ -26,60 +51,144 @@ func New(
 	storage storage.Storage,
 	accessTokenTTL time.Duration,
 	refreshTokenTTL time.Duration,
-	jwtSecret string,
+	keys *KeySet,
+	streams SessionCloser,
+	opts Options,
 ) *Service {
 	return &Service{
 		log:             log,
 		storage:         storage,
 		accessTokenTTL:  accessTokenTTL,
 		refreshTokenTTL: refreshTokenTTL,
-		jwtSecret:       []byte(jwtSecret),
+		keys:            keys,
+		streams:         streams,
+		mail:            opts.Mail,
+		verification:    opts.Verification,
+		mfa:             opts.MFA,
+		protection:      opts.LoginProtection,
+		hasher:          opts.Hasher,
+		oidc:            opts.OIDC,
 	}
 }
 
-func (s *Service) Login(ctx context.Context, email, password string) (accessToken, refreshToken string, user *chatpb.User, err error) {
+// Login проверяет пароль и открывает новую сессию на устройстве client.
+// Если у пользователя включена 2FA, вместо токенов возвращается MFARequiredError
+// с токеном для VerifyMFA.
+func (s *Service) Login(ctx context.Context, email, password string, client models.ClientInfo) (accessToken, refreshToken string, user *chatpb.User, err error) {
 	const op = "services.auth.Login"
 	log := s.log.With(slog.String("op", op), slog.String("email", email))
 
+	// Заблокированный вход неотличим от неверного пароля: счетчик аккаунта ведется по email,
+	// поэтому несуществующие адреса блокируются так же, как зарегистрированные
+	attempt, wait := s.protection.begin(email, client.IP)
+	if wait > 0 {
+		log.Warn("login attempt blocked", slog.String("ip", client.IP), slog.Duration("retry_after", wait))
+		return "", "", nil, fmt.Errorf("%s: %w", op, models.ErrInvalidCredentials)
+	}
+	defer attempt.end()
+
 	dbUser, err := s.storage.UserByEmail(ctx, email)
 	if err != nil {
-		// Не раскрываем информацию о том, существует ли пользователь
+		if !errors.Is(err, models.ErrUserNotFound) {
+			log.Error("failed to get user by email", slog.Any("err", err))
+			return "", "", nil, fmt.Errorf("%s: %w", op, err)
+		}
+		// Не раскрываем информацию о том, существует ли пользователь, в том числе по времени ответа
+		s.verifyDummy(password)
+		attempt.fail()
 		return "", "", nil, fmt.Errorf("%s: %w", op, models.ErrInvalidCredentials)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(dbUser.PasswordHash), []byte(password)); err != nil {
+	needsRehash, err := s.verifyPassword(dbUser, password)
+	if err != nil {
+		if !errors.Is(err, passhash.ErrMismatch) {
+			log.Error("failed to verify password hash", slog.Any("err", err))
+			return "", "", nil, fmt.Errorf("%s: %w", op, err)
+		}
+		attempt.fail()
 		return "", "", nil, fmt.Errorf("%s: %w", op, models.ErrInvalidCredentials)
 	}
+	if needsRehash {
+		s.rehashPassword(ctx, dbUser, password)
+	}
 
-	accessToken, refreshToken, err = NewTokens(dbUser, s.accessTokenTTL, s.refreshTokenTTL, s.jwtSecret)
+	// Проверяем после пароля: иначе по ответу можно было бы узнать, зарегистрирован ли email
+	if s.verification.RequiredForLogin && !dbUser.EmailVerified {
+		log.Info("login rejected: email not verified")
+		return "", "", nil, fmt.Errorf("%s: %w", op, models.ErrEmailNotVerified)
+	}
+
+	// При включенной 2FA вместо токенов выдается токен второго шага
+	if err := s.requireSecondFactor(ctx, dbUser.ID); err != nil {
+		return "", "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	accessToken, refreshToken, user, err = s.startSession(ctx, dbUser, client)
 	if err != nil {
-		log.Error("failed to create tokens", slog.Any("err", err))
 		return "", "", nil, fmt.Errorf("%s: %w", op, err)
 	}
+	attempt.succeed()
+
+	return accessToken, refreshToken, user, nil
+}
+
+// startSession открывает новую сессию на устройстве client и выдает ее первую пару токенов.
+func (s *Service) startSession(ctx context.Context, dbUser *models.User, client models.ClientInfo) (accessToken, refreshToken string, user *chatpb.User, err error) {
+	log := s.log.With(slog.Int64("user_id", dbUser.ID))
+
+	// Каждый вход начинает новую сессию - семейство refresh токенов
+	sessionID, err := newTokenID()
+	if err != nil {
+		return "", "", nil, err
+	}
+	tokens, err := NewTokens(dbUser, sessionID, s.accessTokenTTL, s.refreshTokenTTL, s.keys)
+	if err != nil {
+		log.Error("failed to create tokens", slog.Any("err", err))
+		return "", "", nil, err
+	}
+
+	session := &models.Session{
+		ID:        sessionID,
+		UserID:    dbUser.ID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		ExpiresAt: tokens.RefreshExpiresAt,
+	}
+	if err := s.storage.CreateSession(ctx, session, tokens.RefreshID); err != nil {
+		log.Error("failed to create session", slog.Any("err", err))
+		return "", "", nil, err
+	}
 
 	protoUser := &chatpb.User{
-		Id:   dbUser.ID,
-		Name: dbUser.Name,
+		Id:            dbUser.ID,
+		Name:          dbUser.Name,
+		EmailVerified: dbUser.EmailVerified,
 	}
 
-	return accessToken, refreshToken, protoUser, nil
+	return tokens.AccessToken, tokens.RefreshToken, protoUser, nil
 }
 
 func (s *Service) Register(ctx context.Context, name, email, password string) (*chatpb.User, error) {
 	const op = "services.auth.Register"
 	log := s.log.With(slog.String("op", op), slog.String("email", email))
 
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	passHash, err := s.hasher.Hash(password)
 	if err != nil {
 		log.Error("failed to generate password hash", slog.Any("err", err))
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	userID, err := s.storage.SaveUser(ctx, name, email, string(passHash))
+	userID, err := s.storage.SaveUser(ctx, name, email, passHash)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	// Пользователь уже создан: сбой почты не отменяет регистрацию, письмо можно запросить повторно
+	user := &models.User{ID: userID, Name: name, Email: email}
+	if err := s.sendVerification(ctx, user); err != nil {
+		log.Error("failed to send verification email", slog.Any("err", err))
+	}
+
 	protoUser := &chatpb.User{
 		Id:   userID,
 		Name: name,
@@ -88,35 +197,58 @@ func (s *Service) Register(ctx context.Context, name, email, password string) (*
 	return protoUser, nil
 }
 
-func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (string, error) {
+// RefreshToken обменивает refresh токен на новую пару токенов той же сессии. Старый refresh
+// токен после этого недействителен; его повторное предъявление считается кражей
+// и отзывает всю сессию.
+func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (accessToken, newRefreshToken string, err error) {
 	const op = "services.auth.RefreshToken"
 	log := s.log.With(slog.String("op", op))
 
-	// 1. Валидируем токен и получаем из него ID пользователя
-	userID, err := GetUserID(refreshToken, s.jwtSecret)
+	// 1. Валидируем токен и получаем из него ID пользователя.
+	// Access токен здесь не принимается: он проверяется как токен другого типа и аудитории
+	claims, err := ParseRefreshToken(refreshToken, s.keys)
 	if err != nil {
 		log.Warn("invalid refresh token", slog.Any("err", err))
 		// Возвращаем ошибку, которую поймет gRPC слой
-		return "", models.ErrInvalidCredentials
+		return "", "", models.ErrInvalidCredentials
 	}
+	userID := claims.UserID
+	log = log.With(slog.Int64("user_id", userID), slog.String("session_id", claims.SessionID))
 
 	// 2. Проверяем, что пользователь с таким ID все еще существует в БД
 	user, err := s.storage.UserByID(ctx, userID)
 	if err != nil {
 		if errors.Is(err, models.ErrUserNotFound) {
-			log.Warn("user from token not found", slog.Int64("user_id", userID))
-			return "", models.ErrInvalidCredentials
+			log.Warn("user from token not found")
+			return "", "", models.ErrInvalidCredentials
 		}
 		log.Error("failed to get user by id", slog.Any("err", err))
-		return "", err
+		return "", "", err
+	}
+
+	// 3. Генерируем новую пару токенов той же сессии
+	tokens, err := NewTokens(user, claims.SessionID, s.accessTokenTTL, s.refreshTokenTTL, s.keys)
+	if err != nil {
+		log.Error("failed to create tokens", slog.Any("err", err))
+		return "", "", err
 	}
 
-	// 3. Генерируем новый access токен
-	newAccessToken, err := newAccessToken(user, s.accessTokenTTL, s.jwtSecret)
+	// 4. Заменяем использованный refresh токен новым
+	err = s.storage.RotateRefreshToken(ctx, claims.SessionID, claims.ID, tokens.RefreshID, tokens.RefreshExpiresAt)
 	if err != nil {
-		log.Error("failed to create new access token", slog.Any("err", err))
-		return "", err
+		if errors.Is(err, models.ErrRefreshTokenReused) {
+			log.Warn("refresh token reuse detected, session revoked")
+			// Сессию мог захватить тот, кто украл токен: закрываем и ее открытые стримы
+			s.closeStreams(claims.SessionID)
+			return "", "", models.ErrInvalidCredentials
+		}
+		if errors.Is(err, models.ErrSessionNotFound) {
+			log.Warn("refresh token session not found, expired or revoked")
+			return "", "", models.ErrInvalidCredentials
+		}
+		log.Error("failed to rotate refresh token", slog.Any("err", err))
+		return "", "", err
 	}
 
-	return newAccessToken, nil
+	return tokens.AccessToken, tokens.RefreshToken, nil
 }
@@ -5,10 +5,12 @@ import (
 	"errors"
 	"log/slog"
 	"os"
+	"sort"
 	"testing"
 	"time"
 
 	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/passhash"
 	"github.com/grigory222/go-chat-server/internal/storage"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -20,10 +22,56 @@ type mockStorage struct {
 	nextID       int64
 	saveErr      error
 	getErr       error
+
+	sessions map[string]*models.Session
+	// resetTokens maps reset token hash to its state
+	resetTokens map[string]*mockResetToken
+	// verifyTokens maps verification token hash to its state
+	verifyTokens map[string]*mockVerifyToken
+	// refreshTokens maps refresh jti to its session; used tokens are kept to detect reuse
+	refreshTokens map[string]*mockRefreshToken
+
+	totp map[int64]*models.TOTP
+	// recoveryCodes maps user ID to code hash and whether it was used
+	recoveryCodes map[int64]map[string]bool
+
+	oidcStates map[string]*models.OIDCState
+	// identities maps issuer and subject to user ID
+	identities map[[2]string]int64
+}
+
+type mockResetToken struct {
+	userID    int64
+	expiresAt time.Time
+	createdAt time.Time
+	used      bool
+}
+
+type mockVerifyToken struct {
+	userID    int64
+	expiresAt time.Time
+	createdAt time.Time
+}
+
+type mockRefreshToken struct {
+	sessionID string
+	used      bool
 }
 
 func newMockStorage() *mockStorage {
-	return &mockStorage{usersByEmail: map[string]*models.User{}, usersByID: map[int64]*models.User{}, nextID: 1}
+	return &mockStorage{
+		usersByEmail:  map[string]*models.User{},
+		usersByID:     map[int64]*models.User{},
+		nextID:        1,
+		sessions:      map[string]*models.Session{},
+		refreshTokens: map[string]*mockRefreshToken{},
+		resetTokens:   map[string]*mockResetToken{},
+		verifyTokens:  map[string]*mockVerifyToken{},
+		totp:          map[int64]*models.TOTP{},
+		recoveryCodes: map[int64]map[string]bool{},
+		oidcStates:    map[string]*models.OIDCState{},
+		identities:    map[[2]string]int64{},
+	}
 }
 
 func (m *mockStorage) SaveUser(ctx context.Context, name, email, passHash string) (int64, error) {
@@ -61,15 +109,152 @@ func (m *mockStorage) UserByID(ctx context.Context, id int64) (*models.User, err
 	}
 	return u, nil
 }
+func (m *mockStorage) ChangePassword(ctx context.Context, userID int64, passHash, keepSessionID string) ([]string, error) {
+	u, ok := m.usersByID[userID]
+	if !ok {
+		return nil, models.ErrUserNotFound
+	}
+	u.PasswordHash = passHash
+	var ids []string
+	for id := range m.sessions {
+		if id == keepSessionID {
+			continue
+		}
+		if err := m.RevokeSession(ctx, userID, id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+func (m *mockStorage) CreatePasswordResetToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	for hash, t := range m.resetTokens {
+		if t.userID == userID && !t.used {
+			delete(m.resetTokens, hash)
+		}
+	}
+	m.resetTokens[tokenHash] = &mockResetToken{userID: userID, expiresAt: expiresAt, createdAt: time.Now()}
+	return nil
+}
+func (m *mockStorage) PasswordResetSentAt(ctx context.Context, userID int64) (time.Time, error) {
+	var sentAt time.Time
+	for _, t := range m.resetTokens {
+		if t.userID == userID && t.createdAt.After(sentAt) {
+			sentAt = t.createdAt
+		}
+	}
+	return sentAt, nil
+}
+func (m *mockStorage) ResetPassword(ctx context.Context, tokenHash, passHash string) (int64, []string, error) {
+	t, ok := m.resetTokens[tokenHash]
+	if !ok || t.used || !t.expiresAt.After(time.Now()) {
+		return 0, nil, models.ErrResetTokenInvalid
+	}
+	t.used = true
+	m.usersByID[t.userID].PasswordHash = passHash
+	ids, _ := m.RevokeUserSessions(ctx, t.userID)
+	return t.userID, ids, nil
+}
+func (m *mockStorage) CreateEmailVerificationToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	for hash, t := range m.verifyTokens {
+		if t.userID == userID {
+			delete(m.verifyTokens, hash)
+		}
+	}
+	m.verifyTokens[tokenHash] = &mockVerifyToken{userID: userID, expiresAt: expiresAt, createdAt: time.Now()}
+	return nil
+}
+func (m *mockStorage) EmailVerificationSentAt(ctx context.Context, userID int64) (time.Time, error) {
+	for _, t := range m.verifyTokens {
+		if t.userID == userID {
+			return t.createdAt, nil
+		}
+	}
+	return time.Time{}, nil
+}
+func (m *mockStorage) VerifyEmail(ctx context.Context, tokenHash string) (int64, error) {
+	t, ok := m.verifyTokens[tokenHash]
+	if !ok || !t.expiresAt.After(time.Now()) {
+		return 0, models.ErrVerifyTokenInvalid
+	}
+	delete(m.verifyTokens, tokenHash)
+	m.usersByID[t.userID].EmailVerified = true
+	return t.userID, nil
+}
+func (m *mockStorage) CreateSession(ctx context.Context, session *models.Session, refreshID string) error {
+	stored := *session
+	stored.CreatedAt, stored.LastUsedAt = time.Now(), time.Now()
+	m.sessions[session.ID] = &stored
+	m.refreshTokens[refreshID] = &mockRefreshToken{sessionID: session.ID}
+	return nil
+}
+func (m *mockStorage) RotateRefreshToken(ctx context.Context, sessionID, oldID, newID string, expiresAt time.Time) error {
+	session, ok := m.sessions[sessionID]
+	token, found := m.refreshTokens[oldID]
+	if !ok || !found || token.sessionID != sessionID || session.RevokedAt != nil {
+		return models.ErrSessionNotFound
+	}
+	if token.used {
+		now := time.Now()
+		session.RevokedAt = &now
+		return models.ErrRefreshTokenReused
+	}
+	token.used = true
+	m.refreshTokens[newID] = &mockRefreshToken{sessionID: sessionID}
+	session.LastUsedAt, session.ExpiresAt = time.Now(), expiresAt
+	return nil
+}
+
+func (m *mockStorage) activeSession(sessionID string) (*models.Session, bool) {
+	session, ok := m.sessions[sessionID]
+	if !ok || session.RevokedAt != nil || !session.ExpiresAt.After(time.Now()) {
+		return nil, false
+	}
+	return session, true
+}
+func (m *mockStorage) Sessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	var res []*models.Session
+	for id, session := range m.sessions {
+		if _, ok := m.activeSession(id); ok && session.UserID == userID {
+			res = append(res, session)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].LastUsedAt.After(res[j].LastUsedAt) })
+	return res, nil
+}
+func (m *mockStorage) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	_, ok := m.activeSession(sessionID)
+	return ok, nil
+}
+func (m *mockStorage) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	session, ok := m.activeSession(sessionID)
+	if !ok || session.UserID != userID {
+		return models.ErrSessionNotFound
+	}
+	now := time.Now()
+	session.RevokedAt = &now
+	return nil
+}
+func (m *mockStorage) RevokeUserSessions(ctx context.Context, userID int64) ([]string, error) {
+	var ids []string
+	for id := range m.sessions {
+		if err := m.RevokeSession(ctx, userID, id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
 
 // Unused chat-related methods
-func (m *mockStorage) CreateChat(ctx context.Context, name string) (int64, error) {
+func (m *mockStorage) CreateChat(ctx context.Context, name, chatType string) (int64, error) {
 	return 0, errors.New("not implemented")
 }
-func (m *mockStorage) AddUserToChat(ctx context.Context, chatID, userID int64) error {
+func (m *mockStorage) AddUserToChat(ctx context.Context, chatID, userID int64, role models.ChatRole) error {
 	return errors.New("not implemented")
 }
-func (m *mockStorage) SaveMessage(ctx context.Context, chatID, userID int64, text string) (*models.Message, error) {
+func (m *mockStorage) SaveMessage(ctx context.Context, chatID, userID int64, text, idempotencyKey string, attachmentIDs []int64, ttl time.Duration, claimSlowModeSlot bool) (*models.Message, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) MessageByIdempotencyKey(ctx context.Context, chatID, userID int64, idempotencyKey string) (*models.Message, error) {
 	return nil, errors.New("not implemented")
 }
 func (m *mockStorage) GetChatHistory(ctx context.Context, chatID int64, limit, offset uint64) ([]*models.Message, error) {
@@ -78,15 +263,225 @@ func (m *mockStorage) GetChatHistory(ctx context.Context, chatID int64, limit, o
 func (m *mockStorage) IsUserInChat(ctx context.Context, userID, chatID int64) (bool, error) {
 	return false, errors.New("not implemented")
 }
+func (m *mockStorage) SearchMessages(ctx context.Context, userID int64, query string, filter models.SearchFilter, limit, offset uint64) ([]*models.SearchResult, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) SaveAttachment(ctx context.Context, attachment *models.Attachment) (int64, error) {
+	return 0, errors.New("not implemented")
+}
+func (m *mockStorage) AttachmentByID(ctx context.Context, id int64) (*models.Attachment, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) MessageByID(ctx context.Context, id int64) (*models.Message, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) SaveThumbnail(ctx context.Context, thumbnail *models.Thumbnail) error {
+	return errors.New("not implemented")
+}
+func (m *mockStorage) ChatMemberRole(ctx context.Context, chatID, userID int64) (models.ChatRole, error) {
+	return "", errors.New("not implemented")
+}
+func (m *mockStorage) PinMessage(ctx context.Context, chatID, messageID, pinnedBy int64, maxPins int) (bool, error) {
+	return false, errors.New("not implemented")
+}
+func (m *mockStorage) UnpinMessage(ctx context.Context, chatID, messageID int64) (bool, error) {
+	return false, errors.New("not implemented")
+}
+func (m *mockStorage) PinnedMessages(ctx context.Context, chatID int64) ([]*models.Message, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) SaveScheduledMessage(ctx context.Context, chatID, userID int64, text string, sendAt time.Time) (*models.ScheduledMessage, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) ScheduledMessages(ctx context.Context, userID, chatID int64) ([]*models.ScheduledMessage, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) UpdateScheduledMessage(ctx context.Context, id, userID int64, text string, sendAt time.Time) (*models.ScheduledMessage, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) DeleteScheduledMessage(ctx context.Context, id, userID int64) error {
+	return errors.New("not implemented")
+}
+func (m *mockStorage) ClaimDueScheduledMessages(ctx context.Context, lease time.Duration, limit int) ([]*models.ScheduledMessage, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) FinishScheduledMessage(ctx context.Context, id, messageID int64) error {
+	return errors.New("not implemented")
+}
+func (m *mockStorage) RetentionPolicy(ctx context.Context, chatID int64) (*models.RetentionPolicy, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) SetRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy, actorID int64) error {
+	return errors.New("not implemented")
+}
+func (m *mockStorage) ActiveRetentionPolicies(ctx context.Context) ([]*models.RetentionPolicy, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) PurgeExpiredMessages(ctx context.Context, chatID int64, limit int) (*models.PurgeBatch, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) SavePurgeRun(ctx context.Context, run *models.PurgeRun) error {
+	return errors.New("not implemented")
+}
+func (m *mockStorage) DeleteExpiredMessages(ctx context.Context, limit int) (*models.PurgeBatch, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) SlowMode(ctx context.Context, chatID int64) (time.Duration, error) {
+	return 0, errors.New("not implemented")
+}
+func (m *mockStorage) SetSlowMode(ctx context.Context, chatID int64, interval time.Duration) error {
+	return errors.New("not implemented")
+}
+func (m *mockStorage) ChatByID(ctx context.Context, chatID int64) (*models.Chat, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) ChatMember(ctx context.Context, chatID, userID int64) (*models.ChatMember, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) ModerationSettings(ctx context.Context, chatID int64) (*models.ModerationSettings, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) SetModerationSettings(ctx context.Context, settings *models.ModerationSettings) error {
+	return errors.New("not implemented")
+}
+func (m *mockStorage) IsServerAdmin(ctx context.Context, userID int64) (bool, error) {
+	return false, errors.New("not implemented")
+}
+func (m *mockStorage) CreateReport(ctx context.Context, messageID, reporterID int64, reason string) (*models.Report, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) ReportByID(ctx context.Context, id int64) (*models.Report, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) Reports(ctx context.Context, filter models.ReportFilter, limit, offset uint64) ([]*models.Report, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) ClaimReport(ctx context.Context, id, moderatorID int64, claimTTL time.Duration) (*models.Report, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) ResolveReport(ctx context.Context, res *models.ReportResolution) (*models.Report, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) ModerationAudit(ctx context.Context, chatID int64, limit, offset uint64) ([]*models.AuditEntry, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockStorage) SetMemberMute(ctx context.Context, chatID, userID, moderatorID int64, until *time.Time) error {
+	return errors.New("not implemented")
+}
+func (m *mockStorage) SaveTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	if t, ok := m.totp[userID]; ok && t.Enabled {
+		return models.ErrTOTPAlreadyEnabled
+	}
+	m.totp[userID] = &models.TOTP{UserID: userID, Secret: secret}
+	return nil
+}
+func (m *mockStorage) TOTPByUserID(ctx context.Context, userID int64) (*models.TOTP, error) {
+	t, ok := m.totp[userID]
+	if !ok {
+		return nil, models.ErrTOTPNotFound
+	}
+	copied := *t
+	return &copied, nil
+}
+func (m *mockStorage) EnableTOTP(ctx context.Context, userID, step int64, recoveryHashes []string) error {
+	t, ok := m.totp[userID]
+	if !ok || t.Enabled {
+		return models.ErrTOTPAlreadyEnabled
+	}
+	t.Enabled, t.LastStep = true, step
+	m.recoveryCodes[userID] = map[string]bool{}
+	for _, h := range recoveryHashes {
+		m.recoveryCodes[userID][h] = false
+	}
+	return nil
+}
+func (m *mockStorage) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	t, ok := m.totp[userID]
+	if !ok || !t.Enabled || t.LastStep >= step {
+		return models.ErrTOTPCodeInvalid
+	}
+	t.LastStep = step
+	return nil
+}
+func (m *mockStorage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	used, ok := m.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return models.ErrTOTPCodeInvalid
+	}
+	m.recoveryCodes[userID][codeHash] = true
+	return nil
+}
+func (m *mockStorage) DisableTOTP(ctx context.Context, userID int64) error {
+	delete(m.totp, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+func (m *mockStorage) UpdatePasswordHash(ctx context.Context, userID int64, oldHash, newHash string) error {
+	if u, ok := m.usersByID[userID]; ok && u.PasswordHash == oldHash {
+		u.PasswordHash = newHash
+	}
+	return nil
+}
+func (m *mockStorage) CreateOIDCState(ctx context.Context, state *models.OIDCState) error {
+	m.oidcStates[state.StateHash] = state
+	return nil
+}
+func (m *mockStorage) ConsumeOIDCState(ctx context.Context, stateHash string) (*models.OIDCState, error) {
+	state, ok := m.oidcStates[stateHash]
+	delete(m.oidcStates, stateHash)
+	if !ok || time.Now().After(state.ExpiresAt) {
+		return nil, models.ErrOIDCStateInvalid
+	}
+	return state, nil
+}
+func (m *mockStorage) UserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	id, ok := m.identities[[2]string{issuer, subject}]
+	if !ok {
+		return nil, models.ErrUserNotFound
+	}
+	return m.usersByID[id], nil
+}
+func (m *mockStorage) LinkIdentity(ctx context.Context, userID int64, issuer, subject string) ([]string, error) {
+	u, ok := m.usersByID[userID]
+	if !ok {
+		return nil, models.ErrUserNotFound
+	}
+	m.identities[[2]string{issuer, subject}] = userID
+	if u.EmailVerified {
+		return nil, nil
+	}
+	u.EmailVerified, u.PasswordHash = true, ""
+	return m.RevokeUserSessions(ctx, userID)
+}
+func (m *mockStorage) SaveOIDCUser(ctx context.Context, name, email, issuer, subject string) (int64, error) {
+	id, err := m.SaveUser(ctx, name, email, "")
+	if err != nil {
+		return 0, err
+	}
+	m.usersByID[id].EmailVerified = true
+	m.identities[[2]string{issuer, subject}] = id
+	return id, nil
+}
+func (m *mockStorage) DeleteOrphanBlob(ctx context.Context, key string, deleteBlob func(context.Context, string) error) (bool, error) {
+	return false, errors.New("not implemented")
+}
+func (m *mockStorage) SetMemberRole(ctx context.Context, chatID, userID, ownerID int64, role models.ChatRole) error {
+	return errors.New("not implemented")
+}
 func (m *mockStorage) Close() {}
 
 var _ storage.Storage = (*mockStorage)(nil)
 
 func testLogger() *slog.Logger { return slog.New(slog.NewTextHandler(os.Stdout, nil)) }
 
+// testHasher uses minimal argon2id parameters to keep tests fast.
+var testHasher = passhash.NewArgon2id(passhash.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, KeyLen: 32}, 0)
+
 func TestRegisterAndLogin(t *testing.T) {
 	st := newMockStorage()
-	svc := New(testLogger(), st, time.Minute, time.Hour, "secret")
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		Hasher: testHasher,
+	})
 
 	user, err := svc.Register(context.Background(), "Alice", "alice@example.com", "password")
 	if err != nil {
@@ -102,7 +497,7 @@ func TestRegisterAndLogin(t *testing.T) {
 		t.Fatalf("expected ErrUserExists, got %v", err)
 	}
 
-	access, refresh, pbUser, err := svc.Login(context.Background(), "alice@example.com", "password")
+	access, refresh, pbUser, err := svc.Login(context.Background(), "alice@example.com", "password", models.ClientInfo{})
 	if err != nil {
 		t.Fatalf("login error: %v", err)
 	}
@@ -114,7 +509,7 @@ func TestRegisterAndLogin(t *testing.T) {
 	}
 
 	// Wrong password
-	_, _, _, err = svc.Login(context.Background(), "alice@example.com", "wrong")
+	_, _, _, err = svc.Login(context.Background(), "alice@example.com", "wrong", models.ClientInfo{})
 	if !errors.Is(err, models.ErrInvalidCredentials) {
 		t.Fatalf("expected invalid credentials, got %v", err)
 	}
@@ -122,37 +517,194 @@ func TestRegisterAndLogin(t *testing.T) {
 
 func TestRefreshToken(t *testing.T) {
 	st := newMockStorage()
-	svc := New(testLogger(), st, time.Minute, time.Hour, "secret")
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		Hasher: testHasher,
+	})
 
 	// Prepare user manually
 	hash, _ := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.DefaultCost)
 	id, _ := st.SaveUser(context.Background(), "Bob", "bob@example.com", string(hash))
-	u := &models.User{ID: id, Name: "Bob"}
-	_, refresh, err := NewTokens(u, time.Minute, time.Hour, []byte("secret"))
+	access, refresh, _, err := svc.Login(context.Background(), "bob@example.com", "pass", models.ClientInfo{})
 	if err != nil {
-		t.Fatalf("tokens error: %v", err)
+		t.Fatalf("login error: %v", err)
+	}
+	if len(st.sessions) != 1 {
+		t.Fatalf("login must create a session, got %d", len(st.sessions))
 	}
 
-	newAccess, err := svc.RefreshToken(context.Background(), refresh)
+	newAccess, newRefresh, err := svc.RefreshToken(context.Background(), refresh)
 	if err != nil {
 		t.Fatalf("refresh error: %v", err)
 	}
-	if newAccess == "" {
-		t.Fatalf("empty new access token")
+	if newAccess == "" || newRefresh == "" || newRefresh == refresh {
+		t.Fatalf("expected a new token pair")
+	}
+
+	// Access token cannot be used to refresh
+	if _, _, err := svc.RefreshToken(context.Background(), access); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials for access token, got %v", err)
+	}
+	accessClaims, err := ParseAccessToken(newAccess, NewHMACKeySet("secret"))
+	if err != nil {
+		t.Fatalf("refreshed token must be an access token: %v", err)
+	}
+	refreshClaims, _ := ParseRefreshToken(newRefresh, NewHMACKeySet("secret"))
+	if accessClaims.SessionID != refreshClaims.SessionID || st.sessions[refreshClaims.SessionID] == nil {
+		t.Fatalf("refreshed tokens must stay in the same session")
 	}
 
 	// Corrupted token
-	_, err = svc.RefreshToken(context.Background(), refresh+"tamper")
+	_, _, err = svc.RefreshToken(context.Background(), newRefresh+"tamper")
 	if !errors.Is(err, models.ErrInvalidCredentials) {
 		t.Fatalf("expected invalid credentials for tampered token, got %v", err)
 	}
 
+	// Signed token without a stored session
+	tokens, _ := NewTokens(&models.User{ID: id, Name: "Bob"}, "unknown", time.Minute, time.Hour, NewHMACKeySet("secret"))
+	if _, _, err := svc.RefreshToken(context.Background(), tokens.RefreshToken); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials for unknown session, got %v", err)
+	}
+
 	// Remove user -> should return invalid credentials
 	delete(st.usersByID, id)
 	delete(st.usersByEmail, "bob@example.com")
-	_, refresh2, _ := NewTokens(u, time.Minute, time.Hour, []byte("secret"))
-	_, err = svc.RefreshToken(context.Background(), refresh2)
-	if !errors.Is(err, models.ErrInvalidCredentials) {
+	if _, _, err := svc.RefreshToken(context.Background(), newRefresh); !errors.Is(err, models.ErrInvalidCredentials) {
 		t.Fatalf("expected invalid credentials after user deletion, got %v", err)
 	}
 }
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	st := newMockStorage()
+	closer := &fakeSessionCloser{}
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), closer, Options{
+		Hasher: testHasher,
+	})
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.DefaultCost)
+	st.SaveUser(context.Background(), "Bob", "bob@example.com", string(hash))
+	_, stolen, _, err := svc.Login(context.Background(), "bob@example.com", "pass", models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("login error: %v", err)
+	}
+	// A second login is an independent session
+	_, other, _, _ := svc.Login(context.Background(), "bob@example.com", "pass", models.ClientInfo{})
+
+	// The legitimate client rotates the token
+	_, current, err := svc.RefreshToken(context.Background(), stolen)
+	if err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+
+	// The attacker replays the rotated token: the whole family is revoked
+	if _, _, err := svc.RefreshToken(context.Background(), stolen); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected reuse to be rejected, got %v", err)
+	}
+	// Streams opened by whoever holds the session are closed too
+	if claims, _ := ParseRefreshToken(current, svc.keys); len(closer.closed) != 1 || closer.closed[0] != claims.SessionID {
+		t.Fatalf("expected streams of the revoked session to be closed, got %v", closer.closed)
+	}
+	if _, _, err := svc.RefreshToken(context.Background(), current); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected the latest token of a revoked family to be rejected, got %v", err)
+	}
+
+	if _, _, err := svc.RefreshToken(context.Background(), other); err != nil {
+		t.Fatalf("other sessions must not be affected: %v", err)
+	}
+}
+
+type fakeSessionCloser struct {
+	closed []string
+}
+
+func (f *fakeSessionCloser) CloseSession(sessionID string) { f.closed = append(f.closed, sessionID) }
+
+func TestSessionsManagement(t *testing.T) {
+	st := newMockStorage()
+	closer := &fakeSessionCloser{}
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), closer, Options{
+		Hasher: testHasher,
+	})
+	ctx := context.Background()
+	if _, err := svc.Register(ctx, "Bob", "bob@example.com", "pass"); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	if _, err := svc.Register(ctx, "Eve", "eve@example.com", "pass"); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+
+	sessionOf := func(access string) string {
+		claims, err := ParseAccessToken(access, NewHMACKeySet("secret"))
+		if err != nil {
+			t.Fatalf("ParseAccessToken error: %v", err)
+		}
+		return claims.SessionID
+	}
+	phone, _, _, _ := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{UserAgent: "phone", IP: "10.0.0.1"})
+	laptop, laptopRefresh, _, _ := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{UserAgent: "laptop", IP: "10.0.0.2"})
+	evil, _, _, _ := svc.Login(ctx, "eve@example.com", "pass", models.ClientInfo{})
+	phoneID, laptopID, evilID := sessionOf(phone), sessionOf(laptop), sessionOf(evil)
+
+	sessions, err := svc.ListSessions(ctx, 1, laptopID)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("expected two sessions, got %v %v", sessions, err)
+	}
+	for _, s := range sessions {
+		if s.Current != (s.Id == laptopID) {
+			t.Fatalf("only the caller's session is current: %+v", s)
+		}
+		if s.Id == phoneID && (s.UserAgent != "phone" || s.Ip != "10.0.0.1") {
+			t.Fatalf("device info not stored: %+v", s)
+		}
+	}
+
+	// Another user's session cannot be revoked
+	if err := svc.RevokeSession(ctx, 1, evilID); !errors.Is(err, models.ErrSessionNotFound) {
+		t.Fatalf("expected session not found, got %v", err)
+	}
+
+	if err := svc.RevokeSession(ctx, 1, phoneID); err != nil {
+		t.Fatalf("RevokeSession error: %v", err)
+	}
+	if active, _ := svc.SessionActive(ctx, phoneID); active {
+		t.Fatalf("revoked session must be inactive")
+	}
+	if len(closer.closed) != 1 || closer.closed[0] != phoneID {
+		t.Fatalf("streams of the revoked session must be closed: %v", closer.closed)
+	}
+
+	if err := svc.Logout(ctx, 1, laptopID); err != nil {
+		t.Fatalf("Logout error: %v", err)
+	}
+	// Refresh tokens of a logged out session stop working
+	if _, _, err := svc.RefreshToken(ctx, laptopRefresh); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials after logout, got %v", err)
+	}
+	if err := svc.Logout(ctx, 1, laptopID); !errors.Is(err, models.ErrSessionNotFound) {
+		t.Fatalf("expected session not found on repeated logout, got %v", err)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	st := newMockStorage()
+	closer := &fakeSessionCloser{}
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), closer, Options{
+		Hasher: testHasher,
+	})
+	ctx := context.Background()
+	if _, err := svc.Register(ctx, "Bob", "bob@example.com", "pass"); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, _, _, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{}); err != nil {
+			t.Fatalf("Login error: %v", err)
+		}
+	}
+
+	revoked, err := svc.LogoutAll(ctx, 1)
+	if err != nil || revoked != 3 || len(closer.closed) != 3 {
+		t.Fatalf("expected three revoked sessions, got %d %v %v", revoked, err, closer.closed)
+	}
+	if sessions, _ := svc.ListSessions(ctx, 1, ""); len(sessions) != 0 {
+		t.Fatalf("no sessions must remain: %v", sessions)
+	}
+}
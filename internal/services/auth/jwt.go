@@ -1,6 +1,9 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
@@ -8,76 +11,168 @@ import (
 	"github.com/grigory222/go-chat-server/internal/domain/models"
 )
 
+const (
+	// TokenIssuer - издатель (iss) всех токенов сервера
+	TokenIssuer = "go-chat-server"
+
+	// TokenTypeAccess - токен для вызова API, принимается только перехватчиками
+	TokenTypeAccess = "access"
+	// TokenTypeRefresh - токен для получения нового access токена, принимается только в RefreshToken
+	TokenTypeRefresh = "refresh"
+	// TokenTypeMFA - токен второго шага входа при включенной 2FA, принимается только в VerifyMFA
+	TokenTypeMFA = "mfa"
+
+	// AudienceAPI - аудитория (aud) access токенов
+	AudienceAPI = "go-chat-api"
+	// AudienceRefresh - аудитория (aud) refresh и MFA токенов
+	AudienceRefresh = "go-chat-auth"
+)
+
 // Claims - структура для кастомных полей в JWT
 type Claims struct {
 	jwt.RegisteredClaims
-	UserID int64  `json:"uid"`
-	Name   string `json:"name"`
+	// Type - тип токена: TokenTypeAccess или TokenTypeRefresh
+	Type string `json:"typ"`
+	// SessionID - сессия входа, к которой относится токен
+	SessionID string `json:"sid"`
+	UserID    int64  `json:"uid"`
+	Name      string `json:"name"`
+	// EmailVerified - email подтвержден на момент выдачи токена
+	EmailVerified bool `json:"email_verified,omitempty"`
+}
+
+// TokenPair - выданная пара токенов. RefreshID и RefreshExpiresAt сохраняются в хранилище,
+// чтобы refresh токен можно было использовать ровно один раз.
+type TokenPair struct {
+	AccessToken      string
+	RefreshToken     string
+	RefreshID        string
+	RefreshExpiresAt time.Time
 }
 
-// NewTokens создает новую пару access и refresh токенов для пользователя.
-func NewTokens(user *models.User, accessTokenTTL, refreshTokenTTL time.Duration, signingKey []byte) (string, string, error) {
+// NewTokens создает новую пару access и refresh токенов для пользователя в сессии sessionID.
+func NewTokens(user *models.User, sessionID string, accessTokenTTL, refreshTokenTTL time.Duration, keys *KeySet) (*TokenPair, error) {
 	// Создание Access токена
-	accessToken, err := newAccessToken(user, accessTokenTTL, signingKey)
+	accessToken, err := newAccessToken(user, sessionID, accessTokenTTL, keys)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
 	// Создание Refresh токена
-	refreshToken, err := newRefreshToken(user.ID, refreshTokenTTL, signingKey)
+	refreshClaims, err := newClaims(TokenTypeRefresh, AudienceRefresh, user.ID, refreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	refreshClaims.SessionID = sessionID
+	refreshToken, err := keys.sign(refreshClaims)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 
-	return accessToken, refreshToken, nil
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		RefreshID:        refreshClaims.ID,
+		RefreshExpiresAt: refreshClaims.ExpiresAt.Time,
+	}, nil
 }
 
 // newAccessToken создает только access токен.
-func newAccessToken(user *models.User, ttl time.Duration, signingKey []byte) (string, error) {
-	claims := Claims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
-		},
-		UserID: user.ID,
-		Name:   user.Name,
+func newAccessToken(user *models.User, sessionID string, ttl time.Duration, keys *KeySet) (string, error) {
+	claims, err := newClaims(TokenTypeAccess, AudienceAPI, user.ID, ttl)
+	if err != nil {
+		return "", err
 	}
+	claims.SessionID = sessionID
+	claims.Name = user.Name
+	claims.EmailVerified = user.EmailVerified
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return keys.sign(claims)
+}
 
-	return token.SignedString(signingKey)
+// newMFAToken выдает токен второго шага входа. Сессии у него еще нет, поэтому sid не заполняется.
+func newMFAToken(userID int64, ttl time.Duration, keys *KeySet) (string, error) {
+	claims, err := newClaims(TokenTypeMFA, AudienceRefresh, userID, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	return keys.sign(claims)
 }
 
-// newRefreshToken создает только refresh токен.
-func newRefreshToken(userID int64, ttl time.Duration, signingKey []byte) (string, error) {
-	claims := Claims{
+// newClaims заполняет общие поля токена: тип, издателя, аудиторию, время выдачи и уникальный jti.
+func newClaims(tokenType, audience string, userID int64, ttl time.Duration) (*Claims, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			ID:        jti,
+			Issuer:    TokenIssuer,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 		},
+		Type:   tokenType,
 		UserID: userID,
+	}, nil
+}
+
+// newTokenID возвращает случайный идентификатор токена (jti) или сессии.
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
 	}
+	return hex.EncodeToString(b), nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// ParseAccessToken проверяет access токен и возвращает его поля.
+func ParseAccessToken(tokenString string, keys *KeySet) (*Claims, error) {
+	return parseToken(tokenString, TokenTypeAccess, AudienceAPI, keys)
+}
 
-	return token.SignedString(signingKey)
+// ParseRefreshToken проверяет refresh токен и возвращает его поля.
+func ParseRefreshToken(tokenString string, keys *KeySet) (*Claims, error) {
+	return parseToken(tokenString, TokenTypeRefresh, AudienceRefresh, keys)
 }
 
-// GetUserID извлекает ID пользователя из токена.
-func GetUserID(tokenString string, signingKey []byte) (int64, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Строго проверяем, что используется именно HS256
-		if token.Method != jwt.SigningMethodHS256 {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return signingKey, nil
-	})
+// ParseMFAToken проверяет токен второго шага входа и возвращает его поля.
+func ParseMFAToken(tokenString string, keys *KeySet) (*Claims, error) {
+	return parseToken(tokenString, TokenTypeMFA, AudienceRefresh, keys)
+}
 
+// parseToken проверяет подпись ключом из набора keys по kid и все обязательные поля токена.
+// Токен другого типа или для другой аудитории отклоняется, даже если подпись верна.
+func parseToken(tokenString, tokenType, audience string, keys *KeySet) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc,
+		// Принимаем только алгоритмы ключей набора
+		jwt.WithValidMethods(keys.methods),
+		jwt.WithIssuer(TokenIssuer),
+		jwt.WithAudience(audience),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return 0, fmt.Errorf("invalid token: %w", err)
+		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims.UserID, nil
+	switch {
+	case claims.Type != tokenType:
+		return nil, fmt.Errorf("invalid token: unexpected token type %q", claims.Type)
+	case claims.IssuedAt == nil:
+		return nil, errors.New("invalid token: iat is required")
+	case claims.ID == "":
+		return nil, errors.New("invalid token: jti is required")
+	case claims.SessionID == "" && tokenType != TokenTypeMFA:
+		return nil, errors.New("invalid token: sid is required")
+	case claims.UserID <= 0:
+		return nil, errors.New("invalid token: uid is required")
 	}
 
-	return 0, fmt.Errorf("invalid token claims")
+	return claims, nil
 }
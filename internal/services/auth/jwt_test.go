@@ -8,74 +8,133 @@ import (
 	"github.com/grigory222/go-chat-server/internal/domain/models"
 )
 
-func TestNewTokensAndGetUserID(t *testing.T) {
+func TestNewTokensAndParse(t *testing.T) {
 	user := &models.User{ID: 42, Name: "Alice"}
 
-	access, refresh, err := NewTokens(user, time.Minute, time.Minute*2, []byte("secret"))
+	tokens, err := NewTokens(user, "s1", time.Minute, time.Minute*2, NewHMACKeySet("secret"))
 	if err != nil {
 		t.Fatalf("NewTokens returned error: %v", err)
 	}
+	access, refresh := tokens.AccessToken, tokens.RefreshToken
 	if access == "" || refresh == "" {
 		t.Fatalf("expected non-empty tokens")
 	}
 
-	uid, err := GetUserID(refresh, []byte("secret"))
+	aClaims, err := ParseAccessToken(access, NewHMACKeySet("secret"))
 	if err != nil {
-		t.Fatalf("GetUserID failed: %v", err)
+		t.Fatalf("ParseAccessToken failed: %v", err)
 	}
-	if uid != user.ID {
-		t.Fatalf("expected user id %d, got %d", user.ID, uid)
+	if aClaims.UserID != user.ID || aClaims.Name != user.Name || aClaims.Type != TokenTypeAccess {
+		t.Fatalf("unexpected access claims: %+v", aClaims)
+	}
+	if aClaims.Issuer != TokenIssuer || aClaims.ID == "" || aClaims.IssuedAt == nil {
+		t.Fatalf("access token must carry iss, jti and iat: %+v", aClaims)
 	}
 
-	// Access token should also decode
-	uid2, err := GetUserID(access, []byte("secret"))
-	if err != nil || uid2 != user.ID {
-		t.Fatalf("access token user id mismatch: %v %d", err, uid2)
+	rClaims, err := ParseRefreshToken(refresh, NewHMACKeySet("secret"))
+	if err != nil {
+		t.Fatalf("ParseRefreshToken failed: %v", err)
+	}
+	if rClaims.UserID != user.ID || rClaims.Name != "" || rClaims.Type != TokenTypeRefresh {
+		t.Fatalf("unexpected refresh claims: %+v", rClaims)
+	}
+	if rClaims.ID == aClaims.ID || rClaims.ID != tokens.RefreshID {
+		t.Fatalf("tokens must have distinct jti and expose the refresh jti")
 	}
+	if aClaims.SessionID != "s1" || rClaims.SessionID != "s1" {
+		t.Fatalf("tokens must carry the session id: %q %q", aClaims.SessionID, rClaims.SessionID)
+	}
+	if !rClaims.ExpiresAt.Time.Equal(tokens.RefreshExpiresAt) {
+		t.Fatalf("refresh expiry mismatch")
+	}
+}
 
-	// Decode access token to ensure Name claim present, and refresh token missing Name.
-	tokAccess, _ := jwt.ParseWithClaims(access, &Claims{}, func(token *jwt.Token) (interface{}, error) { return []byte("secret"), nil })
-	aClaims := tokAccess.Claims.(*Claims)
-	if aClaims.Name != user.Name {
-		t.Fatalf("expected name claim %s, got %s", user.Name, aClaims.Name)
+func TestParseToken_WrongType(t *testing.T) {
+	user := &models.User{ID: 42, Name: "Alice"}
+	tokens, err := NewTokens(user, "s1", time.Minute, time.Hour, NewHMACKeySet("secret"))
+	if err != nil {
+		t.Fatalf("NewTokens returned error: %v", err)
+	}
+	access, refresh := tokens.AccessToken, tokens.RefreshToken
+
+	if _, err := ParseAccessToken(refresh, NewHMACKeySet("secret")); err == nil {
+		t.Fatalf("refresh token must not be accepted as access token")
 	}
-	tokRefresh, _ := jwt.ParseWithClaims(refresh, &Claims{}, func(token *jwt.Token) (interface{}, error) { return []byte("secret"), nil })
-	rClaims := tokRefresh.Claims.(*Claims)
-	if rClaims.Name != "" { // refresh shouldn't set name in current implementation
-		t.Fatalf("expected empty name in refresh token, got %s", rClaims.Name)
+	if _, err := ParseRefreshToken(access, NewHMACKeySet("secret")); err == nil {
+		t.Fatalf("access token must not be accepted as refresh token")
 	}
 }
 
-func TestGetUserID_InvalidToken(t *testing.T) {
-	_, err := GetUserID("not-a-token", []byte("secret"))
-	if err == nil {
+func TestParseToken_InvalidClaims(t *testing.T) {
+	valid := func() *Claims {
+		c, err := newClaims(TokenTypeAccess, AudienceAPI, 7, time.Minute)
+		if err != nil {
+			t.Fatalf("newClaims error: %v", err)
+		}
+		c.SessionID = "s1"
+		return c
+	}
+	sign := func(c *Claims) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("sign error: %v", err)
+		}
+		return s
+	}
+
+	cases := map[string]func(c *Claims){
+		"wrong type (same audience)": func(c *Claims) { c.Type = TokenTypeRefresh },
+		"missing type":               func(c *Claims) { c.Type = "" },
+		"wrong audience":             func(c *Claims) { c.Audience = jwt.ClaimStrings{AudienceRefresh} },
+		"wrong issuer":               func(c *Claims) { c.Issuer = "someone-else" },
+		"missing jti":                func(c *Claims) { c.ID = "" },
+		"missing sid":                func(c *Claims) { c.SessionID = "" },
+		"missing iat":                func(c *Claims) { c.IssuedAt = nil },
+		"iat in the future":          func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Hour)) },
+		"missing exp":                func(c *Claims) { c.ExpiresAt = nil },
+		"expired":                    func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) },
+		"missing uid":                func(c *Claims) { c.UserID = 0 },
+	}
+	for name, mutate := range cases {
+		c := valid()
+		mutate(c)
+		if _, err := ParseAccessToken(sign(c), NewHMACKeySet("secret")); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	if _, err := ParseAccessToken(sign(valid()), NewHMACKeySet("secret")); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+}
+
+func TestParseToken_InvalidToken(t *testing.T) {
+	if _, err := ParseAccessToken("not-a-token", NewHMACKeySet("secret")); err == nil {
 		t.Fatalf("expected error for invalid token string")
 	}
 }
 
-func TestGetUserID_ExpiredToken(t *testing.T) {
-	claims := Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))}, UserID: 100}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	s, err := token.SignedString([]byte("secret"))
+func TestParseToken_WrongAlg(t *testing.T) {
+	// Use HS512 to trigger signing method mismatch
+	claims, err := newClaims(TokenTypeAccess, AudienceAPI, 7, time.Minute)
+	if err != nil {
+		t.Fatalf("newClaims error: %v", err)
+	}
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte("secret"))
 	if err != nil {
 		t.Fatalf("sign error: %v", err)
 	}
-	_, err = GetUserID(s, []byte("secret"))
-	if err == nil {
-		t.Fatalf("expected error for expired token")
+	if _, err := ParseAccessToken(s, NewHMACKeySet("secret")); err == nil {
+		t.Fatalf("expected error for wrong signing method")
 	}
 }
 
-func TestGetUserID_WrongAlg(t *testing.T) {
-	// Use HS512 to trigger signing method mismatch
-	claims := Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}, UserID: 7}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	s, err := token.SignedString([]byte("secret"))
+func TestParseToken_WrongKey(t *testing.T) {
+	tokens, err := NewTokens(&models.User{ID: 1}, "s1", time.Minute, time.Minute, NewHMACKeySet("secret"))
 	if err != nil {
-		t.Fatalf("sign error: %v", err)
+		t.Fatalf("NewTokens returned error: %v", err)
 	}
-	_, err = GetUserID(s, []byte("secret"))
-	if err == nil {
-		t.Fatalf("expected error for wrong signing method")
+	if _, err := ParseAccessToken(tokens.AccessToken, NewHMACKeySet("other")); err == nil {
+		t.Fatalf("expected error for wrong signing key")
 	}
 }
@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits - минимальный размер RSA ключа, принимаемый для подписи и проверки.
+const minRSABits = 2048
+
+// KeyFile - PEM файл ключа и его идентификатор (kid). Пустой ID вычисляется
+// из открытого ключа как JWK thumbprint (RFC 7638).
+type KeyFile struct {
+	ID   string
+	Path string
+}
+
+// KeySet - ключи подписи и проверки токенов. Токены подписываются одним ключом,
+// а проверяются любым из ключей набора по kid из заголовка: так при ротации
+// токены, подписанные прежним ключом, действуют до истечения срока.
+type KeySet struct {
+	signing      *key
+	verification map[string]*key
+	methods      []string
+}
+
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	// private - ключ подписи; nil у ключей, которые только проверяют
+	private any
+	public  any
+}
+
+// NewHMACKeySet создает набор из одного HS256 секрета. Токены подписываются без kid,
+// а проверить их может только владелец секрета.
+func NewHMACKeySet(secret string) *KeySet {
+	k := &key{method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+	return &KeySet{
+		signing:      k,
+		verification: map[string]*key{k.id: k},
+		methods:      []string{k.method.Alg()},
+	}
+}
+
+// LoadKeySet загружает закрытый ключ подписи Ed25519 (EdDSA) или RSA (RS256) и дополнительные
+// ключи проверки. Ключ проверки может быть открытым или закрытым; от закрытого берется открытая часть.
+func LoadKeySet(signing KeyFile, verification []KeyFile) (*KeySet, error) {
+	const op = "services.auth.LoadKeySet"
+
+	signer, err := loadPrivateKey(signing)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	set := &KeySet{signing: signer, verification: map[string]*key{}}
+	if err := set.add(signer); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, file := range verification {
+		k, err := loadPublicKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := set.add(k); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return set, nil
+}
+
+// SigningKeyID возвращает kid текущего ключа подписи.
+func (s *KeySet) SigningKeyID() string {
+	return s.signing.id
+}
+
+func (s *KeySet) add(k *key) error {
+	if _, ok := s.verification[k.id]; ok {
+		return fmt.Errorf("duplicate key id %q", k.id)
+	}
+	s.verification[k.id] = k
+
+	for _, alg := range s.methods {
+		if alg == k.method.Alg() {
+			return nil
+		}
+	}
+	s.methods = append(s.methods, k.method.Alg())
+	return nil
+}
+
+// sign подписывает claims текущим ключом и указывает его kid в заголовке.
+func (s *KeySet) sign(claims *Claims) (string, error) {
+	token := jwt.NewWithClaims(s.signing.method, claims)
+	if s.signing.id != "" {
+		token.Header["kid"] = s.signing.id
+	}
+	return token.SignedString(s.signing.private)
+}
+
+// keyFunc выбирает ключ проверки по kid. Алгоритм токена должен совпадать с алгоритмом ключа,
+// иначе открытый ключ можно было бы подсунуть как HMAC секрет.
+func (s *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := s.verification[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("key %q does not accept %s", kid, token.Method.Alg())
+	}
+	return k.public, nil
+}
+
+// JWK - открытый ключ в формате JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS - набор открытых ключей для проверки токенов сторонними сервисами.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает открытые ключи проверки, включая ключ подписи. HMAC секрет не публикуется.
+func (s *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	if jwk, ok := publicJWK(s.signing); ok {
+		set.Keys = append(set.Keys, jwk)
+	}
+	ids := make([]string, 0, len(s.verification))
+	for id, k := range s.verification {
+		if k != s.signing {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if jwk, ok := publicJWK(s.verification[id]); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func publicJWK(k *key) (JWK, bool) {
+	jwk, ok := jwkOf(k.public)
+	if !ok {
+		return JWK{}, false
+	}
+	jwk.Use, jwk.Alg, jwk.Kid = "sig", k.method.Alg(), k.id
+	return jwk, true
+}
+
+// jwkOf описывает открытый ключ обязательными полями JWK.
+func jwkOf(public any) (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := public.(type) {
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: b64(pub)}, true
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", N: b64(pub.N.Bytes()), E: b64(big.NewInt(int64(pub.E)).Bytes())}, true
+	default:
+		return JWK{}, false
+	}
+}
+
+// thumbprint вычисляет JWK thumbprint (RFC 7638): SHA-256 от обязательных полей в лексикографическом порядке.
+func thumbprint(public any) (string, error) {
+	jwk, ok := jwkOf(public)
+	if !ok {
+		return "", errors.New("unsupported public key")
+	}
+
+	var fields any
+	switch jwk.Kty {
+	case "OKP":
+		fields = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		fields = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func loadPrivateKey(file KeyFile) (*key, error) {
+	block, err := readPEM(file.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var private crypto.Signer
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			signer, ok := parsed.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("%s: unsupported private key", file.Path)
+			}
+			private = signer
+		}
+	default:
+		return nil, fmt.Errorf("%s: unexpected PEM block %q", file.Path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file.Path, err)
+	}
+
+	k, err := newKey(file, private.Public())
+	if err != nil {
+		return nil, err
+	}
+	k.private = private
+	return k, nil
+}
+
+func loadPublicKey(file KeyFile) (*key, error) {
+	block, err := readPEM(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PUBLIC KEY" {
+		// Закрытый ключ тоже годится для проверки: берем его открытую часть
+		k, err := loadPrivateKey(file)
+		if err != nil {
+			return nil, err
+		}
+		k.private = nil
+		return k, nil
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file.Path, err)
+	}
+	return newKey(file, public)
+}
+
+// newKey определяет алгоритм по типу ключа и вычисляет kid, если он не задан.
+func newKey(file KeyFile, public any) (*key, error) {
+	k := &key{id: file.ID, public: public}
+	switch pub := public.(type) {
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("%s: RSA key must be at least %d bits", file.Path, minRSABits)
+		}
+		k.method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("%s: only Ed25519 and RSA keys are supported", file.Path)
+	}
+
+	if k.id == "" {
+		id, err := thumbprint(public)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Path, err)
+		}
+		k.id = id
+	}
+	return k, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+)
+
+// writeKey stores a key as PEM in a temp dir and returns its path.
+func writeKey(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return path
+}
+
+func ed25519KeyFiles(t *testing.T) (private, public string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	privDER, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+	return writeKey(t, "PRIVATE KEY", privDER), writeKey(t, "PUBLIC KEY", pubDER)
+}
+
+func TestKeySetEdDSA(t *testing.T) {
+	private, _ := ed25519KeyFiles(t)
+	keys, err := LoadKeySet(KeyFile{Path: private}, nil)
+	if err != nil {
+		t.Fatalf("LoadKeySet error: %v", err)
+	}
+
+	tokens, err := NewTokens(&models.User{ID: 7, Name: "Alice"}, "s1", time.Minute, time.Hour, keys)
+	if err != nil {
+		t.Fatalf("NewTokens error: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(tokens.AccessToken, &Claims{})
+	if err != nil {
+		t.Fatalf("parse header: %v", err)
+	}
+	if parsed.Method.Alg() != "EdDSA" || parsed.Header["kid"] != keys.SigningKeyID() || keys.SigningKeyID() == "" {
+		t.Fatalf("unexpected header: %v", parsed.Header)
+	}
+	if claims, err := ParseAccessToken(tokens.AccessToken, keys); err != nil || claims.UserID != 7 {
+		t.Fatalf("ParseAccessToken failed: %v", err)
+	}
+
+	// A verifier holding only the published JWK accepts the token
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kty != "OKP" || jwks.Keys[0].Kid != keys.SigningKeyID() {
+		t.Fatalf("unexpected jwks: %+v", jwks)
+	}
+	x, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+	_, err = jwt.Parse(tokens.AccessToken, func(*jwt.Token) (any, error) { return ed25519.PublicKey(x), nil },
+		jwt.WithValidMethods([]string{jwks.Keys[0].Alg}))
+	if err != nil {
+		t.Fatalf("token must verify with the published key: %v", err)
+	}
+}
+
+func TestKeySetRS256(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	keys, err := LoadKeySet(KeyFile{ID: "rsa-1", Path: writeKey(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv))}, nil)
+	if err != nil {
+		t.Fatalf("LoadKeySet error: %v", err)
+	}
+
+	tokens, err := NewTokens(&models.User{ID: 7}, "s1", time.Minute, time.Hour, keys)
+	if err != nil {
+		t.Fatalf("NewTokens error: %v", err)
+	}
+	if _, err := ParseRefreshToken(tokens.RefreshToken, keys); err != nil {
+		t.Fatalf("ParseRefreshToken failed: %v", err)
+	}
+	if jwk := keys.JWKS().Keys[0]; jwk.Kty != "RSA" || jwk.Alg != "RS256" || jwk.Kid != "rsa-1" || jwk.E != "AQAB" {
+		t.Fatalf("unexpected jwk: %+v", jwk)
+	}
+
+	// HS256 signed with the public key must not pass as RS256 (algorithm confusion)
+	claims, _ := newClaims(TokenTypeAccess, AudienceAPI, 7, time.Minute)
+	claims.SessionID = "s1"
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "rsa-1"
+	pubDER, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	s, _ := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	if _, err := ParseAccessToken(s, keys); err == nil {
+		t.Fatalf("forged HS256 token must be rejected")
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldPrivate, oldPublic := ed25519KeyFiles(t)
+	newPrivate, _ := ed25519KeyFiles(t)
+
+	oldKeys, err := LoadKeySet(KeyFile{ID: "old", Path: oldPrivate}, nil)
+	if err != nil {
+		t.Fatalf("LoadKeySet error: %v", err)
+	}
+	oldTokens, _ := NewTokens(&models.User{ID: 7}, "s1", time.Minute, time.Hour, oldKeys)
+
+	// After rotation the old public key stays as a verification key
+	keys, err := LoadKeySet(KeyFile{ID: "new", Path: newPrivate}, []KeyFile{{ID: "old", Path: oldPublic}})
+	if err != nil {
+		t.Fatalf("LoadKeySet error: %v", err)
+	}
+	if _, err := ParseAccessToken(oldTokens.AccessToken, keys); err != nil {
+		t.Fatalf("token signed by the previous key must still verify: %v", err)
+	}
+	newTokens, _ := NewTokens(&models.User{ID: 7}, "s1", time.Minute, time.Hour, keys)
+	if _, err := ParseAccessToken(newTokens.AccessToken, oldKeys); err == nil {
+		t.Fatalf("instance without the new key must reject its tokens")
+	}
+	if jwks := keys.JWKS(); len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "new" || jwks.Keys[1].Kid != "old" {
+		t.Fatalf("jwks must list the signing key first and then the old key: %+v", jwks)
+	}
+
+	// Once the old key is dropped, its tokens are rejected
+	keys, _ = LoadKeySet(KeyFile{ID: "new", Path: newPrivate}, nil)
+	if _, err := ParseAccessToken(oldTokens.AccessToken, keys); err == nil {
+		t.Fatalf("token with an unknown kid must be rejected")
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	private, public := ed25519KeyFiles(t)
+	weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	cases := map[string]func() error{
+		"missing file": func() error { _, err := LoadKeySet(KeyFile{Path: "/nonexistent.pem"}, nil); return err },
+		"public key for signing": func() error {
+			_, err := LoadKeySet(KeyFile{Path: public}, nil)
+			return err
+		},
+		"duplicate kid": func() error {
+			_, err := LoadKeySet(KeyFile{ID: "k", Path: private}, []KeyFile{{ID: "k", Path: public}})
+			return err
+		},
+		"weak rsa key": func() error {
+			_, err := LoadKeySet(KeyFile{Path: writeKey(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(weak))}, nil)
+			return err
+		},
+	}
+	for name, load := range cases {
+		if load() == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
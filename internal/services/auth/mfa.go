@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/totp"
+)
+
+// recoveryCodeCount - сколько кодов восстановления выдается при включении 2FA
+const recoveryCodeCount = 10
+
+// MFA - двухфакторная аутентификация по TOTP.
+type MFA struct {
+	// Issuer - название сервиса в приложении-аутентификаторе
+	Issuer string
+	// ChallengeTTL - срок действия токена второго шага входа
+	ChallengeTTL time.Duration
+}
+
+// EnrollTOTP выдает новый секрет TOTP и otpauth:// ссылку для приложения-аутентификатора.
+// 2FA включается только после ConfirmTOTP с первым кодом; повторный вызов до этого
+// заменяет секрет.
+func (s *Service) EnrollTOTP(ctx context.Context, userID int64) (secret, uri string, err error) {
+	const op = "services.auth.EnrollTOTP"
+	log := s.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	user, err := s.storage.UserByID(ctx, userID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err = totp.NewSecret()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.storage.SaveTOTPSecret(ctx, userID, secret); err != nil {
+		if !errors.Is(err, models.ErrTOTPAlreadyEnabled) {
+			log.Error("failed to save totp secret", slog.Any("err", err))
+		}
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("totp enrollment started")
+	return secret, totp.URI(s.mfa.Issuer, user.Email, secret), nil
+}
+
+// ConfirmTOTP включает 2FA, если code подходит к выданному секрету, и возвращает
+// одноразовые коды восстановления. Коды показываются только здесь: хранятся лишь их хэши.
+func (s *Service) ConfirmTOTP(ctx context.Context, userID int64, code string) ([]string, error) {
+	const op = "services.auth.ConfirmTOTP"
+	log := s.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	secret, err := s.storage.TOTPByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if secret.Enabled {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrTOTPAlreadyEnabled)
+	}
+	step, ok := totp.Validate(secret.Secret, code, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrTOTPCodeInvalid)
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+	if err := s.storage.EnableTOTP(ctx, userID, step, hashes); err != nil {
+		if !errors.Is(err, models.ErrTOTPAlreadyEnabled) {
+			log.Error("failed to enable totp", slog.Any("err", err))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("totp enabled")
+	return codes, nil
+}
+
+// DisableTOTP выключает 2FA. Нужен действующий код TOTP или код восстановления.
+func (s *Service) DisableTOTP(ctx context.Context, userID int64, code string) error {
+	const op = "services.auth.DisableTOTP"
+	log := s.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	if err := s.checkSecondFactor(ctx, userID, code); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.storage.DisableTOTP(ctx, userID); err != nil {
+		log.Error("failed to disable totp", slog.Any("err", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("totp disabled")
+	return nil
+}
+
+// VerifyMFA завершает вход с 2FA: обменивает токен из MFARequiredError и код TOTP
+// (или код восстановления) на пару токенов новой сессии.
+func (s *Service) VerifyMFA(ctx context.Context, challengeToken, code string, client models.ClientInfo) (accessToken, refreshToken string, user *chatpb.User, err error) {
+	const op = "services.auth.VerifyMFA"
+	log := s.log.With(slog.String("op", op))
+
+	claims, err := ParseMFAToken(challengeToken, s.keys)
+	if err != nil {
+		log.Warn("invalid mfa token", slog.Any("err", err))
+		return "", "", nil, fmt.Errorf("%s: %w", op, models.ErrInvalidCredentials)
+	}
+	log = log.With(slog.Int64("user_id", claims.UserID))
+
+	dbUser, err := s.storage.UserByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			return "", "", nil, fmt.Errorf("%s: %w", op, models.ErrInvalidCredentials)
+		}
+		return "", "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Перебор кодов учитывается в тех же счетчиках, что и перебор паролей
+	attempt, wait := s.protection.begin(dbUser.Email, client.IP)
+	if wait > 0 {
+		log.Warn("second factor attempt blocked", slog.String("ip", client.IP), slog.Duration("retry_after", wait))
+		return "", "", nil, fmt.Errorf("%s: %w", op, models.ErrTOTPCodeInvalid)
+	}
+	defer attempt.end()
+	if err := s.checkSecondFactor(ctx, dbUser.ID, code); err != nil {
+		if errors.Is(err, models.ErrTOTPCodeInvalid) {
+			log.Warn("invalid second factor code")
+			attempt.fail()
+		}
+		return "", "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	accessToken, refreshToken, user, err = s.startSession(ctx, dbUser, client)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+	attempt.succeed()
+
+	return accessToken, refreshToken, user, nil
+}
+
+// requireSecondFactor возвращает MFARequiredError с токеном второго шага, если у пользователя
+// включена 2FA, и nil, если вход можно завершить сразу.
+func (s *Service) requireSecondFactor(ctx context.Context, userID int64) error {
+	log := s.log.With(slog.Int64("user_id", userID))
+
+	totp, err := s.storage.TOTPByUserID(ctx, userID)
+	if errors.Is(err, models.ErrTOTPNotFound) {
+		return nil
+	}
+	if err != nil {
+		log.Error("failed to get totp", slog.Any("err", err))
+		return err
+	}
+	if !totp.Enabled {
+		return nil
+	}
+
+	challenge, err := newMFAToken(userID, s.mfa.ChallengeTTL, s.keys)
+	if err != nil {
+		log.Error("failed to create mfa token", slog.Any("err", err))
+		return err
+	}
+	log.Info("second factor required")
+	return &models.MFARequiredError{ChallengeToken: challenge}
+}
+
+// checkSecondFactor принимает код TOTP из шести цифр или код восстановления. Оба кода
+// одноразовые: шаг принятого TOTP кода запоминается, код восстановления погашается.
+// 2FA выключена - ErrTOTPNotFound, неверный код - ErrTOTPCodeInvalid.
+func (s *Service) checkSecondFactor(ctx context.Context, userID int64, code string) error {
+	secret, err := s.storage.TOTPByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !secret.Enabled {
+		return models.ErrTOTPNotFound
+	}
+
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(secret.Secret, code, time.Now())
+		if !ok {
+			return models.ErrTOTPCodeInvalid
+		}
+		return s.storage.UseTOTPStep(ctx, userID, step)
+	}
+
+	return s.storage.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+}
+
+// newRecoveryCode возвращает код восстановления вида xxxx-xxxx-xxxx-xxxx (80 бит).
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16], nil
+}
+
+// normalizeRecoveryCode убирает разделители и регистр, которые пользователь мог ввести иначе.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
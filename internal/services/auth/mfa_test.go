@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/totp"
+)
+
+// totpCode returns the code for the given step.
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, step)
+	if err != nil {
+		t.Fatalf("totp.Code error: %v", err)
+	}
+	return code
+}
+
+// mfaChallenge logs in expecting the second step and returns the challenge token.
+func mfaChallenge(t *testing.T, svc *Service, email, password string) string {
+	t.Helper()
+	_, _, _, err := svc.Login(context.Background(), email, password, models.ClientInfo{})
+	var mfaErr *models.MFARequiredError
+	if !errors.As(err, &mfaErr) || !errors.Is(err, models.ErrMFARequired) || mfaErr.ChallengeToken == "" {
+		t.Fatalf("expected MFARequiredError, got %v", err)
+	}
+	return mfaErr.ChallengeToken
+}
+
+func newMFAService(st *mockStorage) *Service {
+	return New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		MFA:    MFA{Issuer: "go-chat", ChallengeTTL: time.Minute},
+		Hasher: testHasher,
+	})
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	st := newMockStorage()
+	svc := newMFAService(st)
+	ctx := context.Background()
+	user, _ := svc.Register(ctx, "Bob", "bob@example.com", "pass")
+
+	secret, uri, err := svc.EnrollTOTP(ctx, user.Id)
+	if err != nil {
+		t.Fatalf("EnrollTOTP error: %v", err)
+	}
+	u, _ := url.Parse(uri)
+	if u.Scheme != "otpauth" || u.Query().Get("secret") != secret || u.Query().Get("issuer") != "go-chat" {
+		t.Fatalf("unexpected uri: %s", uri)
+	}
+
+	// Enrollment alone does not change login
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{}); err != nil {
+		t.Fatalf("login before confirmation must not require mfa: %v", err)
+	}
+
+	if _, err := svc.ConfirmTOTP(ctx, user.Id, "abcdef"); !errors.Is(err, models.ErrTOTPCodeInvalid) {
+		t.Fatalf("expected ErrTOTPCodeInvalid, got %v", err)
+	}
+	step := totp.Step(time.Now())
+	codes, err := svc.ConfirmTOTP(ctx, user.Id, totpCode(t, secret, step))
+	if err != nil || len(codes) != recoveryCodeCount {
+		t.Fatalf("ConfirmTOTP failed: %v %v", err, codes)
+	}
+	for _, hash := range []string{codes[0], normalizeRecoveryCode(codes[0])} {
+		if _, stored := st.recoveryCodes[user.Id][hash]; stored {
+			t.Fatalf("recovery codes must be stored hashed")
+		}
+	}
+
+	if _, err := svc.ConfirmTOTP(ctx, user.Id, totpCode(t, secret, step+1)); !errors.Is(err, models.ErrTOTPAlreadyEnabled) {
+		t.Fatalf("expected ErrTOTPAlreadyEnabled, got %v", err)
+	}
+	if _, _, err := svc.EnrollTOTP(ctx, user.Id); !errors.Is(err, models.ErrTOTPAlreadyEnabled) {
+		t.Fatalf("enabled secret must not be replaced, got %v", err)
+	}
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	st := newMockStorage()
+	svc := newMFAService(st)
+	ctx := context.Background()
+	user, _ := svc.Register(ctx, "Bob", "bob@example.com", "pass")
+	secret, _, _ := svc.EnrollTOTP(ctx, user.Id)
+	step := totp.Step(time.Now())
+	codes, _ := svc.ConfirmTOTP(ctx, user.Id, totpCode(t, secret, step))
+
+	// Wrong password is still reported before the second step
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "wrong", models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	challenge := mfaChallenge(t, svc, "bob@example.com", "pass")
+	if len(st.sessions) != 0 {
+		t.Fatalf("no session must be created before the second step")
+	}
+
+	// The challenge is not an access or refresh token
+	if _, err := ParseAccessToken(challenge, svc.keys); err == nil {
+		t.Fatalf("challenge must not be accepted as access token")
+	}
+	if _, _, err := svc.RefreshToken(ctx, challenge); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("challenge must not be accepted as refresh token, got %v", err)
+	}
+
+	// The confirmation code has been used already
+	if _, _, _, err := svc.VerifyMFA(ctx, challenge, totpCode(t, secret, step), models.ClientInfo{}); !errors.Is(err, models.ErrTOTPCodeInvalid) {
+		t.Fatalf("used code must be rejected, got %v", err)
+	}
+	if _, _, _, err := svc.VerifyMFA(ctx, "garbage", totpCode(t, secret, step+1), models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials for bad challenge, got %v", err)
+	}
+
+	access, refresh, pbUser, err := svc.VerifyMFA(ctx, challenge, totpCode(t, secret, step+1), models.ClientInfo{UserAgent: "ua"})
+	if err != nil || access == "" || refresh == "" || pbUser.GetId() != user.Id {
+		t.Fatalf("VerifyMFA failed: %v", err)
+	}
+	if len(st.sessions) != 1 {
+		t.Fatalf("expected one session, got %d", len(st.sessions))
+	}
+
+	// Recovery codes work once, in any case and without dashes
+	challenge = mfaChallenge(t, svc, "bob@example.com", "pass")
+	if _, _, _, err := svc.VerifyMFA(ctx, challenge, normalizeRecoveryCode(codes[0]), models.ClientInfo{}); err != nil {
+		t.Fatalf("recovery code must be accepted: %v", err)
+	}
+	if _, _, _, err := svc.VerifyMFA(ctx, challenge, codes[0], models.ClientInfo{}); !errors.Is(err, models.ErrTOTPCodeInvalid) {
+		t.Fatalf("recovery code must be single-use, got %v", err)
+	}
+
+	// Expired challenge
+	svc.mfa.ChallengeTTL = -time.Second
+	challenge = mfaChallenge(t, svc, "bob@example.com", "pass")
+	if _, _, _, err := svc.VerifyMFA(ctx, challenge, codes[1], models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expired challenge must be rejected, got %v", err)
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	st := newMockStorage()
+	svc := newMFAService(st)
+	ctx := context.Background()
+	user, _ := svc.Register(ctx, "Bob", "bob@example.com", "pass")
+
+	if err := svc.DisableTOTP(ctx, user.Id, "123456"); !errors.Is(err, models.ErrTOTPNotFound) {
+		t.Fatalf("expected ErrTOTPNotFound, got %v", err)
+	}
+
+	secret, _, _ := svc.EnrollTOTP(ctx, user.Id)
+	codes, _ := svc.ConfirmTOTP(ctx, user.Id, totpCode(t, secret, totp.Step(time.Now())))
+	if err := svc.DisableTOTP(ctx, user.Id, "not-a-code"); !errors.Is(err, models.ErrTOTPCodeInvalid) {
+		t.Fatalf("expected ErrTOTPCodeInvalid, got %v", err)
+	}
+	if err := svc.DisableTOTP(ctx, user.Id, codes[0]); err != nil {
+		t.Fatalf("DisableTOTP error: %v", err)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{}); err != nil {
+		t.Fatalf("login after disabling 2FA must be one-step: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/oidc"
+)
+
+// OIDC - вход через OpenID провайдера компании (authorization code с PKCE).
+type OIDC struct {
+	// Provider - провайдер; nil, если вход через него не настроен
+	Provider *oidc.Provider
+	// StateTTL - сколько ждать возврата пользователя со страницы входа провайдера
+	StateTTL time.Duration
+}
+
+// StartOIDCLogin начинает вход через OpenID провайдера: возвращает адрес его страницы входа
+// и state, с которым провайдер вернет пользователя на redirect URL. codeChallenge - S256
+// от code_verifier, который клиент хранит до FinishOIDCLogin: без него перехваченный
+// код авторизации бесполезен.
+func (s *Service) StartOIDCLogin(ctx context.Context, codeChallenge string) (authURL, state string, err error) {
+	const op = "services.auth.StartOIDCLogin"
+	log := s.log.With(slog.String("op", op))
+
+	if s.oidc.Provider == nil {
+		return "", "", fmt.Errorf("%s: %w", op, models.ErrOIDCDisabled)
+	}
+
+	state, err = newSecretToken()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	nonce, err := newSecretToken()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	authURL, err = s.oidc.Provider.AuthCodeURL(ctx, state, nonce, codeChallenge)
+	if err != nil {
+		log.Error("failed to build authorization url", slog.Any("err", err))
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.storage.CreateOIDCState(ctx, &models.OIDCState{
+		StateHash:     hashToken(state),
+		CodeChallenge: codeChallenge,
+		Nonce:         nonce,
+		ExpiresAt:     time.Now().Add(s.oidc.StateTTL),
+	})
+	if err != nil {
+		log.Error("failed to save oidc state", slog.Any("err", err))
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return authURL, state, nil
+}
+
+// FinishOIDCLogin завершает вход: обменивает код авторизации на ID токен, проверяет его
+// и открывает сессию пользователя, связанного с учетной записью у провайдера. При первом
+// входе пользователь находится по email, подтвержденному провайдером, или создается.
+// Как и Login, при включенной 2FA возвращает MFARequiredError.
+func (s *Service) FinishOIDCLogin(ctx context.Context, state, code, codeVerifier string, client models.ClientInfo) (accessToken, refreshToken string, user *chatpb.User, err error) {
+	const op = "services.auth.FinishOIDCLogin"
+	log := s.log.With(slog.String("op", op))
+
+	if s.oidc.Provider == nil {
+		return "", "", nil, fmt.Errorf("%s: %w", op, models.ErrOIDCDisabled)
+	}
+
+	// state одноразовый: повторить вход с тем же кодом нельзя
+	saved, err := s.storage.ConsumeOIDCState(ctx, hashToken(state))
+	if err != nil {
+		if errors.Is(err, models.ErrOIDCStateInvalid) {
+			log.Warn("invalid oidc state")
+		} else {
+			log.Error("failed to consume oidc state", slog.Any("err", err))
+		}
+		return "", "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// Провайдер тоже сверит code_verifier, но чужой клиент отсекаем, не обращаясь к нему
+	if subtle.ConstantTimeCompare([]byte(oidc.Challenge(codeVerifier)), []byte(saved.CodeChallenge)) != 1 {
+		log.Warn("code verifier does not match")
+		return "", "", nil, fmt.Errorf("%s: %w", op, models.ErrInvalidCredentials)
+	}
+
+	rawIDToken, err := s.oidc.Provider.Exchange(ctx, code, codeVerifier)
+	if err != nil {
+		if errors.Is(err, oidc.ErrCodeRejected) || errors.Is(err, oidc.ErrInvalidIDToken) {
+			log.Warn("authorization code rejected", slog.Any("err", err))
+			return "", "", nil, fmt.Errorf("%s: %w", op, models.ErrInvalidCredentials)
+		}
+		log.Error("failed to exchange authorization code", slog.Any("err", err))
+		return "", "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+	identity, err := s.oidc.Provider.Verify(ctx, rawIDToken, saved.Nonce)
+	if err != nil {
+		log.Warn("invalid id token", slog.Any("err", err))
+		return "", "", nil, fmt.Errorf("%s: %w", op, models.ErrInvalidCredentials)
+	}
+
+	dbUser, err := s.oidcUser(ctx, identity)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.requireSecondFactor(ctx, dbUser.ID); err != nil {
+		return "", "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	accessToken, refreshToken, user, err = s.startSession(ctx, dbUser, client)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged in with oidc", slog.Int64("user_id", dbUser.ID))
+	return accessToken, refreshToken, user, nil
+}
+
+// oidcUser находит пользователя по учетной записи у провайдера. При первом входе учетная
+// запись связывается с пользователем по email или для нее создается новый пользователь -
+// только если провайдер подтвердил email, иначе им мог бы назваться кто угодно.
+func (s *Service) oidcUser(ctx context.Context, identity *oidc.Identity) (*models.User, error) {
+	issuer := s.oidc.Provider.Issuer()
+	log := s.log.With(slog.String("issuer", issuer), slog.String("subject", identity.Subject))
+
+	user, err := s.storage.UserByIdentity(ctx, issuer, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, models.ErrUserNotFound) {
+		log.Error("failed to get user by identity", slog.Any("err", err))
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		log.Warn("oidc login rejected: email is not verified by provider")
+		return nil, models.ErrOIDCEmailUnverified
+	}
+	log = log.With(slog.String("email", identity.Email))
+
+	user, err = s.storage.UserByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		// Неподтвержденный email мог указать при регистрации не его владелец:
+		// хранилище сбрасывает такой аккаунту пароль и отзывает его сессии
+		revoked, err := s.storage.LinkIdentity(ctx, user.ID, issuer, identity.Subject)
+		if err != nil {
+			log.Error("failed to link identity", slog.Any("err", err))
+			return nil, err
+		}
+		for _, id := range revoked {
+			s.closeStreams(id)
+		}
+		if !user.EmailVerified {
+			user.EmailVerified, user.PasswordHash = true, ""
+		}
+		log.Info("identity linked to existing user", slog.Int64("user_id", user.ID), slog.Int("revoked_sessions", len(revoked)))
+		return user, nil
+	case !errors.Is(err, models.ErrUserNotFound):
+		log.Error("failed to get user by email", slog.Any("err", err))
+		return nil, err
+	}
+
+	name := identity.Name
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	userID, err := s.storage.SaveOIDCUser(ctx, name, identity.Email, issuer, identity.Subject)
+	if err != nil {
+		log.Error("failed to create oidc user", slog.Any("err", err))
+		return nil, err
+	}
+
+	log.Info("user created from oidc identity", slog.Int64("user_id", userID))
+	return &models.User{ID: userID, Name: name, Email: identity.Email, EmailVerified: true}, nil
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/oidc"
+	"github.com/grigory222/go-chat-server/internal/lib/oidc/oidctest"
+	"github.com/grigory222/go-chat-server/internal/lib/totp"
+)
+
+func newOIDCService(t *testing.T, st *mockStorage, closer SessionCloser) (*Service, *oidctest.Provider) {
+	t.Helper()
+	fake := oidctest.New(t, "chat", "secret")
+	provider := oidc.New(oidc.Config{
+		Issuer:       fake.Issuer(),
+		ClientID:     "chat",
+		ClientSecret: "secret",
+		RedirectURL:  "https://app.example.com/sso",
+	})
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), closer, Options{
+		MFA:    MFA{Issuer: "go-chat", ChallengeTTL: time.Minute},
+		Hasher: testHasher,
+		OIDC:   OIDC{Provider: provider, StateTTL: time.Minute},
+	})
+	return svc, fake
+}
+
+// ssoLogin starts a login, signs user in at the fake provider and finishes the login.
+func ssoLogin(t *testing.T, svc *Service, fake *oidctest.Provider, user oidctest.User) (string, *chatpb.User, error) {
+	t.Helper()
+	ctx := context.Background()
+	verifier, _ := oidc.NewVerifier()
+	authURL, state, err := svc.StartOIDCLogin(ctx, oidc.Challenge(verifier))
+	if err != nil {
+		t.Fatalf("StartOIDCLogin error: %v", err)
+	}
+	code, returned, err := fake.Authorize(authURL, user)
+	if err != nil || returned != state {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+	access, _, pbUser, err := svc.FinishOIDCLogin(ctx, state, code, verifier, models.ClientInfo{UserAgent: "sso"})
+	return access, pbUser, err
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	st := newMockStorage()
+	svc, fake := newOIDCService(t, st, nil)
+	ctx := context.Background()
+
+	access, user, err := ssoLogin(t, svc, fake, oidctest.User{Subject: "42", Email: "bob@corp.example", EmailVerified: true, Name: "Bob"})
+	if err != nil {
+		t.Fatalf("FinishOIDCLogin error: %v", err)
+	}
+	claims, err := ParseAccessToken(access, svc.keys)
+	if err != nil || claims.UserID != user.GetId() || !user.GetEmailVerified() || user.GetName() != "Bob" {
+		t.Fatalf("unexpected login result: %v %+v", err, user)
+	}
+	dbUser := st.usersByID[user.GetId()]
+	if !dbUser.EmailVerified || dbUser.PasswordHash != "" {
+		t.Fatalf("sso user must be verified and have no password: %+v", dbUser)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@corp.example", "", models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("sso user must not log in with an empty password, got %v", err)
+	}
+
+	// The subject identifies the user even after the email changes at the provider
+	_, again, err := ssoLogin(t, svc, fake, oidctest.User{Subject: "42", Email: "robert@corp.example", EmailVerified: true})
+	if err != nil || again.GetId() != user.GetId() || len(st.usersByID) != 1 {
+		t.Fatalf("expected the same user: %v %+v", err, again)
+	}
+
+	// The name falls back to the email local part
+	_, other, err := ssoLogin(t, svc, fake, oidctest.User{Subject: "43", Email: "alice@corp.example", EmailVerified: true})
+	if err != nil || other.GetName() != "alice" {
+		t.Fatalf("unexpected user: %v %+v", err, other)
+	}
+}
+
+func TestOIDCLoginLinksExistingUser(t *testing.T) {
+	st := newMockStorage()
+	closer := &fakeSessionCloser{}
+	svc, fake := newOIDCService(t, st, closer)
+	ctx := context.Background()
+
+	// A verified local account keeps its password and sessions
+	bob, _ := svc.Register(ctx, "Bob", "bob@corp.example", "pass")
+	st.usersByID[bob.Id].EmailVerified = true
+	svc.Login(ctx, "bob@corp.example", "pass", models.ClientInfo{})
+	_, user, err := ssoLogin(t, svc, fake, oidctest.User{Subject: "42", Email: "bob@corp.example", EmailVerified: true})
+	if err != nil || user.GetId() != bob.Id {
+		t.Fatalf("expected link to the existing user: %v %+v", err, user)
+	}
+	if len(closer.closed) != 0 {
+		t.Fatalf("sessions of a verified account must stay: %v", closer.closed)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@corp.example", "pass", models.ClientInfo{}); err != nil {
+		t.Fatalf("password must keep working: %v", err)
+	}
+
+	// An unverified account may have been registered by someone else: its password and sessions go
+	eve, _ := svc.Register(ctx, "Eve", "carol@corp.example", "squatter")
+	svc.Login(ctx, "carol@corp.example", "squatter", models.ClientInfo{})
+	_, user, err = ssoLogin(t, svc, fake, oidctest.User{Subject: "44", Email: "carol@corp.example", EmailVerified: true})
+	if err != nil || user.GetId() != eve.Id || !user.GetEmailVerified() {
+		t.Fatalf("expected link to the existing user: %v %+v", err, user)
+	}
+	if len(closer.closed) != 1 {
+		t.Fatalf("sessions of the unverified account must be revoked: %v", closer.closed)
+	}
+	if _, _, _, err := svc.Login(ctx, "carol@corp.example", "squatter", models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("password of the unverified account must be dropped, got %v", err)
+	}
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	st := newMockStorage()
+	svc, fake := newOIDCService(t, st, nil)
+	ctx := context.Background()
+
+	// Without a verified email the account can be neither linked nor created
+	svc.Register(ctx, "Bob", "bob@corp.example", "pass")
+	if _, _, err := ssoLogin(t, svc, fake, oidctest.User{Subject: "42", Email: "bob@corp.example"}); !errors.Is(err, models.ErrOIDCEmailUnverified) {
+		t.Fatalf("expected ErrOIDCEmailUnverified, got %v", err)
+	}
+	if len(st.identities) != 0 || len(st.usersByID) != 1 {
+		t.Fatalf("nothing must be linked or created")
+	}
+
+	// ID token checks
+	fake.Claims = func(c jwt.MapClaims) { c["aud"] = "another-app" }
+	if _, _, err := ssoLogin(t, svc, fake, oidctest.User{Subject: "42", Email: "x@corp.example", EmailVerified: true}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("token for another client must be rejected, got %v", err)
+	}
+	fake.Claims = nil
+
+	// The state is single-use and bound to the client's code verifier
+	verifier, _ := oidc.NewVerifier()
+	authURL, state, _ := svc.StartOIDCLogin(ctx, oidc.Challenge(verifier))
+	code, _, _ := fake.Authorize(authURL, oidctest.User{Subject: "45", Email: "y@corp.example", EmailVerified: true})
+	stolen, _ := oidc.NewVerifier()
+	if _, _, _, err := svc.FinishOIDCLogin(ctx, state, code, stolen, models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("wrong verifier must be rejected, got %v", err)
+	}
+	if _, _, _, err := svc.FinishOIDCLogin(ctx, state, code, verifier, models.ClientInfo{}); !errors.Is(err, models.ErrOIDCStateInvalid) {
+		t.Fatalf("state must be single-use, got %v", err)
+	}
+
+	svc.oidc.StateTTL = -time.Second
+	authURL, state, _ = svc.StartOIDCLogin(ctx, oidc.Challenge(verifier))
+	code, _, _ = fake.Authorize(authURL, oidctest.User{Subject: "45", Email: "y@corp.example", EmailVerified: true})
+	if _, _, _, err := svc.FinishOIDCLogin(ctx, state, code, verifier, models.ClientInfo{}); !errors.Is(err, models.ErrOIDCStateInvalid) {
+		t.Fatalf("expired state must be rejected, got %v", err)
+	}
+
+	disabled := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		Hasher: testHasher,
+	})
+	if _, _, err := disabled.StartOIDCLogin(ctx, oidc.Challenge(verifier)); !errors.Is(err, models.ErrOIDCDisabled) {
+		t.Fatalf("expected ErrOIDCDisabled, got %v", err)
+	}
+}
+
+func TestOIDCLoginRequiresMFA(t *testing.T) {
+	st := newMockStorage()
+	svc, fake := newOIDCService(t, st, nil)
+	ctx := context.Background()
+	bob := oidctest.User{Subject: "42", Email: "bob@corp.example", EmailVerified: true}
+
+	_, user, _ := ssoLogin(t, svc, fake, bob)
+	secret, _, _ := svc.EnrollTOTP(ctx, user.GetId())
+	step := totp.Step(time.Now())
+	svc.ConfirmTOTP(ctx, user.GetId(), totpCode(t, secret, step))
+
+	_, _, err := ssoLogin(t, svc, fake, bob)
+	var mfaErr *models.MFARequiredError
+	if !errors.As(err, &mfaErr) {
+		t.Fatalf("expected MFARequiredError, got %v", err)
+	}
+	if _, _, pbUser, err := svc.VerifyMFA(ctx, mfaErr.ChallengeToken, totpCode(t, secret, step+1), models.ClientInfo{}); err != nil || pbUser.GetId() != user.GetId() {
+		t.Fatalf("VerifyMFA failed: %v", err)
+	}
+}
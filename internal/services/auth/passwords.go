@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/mailer"
+	"github.com/grigory222/go-chat-server/internal/lib/passhash"
+)
+
+// Mail - письма пользователям: через что отправлять и какие ссылки в них вставлять.
+type Mail struct {
+	Mailer mailer.Mailer
+	// ResetTokenTTL - срок действия токена сброса пароля
+	ResetTokenTTL time.Duration
+	// ResetURL - шаблон ссылки на форму сброса, {token} заменяется токеном.
+	// Пустой шаблон - в письме только сам токен
+	ResetURL string
+	// ResetInterval - не чаще одного письма сброса за интервал на пользователя
+	ResetInterval time.Duration
+}
+
+// mailTimeout ограничивает отправку письма, которое готовится в фоне.
+const mailTimeout = time.Minute
+
+// ChangePassword меняет пароль после проверки текущего. Все сессии, кроме текущей sessionID,
+// завершаются; возвращается их количество.
+func (s *Service) ChangePassword(ctx context.Context, userID int64, sessionID, currentPassword, newPassword string) (int, error) {
+	const op = "services.auth.ChangePassword"
+	log := s.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	user, err := s.storage.UserByID(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := s.verifyPassword(user, currentPassword); err != nil {
+		if !errors.Is(err, passhash.ErrMismatch) {
+			log.Error("failed to verify password hash", slog.Any("err", err))
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		return 0, fmt.Errorf("%s: %w", op, models.ErrInvalidCredentials)
+	}
+
+	passHash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		log.Error("failed to generate password hash", slog.Any("err", err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	revoked, err := s.storage.ChangePassword(ctx, userID, passHash, sessionID)
+	if err != nil {
+		log.Error("failed to change password", slog.Any("err", err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, id := range revoked {
+		s.closeStreams(id)
+	}
+
+	log.Info("password changed", slog.Int("revoked_sessions", len(revoked)))
+	return len(revoked), nil
+}
+
+// RequestPasswordReset отправляет на email письмо с одноразовым токеном сброса пароля.
+// Для неизвестного email ошибка не возвращается, чтобы по ответу нельзя было узнать,
+// зарегистрирован ли адрес; слишком частые запросы молча пропускаются.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	const op = "services.auth.RequestPasswordReset"
+	log := s.log.With(slog.String("op", op))
+
+	user, err := s.storage.UserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			log.Info("password reset requested for unknown email")
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Токен и письмо готовятся в фоне: иначе по времени ответа было бы видно,
+	// что адрес зарегистрирован
+	s.mailing.Add(1)
+	go func() {
+		defer s.mailing.Done()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailTimeout)
+		defer cancel()
+		s.sendPasswordReset(ctx, user)
+	}()
+
+	return nil
+}
+
+// sendPasswordReset выдает пользователю новый токен сброса и отправляет письмо со ссылкой,
+// если предыдущее письмо было не раньше чем Mail.ResetInterval назад.
+// Ошибки только логируются: ответ на запрос уже отправлен.
+func (s *Service) sendPasswordReset(ctx context.Context, user *models.User) {
+	log := s.log.With(slog.String("op", "services.auth.sendPasswordReset"), slog.Int64("user_id", user.ID))
+
+	sentAt, err := s.storage.PasswordResetSentAt(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to get last reset email time", slog.Any("err", err))
+		return
+	}
+	if time.Since(sentAt) < s.mail.ResetInterval {
+		log.Info("password reset email throttled", slog.Time("sent_at", sentAt))
+		return
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		log.Error("failed to generate reset token", slog.Any("err", err))
+		return
+	}
+	expiresAt := time.Now().Add(s.mail.ResetTokenTTL)
+	if err := s.storage.CreatePasswordResetToken(ctx, user.ID, hashToken(token), expiresAt); err != nil {
+		log.Error("failed to save reset token", slog.Any("err", err))
+		return
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Сброс пароля",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\nДля сброса пароля перейдите по ссылке или введите код в приложении:\n%s\n\n"+
+			"Ссылка действует до %s. Если вы не запрашивали сброс, просто проигнорируйте это письмо.\n",
+			user.Name, mailLink(s.mail.ResetURL, token), expiresAt.UTC().Format("02.01.2006 15:04 MST")),
+	}
+	if err := s.mail.Mailer.Send(ctx, msg); err != nil {
+		log.Error("failed to send reset email", slog.Any("err", err))
+		return
+	}
+
+	log.Info("password reset email sent")
+}
+
+// Wait дожидается писем, которые отправляются в фоне.
+func (s *Service) Wait() {
+	s.mailing.Wait()
+}
+
+// ConfirmPasswordReset устанавливает новый пароль по токену из письма. Токен одноразовый;
+// все сессии пользователя завершаются.
+func (s *Service) ConfirmPasswordReset(ctx context.Context, token, newPassword string) error {
+	const op = "services.auth.ConfirmPasswordReset"
+	log := s.log.With(slog.String("op", op))
+
+	passHash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		log.Error("failed to generate password hash", slog.Any("err", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	userID, revoked, err := s.storage.ResetPassword(ctx, hashToken(token), passHash)
+	if err != nil {
+		if errors.Is(err, models.ErrResetTokenInvalid) {
+			log.Warn("invalid password reset token")
+		} else {
+			log.Error("failed to reset password", slog.Any("err", err))
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, id := range revoked {
+		s.closeStreams(id)
+	}
+
+	log.Info("password reset", slog.Int64("user_id", userID), slog.Int("revoked_sessions", len(revoked)))
+	return nil
+}
+
+// rehashPassword пересчитывает хэш верного пароля текущим алгоритмом и параметрами.
+// Ошибка только логируется: вход от нее не зависит, хэш обновится при следующем входе.
+func (s *Service) rehashPassword(ctx context.Context, user *models.User, password string) {
+	log := s.log.With(slog.Int64("user_id", user.ID))
+
+	passHash, err := s.hasher.Hash(password)
+	if err != nil {
+		log.Error("failed to rehash password", slog.Any("err", err))
+		return
+	}
+	if err := s.storage.UpdatePasswordHash(ctx, user.ID, user.PasswordHash, passHash); err != nil {
+		log.Error("failed to update password hash", slog.Any("err", err))
+		return
+	}
+
+	log.Info("password hash upgraded")
+}
+
+// verifyPassword сверяет пароль с хэшем пользователя. У пользователя, созданного входом
+// через OpenID провайдера, пароля нет: к нему не подходит никакой пароль, а ответ занимает
+// столько же времени, сколько обычная проверка.
+func (s *Service) verifyPassword(user *models.User, password string) (needsRehash bool, err error) {
+	if user.PasswordHash == "" {
+		s.verifyDummy(password)
+		return false, passhash.ErrMismatch
+	}
+	return s.hasher.Verify(user.PasswordHash, password)
+}
+
+// verifyDummy сверяет пароль с хэшем несуществующего пользователя, чтобы ответ для
+// неизвестного email занимал столько же времени, сколько для неверного пароля.
+func (s *Service) verifyDummy(password string) {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = s.hasher.Hash("dummy password")
+	})
+	_, _ = s.hasher.Verify(s.dummyHash, password)
+}
+
+// newSecretToken возвращает случайный токен для ссылок в письмах.
+func newSecretToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken - в хранилище попадает только SHA-256 токена. У токена 256 бит энтропии,
+// поэтому медленный хэш, как для паролей, не нужен.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// mailLink подставляет токен в шаблон ссылки.
+func mailLink(template, token string) string {
+	if template == "" {
+		return token
+	}
+	return strings.ReplaceAll(template, "{token}", url.QueryEscape(token))
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/mailer"
+	"github.com/grigory222/go-chat-server/internal/lib/passhash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeMailer struct {
+	sent []mailer.Message
+	err  error
+}
+
+func (f *fakeMailer) Send(ctx context.Context, msg mailer.Message) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+var resetTokenRe = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// lastToken extracts the token from the last link sent by the mailer.
+func lastToken(t *testing.T, m *fakeMailer) string {
+	t.Helper()
+	if len(m.sent) == 0 {
+		t.Fatalf("no email sent")
+	}
+	match := resetTokenRe.FindStringSubmatch(m.sent[len(m.sent)-1].Body)
+	if match == nil {
+		t.Fatalf("no token in email: %q", m.sent[len(m.sent)-1].Body)
+	}
+	return match[1]
+}
+
+func TestChangePassword(t *testing.T) {
+	st := newMockStorage()
+	closer := &fakeSessionCloser{}
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), closer, Options{
+		Hasher: testHasher,
+	})
+	ctx := context.Background()
+	if _, err := svc.Register(ctx, "Bob", "bob@example.com", "old"); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	current, _, _, _ := svc.Login(ctx, "bob@example.com", "old", models.ClientInfo{})
+	_, otherRefresh, _, _ := svc.Login(ctx, "bob@example.com", "old", models.ClientInfo{})
+	claims, _ := ParseAccessToken(current, NewHMACKeySet("secret"))
+
+	if _, err := svc.ChangePassword(ctx, 1, claims.SessionID, "wrong", "new"); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+
+	revoked, err := svc.ChangePassword(ctx, 1, claims.SessionID, "old", "new")
+	if err != nil || revoked != 1 || len(closer.closed) != 1 {
+		t.Fatalf("other session must be revoked: %d %v %v", revoked, err, closer.closed)
+	}
+	if active, _ := svc.SessionActive(ctx, claims.SessionID); !active {
+		t.Fatalf("current session must stay active")
+	}
+	if _, _, err := svc.RefreshToken(ctx, otherRefresh); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("other session refresh must fail, got %v", err)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "old", models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("old password must not work, got %v", err)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "new", models.ClientInfo{}); err != nil {
+		t.Fatalf("new password must work: %v", err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	st := newMockStorage()
+	mail := &fakeMailer{}
+	closer := &fakeSessionCloser{}
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), closer, Options{
+		Mail: Mail{
+			Mailer:        mail,
+			ResetTokenTTL: time.Hour,
+			ResetURL:      "https://chat.example.com/reset?token={token}",
+		},
+		Hasher: testHasher,
+	})
+	ctx := context.Background()
+	if _, err := svc.Register(ctx, "Bob", "bob@example.com", "old"); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	mail.sent = nil // drop the verification email
+	_, refresh, _, _ := svc.Login(ctx, "bob@example.com", "old", models.ClientInfo{})
+
+	// Unknown email: same answer, nothing sent
+	err := svc.RequestPasswordReset(ctx, "nobody@example.com")
+	svc.Wait()
+	if err != nil || len(mail.sent) != 0 {
+		t.Fatalf("unknown email must be silently ignored: %v %v", err, mail.sent)
+	}
+
+	if err := svc.RequestPasswordReset(ctx, "bob@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset error: %v", err)
+	}
+	svc.Wait()
+	first := lastToken(t, mail)
+	if mail.sent[0].To != "bob@example.com" {
+		t.Fatalf("unexpected recipient: %v", mail.sent[0].To)
+	}
+	for hash := range st.resetTokens {
+		if hash == first {
+			t.Fatalf("token must be stored hashed")
+		}
+	}
+
+	// A newer email invalidates the previous token
+	if err := svc.RequestPasswordReset(ctx, "bob@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset error: %v", err)
+	}
+	svc.Wait()
+	token := lastToken(t, mail)
+	if err := svc.ConfirmPasswordReset(ctx, first, "new"); !errors.Is(err, models.ErrResetTokenInvalid) {
+		t.Fatalf("superseded token must be rejected, got %v", err)
+	}
+
+	if err := svc.ConfirmPasswordReset(ctx, token, "new"); err != nil {
+		t.Fatalf("ConfirmPasswordReset error: %v", err)
+	}
+	if err := svc.ConfirmPasswordReset(ctx, token, "again"); !errors.Is(err, models.ErrResetTokenInvalid) {
+		t.Fatalf("token must be single-use, got %v", err)
+	}
+	if _, _, err := svc.RefreshToken(ctx, refresh); !errors.Is(err, models.ErrInvalidCredentials) || len(closer.closed) != 1 {
+		t.Fatalf("all sessions must be revoked after reset: %v %v", err, closer.closed)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "new", models.ClientInfo{}); err != nil {
+		t.Fatalf("new password must work: %v", err)
+	}
+}
+
+func TestPasswordResetExpiredAndMailerFailure(t *testing.T) {
+	st := newMockStorage()
+	mail := &fakeMailer{}
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		Mail: Mail{
+			Mailer:        mail,
+			ResetTokenTTL: -time.Second,
+			ResetURL:      "https://chat.example.com/reset?token={token}",
+		},
+		Hasher: testHasher,
+	})
+	ctx := context.Background()
+	if _, err := svc.Register(ctx, "Bob", "bob@example.com", "old"); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	mail.sent = nil // drop the verification email
+
+	if err := svc.RequestPasswordReset(ctx, "bob@example.com"); err != nil {
+		t.Fatalf("RequestPasswordReset error: %v", err)
+	}
+	svc.Wait()
+	if err := svc.ConfirmPasswordReset(ctx, lastToken(t, mail), "new"); !errors.Is(err, models.ErrResetTokenInvalid) {
+		t.Fatalf("expired token must be rejected, got %v", err)
+	}
+
+	// A mailer failure must not reveal that the address exists
+	mail.err = errors.New("smtp down")
+	if err := svc.RequestPasswordReset(ctx, "bob@example.com"); err != nil {
+		t.Fatalf("mailer failure must not be returned: %v", err)
+	}
+	svc.Wait()
+}
+
+func TestPasswordResetThrottled(t *testing.T) {
+	st := newMockStorage()
+	mail := &fakeMailer{}
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		Mail: Mail{
+			Mailer:        mail,
+			ResetTokenTTL: time.Hour,
+			ResetInterval: time.Minute,
+		},
+		Hasher: testHasher,
+	})
+	ctx := context.Background()
+	if _, err := svc.Register(ctx, "Bob", "bob@example.com", "old"); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	mail.sent = nil // drop the verification email
+
+	for i := 0; i < 3; i++ {
+		if err := svc.RequestPasswordReset(ctx, "bob@example.com"); err != nil {
+			t.Fatalf("throttled request must look the same: %v", err)
+		}
+		svc.Wait()
+	}
+	if len(mail.sent) != 1 || len(st.resetTokens) != 1 {
+		t.Fatalf("expected a single email within the interval, got %d", len(mail.sent))
+	}
+
+	// The interval counts from the last email
+	for _, token := range st.resetTokens {
+		token.createdAt = time.Now().Add(-2 * time.Minute)
+	}
+	svc.RequestPasswordReset(ctx, "bob@example.com")
+	svc.Wait()
+	if len(mail.sent) != 2 {
+		t.Fatalf("expected a new email after the interval, got %d", len(mail.sent))
+	}
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	st := newMockStorage()
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		Hasher: testHasher,
+	})
+	ctx := context.Background()
+
+	// A legacy bcrypt hash is accepted and replaced with argon2id
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	id, _ := st.SaveUser(ctx, "Bob", "bob@example.com", string(legacy))
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "wrong", models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if st.usersByID[id].PasswordHash != string(legacy) {
+		t.Fatalf("failed login must not touch the hash")
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{}); err != nil {
+		t.Fatalf("login with bcrypt hash must succeed: %v", err)
+	}
+	upgraded := st.usersByID[id].PasswordHash
+	if !strings.HasPrefix(upgraded, "$argon2id$") {
+		t.Fatalf("hash must be upgraded to argon2id, got %q", upgraded)
+	}
+
+	// Stronger parameters upgrade an argon2id hash as well
+	svc.hasher = passhash.NewArgon2id(passhash.Argon2Params{Memory: 128, Iterations: 1, Parallelism: 1, KeyLen: 32}, 0)
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{}); err != nil {
+		t.Fatalf("login with old params must succeed: %v", err)
+	}
+	current := st.usersByID[id].PasswordHash
+	if current == upgraded || !strings.Contains(current, "m=128,") {
+		t.Fatalf("hash must be recomputed with new params, got %q", current)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{}); err != nil || st.usersByID[id].PasswordHash != current {
+		t.Fatalf("up-to-date hash must be kept: %v", err)
+	}
+}
+
+func TestRegisterLongPassword(t *testing.T) {
+	svc := New(testLogger(), newMockStorage(), time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		Hasher: testHasher,
+	})
+	ctx := context.Background()
+
+	// bcrypt would ignore everything past 72 bytes
+	password := strings.Repeat("a", 80)
+	if _, err := svc.Register(ctx, "Bob", "bob@example.com", password); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", strings.Repeat("a", 72)+"bbbbbbbb", models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("the whole password must be checked, got %v", err)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", password, models.ClientInfo{}); err != nil {
+		t.Fatalf("login error: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/lib/lockout"
+)
+
+// LoginProtection - защита входа от перебора паролей и кодов 2FA. Счетчики ведутся
+// в памяти экземпляра, nil-счетчик ничего не ограничивает.
+type LoginProtection struct {
+	// Account - неудачи по email, в том числе по незарегистрированным адресам
+	Account *lockout.Guard
+	// IP - неудачи с IP клиента по любым email
+	IP *lockout.Guard
+}
+
+// begin начинает попытку входа по аккаунту и IP. Если пробовать пока нельзя, возвращает,
+// сколько еще ждать; иначе попытку нужно завершить через end.
+func (p LoginProtection) begin(email, ip string) (*loginAttempt, time.Duration) {
+	attempt := &loginAttempt{protection: p, account: accountKey(email), ip: ip}
+	if wait := p.Account.Begin(attempt.account); wait > 0 {
+		return nil, wait
+	}
+	if ip != "" {
+		if wait := p.IP.Begin(ip); wait > 0 {
+			p.Account.Done(attempt.account)
+			return nil, wait
+		}
+	}
+	return attempt, 0
+}
+
+// loginAttempt - начатая попытка входа. Пока она не завершена, счетчики учитывают ее
+// как неудачную, поэтому параллельные попытки не проходят мимо порога.
+type loginAttempt struct {
+	protection LoginProtection
+	account    string
+	ip         string
+	failed     bool
+	succeeded  bool
+}
+
+// fail отмечает попытку неудачной: неверный пароль или код.
+func (a *loginAttempt) fail() { a.failed = true }
+
+// succeed отмечает попытку успешной.
+func (a *loginAttempt) succeed() { a.succeeded = true }
+
+// end завершает попытку. Неудача учитывается по аккаунту и IP. Успех сбрасывает счетчик
+// аккаунта, но не IP: иначе вход в собственный аккаунт позволял бы продолжать перебор
+// чужих паролей с того же адреса. Попытка без итога (ошибка хранилища, требуется второй
+// фактор) просто снимается со счетчиков.
+func (a *loginAttempt) end() {
+	p := a.protection
+	switch {
+	case a.failed:
+		p.Account.Fail(a.account)
+	case a.succeeded:
+		p.Account.Reset(a.account)
+	default:
+		p.Account.Done(a.account)
+	}
+	if a.ip == "" {
+		return
+	}
+	if a.failed {
+		p.IP.Fail(a.ip)
+	} else {
+		p.IP.Done(a.ip)
+	}
+}
+
+// accountKey - email без учета регистра, чтобы перебор не обходил счетчик вариантами написания.
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
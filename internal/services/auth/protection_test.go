@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/lockout"
+	"github.com/grigory222/go-chat-server/internal/lib/passhash"
+	"github.com/grigory222/go-chat-server/internal/lib/totp"
+)
+
+func newProtectedService(st *mockStorage, accountAttempts, ipAttempts int) *Service {
+	return New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		MFA: MFA{Issuer: "go-chat", ChallengeTTL: time.Minute},
+		LoginProtection: LoginProtection{
+			Account: lockout.New(lockout.Config{LockoutAttempts: accountAttempts, LockoutDuration: time.Hour, ResetAfter: time.Hour}),
+			IP:      lockout.New(lockout.Config{LockoutAttempts: ipAttempts, LockoutDuration: time.Hour, ResetAfter: time.Hour}),
+		},
+		Hasher: testHasher,
+	})
+}
+
+func TestLoginAccountLockout(t *testing.T) {
+	st := newMockStorage()
+	svc := newProtectedService(st, 3, 100)
+	ctx := context.Background()
+	svc.Register(ctx, "Bob", "bob@example.com", "pass")
+
+	login := func(email, password, ip string) error {
+		_, _, _, err := svc.Login(ctx, email, password, models.ClientInfo{IP: ip})
+		return err
+	}
+
+	// A success before the threshold resets the counter
+	login("bob@example.com", "wrong", "10.0.0.1")
+	login("bob@example.com", "wrong", "10.0.0.1")
+	if err := login("bob@example.com", "pass", "10.0.0.1"); err != nil {
+		t.Fatalf("login under the threshold must succeed: %v", err)
+	}
+
+	// Failures from different IPs add up per account, email case does not matter
+	login("bob@example.com", "wrong", "10.0.0.1")
+	login("BOB@example.com", "wrong", "10.0.0.2")
+	login("bob@example.com", "wrong", "10.0.0.3")
+	if err := login("bob@example.com", "pass", "10.0.0.4"); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("locked account must be rejected like a wrong password, got %v", err)
+	}
+
+	// An unknown email is locked the same way, so lockouts do not reveal registered accounts
+	for i := 0; i < 3; i++ {
+		if err := login("nobody@example.com", "wrong", "10.0.0.5"); !errors.Is(err, models.ErrInvalidCredentials) {
+			t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+		}
+	}
+	if svc.protection.Account.Check(accountKey("nobody@example.com")) == 0 {
+		t.Fatalf("unknown email must be locked after the same number of failures")
+	}
+}
+
+// countingHasher counts password checks that reach the hasher.
+type countingHasher struct {
+	passhash.Hasher
+	verified atomic.Int32
+}
+
+func (h *countingHasher) Verify(hash, password string) (bool, error) {
+	h.verified.Add(1)
+	return h.Hasher.Verify(hash, password)
+}
+
+func TestLoginLockoutConcurrent(t *testing.T) {
+	st := newMockStorage()
+	svc := newProtectedService(st, 3, 100)
+	ctx := context.Background()
+	svc.Register(ctx, "Bob", "bob@example.com", "pass")
+	hasher := &countingHasher{Hasher: testHasher}
+	svc.hasher = hasher
+
+	// Parallel guesses cannot slip past the threshold while earlier ones are still checked
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			svc.Login(ctx, "bob@example.com", "guess", models.ClientInfo{})
+		}()
+	}
+	wg.Wait()
+
+	if n := hasher.verified.Load(); n > 3 {
+		t.Fatalf("expected at most 3 password checks, got %d", n)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("account must be locked, got %v", err)
+	}
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	st := newMockStorage()
+	svc := newProtectedService(st, 100, 3)
+	ctx := context.Background()
+	svc.Register(ctx, "Bob", "bob@example.com", "pass")
+
+	// Spraying different accounts from one IP
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		svc.Login(ctx, email, "guess", models.ClientInfo{IP: "10.0.0.1"})
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{IP: "10.0.0.1"}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("blocked IP must be rejected, got %v", err)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{IP: "10.0.0.2"}); err != nil {
+		t.Fatalf("other IPs must not be affected: %v", err)
+	}
+}
+
+func TestVerifyMFALockout(t *testing.T) {
+	st := newMockStorage()
+	svc := newProtectedService(st, 3, 100)
+	ctx := context.Background()
+	user, _ := svc.Register(ctx, "Bob", "bob@example.com", "pass")
+	secret, _, _ := svc.EnrollTOTP(ctx, user.Id)
+	step := totp.Step(time.Now())
+	svc.ConfirmTOTP(ctx, user.Id, totpCode(t, secret, step))
+
+	challenge := mfaChallenge(t, svc, "bob@example.com", "pass")
+	for i := 0; i < 3; i++ {
+		svc.VerifyMFA(ctx, challenge, "abcdef", models.ClientInfo{})
+	}
+
+	// Guessing codes locks the account: the right code and the password are rejected too
+	if _, _, _, err := svc.VerifyMFA(ctx, challenge, totpCode(t, secret, step+1), models.ClientInfo{}); !errors.Is(err, models.ErrTOTPCodeInvalid) {
+		t.Fatalf("expected ErrTOTPCodeInvalid while locked, got %v", err)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials while locked, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+)
+
+// SessionCloser закрывает открытые на этом экземпляре стримы сессии,
+// чтобы отозванное устройство сразу теряло доступ к чатам.
+type SessionCloser interface {
+	CloseSession(sessionID string)
+}
+
+// Logout завершает текущую сессию пользователя.
+func (s *Service) Logout(ctx context.Context, userID int64, sessionID string) error {
+	const op = "services.auth.Logout"
+
+	if err := s.revokeSession(ctx, userID, sessionID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// LogoutAll завершает все сессии пользователя, включая текущую, и возвращает их количество.
+func (s *Service) LogoutAll(ctx context.Context, userID int64) (int, error) {
+	const op = "services.auth.LogoutAll"
+	log := s.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	ids, err := s.storage.RevokeUserSessions(ctx, userID)
+	if err != nil {
+		log.Error("failed to revoke sessions", slog.Any("err", err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, id := range ids {
+		s.closeStreams(id)
+	}
+
+	log.Info("all sessions revoked", slog.Int("count", len(ids)))
+	return len(ids), nil
+}
+
+// ListSessions возвращает действующие сессии пользователя; сессия currentSessionID помечается текущей.
+func (s *Service) ListSessions(ctx context.Context, userID int64, currentSessionID string) ([]*chatpb.Session, error) {
+	const op = "services.auth.ListSessions"
+
+	sessions, err := s.storage.Sessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res := make([]*chatpb.Session, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, &chatpb.Session{
+			Id:         session.ID,
+			UserAgent:  session.UserAgent,
+			Ip:         session.IP,
+			CreatedAt:  session.CreatedAt.Unix(),
+			LastUsedAt: session.LastUsedAt.Unix(),
+			Current:    session.ID == currentSessionID,
+		})
+	}
+
+	return res, nil
+}
+
+// RevokeSession завершает одну из сессий пользователя, например потерянное устройство.
+// Чужая или уже завершенная сессия - ErrSessionNotFound.
+func (s *Service) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	const op = "services.auth.RevokeSession"
+
+	if err := s.revokeSession(ctx, userID, sessionID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SessionActive сообщает, действует ли сессия. Вызывается перехватчиками на каждый запрос,
+// чтобы access токены отозванной сессии переставали работать до истечения срока.
+func (s *Service) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	const op = "services.auth.SessionActive"
+
+	active, err := s.storage.SessionActive(ctx, sessionID)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return active, nil
+}
+
+func (s *Service) revokeSession(ctx context.Context, userID int64, sessionID string) error {
+	log := s.log.With(slog.Int64("user_id", userID), slog.String("session_id", sessionID))
+
+	if err := s.storage.RevokeSession(ctx, userID, sessionID); err != nil {
+		if !errors.Is(err, models.ErrSessionNotFound) {
+			log.Error("failed to revoke session", slog.Any("err", err))
+		}
+		return err
+	}
+	s.closeStreams(sessionID)
+
+	log.Info("session revoked")
+	return nil
+}
+
+func (s *Service) closeStreams(sessionID string) {
+	if s.streams != nil {
+		s.streams.CloseSession(sessionID)
+	}
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/mailer"
+)
+
+// Verification - подтверждение email после регистрации.
+type Verification struct {
+	// TokenTTL - срок действия ссылки подтверждения
+	TokenTTL time.Duration
+	// ResendInterval - не чаще одного письма за интервал на пользователя
+	ResendInterval time.Duration
+	// URL - шаблон ссылки подтверждения, {token} заменяется токеном.
+	// Пустой шаблон - в письме только сам токен
+	URL string
+	// RequiredForLogin - без подтвержденного email Login возвращает ErrEmailNotVerified
+	RequiredForLogin bool
+}
+
+// VerifyEmail подтверждает email по токену из письма. Токен одноразовый.
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	const op = "services.auth.VerifyEmail"
+	log := s.log.With(slog.String("op", op))
+
+	userID, err := s.storage.VerifyEmail(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, models.ErrVerifyTokenInvalid) {
+			log.Warn("invalid email verification token")
+		} else {
+			log.Error("failed to verify email", slog.Any("err", err))
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("email verified", slog.Int64("user_id", userID))
+	return nil
+}
+
+// ResendVerificationEmail повторно отправляет письмо подтверждения. Как и RequestPasswordReset,
+// для неизвестного или уже подтвержденного email ошибка не возвращается; слишком частые
+// запросы молча пропускаются.
+func (s *Service) ResendVerificationEmail(ctx context.Context, email string) error {
+	const op = "services.auth.ResendVerificationEmail"
+	log := s.log.With(slog.String("op", op))
+
+	user, err := s.storage.UserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			log.Info("verification email requested for unknown email")
+			return nil
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	log = log.With(slog.Int64("user_id", user.ID))
+
+	if user.EmailVerified {
+		log.Info("verification email requested for verified email")
+		return nil
+	}
+
+	// Токен и письмо готовятся в фоне, как в RequestPasswordReset: иначе по времени
+	// ответа было бы видно, что адрес зарегистрирован
+	s.mailing.Add(1)
+	go func() {
+		defer s.mailing.Done()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailTimeout)
+		defer cancel()
+		s.resendVerification(ctx, user)
+	}()
+
+	return nil
+}
+
+// resendVerification отправляет письмо подтверждения, если предыдущее было не раньше
+// чем Verification.ResendInterval назад. Ошибки только логируются: ответ на запрос уже отправлен.
+func (s *Service) resendVerification(ctx context.Context, user *models.User) {
+	log := s.log.With(slog.String("op", "services.auth.resendVerification"), slog.Int64("user_id", user.ID))
+
+	sentAt, err := s.storage.EmailVerificationSentAt(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to get last verification email time", slog.Any("err", err))
+		return
+	}
+	if time.Since(sentAt) < s.verification.ResendInterval {
+		log.Info("verification email throttled", slog.Time("sent_at", sentAt))
+		return
+	}
+
+	if err := s.sendVerification(ctx, user); err != nil {
+		log.Error("failed to send verification email", slog.Any("err", err))
+	}
+}
+
+// sendVerification выдает пользователю новый токен подтверждения и отправляет письмо со ссылкой.
+func (s *Service) sendVerification(ctx context.Context, user *models.User) error {
+	if s.mail.Mailer == nil {
+		return errors.New("mailer is not configured")
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(s.verification.TokenTTL)
+	if err := s.storage.CreateEmailVerificationToken(ctx, user.ID, hashToken(token), expiresAt); err != nil {
+		return fmt.Errorf("failed to save verification token: %w", err)
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Подтверждение email",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\nДля подтверждения email перейдите по ссылке или введите код в приложении:\n%s\n\n"+
+			"Ссылка действует до %s. Если вы не регистрировались, просто проигнорируйте это письмо.\n",
+			user.Name, mailLink(s.verification.URL, token), expiresAt.UTC().Format("02.01.2006 15:04 MST")),
+	}
+	if err := s.mail.Mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	s.log.Info("verification email sent", slog.Int64("user_id", user.ID))
+	return nil
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+)
+
+func TestEmailVerification(t *testing.T) {
+	st := newMockStorage()
+	mail := &fakeMailer{}
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		Mail: Mail{Mailer: mail},
+		Verification: Verification{
+			TokenTTL:       time.Hour,
+			ResendInterval: time.Minute,
+			URL:            "https://chat.example.com/verify?token={token}",
+		},
+		Hasher: testHasher,
+	})
+	ctx := context.Background()
+	user, err := svc.Register(ctx, "Bob", "bob@example.com", "pass")
+	if err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	if len(mail.sent) != 1 || mail.sent[0].To != "bob@example.com" || !strings.Contains(mail.sent[0].Body, "https://chat.example.com/verify?token=") {
+		t.Fatalf("registration must send a verification email: %+v", mail.sent)
+	}
+	token := lastToken(t, mail)
+
+	// Not verified yet: login is allowed by default, the token carries the flag
+	access, refresh, pbUser, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{})
+	if err != nil || pbUser.GetEmailVerified() {
+		t.Fatalf("unexpected login result: %v %+v", err, pbUser)
+	}
+	if claims, _ := ParseAccessToken(access, svc.keys); claims.EmailVerified {
+		t.Fatalf("access token must not claim a verified email")
+	}
+
+	// Resend within the interval is silently throttled
+	err = svc.ResendVerificationEmail(ctx, "bob@example.com")
+	svc.Wait()
+	if err != nil || len(mail.sent) != 1 {
+		t.Fatalf("resend must be throttled: %v %d", err, len(mail.sent))
+	}
+
+	if err := svc.VerifyEmail(ctx, token); err != nil {
+		t.Fatalf("VerifyEmail error: %v", err)
+	}
+	if !st.usersByID[user.Id].EmailVerified {
+		t.Fatalf("email must be marked verified")
+	}
+	if err := svc.VerifyEmail(ctx, token); !errors.Is(err, models.ErrVerifyTokenInvalid) {
+		t.Fatalf("token must be single-use, got %v", err)
+	}
+
+	// Refreshed access token picks up the new flag
+	access, _, err = svc.RefreshToken(ctx, refresh)
+	if err != nil {
+		t.Fatalf("RefreshToken error: %v", err)
+	}
+	if claims, _ := ParseAccessToken(access, svc.keys); !claims.EmailVerified {
+		t.Fatalf("refreshed access token must claim a verified email")
+	}
+
+	// Verified and unknown emails: same answer, nothing sent
+	for _, email := range []string{"bob@example.com", "nobody@example.com"} {
+		err := svc.ResendVerificationEmail(ctx, email)
+		svc.Wait()
+		if err != nil || len(mail.sent) != 1 {
+			t.Fatalf("%s: resend must be a silent no-op: %v %d", email, err, len(mail.sent))
+		}
+	}
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	st := newMockStorage()
+	mail := &fakeMailer{}
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		Mail: Mail{Mailer: mail},
+		Verification: Verification{
+			TokenTTL: time.Hour,
+			URL:      "https://chat.example.com/verify?token={token}",
+		},
+		Hasher: testHasher,
+	})
+	ctx := context.Background()
+	if _, err := svc.Register(ctx, "Bob", "bob@example.com", "pass"); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+	first := lastToken(t, mail)
+
+	err := svc.ResendVerificationEmail(ctx, "bob@example.com")
+	svc.Wait()
+	if err != nil || len(mail.sent) != 2 {
+		t.Fatalf("resend must send a new email: %v %d", err, len(mail.sent))
+	}
+	second := lastToken(t, mail)
+
+	// Only the latest link is valid
+	if err := svc.VerifyEmail(ctx, first); !errors.Is(err, models.ErrVerifyTokenInvalid) {
+		t.Fatalf("previous token must be invalidated, got %v", err)
+	}
+	if err := svc.VerifyEmail(ctx, second); err != nil {
+		t.Fatalf("VerifyEmail error: %v", err)
+	}
+
+	// Mailer failure does not fail registration
+	mail.err = errors.New("smtp down")
+	if _, err := svc.Register(ctx, "Eve", "eve@example.com", "pass"); err != nil {
+		t.Fatalf("Register must succeed when mail fails: %v", err)
+	}
+}
+
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	st := newMockStorage()
+	mail := &fakeMailer{}
+	svc := New(testLogger(), st, time.Minute, time.Hour, NewHMACKeySet("secret"), nil, Options{
+		Mail: Mail{Mailer: mail},
+		Verification: Verification{
+			TokenTTL:         time.Hour,
+			URL:              "https://chat.example.com/verify?token={token}",
+			RequiredForLogin: true,
+		},
+		Hasher: testHasher,
+	})
+	ctx := context.Background()
+	if _, err := svc.Register(ctx, "Bob", "bob@example.com", "pass"); err != nil {
+		t.Fatalf("Register error: %v", err)
+	}
+
+	// Wrong password is reported as such, so the gate does not leak registered emails
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "wrong", models.ClientInfo{}); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+	}
+	if _, _, _, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{}); !errors.Is(err, models.ErrEmailNotVerified) {
+		t.Fatalf("expected ErrEmailNotVerified, got %v", err)
+	}
+
+	if err := svc.VerifyEmail(ctx, lastToken(t, mail)); err != nil {
+		t.Fatalf("VerifyEmail error: %v", err)
+	}
+	if _, _, pbUser, err := svc.Login(ctx, "bob@example.com", "pass", models.ClientInfo{}); err != nil || !pbUser.GetEmailVerified() {
+		t.Fatalf("login after verification failed: %v", err)
+	}
+}
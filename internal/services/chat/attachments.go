@@ -0,0 +1,294 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"image"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+	"github.com/grigory222/go-chat-server/internal/lib/imaging"
+	"github.com/grigory222/go-chat-server/internal/storage"
+)
+
+// sniffLen - столько байт смотрит http.DetectContentType
+const sniffLen = 512
+
+// AttachmentService принимает и отдает файлы вложений.
+// Содержимое адресуется SHA-256, поэтому одинаковые файлы хранятся в blob-хранилище один раз.
+// У изображений перед сохранением затираются GPS-данные EXIF, а превью строит thumbnailer (может быть nil).
+type AttachmentService struct {
+	log         *slog.Logger
+	storage     storage.Storage
+	blobs       storage.BlobStore
+	maxSize     int64
+	thumbnailer *Thumbnailer
+}
+
+func NewAttachmentService(
+	log *slog.Logger,
+	storage storage.Storage,
+	blobs storage.BlobStore,
+	maxSize int64,
+	thumbnailer *Thumbnailer,
+) *AttachmentService {
+	return &AttachmentService{log: log, storage: storage, blobs: blobs, maxSize: maxSize, thumbnailer: thumbnailer}
+}
+
+// Upload читает содержимое файла из r, считает хеш и размер, сохраняет blob (если такого еще нет)
+// и метаданные. Загружать можно только в чат, где состоит пользователь.
+func (s *AttachmentService) Upload(ctx context.Context, chatID int64, name, mimeType string, r io.Reader) (*chatpb.Attachment, error) {
+	const op = "services.chat.AttachmentService.Upload"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	inChat, err := s.storage.IsUserInChat(ctx, userID, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !inChat {
+		log.Warn("access denied: user is not member of chat", slog.Int64("user_id", userID))
+		return nil, models.ErrAccessDenied
+	}
+
+	// Хеш известен только после чтения всего файла, поэтому сначала пишем во временный файл
+	tmp, err := os.CreateTemp("", "chat-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	sniff := &prefixBuffer{limit: sniffLen}
+	// Читаем на байт больше лимита, чтобы отличить "ровно maxSize" от "больше"
+	size, err := io.Copy(io.MultiWriter(tmp, hasher, sniff), io.LimitReader(r, s.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if size > s.maxSize {
+		log.Warn("attachment exceeds size limit", slog.Int64("max_size", s.maxSize))
+		return nil, models.ErrAttachmentTooLarge
+	}
+
+	// Решение об обработке изображения принимаем по содержимому, а не по заявленному клиентом типу
+	detected := http.DetectContentType(sniff.buf)
+	var width, height int
+	if imaging.IsSupported(detected) {
+		width, height, err = s.prepareImage(tmp, hasher)
+		if err != nil {
+			log.Warn("image rejected: location data cannot be stripped", slog.Any("err", err))
+			return nil, fmt.Errorf("%s: %w", op, models.ErrInvalidImage)
+		}
+	}
+
+	key := hex.EncodeToString(hasher.Sum(nil))
+
+	exists, err := s.blobs.Exists(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := s.blobs.Put(ctx, key, tmp); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	} else {
+		log.Debug("attachment content already stored, deduplicated", slog.String("sha256", key))
+	}
+
+	if mimeType == "" {
+		mimeType = detected
+	}
+
+	attachment := &models.Attachment{
+		ChatID:     chatID,
+		UploaderID: userID,
+		Name:       filepath.Base(name),
+		MimeType:   mimeType,
+		Size:       size,
+		SHA256:     key,
+		Width:      width,
+		Height:     height,
+	}
+
+	attachment.ID, err = s.storage.SaveAttachment(ctx, attachment)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Уборщик мог удалить найденный blob до того, как на него сослалось новое вложение.
+	// После сохранения ссылки удалить его уже нельзя, поэтому достаточно проверить еще раз
+	if exists {
+		if err := s.ensureBlob(ctx, key, tmp); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("attachment uploaded", slog.Int64("attachment_id", attachment.ID), slog.Int64("size", size))
+
+	if width > 0 && s.thumbnailer != nil {
+		if s.thumbnailer.Fits(width, height) {
+			s.thumbnailer.Enqueue(attachment.ID, key)
+		} else {
+			log.Warn("image is too large for thumbnails", slog.Int("width", width), slog.Int("height", height))
+		}
+	}
+
+	return toProtoAttachment(attachment), nil
+}
+
+// ensureBlob записывает содержимое f под ключом key, если его нет в хранилище.
+func (s *AttachmentService) ensureBlob(ctx context.Context, key string, f *os.File) error {
+	exists, err := s.blobs.Exists(ctx, key)
+	if err != nil || exists {
+		return err
+	}
+	s.log.Warn("deduplicated blob was deleted concurrently, storing again", slog.String("sha256", key))
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return s.blobs.Put(ctx, key, f)
+}
+
+// prepareImage затирает GPS-данные в файле изображения и возвращает его размеры.
+// Если файл изменился, hash пересчитывается по новому содержимому. Ошибка означает,
+// что метаданные не удалось разобрать и файл нельзя сохранять. Изображение, которое
+// Go не может декодировать, сохраняется без размеров (и без превью).
+func (s *AttachmentService) prepareImage(f *os.File, hash hash.Hash) (width, height int, err error) {
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Местоположение затирается независимо от того, удастся ли потом прочитать размеры
+	stripped, changed, err := imaging.StripLocation(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	if changed {
+		// Размер не меняется, поэтому достаточно перезаписать содержимое
+		if _, err := f.WriteAt(stripped, 0); err != nil {
+			return 0, 0, err
+		}
+		hash.Reset()
+		hash.Write(stripped)
+		s.log.Debug("stripped EXIF location data from image")
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(stripped))
+	if err != nil {
+		s.log.Warn("failed to decode image config, storing without dimensions", slog.Any("err", err))
+		return 0, 0, nil
+	}
+
+	return cfg.Width, cfg.Height, nil
+}
+
+// Open возвращает метаданные вложения и поток его содержимого (или одного из его превью, если thumbnailID != 0).
+// Вызывающий обязан закрыть поток.
+func (s *AttachmentService) Open(ctx context.Context, attachmentID, thumbnailID int64) (*chatpb.Attachment, io.ReadCloser, error) {
+	const op = "services.chat.AttachmentService.Open"
+	log := s.log.With(slog.String("op", op), slog.Int64("attachment_id", attachmentID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, nil, models.ErrInvalidCredentials
+	}
+
+	attachment, err := s.storage.AttachmentByID(ctx, attachmentID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	inChat, err := s.storage.IsUserInChat(ctx, userID, attachment.ChatID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !inChat {
+		log.Warn("access denied: user is not member of chat", slog.Int64("user_id", userID))
+		return nil, nil, models.ErrAccessDenied
+	}
+
+	key := attachment.SHA256
+	if thumbnailID != 0 {
+		key = ""
+		for _, t := range attachment.Thumbnails {
+			if t.ID == thumbnailID {
+				key = t.SHA256
+			}
+		}
+		if key == "" {
+			return nil, nil, fmt.Errorf("%s: thumbnail %d: %w", op, thumbnailID, models.ErrAttachmentNotFound)
+		}
+	}
+
+	rc, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, models.ErrBlobNotFound) {
+			log.Error("attachment content is missing in blob store", slog.String("sha256", key))
+		}
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return toProtoAttachment(attachment), rc, nil
+}
+
+func toProtoAttachment(a *models.Attachment) *chatpb.Attachment {
+	protoAttachment := &chatpb.Attachment{
+		Id:        a.ID,
+		ChatId:    a.ChatID,
+		Name:      a.Name,
+		MimeType:  a.MimeType,
+		Size:      a.Size,
+		Sha256:    a.SHA256,
+		CreatedAt: a.CreatedAt.Unix(),
+		Width:     int32(a.Width),
+		Height:    int32(a.Height),
+	}
+	for _, t := range a.Thumbnails {
+		protoAttachment.Thumbnails = append(protoAttachment.Thumbnails, &chatpb.Thumbnail{
+			Id:       t.ID,
+			Width:    int32(t.Width),
+			Height:   int32(t.Height),
+			MimeType: t.MimeType,
+			Size:     t.Size,
+		})
+	}
+	return protoAttachment
+}
+
+// prefixBuffer запоминает первые limit байт записанных данных.
+type prefixBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (b *prefixBuffer) Write(p []byte) (int, error) {
+	if rest := b.limit - len(b.buf); rest > 0 {
+		if len(p) < rest {
+			rest = len(p)
+		}
+		b.buf = append(b.buf, p[:rest]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,249 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+// memBlobStore is an in-memory storage.BlobStore that counts writes.
+type memBlobStore struct {
+	blobs map[string][]byte
+	puts  int
+}
+
+func newMemBlobStore() *memBlobStore { return &memBlobStore{blobs: map[string][]byte{}} }
+
+func (m *memBlobStore) Put(ctx context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.blobs[key] = data
+	m.puts++
+	return nil
+}
+func (m *memBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	data, ok := m.blobs[key]
+	if !ok {
+		return nil, models.ErrBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+func (m *memBlobStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok := m.blobs[key]
+	return ok, nil
+}
+func (m *memBlobStore) Delete(ctx context.Context, key string) error {
+	delete(m.blobs, key)
+	return nil
+}
+
+func TestAttachmentServiceUpload(t *testing.T) {
+	st := &mockChatStorage{}
+	blobs := newMemBlobStore()
+	svc := NewAttachmentService(testLogger(), st, blobs, 16, nil)
+
+	// Missing user id
+	if _, err := svc.Upload(context.Background(), 1, "a.txt", "", strings.NewReader("hello")); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	// Not a member
+	if _, err := svc.Upload(ctx, 1, "a.txt", "", strings.NewReader("hello")); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+
+	st.isUserInChat = true
+
+	// Too large
+	if _, err := svc.Upload(ctx, 1, "big.bin", "", strings.NewReader(strings.Repeat("x", 17))); !errors.Is(err, models.ErrAttachmentTooLarge) {
+		t.Fatalf("expected too large, got %v", err)
+	}
+
+	// Success: hash, size and sniffed MIME type
+	a, err := svc.Upload(ctx, 1, "../../a.txt", "", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+	sum := sha256.Sum256([]byte("hello"))
+	if a.Sha256 != hex.EncodeToString(sum[:]) || a.Size != 5 || a.Name != "a.txt" {
+		t.Fatalf("unexpected attachment: %+v", a)
+	}
+	if !strings.HasPrefix(a.MimeType, "text/plain") {
+		t.Fatalf("expected sniffed text/plain, got %q", a.MimeType)
+	}
+
+	// Same content again: new metadata row, no second blob write
+	b, err := svc.Upload(ctx, 1, "copy.txt", "text/markdown", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("second upload error: %v", err)
+	}
+	if b.Id == a.Id || b.MimeType != "text/markdown" {
+		t.Fatalf("unexpected second attachment: %+v", b)
+	}
+	if blobs.puts != 1 {
+		t.Fatalf("expected content to be deduplicated, got %d puts", blobs.puts)
+	}
+}
+
+// vanishingBlobStore deletes a blob right after reporting it exists, as the janitor would.
+type vanishingBlobStore struct {
+	*memBlobStore
+	vanished bool
+}
+
+func (v *vanishingBlobStore) Exists(ctx context.Context, key string) (bool, error) {
+	ok, err := v.memBlobStore.Exists(ctx, key)
+	if ok && !v.vanished {
+		v.vanished = true
+		delete(v.blobs, key)
+	}
+	return ok, err
+}
+
+func TestAttachmentServiceUploadRestoresVanishedBlob(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	blobs := &vanishingBlobStore{memBlobStore: newMemBlobStore()}
+	svc := NewAttachmentService(testLogger(), st, blobs, 1024, nil)
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	svc.Upload(ctx, 1, "a.txt", "", strings.NewReader("payload"))
+	b, err := svc.Upload(ctx, 1, "b.txt", "", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+	if !blobs.vanished {
+		t.Fatalf("expected the deduplicated blob to vanish")
+	}
+	if _, rc, err := svc.Open(ctx, b.Id, 0); err != nil {
+		t.Fatalf("content must be stored again: %v", err)
+	} else {
+		rc.Close()
+	}
+}
+
+func TestAttachmentServiceOpen(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	blobs := newMemBlobStore()
+	svc := NewAttachmentService(testLogger(), st, blobs, 1024, nil)
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	uploaded, err := svc.Upload(ctx, 1, "a.txt", "", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	// Unknown attachment
+	if _, _, err := svc.Open(ctx, 999, 0); !errors.Is(err, models.ErrAttachmentNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	// Not a member of the attachment's chat
+	st.isUserInChat = false
+	if _, _, err := svc.Open(ctx, uploaded.Id, 0); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+
+	// Success
+	st.isUserInChat = true
+	a, rc, err := svc.Open(ctx, uploaded.Id, 0)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	defer rc.Close()
+	data, _ := io.ReadAll(rc)
+	if string(data) != "payload" || a.Id != uploaded.Id {
+		t.Fatalf("unexpected content %q for %+v", data, a)
+	}
+}
+
+func TestServiceSendMessageWithAttachments(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	attachments := NewAttachmentService(testLogger(), st, newMemBlobStore(), 1024, nil)
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	a, err := attachments.Upload(ctx, 1, "a.txt", "", strings.NewReader("x"))
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+
+	msg, err := svc.SendMessage(ctx, 1, "see file", "", []int64{a.Id}, 0)
+	if err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Id != a.Id {
+		t.Fatalf("expected attachment on message: %+v", msg.Attachments)
+	}
+
+	// An attachment cannot be reused by another message
+	if _, err := svc.SendMessage(ctx, 1, "again", "", []int64{a.Id}, 0); !errors.Is(err, models.ErrAttachmentNotFound) {
+		t.Fatalf("expected attachment not found, got %v", err)
+	}
+}
+
+// jpegWithGPS returns a JPEG whose EXIF holds a GPS latitude, followed by image data Go cannot decode.
+func jpegWithGPS() []byte {
+	tiff := make([]byte, 68)
+	le := binary.LittleEndian
+	copy(tiff, "II")
+	le.PutUint16(tiff[2:], 42)
+	le.PutUint32(tiff[4:], 8)
+	// IFD0: GPSInfo -> 26; GPS IFD: GPSLatitude, RATIONAL x3 at 44
+	le.PutUint16(tiff[8:], 1)
+	le.PutUint16(tiff[10:], 0x8825)
+	le.PutUint16(tiff[12:], 4)
+	le.PutUint32(tiff[14:], 1)
+	le.PutUint32(tiff[18:], 26)
+	le.PutUint16(tiff[26:], 1)
+	le.PutUint16(tiff[28:], 2)
+	le.PutUint16(tiff[30:], 5)
+	le.PutUint32(tiff[32:], 3)
+	le.PutUint32(tiff[36:], 44)
+	copy(tiff[44:], bytes.Repeat([]byte{0x7F}, 24))
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(data[4:], uint16(len(payload)+2))
+	data = append(data, payload...)
+	return append(data, 0xFF, 0xDA, 0x00, 0x02, 0xDE, 0xAD)
+}
+
+func TestAttachmentServiceUploadStripsUndecodableImage(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	blobs := newMemBlobStore()
+	svc := NewAttachmentService(testLogger(), st, blobs, 1024, nil)
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	// Go cannot decode the image, but the location is stripped anyway
+	uploaded, err := svc.Upload(ctx, 1, "photo.jpg", "", bytes.NewReader(jpegWithGPS()))
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+	if uploaded.Width != 0 {
+		t.Fatalf("undecodable image must be stored without dimensions: %+v", uploaded)
+	}
+	stored := blobs.blobs[uploaded.Sha256]
+	if bytes.Contains(stored, bytes.Repeat([]byte{0x7F}, 24)) {
+		t.Fatalf("GPS data must be stripped")
+	}
+
+	// Metadata that cannot be parsed rejects the upload
+	broken := jpegWithGPS()
+	binary.LittleEndian.PutUint32(broken[6+6+18:], 0xFFFF)
+	if _, err := svc.Upload(ctx, 1, "photo.jpg", "", bytes.NewReader(broken)); !errors.Is(err, models.ErrInvalidImage) {
+		t.Fatalf("expected ErrInvalidImage, got %v", err)
+	}
+}
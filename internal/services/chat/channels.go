@@ -0,0 +1,40 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+// SubscribeChannel добавляет пользователя в канал как подписчика (RoleMember).
+// Подписаться может любой пользователь; повторная подписка роль не меняет.
+func (s *Service) SubscribeChannel(ctx context.Context, chatID int64) (*chatpb.Chat, error) {
+	const op = "services.chat.SubscribeChannel"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	chat, err := s.storage.ChatByID(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if chat.Type != models.ChatTypeChannel {
+		return nil, models.ErrNotChannel
+	}
+
+	if err := s.storage.AddUserToChat(ctx, chatID, userID, models.RoleMember); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user subscribed to channel", slog.Int64("user_id", userID))
+
+	return &chatpb.Chat{Id: chat.ID, Name: chat.Name, Type: chat.Type}, nil
+}
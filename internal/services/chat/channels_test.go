@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+func TestServiceSubscribeChannel(t *testing.T) {
+	st := &mockChatStorage{chatTypes: map[int64]string{1: models.ChatTypeChannel, 2: models.ChatTypePublic}}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	chat, err := svc.SubscribeChannel(ctx, 1)
+	if err != nil || chat.Type != models.ChatTypeChannel {
+		t.Fatalf("subscribe error: %v %+v", err, chat)
+	}
+	if _, err := svc.SubscribeChannel(ctx, 2); !errors.Is(err, models.ErrNotChannel) {
+		t.Fatalf("expected not a channel, got %v", err)
+	}
+	if _, err := svc.SubscribeChannel(ctx, 404); !errors.Is(err, models.ErrChatNotFound) {
+		t.Fatalf("expected chat not found, got %v", err)
+	}
+}
+
+func TestServiceChannelOnlyAdminsPost(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true, role: models.RoleMember, chatTypes: map[int64]string{1: models.ChatTypeChannel}}
+	publisher := NewPublisher(testLogger())
+	reader := &mockSubscriber{id: 9}
+	publisher.Register(1, reader)
+	svc := New(testLogger(), st, publisher, 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	if _, err := svc.SendMessage(ctx, 1, "hi", "", nil, 0); !errors.Is(err, models.ErrReadOnlyChat) {
+		t.Fatalf("expected read-only error for subscriber, got %v", err)
+	}
+	if _, err := svc.ScheduleMessage(ctx, 1, "later", time.Now().Add(time.Hour)); !errors.Is(err, models.ErrReadOnlyChat) {
+		t.Fatalf("expected read-only error for scheduled message, got %v", err)
+	}
+
+	st.role = models.RoleAdmin
+	if _, err := svc.SendMessage(ctx, 1, "announcement", "", nil, 0); err != nil {
+		t.Fatalf("admin send error: %v", err)
+	}
+	if len(reader.received) != 1 || reader.received[0].Text != "announcement" {
+		t.Fatalf("subscriber did not receive the announcement: %+v", reader.received)
+	}
+}
+
+func TestServiceJoinChannelAsSubscriber(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true, role: models.RoleMember, chatTypes: map[int64]string{55: models.ChatTypeChannel}}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(7))
+	stream := &fakeJoinStream{ctx: ctx, recvQueue: []*chatpb.JoinChatRequest{
+		{ChatId: 55},
+		{ChatId: 55, Text: "can I post?"},
+	}}
+
+	// Subscribers may join to read; their messages are rejected without closing the stream
+	if err := svc.JoinChat(stream); err != nil {
+		t.Fatalf("JoinChat error: %v", err)
+	}
+	if len(st.savedMessages) != 0 {
+		t.Fatalf("subscriber message must not be saved")
+	}
+}
@@ -2,13 +2,17 @@ package chat
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"strconv"
+	"time"
 
 	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
 	"github.com/grigory222/go-chat-server/internal/domain/models"
 	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+	"github.com/grigory222/go-chat-server/internal/lib/ratelimit"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -16,28 +20,48 @@ import (
 )
 
 type Service struct {
-	log       *slog.Logger
-	storage   storage.Storage
-	publisher *Publisher
+	log        *slog.Logger
+	storage    storage.Storage
+	publisher  *Publisher
+	maxPins    int
+	sendLimits SendLimits
+	filters    *filterCache
 }
 
-func New(log *slog.Logger, storage storage.Storage, publisher *Publisher) *Service {
-	return &Service{log: log, storage: storage, publisher: publisher}
+// SendLimits ограничивает частоту отправки сообщений пользователями. nil-лимитер не ограничивает.
+type SendLimits struct {
+	// PerUser - сообщения одного пользователя во все чаты
+	PerUser *ratelimit.Limiter
+	// PerChat - сообщения всех участников в один чат
+	PerChat *ratelimit.Limiter
 }
 
-func (s *Service) CreateChat(ctx context.Context, name string, userID int64) (*chatpb.Chat, error) {
+func New(log *slog.Logger, storage storage.Storage, publisher *Publisher, maxPins int, sendLimits SendLimits) *Service {
+	return &Service{
+		log:        log,
+		storage:    storage,
+		publisher:  publisher,
+		maxPins:    maxPins,
+		sendLimits: sendLimits,
+		filters:    newFilterCache(),
+	}
+}
+
+// CreateChat создает чат типа chatType (ChatTypePublic или ChatTypeChannel).
+func (s *Service) CreateChat(ctx context.Context, name, chatType string, userID int64) (*chatpb.Chat, error) {
 	const op = "services.chat.CreateChat"
 
-	chatID, err := s.storage.CreateChat(ctx, name)
+	chatID, err := s.storage.CreateChat(ctx, name, chatType)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := s.storage.AddUserToChat(ctx, chatID, userID); err != nil {
+	// Создатель становится владельцем чата
+	if err := s.storage.AddUserToChat(ctx, chatID, userID, models.RoleOwner); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &chatpb.Chat{Id: chatID, Name: name, Type: "public"}, nil
+	return &chatpb.Chat{Id: chatID, Name: name, Type: chatType}, nil
 }
 
 func (s *Service) GetHistory(ctx context.Context, chatID int64, limit, offset uint64) ([]*chatpb.Message, error) {
@@ -67,19 +91,157 @@ func (s *Service) GetHistory(ctx context.Context, chatID int64, limit, offset ui
 
 	protoMessages := make([]*chatpb.Message, len(messages))
 	for i, msg := range messages {
-		protoMessages[i] = &chatpb.Message{
-			Id:        msg.ID,
-			ChatId:    msg.ChatID,
-			UserId:    msg.UserID,
-			UserName:  msg.UserName,
-			Text:      msg.Text,
-			CreatedAt: msg.CreatedAt.Unix(),
-		}
+		protoMessages[i] = toProtoMessage(msg)
 	}
 
 	return protoMessages, nil
 }
 
+// SendMessage публикует сообщение без открытого JoinChat стрима (боты, интеграции).
+// Повторный вызов с тем же idempotencyKey возвращает уже сохраненное сообщение.
+// Ненулевой ttl делает сообщение исчезающим.
+func (s *Service) SendMessage(ctx context.Context, chatID int64, text, idempotencyKey string, attachmentIDs []int64, ttl time.Duration) (*chatpb.Message, error) {
+	const op = "services.chat.SendMessage"
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		s.log.With(slog.String("op", op)).Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	msg, err := s.send(ctx, outgoing{
+		userID:         userID,
+		chatID:         chatID,
+		text:           text,
+		idempotencyKey: idempotencyKey,
+		attachmentIDs:  attachmentIDs,
+		ttl:            ttl,
+		limited:        true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return msg, nil
+}
+
+// outgoing - сообщение, отправляемое через send.
+type outgoing struct {
+	userID         int64
+	chatID         int64
+	text           string
+	idempotencyKey string
+	attachmentIDs  []int64
+	ttl            time.Duration
+	// limited - применять лимиты частоты и медленный режим; отложенные сообщения уже были приняты раньше
+	limited bool
+	// from - стрим JoinChat, из которого пришло сообщение: ему оно не рассылается.
+	// Остальные устройства отправителя получают сообщение как обычные подписчики
+	from Subscriber
+}
+
+// send - общий путь отправки для JoinChat, SendMessage и планировщика:
+// проверка членства и лимитов, фильтры чата, сохранение и рассылка подписчикам.
+func (s *Service) send(ctx context.Context, out outgoing) (*chatpb.Message, error) {
+	const op = "services.chat.send"
+	userID, chatID, idempotencyKey := out.userID, out.chatID, out.idempotencyKey
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID), slog.Int64("user_id", userID))
+
+	member, err := s.checkPoster(ctx, chatID, userID)
+	if err != nil {
+		log.Warn("user cannot post to chat", slog.Any("err", err))
+		return nil, err
+	}
+
+	// Лимиты проверяются после членства, чтобы посторонние не расходовали лимит чата
+	if out.limited {
+		if err := s.allowSend(userID, chatID); err != nil {
+			log.Warn("send rate limit exceeded", slog.Any("err", err))
+			return nil, err
+		}
+	}
+
+	// Повтор запроса: отдаем ранее сохраненное сообщение и не рассылаем его второй раз
+	if idempotencyKey != "" {
+		existing, err := s.storage.MessageByIdempotencyKey(ctx, chatID, userID, idempotencyKey)
+		if err == nil {
+			return toProtoMessage(existing), nil
+		}
+		if !errors.Is(err, models.ErrMessageNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	// Фильтры работают до медленного режима, чтобы отклоненное сообщение не занимало слот
+	chain, err := s.filterChain(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	text, err := chain.Run(FilterMessage{ChatID: chatID, UserID: userID, Text: out.text, Attachments: len(out.attachmentIDs)})
+	if err != nil {
+		log.Info("message rejected by chat filters", slog.Any("err", err))
+		return nil, err
+	}
+
+	// Медленный режим проверяется после поиска по ключу, чтобы повтор запроса не отклонялся.
+	// Слот занимается в транзакции сохранения: сообщение, которое не удалось сохранить, слот не тратит.
+	// Если режим выключен или участник от него освобожден, в базу за слотом не ходим
+	claimSlot := out.limited && member.SlowModeApplies()
+	savedMsg, err := s.storage.SaveMessage(ctx, chatID, userID, text, idempotencyKey, out.attachmentIDs, out.ttl, claimSlot)
+	if err != nil {
+		var slowErr *models.SlowModeError
+		if errors.As(err, &slowErr) {
+			log.Debug("slow mode: message rejected", slog.Time("retry_at", slowErr.RetryAt))
+			return nil, slowErr
+		}
+		// Параллельный повтор успел сохранить сообщение раньше нас
+		if errors.Is(err, models.ErrMessageExists) {
+			existing, err := s.storage.MessageByIdempotencyKey(ctx, chatID, userID, idempotencyKey)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			return toProtoMessage(existing), nil
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	protoMsg := toProtoMessage(savedMsg)
+	s.publisher.Broadcast(protoMsg, out.from)
+
+	return protoMsg, nil
+}
+
+// checkPoster проверяет, что пользователь состоит в чате и может в него писать:
+// в каналах пишут только владелец и администраторы, заглушенный участник не пишет до конца мута.
+// Возвращает участника, чтобы дальше не читать его настройки повторно.
+func (s *Service) checkPoster(ctx context.Context, chatID, userID int64) (*models.ChatMember, error) {
+	member, err := s.storage.ChatMember(ctx, chatID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotChatMember) {
+			return nil, models.ErrAccessDenied
+		}
+		return nil, err
+	}
+	if !member.CanPost() {
+		return nil, models.ErrReadOnlyChat
+	}
+	if member.Muted(time.Now()) {
+		return nil, &models.MutedError{Until: *member.MutedUntil}
+	}
+	return member, nil
+}
+
+// allowSend проверяет лимиты отправки пользователя и чата.
+func (s *Service) allowSend(userID, chatID int64) error {
+	if ok, retryAfter := s.sendLimits.PerUser.Allow(strconv.FormatInt(userID, 10)); !ok {
+		return &models.RateLimitError{RetryAfter: retryAfter}
+	}
+	if ok, retryAfter := s.sendLimits.PerChat.Allow(strconv.FormatInt(chatID, 10)); !ok {
+		return &models.RateLimitError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
 func (s *Service) JoinChat(stream chatpb.ChatService_JoinChatServer) error {
 	const op = "services.chat.JoinChat"
 	log := s.log.With(slog.String("op", op))
@@ -89,45 +251,182 @@ func (s *Service) JoinChat(stream chatpb.ChatService_JoinChatServer) error {
 		return status.Error(codes.Internal, "failed to get user id")
 	}
 
-	initialReq, err := stream.Recv()
-	if err != nil {
+	// Recv не прерывается отменой контекста, поэтому читаем в отдельной горутине: при отзыве
+	// сессии перехватчик отменяет контекст и ждет возврата обработчика
+	ctx := stream.Context()
+	stop := make(chan struct{})
+	defer close(stop)
+	requests, recvErr := receive(stream, stop)
+
+	var initialReq *chatpb.JoinChatRequest
+	select {
+	case initialReq = <-requests:
+	case err := <-recvErr:
 		return status.Errorf(codes.InvalidArgument, "failed to receive initial request: %v", err)
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
 	}
 	chatID := initialReq.GetChatId()
 
+	member, err := s.storage.ChatMember(stream.Context(), chatID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotChatMember) {
+			log.Warn("access denied: user is not member of chat", slog.Int64("user_id", userID), slog.Int64("chat_id", chatID))
+			return status.Error(codes.PermissionDenied, "access denied")
+		}
+		log.Error("failed to check chat membership", slog.Any("err", err))
+		return status.Error(codes.Internal, "failed to join chat")
+	}
+
 	log.Info("user connecting", slog.Int64("user_id", userID), slog.Int64("chat_id", chatID))
 
 	subscriber := newChatSubscriber(userID, stream, log)
 	s.publisher.Register(chatID, subscriber)
-	defer s.publisher.Unregister(chatID, userID)
+	// Стрим нельзя использовать после возврата обработчика: дожидаемся остановки writer-горутины
+	defer subscriber.Wait()
+	defer s.publisher.Unregister(chatID, subscriber)
+
+	// Заглушенный участник читает чат как обычно, но сразу узнает, когда сможет писать
+	if member.Muted(time.Now()) {
+		subscriber.Notify(mutedNotice(chatID, *member.MutedUntil))
+	}
 
 	// Читаем сообщения от клиента
 	for {
-		req, err := stream.Recv()
-		if err == io.EOF {
-			log.Info("client disconnected", slog.Int64("user_id", userID))
-			return nil
-		}
-		if err != nil {
+		var req *chatpb.JoinChatRequest
+		select {
+		case req = <-requests:
+		case err := <-recvErr:
+			if err == io.EOF {
+				log.Info("client disconnected", slog.Int64("user_id", userID))
+				return nil
+			}
 			log.Error("stream error", slog.Any("err", err))
 			return status.Errorf(codes.Unknown, "stream error: %v", err)
+		case <-ctx.Done():
+			log.Info("stream context done", slog.Int64("user_id", userID), slog.Any("err", ctx.Err()))
+			return status.FromContextError(ctx.Err()).Err()
+		case <-subscriber.Done():
+			// Publisher закрыл подписчика: пользователя исключили из чата
+			log.Info("user removed from chat", slog.Int64("user_id", userID), slog.Int64("chat_id", chatID))
+			return status.Error(codes.PermissionDenied, "access denied")
 		}
 
-		savedMsg, err := s.storage.SaveMessage(stream.Context(), chatID, userID, req.GetText())
+		if req.GetTtlSeconds() < 0 {
+			log.Warn("negative message ttl, message skipped", slog.Int64("user_id", userID))
+			continue
+		}
+		ttl := time.Duration(req.GetTtlSeconds()) * time.Second
+
+		_, err = s.send(ctx, outgoing{
+			userID:        userID,
+			chatID:        chatID,
+			text:          req.GetText(),
+			attachmentIDs: req.GetAttachmentIds(),
+			ttl:           ttl,
+			limited:       true,
+			from:          subscriber,
+		})
 		if err != nil {
-			log.Error("failed to save message", slog.Any("err", err))
+			// Пользователя исключили из чата - закрываем стрим
+			if errors.Is(err, models.ErrAccessDenied) {
+				return status.Error(codes.PermissionDenied, "access denied")
+			}
+			// Подписчик канала не может писать - сообщаем ему, но стрим не закрываем: читать он может
+			if errors.Is(err, models.ErrReadOnlyChat) {
+				subscriber.Notify(&chatpb.Message{
+					ChatId: chatID,
+					Event:  chatpb.MessageEvent_MESSAGE_EVENT_REJECTED,
+					Text:   models.ErrReadOnlyChat.Error(),
+				})
+				continue
+			}
+			// Сообщение не прошло фильтры чата - сообщаем отправителю причину
+			var rejectedErr *models.MessageRejectedError
+			if errors.As(err, &rejectedErr) {
+				subscriber.Notify(&chatpb.Message{
+					ChatId: chatID,
+					Event:  chatpb.MessageEvent_MESSAGE_EVENT_REJECTED,
+					Text:   rejectedErr.Error(),
+				})
+				continue
+			}
+			// Заглушенный участник продолжает читать чат - сообщаем, когда закончится мут
+			var mutedErr *models.MutedError
+			if errors.As(err, &mutedErr) {
+				subscriber.Notify(&chatpb.Message{
+					ChatId:  chatID,
+					Event:   chatpb.MessageEvent_MESSAGE_EVENT_REJECTED,
+					Text:    mutedErr.Error(),
+					RetryAt: mutedErr.Until.Unix(),
+				})
+				continue
+			}
+			// Медленный режим - стрим не закрываем, а сообщаем отправителю, когда можно писать снова
+			var slowErr *models.SlowModeError
+			if errors.As(err, &slowErr) {
+				subscriber.Notify(slowModeNotice(chatID, slowErr))
+				continue
+			}
+			// Клиент превысил лимит - закрываем стрим, время повтора передаем в trailer
+			var limitErr *models.RateLimitError
+			if errors.As(err, &limitErr) {
+				stream.SetTrailer(interceptors.RetryAfterMD(limitErr.RetryAfter))
+				return interceptors.RateLimitStatus(limitErr.RetryAfter)
+			}
+			log.Error("failed to send message", slog.Any("err", err))
 			continue
 		}
+	}
+}
 
-		protoMsg := &chatpb.Message{
-			Id:        savedMsg.ID,
-			ChatId:    savedMsg.ChatID,
-			UserId:    savedMsg.UserID,
-			UserName:  savedMsg.UserName,
-			Text:      savedMsg.Text,
-			CreatedAt: savedMsg.CreatedAt.Unix(),
+// receive читает запросы клиента, пока стрим не вернет ошибку или не будет закрыт stop.
+func receive(stream chatpb.ChatService_JoinChatServer, stop <-chan struct{}) (<-chan *chatpb.JoinChatRequest, <-chan error) {
+	requests := make(chan *chatpb.JoinChatRequest)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-stop:
+				return
+			}
 		}
+	}()
+	return requests, errs
+}
 
-		s.publisher.Broadcast(protoMsg, userID)
+// slowModeNotice - уведомление отправителю об отклоненном сообщении.
+func slowModeNotice(chatID int64, err *models.SlowModeError) *chatpb.Message {
+	wait := max(time.Second, time.Until(err.RetryAt).Round(time.Second))
+	return &chatpb.Message{
+		ChatId:  chatID,
+		Event:   chatpb.MessageEvent_MESSAGE_EVENT_REJECTED,
+		Text:    fmt.Sprintf("slow mode is enabled: you can post again in %s", wait),
+		RetryAt: err.RetryAt.Unix(),
+	}
+}
+
+func toProtoMessage(msg *models.Message) *chatpb.Message {
+	protoMsg := &chatpb.Message{
+		Id:        msg.ID,
+		ChatId:    msg.ChatID,
+		UserId:    msg.UserID,
+		UserName:  msg.UserName,
+		Text:      msg.Text,
+		CreatedAt: msg.CreatedAt.Unix(),
+		Pinned:    msg.Pinned,
+	}
+	if msg.ExpiresAt != nil {
+		protoMsg.ExpiresAt = msg.ExpiresAt.Unix()
+	}
+	for _, a := range msg.Attachments {
+		protoMsg.Attachments = append(protoMsg.Attachments, toProtoAttachment(a))
 	}
+	return protoMsg
 }
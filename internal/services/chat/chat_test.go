@@ -12,6 +12,9 @@ import (
 	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
 	"github.com/grigory222/go-chat-server/internal/domain/models"
 	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // mockChatStorage provides controllable behavior for chat service tests.
@@ -25,22 +28,97 @@ type mockChatStorage struct {
 	historyErr      error
 	saveMsgErr      error
 	savedMessages   []*models.Message
+	byKey           map[string]*models.Message
+	searchResults   []*models.SearchResult
+	searchErr       error
+	lastFilter      models.SearchFilter
+
+	attachments       map[int64]*models.Attachment
+	saveAttachmentErr error
+
+	role   models.ChatRole
+	pinned []*models.Message
+
+	scheduled []*models.ScheduledMessage
+	finished  map[int64]int64
+
+	policies     map[int64]*models.RetentionPolicy
+	purgeBatches []*models.PurgeBatch
+	purgeErr     error
+	purgeRuns    []*models.PurgeRun
+
+	expiredBatches []*models.PurgeBatch
+
+	slowMode   map[int64]time.Duration
+	lastSent   map[[2]int64]time.Time
+	slotClaims int
+
+	chatTypes map[int64]string
+
+	moderation map[int64]*models.ModerationSettings
+
+	// roles overrides role for individual users
+	roles            map[int64]models.ChatRole
+	admins           map[int64]bool
+	reports          []*models.Report
+	lastReportFilter models.ReportFilter
+	audit            []*models.AuditEntry
+	mutedUntil       map[[2]int64]time.Time
+	banned           map[[2]int64]bool
 }
 
-func (m *mockChatStorage) CreateChat(ctx context.Context, name string) (int64, error) {
+func (m *mockChatStorage) CreateChat(ctx context.Context, name, chatType string) (int64, error) {
 	return m.createChatID, m.createErr
 }
-func (m *mockChatStorage) AddUserToChat(ctx context.Context, chatID, userID int64) error {
+func (m *mockChatStorage) AddUserToChat(ctx context.Context, chatID, userID int64, role models.ChatRole) error {
 	return m.addUserErr
 }
-func (m *mockChatStorage) SaveMessage(ctx context.Context, chatID, userID int64, text string) (*models.Message, error) {
+func (m *mockChatStorage) SaveMessage(ctx context.Context, chatID, userID int64, text, idempotencyKey string, attachmentIDs []int64, ttl time.Duration, claimSlowModeSlot bool) (*models.Message, error) {
 	if m.saveMsgErr != nil {
 		return nil, m.saveMsgErr
 	}
+	if _, ok := m.byKey[idempotencyKey]; ok && idempotencyKey != "" {
+		return nil, models.ErrMessageExists
+	}
+	if claimSlowModeSlot {
+		m.slotClaims++
+		key := [2]int64{chatID, userID}
+		if last, ok := m.lastSent[key]; ok && time.Since(last) < m.slowMode[chatID] {
+			return nil, &models.SlowModeError{RetryAt: last.Add(m.slowMode[chatID])}
+		}
+		if m.lastSent == nil {
+			m.lastSent = make(map[[2]int64]time.Time)
+		}
+		m.lastSent[key] = time.Now()
+	}
 	msg := &models.Message{ID: int64(len(m.savedMessages) + 1), ChatID: chatID, UserID: userID, UserName: "User", Text: text, CreatedAt: time.Unix(1000, 0)}
+	if ttl > 0 {
+		expiresAt := msg.CreatedAt.Add(ttl)
+		msg.ExpiresAt = &expiresAt
+	}
+	for _, id := range attachmentIDs {
+		a, ok := m.attachments[id]
+		if !ok || a.MessageID != 0 || a.ChatID != chatID || a.UploaderID != userID {
+			return nil, models.ErrAttachmentNotFound
+		}
+		a.MessageID = msg.ID
+		msg.Attachments = append(msg.Attachments, a)
+	}
 	m.savedMessages = append(m.savedMessages, msg)
+	if idempotencyKey != "" {
+		if m.byKey == nil {
+			m.byKey = map[string]*models.Message{}
+		}
+		m.byKey[idempotencyKey] = msg
+	}
 	return msg, nil
 }
+func (m *mockChatStorage) MessageByIdempotencyKey(ctx context.Context, chatID, userID int64, idempotencyKey string) (*models.Message, error) {
+	if msg, ok := m.byKey[idempotencyKey]; ok && (msg.ExpiresAt == nil || msg.ExpiresAt.After(time.Now())) {
+		return msg, nil
+	}
+	return nil, models.ErrMessageNotFound
+}
 func (m *mockChatStorage) GetChatHistory(ctx context.Context, chatID int64, limit, offset uint64) ([]*models.Message, error) {
 	if m.historyErr != nil {
 		return nil, m.historyErr
@@ -50,6 +128,470 @@ func (m *mockChatStorage) GetChatHistory(ctx context.Context, chatID int64, limi
 func (m *mockChatStorage) IsUserInChat(ctx context.Context, userID, chatID int64) (bool, error) {
 	return m.isUserInChat, m.isUserInChatErr
 }
+func (m *mockChatStorage) SearchMessages(ctx context.Context, userID int64, query string, filter models.SearchFilter, limit, offset uint64) ([]*models.SearchResult, error) {
+	if m.searchErr != nil {
+		return nil, m.searchErr
+	}
+	m.lastFilter = filter
+	return m.searchResults, nil
+}
+func (m *mockChatStorage) SaveAttachment(ctx context.Context, attachment *models.Attachment) (int64, error) {
+	if m.saveAttachmentErr != nil {
+		return 0, m.saveAttachmentErr
+	}
+	stored := *attachment
+	stored.ID = int64(len(m.attachments) + 1)
+	if m.attachments == nil {
+		m.attachments = map[int64]*models.Attachment{}
+	}
+	m.attachments[stored.ID] = &stored
+	return stored.ID, nil
+}
+func (m *mockChatStorage) AttachmentByID(ctx context.Context, id int64) (*models.Attachment, error) {
+	if a, ok := m.attachments[id]; ok {
+		return a, nil
+	}
+	return nil, models.ErrAttachmentNotFound
+}
+func (m *mockChatStorage) MessageByID(ctx context.Context, id int64) (*models.Message, error) {
+	for _, msg := range m.savedMessages {
+		if msg.ID == id {
+			return msg, nil
+		}
+	}
+	return nil, models.ErrMessageNotFound
+}
+func (m *mockChatStorage) SaveThumbnail(ctx context.Context, thumbnail *models.Thumbnail) error {
+	a, ok := m.attachments[thumbnail.AttachmentID]
+	if !ok {
+		return models.ErrAttachmentNotFound
+	}
+	stored := *thumbnail
+	stored.ID = int64(len(a.Thumbnails) + 100)
+	a.Thumbnails = append(a.Thumbnails, &stored)
+	return nil
+}
+func (m *mockChatStorage) ChatMemberRole(ctx context.Context, chatID, userID int64) (models.ChatRole, error) {
+	if m.isUserInChatErr != nil {
+		return "", m.isUserInChatErr
+	}
+	if !m.isUserInChat || m.banned[[2]int64{chatID, userID}] {
+		return "", models.ErrNotChatMember
+	}
+	if role, ok := m.roles[userID]; ok {
+		return role, nil
+	}
+	if m.role == "" {
+		return models.RoleMember, nil
+	}
+	return m.role, nil
+}
+func (m *mockChatStorage) PinMessage(ctx context.Context, chatID, messageID, pinnedBy int64, maxPins int) (bool, error) {
+	msg, err := m.MessageByID(ctx, messageID)
+	if err != nil || msg.ChatID != chatID {
+		return false, models.ErrMessageNotFound
+	}
+	if msg.Pinned {
+		return false, nil
+	}
+	if len(m.pinned) >= maxPins {
+		return false, models.ErrPinLimitReached
+	}
+	msg.Pinned = true
+	m.pinned = append([]*models.Message{msg}, m.pinned...)
+	return true, nil
+}
+func (m *mockChatStorage) UnpinMessage(ctx context.Context, chatID, messageID int64) (bool, error) {
+	for i, msg := range m.pinned {
+		if msg.ID == messageID && msg.ChatID == chatID {
+			msg.Pinned = false
+			m.pinned = append(m.pinned[:i], m.pinned[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+func (m *mockChatStorage) PinnedMessages(ctx context.Context, chatID int64) ([]*models.Message, error) {
+	return m.pinned, nil
+}
+func (m *mockChatStorage) SaveScheduledMessage(ctx context.Context, chatID, userID int64, text string, sendAt time.Time) (*models.ScheduledMessage, error) {
+	msg := &models.ScheduledMessage{ID: int64(len(m.scheduled) + 1), ChatID: chatID, UserID: userID, Text: text, SendAt: sendAt, CreatedAt: time.Now()}
+	m.scheduled = append(m.scheduled, msg)
+	return msg, nil
+}
+func (m *mockChatStorage) ScheduledMessages(ctx context.Context, userID, chatID int64) ([]*models.ScheduledMessage, error) {
+	var res []*models.ScheduledMessage
+	for _, msg := range m.scheduled {
+		if _, done := m.finished[msg.ID]; !done && msg.UserID == userID && (chatID == 0 || msg.ChatID == chatID) {
+			res = append(res, msg)
+		}
+	}
+	return res, nil
+}
+func (m *mockChatStorage) UpdateScheduledMessage(ctx context.Context, id, userID int64, text string, sendAt time.Time) (*models.ScheduledMessage, error) {
+	for _, msg := range m.scheduled {
+		if _, done := m.finished[msg.ID]; !done && msg.ID == id && msg.UserID == userID {
+			msg.Text, msg.SendAt = text, sendAt
+			return msg, nil
+		}
+	}
+	return nil, models.ErrScheduledNotFound
+}
+func (m *mockChatStorage) DeleteScheduledMessage(ctx context.Context, id, userID int64) error {
+	for i, msg := range m.scheduled {
+		if _, done := m.finished[msg.ID]; !done && msg.ID == id && msg.UserID == userID {
+			m.scheduled = append(m.scheduled[:i], m.scheduled[i+1:]...)
+			return nil
+		}
+	}
+	return models.ErrScheduledNotFound
+}
+func (m *mockChatStorage) ClaimDueScheduledMessages(ctx context.Context, lease time.Duration, limit int) ([]*models.ScheduledMessage, error) {
+	var res []*models.ScheduledMessage
+	for _, msg := range m.scheduled {
+		if _, done := m.finished[msg.ID]; !done && !msg.SendAt.After(time.Now()) && len(res) < limit {
+			res = append(res, msg)
+		}
+	}
+	return res, nil
+}
+func (m *mockChatStorage) FinishScheduledMessage(ctx context.Context, id, messageID int64) error {
+	if m.finished == nil {
+		m.finished = make(map[int64]int64)
+	}
+	m.finished[id] = messageID
+	return nil
+}
+func (m *mockChatStorage) RetentionPolicy(ctx context.Context, chatID int64) (*models.RetentionPolicy, error) {
+	if p, ok := m.policies[chatID]; ok {
+		copied := *p
+		return &copied, nil
+	}
+	return &models.RetentionPolicy{ChatID: chatID}, nil
+}
+func (m *mockChatStorage) SetRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy, actorID int64) error {
+	if m.policies == nil {
+		m.policies = make(map[int64]*models.RetentionPolicy)
+	}
+	if current := m.policies[policy.ChatID]; (current != nil && current.LegalHold) != policy.LegalHold {
+		action := models.AuditLegalHoldReleased
+		if policy.LegalHold {
+			action = models.AuditLegalHoldSet
+		}
+		m.audit = append(m.audit, &models.AuditEntry{ActorID: actorID, ChatID: policy.ChatID, Action: action})
+	}
+	copied := *policy
+	m.policies[policy.ChatID] = &copied
+	return nil
+}
+func (m *mockChatStorage) ActiveRetentionPolicies(ctx context.Context) ([]*models.RetentionPolicy, error) {
+	var res []*models.RetentionPolicy
+	for _, p := range m.policies {
+		if p.RetentionDays > 0 && !p.LegalHold {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+func (m *mockChatStorage) PurgeExpiredMessages(ctx context.Context, chatID int64, limit int) (*models.PurgeBatch, error) {
+	if m.purgeErr != nil {
+		return nil, m.purgeErr
+	}
+	if len(m.purgeBatches) == 0 {
+		return &models.PurgeBatch{}, nil
+	}
+	batch := m.purgeBatches[0]
+	m.purgeBatches = m.purgeBatches[1:]
+	return batch, nil
+}
+func (m *mockChatStorage) SavePurgeRun(ctx context.Context, run *models.PurgeRun) error {
+	m.purgeRuns = append(m.purgeRuns, run)
+	return nil
+}
+func (m *mockChatStorage) DeleteExpiredMessages(ctx context.Context, limit int) (*models.PurgeBatch, error) {
+	if len(m.expiredBatches) == 0 {
+		return &models.PurgeBatch{}, nil
+	}
+	batch := m.expiredBatches[0]
+	m.expiredBatches = m.expiredBatches[1:]
+	return batch, nil
+}
+func (m *mockChatStorage) SlowMode(ctx context.Context, chatID int64) (time.Duration, error) {
+	return m.slowMode[chatID], nil
+}
+func (m *mockChatStorage) SetSlowMode(ctx context.Context, chatID int64, interval time.Duration) error {
+	if m.slowMode == nil {
+		m.slowMode = make(map[int64]time.Duration)
+	}
+	m.slowMode[chatID] = interval
+	return nil
+}
+func (m *mockChatStorage) ChatByID(ctx context.Context, chatID int64) (*models.Chat, error) {
+	chatType, ok := m.chatTypes[chatID]
+	if !ok {
+		return nil, models.ErrChatNotFound
+	}
+	return &models.Chat{ID: chatID, Name: "chat", Type: chatType}, nil
+}
+func (m *mockChatStorage) ChatMember(ctx context.Context, chatID, userID int64) (*models.ChatMember, error) {
+	if m.isUserInChatErr != nil {
+		return nil, m.isUserInChatErr
+	}
+	role, err := m.ChatMemberRole(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	member := &models.ChatMember{ChatID: chatID, UserID: userID, Role: role, ChatType: m.chatTypes[chatID], SlowMode: m.slowMode[chatID]}
+	if until, ok := m.mutedUntil[[2]int64{chatID, userID}]; ok {
+		member.MutedUntil = &until
+	}
+	if member.ChatType == "" {
+		member.ChatType = models.ChatTypePublic
+	}
+	return member, nil
+}
+func (m *mockChatStorage) ModerationSettings(ctx context.Context, chatID int64) (*models.ModerationSettings, error) {
+	if s, ok := m.moderation[chatID]; ok {
+		return s, nil
+	}
+	return &models.ModerationSettings{ChatID: chatID}, nil
+}
+func (m *mockChatStorage) SetModerationSettings(ctx context.Context, settings *models.ModerationSettings) error {
+	if m.moderation == nil {
+		m.moderation = make(map[int64]*models.ModerationSettings)
+	}
+	m.moderation[settings.ChatID] = settings
+	return nil
+}
+func (m *mockChatStorage) IsServerAdmin(ctx context.Context, userID int64) (bool, error) {
+	return m.admins[userID], nil
+}
+func (m *mockChatStorage) CreateReport(ctx context.Context, messageID, reporterID int64, reason string) (*models.Report, error) {
+	msg, err := m.MessageByID(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range m.reports {
+		if r.MessageID == messageID && r.ReporterID == reporterID {
+			return nil, models.ErrReportExists
+		}
+	}
+	report := &models.Report{
+		ID:          int64(len(m.reports) + 1),
+		MessageID:   messageID,
+		ChatID:      msg.ChatID,
+		ReporterID:  reporterID,
+		AuthorID:    msg.UserID,
+		Reason:      reason,
+		MessageText: msg.Text,
+		Status:      models.ReportOpen,
+		CreatedAt:   time.Now(),
+	}
+	m.reports = append(m.reports, report)
+	m.audit = append(m.audit, &models.AuditEntry{ActorID: reporterID, ChatID: msg.ChatID, ReportID: report.ID, Action: models.AuditReportCreated, Details: reason})
+	return report, nil
+}
+func (m *mockChatStorage) ReportByID(ctx context.Context, id int64) (*models.Report, error) {
+	for _, r := range m.reports {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return nil, models.ErrReportNotFound
+}
+func (m *mockChatStorage) Reports(ctx context.Context, filter models.ReportFilter, limit, offset uint64) ([]*models.Report, error) {
+	m.lastReportFilter = filter
+	var out []*models.Report
+	for _, r := range m.reports {
+		if filter.ChatID != 0 && r.ChatID != filter.ChatID {
+			continue
+		}
+		if filter.Status == "" && r.Status == models.ReportResolved || filter.Status != "" && r.Status != filter.Status {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+func (m *mockChatStorage) ClaimReport(ctx context.Context, id, moderatorID int64, claimTTL time.Duration) (*models.Report, error) {
+	r, err := m.ReportByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if r.Status == models.ReportResolved {
+		return nil, models.ErrReportResolved
+	}
+	if r.Status == models.ReportClaimed && r.ClaimedBy != moderatorID && time.Since(*r.ClaimedAt) < claimTTL {
+		return nil, models.ErrReportClaimed
+	}
+	now := time.Now()
+	r.Status, r.ClaimedBy, r.ClaimedAt = models.ReportClaimed, moderatorID, &now
+	m.audit = append(m.audit, &models.AuditEntry{ActorID: moderatorID, ChatID: r.ChatID, ReportID: r.ID, Action: models.AuditReportClaimed})
+	return r, nil
+}
+func (m *mockChatStorage) ResolveReport(ctx context.Context, res *models.ReportResolution) (*models.Report, error) {
+	r, err := m.ReportByID(ctx, res.ReportID)
+	if err != nil {
+		return nil, err
+	}
+	if r.Status == models.ReportResolved {
+		return nil, models.ErrReportResolved
+	}
+	if r.Status == models.ReportClaimed && r.ClaimedBy != res.ModeratorID && time.Since(*r.ClaimedAt) < res.ClaimTTL {
+		return nil, models.ErrReportClaimed
+	}
+	key := [2]int64{r.ChatID, r.AuthorID}
+	switch res.Resolution {
+	case models.ResolutionDeleteMessage:
+		if msg, err := m.MessageByID(ctx, r.MessageID); err == nil {
+			expired := time.Now()
+			msg.ExpiresAt = &expired
+		}
+	case models.ResolutionMuteUser:
+		if m.mutedUntil == nil {
+			m.mutedUntil = map[[2]int64]time.Time{}
+		}
+		m.mutedUntil[key] = res.MuteUntil
+	case models.ResolutionBanUser:
+		if m.banned == nil {
+			m.banned = map[[2]int64]bool{}
+		}
+		m.banned[key] = true
+	}
+	now := time.Now()
+	r.Status, r.Resolution, r.ResolvedBy, r.ResolvedAt = models.ReportResolved, res.Resolution, res.ModeratorID, &now
+	m.audit = append(m.audit, &models.AuditEntry{ActorID: res.ModeratorID, ChatID: r.ChatID, ReportID: r.ID, TargetUserID: r.AuthorID, Action: models.AuditReportResolved, Details: string(res.Resolution)})
+	return r, nil
+}
+func (m *mockChatStorage) ModerationAudit(ctx context.Context, chatID int64, limit, offset uint64) ([]*models.AuditEntry, error) {
+	var out []*models.AuditEntry
+	for _, e := range m.audit {
+		if chatID == 0 || e.ChatID == chatID {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+func (m *mockChatStorage) SetMemberMute(ctx context.Context, chatID, userID, moderatorID int64, until *time.Time) error {
+	if _, err := m.ChatMemberRole(ctx, chatID, userID); err != nil {
+		return err
+	}
+	if m.mutedUntil == nil {
+		m.mutedUntil = map[[2]int64]time.Time{}
+	}
+	key := [2]int64{chatID, userID}
+	action := models.AuditMemberUnmuted
+	if until != nil {
+		m.mutedUntil[key] = *until
+		action = models.AuditMemberMuted
+	} else {
+		delete(m.mutedUntil, key)
+	}
+	m.audit = append(m.audit, &models.AuditEntry{ActorID: moderatorID, ChatID: chatID, TargetUserID: userID, Action: action})
+	return nil
+}
+func (m *mockChatStorage) CreateSession(ctx context.Context, session *models.Session, refreshID string) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) RotateRefreshToken(ctx context.Context, sessionID, oldID, newID string, expiresAt time.Time) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) Sessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockChatStorage) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	return false, errors.New("not implemented")
+}
+func (m *mockChatStorage) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) RevokeUserSessions(ctx context.Context, userID int64) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockChatStorage) ChangePassword(ctx context.Context, userID int64, passHash, keepSessionID string) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockChatStorage) CreatePasswordResetToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) ResetPassword(ctx context.Context, tokenHash, passHash string) (int64, []string, error) {
+	return 0, nil, errors.New("not implemented")
+}
+func (m *mockChatStorage) CreateEmailVerificationToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) EmailVerificationSentAt(ctx context.Context, userID int64) (time.Time, error) {
+	return time.Time{}, errors.New("not implemented")
+}
+func (m *mockChatStorage) VerifyEmail(ctx context.Context, tokenHash string) (int64, error) {
+	return 0, errors.New("not implemented")
+}
+func (m *mockChatStorage) SaveTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) TOTPByUserID(ctx context.Context, userID int64) (*models.TOTP, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockChatStorage) EnableTOTP(ctx context.Context, userID, step int64, recoveryHashes []string) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) DisableTOTP(ctx context.Context, userID int64) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) UpdatePasswordHash(ctx context.Context, userID int64, oldHash, newHash string) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) CreateOIDCState(ctx context.Context, state *models.OIDCState) error {
+	return errors.New("not implemented")
+}
+func (m *mockChatStorage) ConsumeOIDCState(ctx context.Context, stateHash string) (*models.OIDCState, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockChatStorage) UserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockChatStorage) LinkIdentity(ctx context.Context, userID int64, issuer, subject string) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+func (m *mockChatStorage) SaveOIDCUser(ctx context.Context, name, email, issuer, subject string) (int64, error) {
+	return 0, errors.New("not implemented")
+}
+func (m *mockChatStorage) DeleteOrphanBlob(ctx context.Context, key string, deleteBlob func(context.Context, string) error) (bool, error) {
+	for _, a := range m.attachments {
+		if a.SHA256 == key {
+			return false, nil
+		}
+		for _, t := range a.Thumbnails {
+			if t.SHA256 == key {
+				return false, nil
+			}
+		}
+	}
+	return true, deleteBlob(ctx, key)
+}
+func (m *mockChatStorage) SetMemberRole(ctx context.Context, chatID, userID, ownerID int64, role models.ChatRole) error {
+	if _, err := m.ChatMemberRole(ctx, chatID, userID); err != nil {
+		return err
+	}
+	if m.roles[userID] == models.RoleOwner {
+		return models.ErrAccessDenied
+	}
+	if m.roles == nil {
+		m.roles = map[int64]models.ChatRole{}
+	}
+	m.roles[userID] = role
+	m.audit = append(m.audit, &models.AuditEntry{ActorID: ownerID, ChatID: chatID, TargetUserID: userID, Action: models.AuditMemberRoleChanged, Details: "role " + string(role)})
+	return nil
+}
+func (m *mockChatStorage) PasswordResetSentAt(ctx context.Context, userID int64) (time.Time, error) {
+	return time.Time{}, errors.New("not implemented")
+}
 
 // Unused methods for this test suite
 func (m *mockChatStorage) SaveUser(context.Context, string, string, string) (int64, error) {
@@ -69,8 +611,8 @@ func testLogger() *slog.Logger {
 
 func TestServiceCreateChat(t *testing.T) {
 	st := &mockChatStorage{createChatID: 10}
-	svc := New(testLogger(), st, NewPublisher(testLogger()))
-	chatObj, err := svc.CreateChat(context.Background(), "General", 123)
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	chatObj, err := svc.CreateChat(context.Background(), "General", models.ChatTypePublic, 123)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -80,14 +622,14 @@ func TestServiceCreateChat(t *testing.T) {
 
 	// Error in CreateChat
 	st.createErr = errors.New("db error")
-	if _, err := svc.CreateChat(context.Background(), "General", 123); err == nil {
+	if _, err := svc.CreateChat(context.Background(), "General", models.ChatTypePublic, 123); err == nil {
 		t.Fatalf("expected error from storage.CreateChat")
 	}
 }
 
 func TestServiceGetHistoryBranches(t *testing.T) {
 	st := &mockChatStorage{}
-	svc := New(testLogger(), st, NewPublisher(testLogger()))
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
 	ctx := context.Background()
 
 	// Missing user id
@@ -132,9 +674,11 @@ type fakeJoinStream struct {
 	recvQueue []*chatpb.JoinChatRequest
 	recvIdx   int
 	sent      []*chatpb.Message
+	trailer   metadata.MD
 }
 
-func (f *fakeJoinStream) Context() context.Context { return f.ctx }
+func (f *fakeJoinStream) Context() context.Context  { return f.ctx }
+func (f *fakeJoinStream) SetTrailer(md metadata.MD) { f.trailer = metadata.Join(f.trailer, md) }
 func (f *fakeJoinStream) Recv() (*chatpb.JoinChatRequest, error) {
 	if f.recvIdx >= len(f.recvQueue) {
 		return nil, io.EOF
@@ -146,9 +690,9 @@ func (f *fakeJoinStream) Recv() (*chatpb.JoinChatRequest, error) {
 func (f *fakeJoinStream) Send(m *chatpb.Message) error { f.sent = append(f.sent, m); return nil }
 
 func TestServiceJoinChatSuccess(t *testing.T) {
-	st := &mockChatStorage{}
+	st := &mockChatStorage{isUserInChat: true}
 	publisher := NewPublisher(testLogger())
-	svc := New(testLogger(), st, publisher)
+	svc := New(testLogger(), st, publisher, 10, SendLimits{})
 
 	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(7))
 	stream := &fakeJoinStream{ctx: ctx, recvQueue: []*chatpb.JoinChatRequest{
@@ -164,10 +708,59 @@ func TestServiceJoinChatSuccess(t *testing.T) {
 	}
 }
 
+// blockingJoinStream returns the initial request and then blocks in Recv like a quiet client.
+type blockingJoinStream struct {
+	fakeJoinStream
+	initial chan *chatpb.JoinChatRequest
+	// release unblocks Recv, as gRPC does once the RPC has finished
+	release chan struct{}
+}
+
+func (b *blockingJoinStream) Recv() (*chatpb.JoinChatRequest, error) {
+	req, ok := <-b.initial
+	if !ok {
+		<-b.release
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+func TestServiceJoinChatExitsOnContextCancel(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	publisher := NewPublisher(testLogger())
+	svc := New(testLogger(), st, publisher, 10, SendLimits{})
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), interceptors.UserIDKey, int64(7)))
+	stream := &blockingJoinStream{fakeJoinStream: fakeJoinStream{ctx: ctx}, initial: make(chan *chatpb.JoinChatRequest, 1), release: make(chan struct{})}
+	defer close(stream.release)
+	stream.initial <- &chatpb.JoinChatRequest{ChatId: 55}
+	close(stream.initial)
+
+	result := make(chan error, 1)
+	go func() { result <- svc.JoinChat(stream) }()
+	for publisher.subscriberCount(55) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The auth interceptor cancels the context when the session is revoked
+	cancel()
+	select {
+	case err := <-result:
+		if status.Code(err) != codes.Canceled {
+			t.Fatalf("expected canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("JoinChat blocked in Recv after the context was cancelled")
+	}
+	if publisher.subscriberCount(55) != 0 {
+		t.Fatalf("subscriber must be unregistered")
+	}
+}
+
 func TestServiceJoinChatInitialRecvError(t *testing.T) {
 	st := &mockChatStorage{}
 	publisher := NewPublisher(testLogger())
-	svc := New(testLogger(), st, publisher)
+	svc := New(testLogger(), st, publisher, 10, SendLimits{})
 	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(7))
 	// Empty queue => first Recv returns EOF -> should map to InvalidArgument error
 	stream := &fakeJoinStream{ctx: ctx}
@@ -175,3 +768,61 @@ func TestServiceJoinChatInitialRecvError(t *testing.T) {
 		t.Fatalf("expected error on initial recv")
 	}
 }
+
+func TestServiceJoinChatNotMember(t *testing.T) {
+	st := &mockChatStorage{}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(7))
+	stream := &fakeJoinStream{ctx: ctx, recvQueue: []*chatpb.JoinChatRequest{{ChatId: 55}, {ChatId: 55, Text: "Hi"}}}
+	if err := svc.JoinChat(stream); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+	if len(st.savedMessages) != 0 {
+		t.Fatalf("message from non-member must not be saved")
+	}
+}
+
+func TestServiceSendMessage(t *testing.T) {
+	st := &mockChatStorage{}
+	publisher := NewPublisher(testLogger())
+	svc := New(testLogger(), st, publisher, 10, SendLimits{})
+	listener := &mockSubscriber{id: 2}
+	publisher.Register(9, listener)
+
+	// Missing user id
+	if _, err := svc.SendMessage(context.Background(), 9, "hi", "", nil, 0); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(1))
+
+	// Not a member
+	if _, err := svc.SendMessage(ctx, 9, "hi", "", nil, 0); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+
+	// Success: saved and broadcast
+	st.isUserInChat = true
+	msg, err := svc.SendMessage(ctx, 9, "hi", "key-1", nil, 0)
+	if err != nil || msg.Text != "hi" {
+		t.Fatalf("unexpected result: %v %+v", err, msg)
+	}
+	if len(listener.received) != 1 {
+		t.Fatalf("expected broadcast to chat member, got %d", len(listener.received))
+	}
+
+	// Retry with the same key returns the stored message without a second save or broadcast
+	again, err := svc.SendMessage(ctx, 9, "hi", "key-1", nil, 0)
+	if err != nil || again.Id != msg.Id {
+		t.Fatalf("expected same message on retry: %v %+v", err, again)
+	}
+	if len(st.savedMessages) != 1 || len(listener.received) != 1 {
+		t.Fatalf("retry must not duplicate: saved=%d received=%d", len(st.savedMessages), len(listener.received))
+	}
+
+	// Storage error
+	st.saveMsgErr = errors.New("db error")
+	if _, err := svc.SendMessage(ctx, 9, "hi", "", nil, 0); err == nil {
+		t.Fatalf("expected save error")
+	}
+}
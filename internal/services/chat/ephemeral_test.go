@@ -0,0 +1,103 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+func TestServiceSendEphemeralMessage(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	msg, err := svc.SendMessage(ctx, 1, "secret", "", nil, time.Minute)
+	if err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	if msg.ExpiresAt != msg.CreatedAt+60 {
+		t.Fatalf("unexpected expiry: %+v", msg)
+	}
+
+	plain, _ := svc.SendMessage(ctx, 1, "plain", "", nil, 0)
+	if plain.ExpiresAt != 0 {
+		t.Fatalf("regular message must not expire: %+v", plain)
+	}
+}
+
+func TestServiceSendMessageRetryAfterExpiry(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	// The mock stores messages as created long ago, so this one has already expired
+	if _, err := svc.SendMessage(ctx, 1, "secret", "key-1", nil, time.Minute); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+
+	// A retry with the same key must not bring the expired message back
+	msg, err := svc.SendMessage(ctx, 1, "secret", "key-1", nil, time.Minute)
+	if !errors.Is(err, models.ErrMessageNotFound) || msg != nil {
+		t.Fatalf("expected message not found, got %+v %v", msg, err)
+	}
+	if len(st.savedMessages) != 1 {
+		t.Fatalf("retry must not save a duplicate: %d", len(st.savedMessages))
+	}
+}
+
+func TestServiceJoinChatNegativeTTL(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(7))
+	stream := &fakeJoinStream{ctx: ctx, recvQueue: []*chatpb.JoinChatRequest{
+		{ChatId: 55},
+		{ChatId: 55, Text: "bad", TtlSeconds: -5},
+		{ChatId: 55, Text: "gone soon", TtlSeconds: 30},
+	}}
+
+	if err := svc.JoinChat(stream); err != nil {
+		t.Fatalf("JoinChat error: %v", err)
+	}
+	if len(st.savedMessages) != 1 || st.savedMessages[0].ExpiresAt == nil {
+		t.Fatalf("expected only the ephemeral message to be saved: %+v", st.savedMessages)
+	}
+}
+
+func TestJanitorExpireBroadcastsDeletes(t *testing.T) {
+	st := &mockChatStorage{
+		expiredBatches: []*models.PurgeBatch{
+			{Messages: 2, Deleted: []*models.Message{{ID: 10, ChatID: 1}, {ID: 11, ChatID: 2}}, OrphanBlobs: []string{"a"}},
+			{Messages: 1, Deleted: []*models.Message{{ID: 12, ChatID: 1}}},
+		},
+	}
+	blobs := newMemBlobStore()
+	blobs.blobs["a"] = []byte("data")
+	publisher := NewPublisher(testLogger())
+	listener := &mockSubscriber{id: 3}
+	publisher.Register(1, listener)
+
+	janitor := NewJanitor(testLogger(), st, blobs, publisher, time.Hour, time.Hour, 2)
+	janitor.expire()
+
+	// Both batches processed: the first one was full
+	if len(listener.received) != 2 {
+		t.Fatalf("expected 2 delete events for chat 1, got %d", len(listener.received))
+	}
+	for _, ev := range listener.received {
+		if ev.Event != chatpb.MessageEvent_MESSAGE_EVENT_DELETED || ev.ChatId != 1 || ev.Text != "" {
+			t.Fatalf("unexpected delete event: %+v", ev)
+		}
+	}
+	if _, ok := blobs.blobs["a"]; ok {
+		t.Fatalf("orphan blob must be deleted")
+	}
+	// Expiry is not a retention purge and is not audited
+	if len(st.purgeRuns) != 0 {
+		t.Fatalf("unexpected purge runs: %+v", st.purgeRuns)
+	}
+}
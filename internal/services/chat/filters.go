@@ -0,0 +1,212 @@
+package chat
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+)
+
+// Verdict - решение фильтра о сообщении.
+type Verdict int
+
+const (
+	// Allow - пропустить сообщение без изменений
+	Allow Verdict = iota
+	// Reject - отклонить сообщение
+	Reject
+	// Rewrite - заменить текст сообщения
+	Rewrite
+)
+
+// Decision - результат проверки сообщения фильтром.
+type Decision struct {
+	Verdict Verdict
+	// Reason - причина отклонения, ее увидит отправитель
+	Reason string
+	// Text - новый текст сообщения для Rewrite
+	Text string
+}
+
+// FilterMessage - сообщение, которое проверяют фильтры.
+type FilterMessage struct {
+	ChatID      int64
+	UserID      int64
+	Text        string
+	Attachments int
+}
+
+// Filter проверяет сообщение перед сохранением.
+type Filter interface {
+	Check(msg FilterMessage) Decision
+}
+
+// FilterFunc позволяет использовать функцию как Filter.
+type FilterFunc func(msg FilterMessage) Decision
+
+func (f FilterFunc) Check(msg FilterMessage) Decision {
+	return f(msg)
+}
+
+// FilterChain применяет фильтры по порядку: переписанный текст получает следующий
+// фильтр, первое отклонение останавливает цепочку.
+type FilterChain []Filter
+
+// Run прогоняет сообщение через цепочку и возвращает итоговый текст
+// либо *models.MessageRejectedError.
+func (c FilterChain) Run(msg FilterMessage) (string, error) {
+	for _, filter := range c {
+		decision := filter.Check(msg)
+		switch decision.Verdict {
+		case Reject:
+			return "", &models.MessageRejectedError{Reason: decision.Reason}
+		case Rewrite:
+			msg.Text = decision.Text
+		}
+	}
+	return msg.Text, nil
+}
+
+// NewFilterChain собирает встроенные фильтры по настройкам чата.
+// Сначала работают фильтры, которые могут переписать текст, затем проверки длины
+// и пустого текста - последняя включена всегда.
+func NewFilterChain(settings *models.ModerationSettings) (FilterChain, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	var chain FilterChain
+	for _, rule := range settings.Rules {
+		chain = append(chain, &regexFilter{
+			re:          regexp.MustCompile(rule.Pattern),
+			action:      rule.Action,
+			replacement: rule.Replacement,
+		})
+	}
+	if len(settings.BannedWords) > 0 {
+		chain = append(chain, newBannedWordsFilter(settings.BannedWords, settings.BannedWordsAction))
+	}
+	if settings.BlockLinks {
+		chain = append(chain, FilterFunc(blockLinks))
+	}
+	if settings.MaxLength > 0 {
+		chain = append(chain, maxLength(settings.MaxLength))
+	}
+	chain = append(chain, FilterFunc(rejectEmpty))
+
+	return chain, nil
+}
+
+// regexFilter отклоняет сообщения, совпавшие с шаблоном, или заменяет совпадения.
+type regexFilter struct {
+	re          *regexp.Regexp
+	action      models.FilterAction
+	replacement string
+}
+
+func (f *regexFilter) Check(msg FilterMessage) Decision {
+	if !f.re.MatchString(msg.Text) {
+		return Decision{}
+	}
+	if f.action == models.FilterReplace {
+		return Decision{Verdict: Rewrite, Text: f.re.ReplaceAllString(msg.Text, f.replacement)}
+	}
+	return Decision{Verdict: Reject, Reason: "message matches a forbidden pattern"}
+}
+
+// bannedWordsFilter ищет запрещенные слова без учета регистра. Совпадением считается
+// только слово целиком: "класс" не срабатывает на "подкласс".
+type bannedWordsFilter struct {
+	words  map[string]struct{}
+	action models.FilterAction
+}
+
+func newBannedWordsFilter(words []string, action models.FilterAction) *bannedWordsFilter {
+	f := &bannedWordsFilter{words: make(map[string]struct{}, len(words)), action: action}
+	for _, word := range words {
+		f.words[strings.ToLower(word)] = struct{}{}
+	}
+	return f
+}
+
+func (f *bannedWordsFilter) Check(msg FilterMessage) Decision {
+	text := msg.Text
+
+	var masked strings.Builder
+	last, found := 0, false
+	// banned обрабатывает слово text[start:end] и сообщает, нужно ли отклонить сообщение
+	banned := func(start, end int) bool {
+		if _, ok := f.words[strings.ToLower(text[start:end])]; !ok {
+			return false
+		}
+		if f.action != models.FilterReplace {
+			return true
+		}
+		found = true
+		masked.WriteString(text[last:start])
+		masked.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[start:end])))
+		last = end
+		return false
+	}
+
+	reject := Decision{Verdict: Reject, Reason: "message contains a banned word"}
+	start := -1
+	for i, r := range text {
+		if models.IsWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && banned(start, i) {
+			return reject
+		}
+		start = -1
+	}
+	if start >= 0 && banned(start, len(text)) {
+		return reject
+	}
+
+	if !found {
+		return Decision{}
+	}
+	masked.WriteString(text[last:])
+	return Decision{Verdict: Rewrite, Text: masked.String()}
+}
+
+// linkPattern находит ссылки со схемой, адреса на www. и домены в распространенных зонах.
+var linkPattern = regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.-]*://\S+|\bwww\.\S+|\b[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:com|net|org|ru|su|io|me|info|biz|xyz|app|dev|gg|tv|cc|co)\b`)
+
+func blockLinks(msg FilterMessage) Decision {
+	if linkPattern.MatchString(msg.Text) {
+		return Decision{Verdict: Reject, Reason: "links are not allowed in this chat"}
+	}
+	return Decision{}
+}
+
+// maxLength отклоняет сообщения длиннее limit символов.
+func maxLength(limit int) FilterFunc {
+	return func(msg FilterMessage) Decision {
+		if utf8.RuneCountInString(msg.Text) > limit {
+			return Decision{Verdict: Reject, Reason: fmt.Sprintf("message is longer than %d characters", limit)}
+		}
+		return Decision{}
+	}
+}
+
+// rejectEmpty отклоняет сообщения без текста и вложений. У сообщения с вложениями
+// текст из одних пробелов очищается.
+func rejectEmpty(msg FilterMessage) Decision {
+	if strings.TrimSpace(msg.Text) != "" {
+		return Decision{}
+	}
+	if msg.Attachments == 0 {
+		return Decision{Verdict: Reject, Reason: "message is empty"}
+	}
+	if msg.Text != "" {
+		return Decision{Verdict: Rewrite, Text: ""}
+	}
+	return Decision{}
+}
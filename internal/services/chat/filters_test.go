@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+)
+
+func runChain(t *testing.T, settings *models.ModerationSettings, text string, attachments int) (string, error) {
+	t.Helper()
+	chain, err := NewFilterChain(settings)
+	if err != nil {
+		t.Fatalf("build chain: %v", err)
+	}
+	return chain.Run(FilterMessage{ChatID: 1, UserID: 2, Text: text, Attachments: attachments})
+}
+
+func TestFilterChainEmptyText(t *testing.T) {
+	settings := &models.ModerationSettings{}
+
+	for _, text := range []string{"", "   ", "\n\t"} {
+		if _, err := runChain(t, settings, text, 0); !errors.Is(err, models.ErrMessageRejected) {
+			t.Fatalf("expected %q to be rejected, got %v", text, err)
+		}
+	}
+	// Attachments may go without text; blank text is dropped
+	if text, err := runChain(t, settings, "  ", 1); err != nil || text != "" {
+		t.Fatalf("unexpected: %q %v", text, err)
+	}
+	if text, err := runChain(t, settings, "hi", 0); err != nil || text != "hi" {
+		t.Fatalf("unexpected: %q %v", text, err)
+	}
+}
+
+func TestFilterChainBannedWords(t *testing.T) {
+	settings := &models.ModerationSettings{BannedWords: []string{"Spam", "дурак"}}
+
+	_, err := runChain(t, settings, "buy SPAM now", 0)
+	var rejected *models.MessageRejectedError
+	if !errors.As(err, &rejected) || rejected.Reason != "message contains a banned word" {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+	// Only whole words match
+	if _, err := runChain(t, settings, "spammer and antispam", 0); err != nil {
+		t.Fatalf("substrings must not match: %v", err)
+	}
+
+	settings.BannedWordsAction = models.FilterReplace
+	text, err := runChain(t, settings, "Сам ты Дурак, spam!", 0)
+	if err != nil || text != "Сам ты *****, ****!" {
+		t.Fatalf("unexpected masked text: %q %v", text, err)
+	}
+	// A message consisting only of banned words still has text after masking
+	if text, err := runChain(t, settings, "spam", 0); err != nil || text != "****" {
+		t.Fatalf("unexpected: %q %v", text, err)
+	}
+}
+
+func TestFilterChainRegexRules(t *testing.T) {
+	settings := &models.ModerationSettings{Rules: []models.FilterRule{
+		{Pattern: `\b\d{4} ?\d{4} ?\d{4} ?\d{4}\b`, Action: models.FilterReplace, Replacement: "[card]"},
+		{Pattern: `(?i)casino`},
+	}}
+
+	text, err := runChain(t, settings, "pay to 1234 5678 9012 3456 please", 0)
+	if err != nil || text != "pay to [card] please" {
+		t.Fatalf("unexpected rewrite: %q %v", text, err)
+	}
+	if _, err := runChain(t, settings, "best CASINO", 0); !errors.Is(err, models.ErrMessageRejected) {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+
+	// A rule that rewrites the message to nothing leaves an empty message
+	settings.Rules = []models.FilterRule{{Pattern: `.+`, Action: models.FilterReplace}}
+	if _, err := runChain(t, settings, "anything", 0); !errors.Is(err, models.ErrMessageRejected) {
+		t.Fatalf("expected emptied message to be rejected, got %v", err)
+	}
+}
+
+func TestFilterChainLinks(t *testing.T) {
+	settings := &models.ModerationSettings{BlockLinks: true}
+
+	for _, text := range []string{
+		"see https://example.org/page",
+		"go to www.example.net",
+		"join t.me/somechannel",
+		"mail ftp://files.local/x",
+		"visit Example.COM today",
+	} {
+		if _, err := runChain(t, settings, text, 0); !errors.Is(err, models.ErrMessageRejected) {
+			t.Fatalf("expected %q to be rejected, got %v", text, err)
+		}
+	}
+	for _, text := range []string{"version 1.2.3", "e.g. this", "end of sentence.Next one"} {
+		if _, err := runChain(t, settings, text, 0); err != nil {
+			t.Fatalf("expected %q to pass, got %v", text, err)
+		}
+	}
+}
+
+func TestFilterChainMaxLength(t *testing.T) {
+	settings := &models.ModerationSettings{MaxLength: 5}
+
+	// Length is counted in characters, not bytes
+	if _, err := runChain(t, settings, "привет", 0); !errors.Is(err, models.ErrMessageRejected) {
+		t.Fatalf("expected long message to be rejected, got %v", err)
+	}
+	if _, err := runChain(t, settings, "тест", 0); err != nil {
+		t.Fatalf("unexpected rejection: %v", err)
+	}
+}
+
+func TestFilterChainCustomFilter(t *testing.T) {
+	chain := FilterChain{
+		FilterFunc(func(msg FilterMessage) Decision { return Decision{Verdict: Rewrite, Text: msg.Text + "!"} }),
+		FilterFunc(func(msg FilterMessage) Decision {
+			if msg.Text != "hi!" {
+				t.Fatalf("next filter must see rewritten text, got %q", msg.Text)
+			}
+			return Decision{Verdict: Reject, Reason: "custom"}
+		}),
+		FilterFunc(func(msg FilterMessage) Decision {
+			t.Fatalf("chain must stop after rejection")
+			return Decision{}
+		}),
+	}
+
+	_, err := chain.Run(FilterMessage{Text: "hi"})
+	if err == nil || err.Error() != "message rejected: custom" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewFilterChainInvalidSettings(t *testing.T) {
+	for _, settings := range []*models.ModerationSettings{
+		{Rules: []models.FilterRule{{Pattern: "(unclosed"}}},
+		{Rules: []models.FilterRule{{Pattern: "x", Action: "drop"}}},
+		{BannedWords: []string{"no spaces"}},
+		{BannedWords: []string{""}},
+		{BannedWordsAction: "hide"},
+		{MaxLength: -1},
+	} {
+		if _, err := NewFilterChain(settings); !errors.Is(err, models.ErrInvalidModeration) {
+			t.Fatalf("expected invalid settings for %+v, got %v", settings, err)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package chat
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/storage"
+)
+
+const purgeBatchTimeout = 30 * time.Second
+
+// Janitor периодически удаляет сообщения старше срока хранения чата и исчезнувшие
+// сообщения с истекшим TTL.
+// Удаление идет небольшими порциями в отдельных транзакциях, чтобы не держать
+// долгих блокировок на messages. Blob-ы, на которые больше не ссылается ни одно
+// вложение, удаляются после фиксации транзакции. Каждый проход по чату, в котором
+// что-то удалено по сроку хранения (или произошла ошибка), записывается в журнал аудита.
+// Об исчезнувших сообщениях подписчики чата получают событие DELETED.
+type Janitor struct {
+	log            *slog.Logger
+	storage        storage.Storage
+	blobs          storage.BlobStore
+	publisher      *Publisher
+	interval       time.Duration
+	expireInterval time.Duration
+	batch          int
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewJanitor(
+	log *slog.Logger,
+	storage storage.Storage,
+	blobs storage.BlobStore,
+	publisher *Publisher,
+	interval time.Duration,
+	expireInterval time.Duration,
+	batch int,
+) *Janitor {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	if expireInterval <= 0 {
+		expireInterval = 5 * time.Second
+	}
+	return &Janitor{
+		log:            log,
+		storage:        storage,
+		blobs:          blobs,
+		publisher:      publisher,
+		interval:       interval,
+		expireInterval: expireInterval,
+		batch:          max(1, batch),
+		stop:           make(chan struct{}),
+	}
+}
+
+// Start запускает фоновую уборку. Первые проходы выполняются сразу.
+func (j *Janitor) Start() {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+
+		purgeTicker := time.NewTicker(j.interval)
+		defer purgeTicker.Stop()
+		expireTicker := time.NewTicker(j.expireInterval)
+		defer expireTicker.Stop()
+
+		j.expire()
+		j.purge()
+
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-expireTicker.C:
+				j.expire()
+			case <-purgeTicker.C:
+				j.purge()
+			}
+		}
+	}()
+}
+
+// Stop останавливает уборку и дожидается завершения текущей порции.
+func (j *Janitor) Stop() {
+	j.stopOnce.Do(func() { close(j.stop) })
+	j.wg.Wait()
+}
+
+// purge выполняет один проход по всем чатам с активным сроком хранения.
+func (j *Janitor) purge() {
+	const op = "services.chat.Janitor.purge"
+	log := j.log.With(slog.String("op", op))
+
+	ctx, cancel := context.WithTimeout(context.Background(), purgeBatchTimeout)
+	policies, err := j.storage.ActiveRetentionPolicies(ctx)
+	cancel()
+	if err != nil {
+		log.Error("failed to list retention policies", slog.Any("err", err))
+		return
+	}
+
+	for _, policy := range policies {
+		if j.stopped() {
+			return
+		}
+
+		run := j.purgeChat(policy)
+		if run.MessagesDeleted == 0 && run.AttachmentsDeleted == 0 && run.Error == "" {
+			continue
+		}
+
+		log.Info("purged expired messages",
+			slog.Int64("chat_id", run.ChatID),
+			slog.Int("messages", run.MessagesDeleted),
+			slog.Int("attachments", run.AttachmentsDeleted),
+			slog.Int("blobs", run.BlobsDeleted),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), purgeBatchTimeout)
+		if err := j.storage.SavePurgeRun(ctx, run); err != nil {
+			log.Error("failed to save purge run", slog.Int64("chat_id", run.ChatID), slog.Any("err", err))
+		}
+		cancel()
+	}
+}
+
+// expire удаляет исчезнувшие сообщения порциями и оповещает подписчиков их чатов.
+// Сами сообщения перестают отдаваться сразу по истечении TTL (фильтр в запросах),
+// здесь они удаляются физически.
+func (j *Janitor) expire() {
+	const op = "services.chat.Janitor.expire"
+	log := j.log.With(slog.String("op", op))
+
+	for !j.stopped() {
+		ctx, cancel := context.WithTimeout(context.Background(), purgeBatchTimeout)
+		batch, err := j.storage.DeleteExpiredMessages(ctx, j.batch)
+		if err != nil {
+			cancel()
+			log.Error("failed to delete expired messages", slog.Any("err", err))
+			return
+		}
+
+		for _, msg := range batch.Deleted {
+			j.publisher.Broadcast(&chatpb.Message{
+				Id:     msg.ID,
+				ChatId: msg.ChatID,
+				Event:  chatpb.MessageEvent_MESSAGE_EVENT_DELETED,
+			}, nil)
+		}
+		j.deleteBlobs(ctx, log, batch.OrphanBlobs)
+		cancel()
+
+		if len(batch.Deleted) < j.batch {
+			return
+		}
+	}
+}
+
+// purgeChat удаляет устаревшие сообщения одного чата порциями, пока они не закончатся.
+func (j *Janitor) purgeChat(policy *models.RetentionPolicy) *models.PurgeRun {
+	const op = "services.chat.Janitor.purgeChat"
+	log := j.log.With(slog.String("op", op), slog.Int64("chat_id", policy.ChatID))
+
+	run := &models.PurgeRun{
+		ChatID:        policy.ChatID,
+		RetentionDays: policy.RetentionDays,
+		StartedAt:     time.Now(),
+	}
+	defer func() { run.FinishedAt = time.Now() }()
+
+	for !j.stopped() {
+		ctx, cancel := context.WithTimeout(context.Background(), purgeBatchTimeout)
+		batch, err := j.storage.PurgeExpiredMessages(ctx, policy.ChatID, j.batch)
+		if err != nil {
+			cancel()
+			log.Error("failed to purge messages", slog.Any("err", err))
+			run.Error = err.Error()
+			return run
+		}
+
+		run.MessagesDeleted += batch.Messages
+		run.AttachmentsDeleted += batch.Attachments
+
+		run.BlobsDeleted += j.deleteBlobs(ctx, log, batch.OrphanBlobs)
+		cancel()
+
+		if batch.Messages == 0 && batch.Attachments == 0 {
+			return run
+		}
+	}
+
+	return run
+}
+
+// deleteBlobs удаляет blob-ы, оставшиеся без ссылок, и возвращает число удаленных.
+// Пока шла транзакция удаления, на тот же контент могло сослаться новое вложение,
+// поэтому ссылки перепроверяются под блокировкой ключа.
+func (j *Janitor) deleteBlobs(ctx context.Context, log *slog.Logger, keys []string) int {
+	deleted := 0
+	for _, key := range keys {
+		// Ошибка не критична: blob останется лежать, но на него никто не ссылается
+		ok, err := j.storage.DeleteOrphanBlob(ctx, key, j.blobs.Delete)
+		if err != nil {
+			log.Error("failed to delete blob", slog.String("key", key), slog.Any("err", err))
+			continue
+		}
+		if ok {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+func (j *Janitor) stopped() bool {
+	select {
+	case <-j.stop:
+		return true
+	default:
+		return false
+	}
+}
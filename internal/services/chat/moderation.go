@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+// filterCacheTTL - сколько инстанс использует собранную цепочку фильтров чата.
+// Изменения настроек, сделанные через другой инстанс, применяются с этой задержкой.
+const filterCacheTTL = 30 * time.Second
+
+// GetModerationSettings возвращает настройки фильтров чата. Доступно участникам чата.
+func (s *Service) GetModerationSettings(ctx context.Context, chatID int64) (*chatpb.ModerationSettings, error) {
+	const op = "services.chat.GetModerationSettings"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	inChat, err := s.storage.IsUserInChat(ctx, userID, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !inChat {
+		log.Warn("access denied: user is not member of chat", slog.Int64("user_id", userID))
+		return nil, models.ErrAccessDenied
+	}
+
+	settings, err := s.storage.ModerationSettings(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return toProtoModeration(settings), nil
+}
+
+// SetModerationSettings заменяет настройки фильтров чата. Доступно владельцу и администраторам.
+func (s *Service) SetModerationSettings(ctx context.Context, settings *models.ModerationSettings) (*chatpb.ModerationSettings, error) {
+	const op = "services.chat.SetModerationSettings"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", settings.ChatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	if err := s.requireManager(ctx, settings.ChatID, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Цепочка собирается заранее: настройки, которые не собираются, не должны попасть в хранилище
+	chain, err := NewFilterChain(settings)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.storage.SetModerationSettings(ctx, settings); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	s.filters.put(settings.ChatID, chain)
+
+	log.Info("moderation settings changed",
+		slog.Int64("user_id", userID),
+		slog.Int("banned_words", len(settings.BannedWords)),
+		slog.Int("rules", len(settings.Rules)),
+		slog.Bool("block_links", settings.BlockLinks),
+		slog.Int("max_length", settings.MaxLength),
+	)
+
+	return toProtoModeration(settings), nil
+}
+
+// filterChain возвращает цепочку фильтров чата из кеша или собирает ее по настройкам из хранилища.
+func (s *Service) filterChain(ctx context.Context, chatID int64) (FilterChain, error) {
+	if chain, ok := s.filters.get(chatID); ok {
+		return chain, nil
+	}
+
+	settings, err := s.storage.ModerationSettings(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := NewFilterChain(settings)
+	if err != nil {
+		return nil, err
+	}
+	s.filters.put(chatID, chain)
+
+	return chain, nil
+}
+
+// filterCache хранит собранные цепочки фильтров, чтобы не читать настройки
+// и не компилировать регулярные выражения на каждое сообщение.
+type filterCache struct {
+	mu        sync.Mutex
+	chains    map[int64]cachedChain
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type cachedChain struct {
+	chain   FilterChain
+	expires time.Time
+}
+
+func newFilterCache() *filterCache {
+	return &filterCache{chains: make(map[int64]cachedChain), now: time.Now}
+}
+
+func (c *filterCache) get(chatID int64) (FilterChain, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.chains[chatID]
+	if !ok || !c.now().Before(cached.expires) {
+		return nil, false
+	}
+	return cached.chain, true
+}
+
+func (c *filterCache) put(chatID int64, chain FilterChain) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.chains[chatID] = cachedChain{chain: chain, expires: now.Add(filterCacheTTL)}
+
+	// Записи неактивных чатов удаляются не чаще раза в TTL
+	if now.Sub(c.lastSweep) < filterCacheTTL {
+		return
+	}
+	c.lastSweep = now
+	for id, cached := range c.chains {
+		if !now.Before(cached.expires) {
+			delete(c.chains, id)
+		}
+	}
+}
+
+func toProtoModeration(settings *models.ModerationSettings) *chatpb.ModerationSettings {
+	action := settings.BannedWordsAction
+	if action == "" {
+		action = models.FilterReject
+	}
+
+	protoSettings := &chatpb.ModerationSettings{
+		ChatId:            settings.ChatID,
+		BannedWords:       settings.BannedWords,
+		BannedWordsAction: string(action),
+		BlockLinks:        settings.BlockLinks,
+		MaxLength:         int32(settings.MaxLength),
+	}
+	for _, rule := range settings.Rules {
+		action := rule.Action
+		if action == "" {
+			action = models.FilterReject
+		}
+		protoSettings.Rules = append(protoSettings.Rules, &chatpb.FilterRule{
+			Pattern:     rule.Pattern,
+			Action:      string(action),
+			Replacement: rule.Replacement,
+		})
+	}
+	return protoSettings
+}
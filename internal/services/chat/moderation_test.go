@@ -0,0 +1,111 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+func TestServiceSetModerationSettings(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true, role: models.RoleMember}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+	settings := &models.ModerationSettings{ChatID: 1, BannedWords: []string{"spam"}, MaxLength: 100}
+
+	if _, err := svc.SetModerationSettings(ctx, settings); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for member, got %v", err)
+	}
+
+	st.role = models.RoleOwner
+	if _, err := svc.SetModerationSettings(ctx, &models.ModerationSettings{ChatID: 1, Rules: []models.FilterRule{{Pattern: "("}}}); !errors.Is(err, models.ErrInvalidModeration) {
+		t.Fatalf("expected invalid settings, got %v", err)
+	}
+	if st.moderation[1] != nil {
+		t.Fatalf("invalid settings must not be stored")
+	}
+
+	if _, err := svc.SetModerationSettings(ctx, settings); err != nil {
+		t.Fatalf("set moderation settings error: %v", err)
+	}
+	got, err := svc.GetModerationSettings(ctx, 1)
+	if err != nil || got.MaxLength != 100 || len(got.BannedWords) != 1 || got.BannedWordsAction != string(models.FilterReject) {
+		t.Fatalf("unexpected settings: %+v %v", got, err)
+	}
+}
+
+func TestServiceSendMessageFilters(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true, role: models.RoleAdmin, slowMode: map[int64]time.Duration{1: time.Minute}}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	if _, err := svc.SetModerationSettings(ctx, &models.ModerationSettings{
+		ChatID:            1,
+		BannedWords:       []string{"heck"},
+		BannedWordsAction: models.FilterReplace,
+		BlockLinks:        true,
+	}); err != nil {
+		t.Fatalf("set moderation settings error: %v", err)
+	}
+
+	st.role = models.RoleMember
+	_, err := svc.SendMessage(ctx, 1, "see https://example.com", "", nil, 0)
+	var rejected *models.MessageRejectedError
+	if !errors.As(err, &rejected) || rejected.Reason != "links are not allowed in this chat" {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+	// A rejected message does not take the slow mode slot
+	msg, err := svc.SendMessage(ctx, 1, "what the heck", "", nil, 0)
+	if err != nil || msg.Text != "what the ****" {
+		t.Fatalf("unexpected: %+v %v", msg, err)
+	}
+	if len(st.savedMessages) != 1 || st.savedMessages[0].Text != "what the ****" {
+		t.Fatalf("rewritten text must be saved: %+v", st.savedMessages)
+	}
+}
+
+func TestServiceFilterCacheExpires(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	clock := time.Unix(1_700_000_000, 0)
+	svc.filters.now = func() time.Time { return clock }
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	if _, err := svc.SendMessage(ctx, 1, "spam", "", nil, 0); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+
+	// Settings changed by another instance apply once the cached chain expires
+	st.moderation = map[int64]*models.ModerationSettings{1: {ChatID: 1, BannedWords: []string{"spam"}}}
+	if _, err := svc.SendMessage(ctx, 1, "spam", "", nil, 0); err != nil {
+		t.Fatalf("cached chain must be used: %v", err)
+	}
+	clock = clock.Add(filterCacheTTL)
+	if _, err := svc.SendMessage(ctx, 1, "spam", "", nil, 0); !errors.Is(err, models.ErrMessageRejected) {
+		t.Fatalf("expected rejection after cache expiry, got %v", err)
+	}
+}
+
+func TestServiceJoinChatRejectsEmptyText(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(7))
+	stream := &fakeJoinStream{ctx: ctx, recvQueue: []*chatpb.JoinChatRequest{
+		{ChatId: 55},
+		{ChatId: 55},
+		{ChatId: 55, Text: "  "},
+		{ChatId: 55, Text: "hello"},
+	}}
+
+	// Rejected messages do not close the stream
+	if err := svc.JoinChat(stream); err != nil {
+		t.Fatalf("JoinChat error: %v", err)
+	}
+	if len(st.savedMessages) != 1 || st.savedMessages[0].Text != "hello" {
+		t.Fatalf("only the non-empty message must be saved: %+v", st.savedMessages)
+	}
+}
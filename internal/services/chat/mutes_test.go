@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+)
+
+func TestServiceMuteMember(t *testing.T) {
+	st := &mockChatStorage{
+		isUserInChat: true,
+		roles:        map[int64]models.ChatRole{1: models.RoleOwner, 2: models.RoleAdmin},
+	}
+	pub := NewPublisher(testLogger())
+	svc := New(testLogger(), st, pub, 10, SendLimits{})
+	target := &mockSubscriber{id: 10}
+	pub.Register(1, target)
+
+	if _, err := svc.MuteMember(withUser(11), 1, 10, time.Hour); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for member, got %v", err)
+	}
+	if _, err := svc.MuteMember(withUser(2), 1, 1, time.Hour); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for admin muting owner, got %v", err)
+	}
+
+	until, err := svc.MuteMember(withUser(2), 1, 10, time.Hour)
+	if err != nil || time.Until(until) < 59*time.Minute {
+		t.Fatalf("unexpected mute: %v %v", until, err)
+	}
+	if len(target.received) != 1 || target.received[0].Event != chatpb.MessageEvent_MESSAGE_EVENT_MUTED || target.received[0].RetryAt != until.Unix() {
+		t.Fatalf("connected member must be told when the mute ends: %+v", target.received)
+	}
+
+	_, err = svc.SendMessage(withUser(10), 1, "hello", "", nil, 0)
+	var muted *models.MutedError
+	if !errors.As(err, &muted) || !muted.Until.Equal(until) {
+		t.Fatalf("expected muted error, got %v", err)
+	}
+	// Muted members keep reading the chat
+	if _, err := svc.GetHistory(withUser(10), 1, 10, 0); err != nil {
+		t.Fatalf("muted member must read history: %v", err)
+	}
+
+	if err := svc.UnmuteMember(withUser(2), 1, 10); err != nil {
+		t.Fatalf("unmute error: %v", err)
+	}
+	if last := target.received[len(target.received)-1]; last.Event != chatpb.MessageEvent_MESSAGE_EVENT_UNMUTED {
+		t.Fatalf("expected unmute notice, got %+v", last)
+	}
+	if _, err := svc.SendMessage(withUser(10), 1, "hello", "", nil, 0); err != nil {
+		t.Fatalf("unmuted member must post: %v", err)
+	}
+
+	if len(st.audit) != 2 || st.audit[0].Action != models.AuditMemberMuted || st.audit[1].Action != models.AuditMemberUnmuted {
+		t.Fatalf("unexpected audit: %+v", st.audit)
+	}
+}
+
+func TestServiceMuteExpires(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true, mutedUntil: map[[2]int64]time.Time{{1, 10}: time.Now().Add(-time.Second)}}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+
+	if _, err := svc.SendMessage(withUser(10), 1, "hello", "", nil, 0); err != nil {
+		t.Fatalf("expired mute must not block posting: %v", err)
+	}
+}
+
+func TestServiceJoinChatMuted(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true, mutedUntil: map[[2]int64]time.Time{{55, 7}: time.Now().Add(time.Hour)}}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	stream := &fakeJoinStream{ctx: withUser(7), recvQueue: []*chatpb.JoinChatRequest{
+		{ChatId: 55},
+		{ChatId: 55, Text: "let me speak"},
+	}}
+
+	// Muted members may join to read; their messages are rejected without closing the stream
+	if err := svc.JoinChat(stream); err != nil {
+		t.Fatalf("JoinChat error: %v", err)
+	}
+	if len(st.savedMessages) != 0 {
+		t.Fatalf("muted member message must not be saved")
+	}
+}
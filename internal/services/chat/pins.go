@@ -0,0 +1,139 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+// PinMessage закрепляет сообщение в чате и рассылает подписчикам событие PINNED.
+// Закреплять могут только владелец и администраторы чата.
+func (s *Service) PinMessage(ctx context.Context, chatID, messageID int64) (*chatpb.Message, error) {
+	const op = "services.chat.PinMessage"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID), slog.Int64("message_id", messageID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	if err := s.requireManager(ctx, chatID, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	pinned, err := s.storage.PinMessage(ctx, chatID, messageID, userID, s.maxPins)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	msg, err := s.storage.MessageByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	protoMsg := toProtoMessage(msg)
+	// Повторный закреп ничего не меняет - событие не дублируем
+	if pinned {
+		log.Info("message pinned", slog.Int64("user_id", userID))
+		event := toProtoMessage(msg)
+		event.Event = chatpb.MessageEvent_MESSAGE_EVENT_PINNED
+		// Закреп сделан через RPC, а не из стрима - событие получают и устройства автора
+		s.publisher.Broadcast(event, nil)
+	}
+
+	return protoMsg, nil
+}
+
+// UnpinMessage открепляет сообщение и рассылает подписчикам событие UNPINNED.
+func (s *Service) UnpinMessage(ctx context.Context, chatID, messageID int64) error {
+	const op = "services.chat.UnpinMessage"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID), slog.Int64("message_id", messageID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return models.ErrInvalidCredentials
+	}
+
+	if err := s.requireManager(ctx, chatID, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	unpinned, err := s.storage.UnpinMessage(ctx, chatID, messageID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !unpinned {
+		return nil
+	}
+
+	log.Info("message unpinned", slog.Int64("user_id", userID))
+
+	msg, err := s.storage.MessageByID(ctx, messageID)
+	if err != nil {
+		// Открепление уже произошло - отсутствие события не повод возвращать ошибку
+		log.Error("failed to load unpinned message", slog.Any("err", err))
+		return nil
+	}
+	event := toProtoMessage(msg)
+	event.Event = chatpb.MessageEvent_MESSAGE_EVENT_UNPINNED
+	s.publisher.Broadcast(event, nil)
+
+	return nil
+}
+
+// GetPinnedMessages возвращает закрепленные сообщения чата, последние закрепленные первыми.
+func (s *Service) GetPinnedMessages(ctx context.Context, chatID int64) ([]*chatpb.Message, error) {
+	const op = "services.chat.GetPinnedMessages"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	inChat, err := s.storage.IsUserInChat(ctx, userID, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !inChat {
+		log.Warn("access denied: user is not member of chat", slog.Int64("user_id", userID))
+		return nil, models.ErrAccessDenied
+	}
+
+	messages, err := s.storage.PinnedMessages(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	protoMessages := make([]*chatpb.Message, len(messages))
+	for i, msg := range messages {
+		protoMessages[i] = toProtoMessage(msg)
+	}
+
+	return protoMessages, nil
+}
+
+// requireManager проверяет, что пользователь - владелец или администратор чата.
+func (s *Service) requireManager(ctx context.Context, chatID, userID int64) error {
+	role, err := s.storage.ChatMemberRole(ctx, chatID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotChatMember) {
+			return models.ErrAccessDenied
+		}
+		return err
+	}
+	if !role.CanManage() {
+		s.log.Warn("access denied: user is not chat admin",
+			slog.Int64("chat_id", chatID), slog.Int64("user_id", userID), slog.String("role", string(role)))
+		return models.ErrAccessDenied
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+func TestServicePinMessage(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	publisher := NewPublisher(testLogger())
+	listener := &mockSubscriber{id: 2}
+	publisher.Register(1, listener)
+	svc := New(testLogger(), st, publisher, 1, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	first, _ := svc.SendMessage(ctx, 1, "first", "", nil, 0)
+	second, _ := svc.SendMessage(ctx, 1, "second", "", nil, 0)
+	received := len(listener.received)
+
+	// Regular members cannot pin
+	if _, err := svc.PinMessage(ctx, 1, first.Id); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for member, got %v", err)
+	}
+
+	st.role = models.RoleAdmin
+	pinned, err := svc.PinMessage(ctx, 1, first.Id)
+	if err != nil || !pinned.Pinned {
+		t.Fatalf("unexpected pin result: %v %+v", err, pinned)
+	}
+	if len(listener.received) != received+1 || listener.received[received].Event != chatpb.MessageEvent_MESSAGE_EVENT_PINNED {
+		t.Fatalf("expected pinned event, got %+v", listener.received[received:])
+	}
+
+	// Repeated pin is a no-op without a second event
+	if _, err := svc.PinMessage(ctx, 1, first.Id); err != nil {
+		t.Fatalf("repeated pin error: %v", err)
+	}
+	if len(listener.received) != received+1 {
+		t.Fatalf("repeated pin must not broadcast")
+	}
+
+	if _, err := svc.PinMessage(ctx, 1, second.Id); !errors.Is(err, models.ErrPinLimitReached) {
+		t.Fatalf("expected pin limit, got %v", err)
+	}
+	if _, err := svc.PinMessage(ctx, 2, second.Id); !errors.Is(err, models.ErrMessageNotFound) {
+		t.Fatalf("expected message not found for another chat, got %v", err)
+	}
+
+	list, err := svc.GetPinnedMessages(ctx, 1)
+	if err != nil || len(list) != 1 || list[0].Id != first.Id {
+		t.Fatalf("unexpected pinned list: %v %+v", err, list)
+	}
+
+	if err := svc.UnpinMessage(ctx, 1, first.Id); err != nil {
+		t.Fatalf("unpin error: %v", err)
+	}
+	last := listener.received[len(listener.received)-1]
+	if last.Event != chatpb.MessageEvent_MESSAGE_EVENT_UNPINNED || last.Pinned {
+		t.Fatalf("expected unpinned event, got %+v", last)
+	}
+	if list, _ := svc.GetPinnedMessages(ctx, 1); len(list) != 0 {
+		t.Fatalf("expected empty pinned list, got %+v", list)
+	}
+}
+
+func TestServicePinMessageNotMember(t *testing.T) {
+	st := &mockChatStorage{}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	if _, err := svc.PinMessage(ctx, 1, 1); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+	if err := svc.UnpinMessage(ctx, 1, 1); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+	if _, err := svc.GetPinnedMessages(ctx, 1); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+}
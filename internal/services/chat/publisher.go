@@ -1,84 +1,233 @@
 package chat
 
 import (
+	"context"
 	"log/slog"
+	"runtime"
 	"sync"
+	"sync/atomic"
 
 	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
 )
 
-// Publisher управляет подписчиками и рассылает им сообщения
+const (
+	// publisherShards - число независимых шардов; чат попадает в шард по chatID
+	publisherShards = 64
+
+	// fanoutChunk - сколько подписчиков уведомляет одна горутина рассылки.
+	// Чаты не больше этого размера рассылаются прямо в вызывающей горутине.
+	fanoutChunk = 512
+)
+
+// Publisher управляет подписчиками и рассылает им сообщения.
+//
+// Чаты распределены по шардам с собственными блокировками, поэтому подключения
+// и рассылка в разных чатах не ждут друг друга. Для рассылки каждый чат хранит
+// неизменяемый снимок списка подписчиков (copy-on-write): Register и Unregister
+// только сбрасывают его, а ближайший Broadcast пересобирает. Пока состав чата
+// не меняется, рассылка не копирует список и не выделяет память.
+//
+// Подписчик - это один стрим: пользователь может быть подключен к чату
+// с нескольких устройств одновременно.
 type Publisher struct {
-	log *slog.Logger
-	mu  sync.RWMutex
+	log    *slog.Logger
+	shards [publisherShards]publisherShard
+
+	// fanout ограничивает число одновременных горутин рассылки по всем чатам
+	fanout chan struct{}
+}
+
+type publisherShard struct {
+	mu sync.RWMutex
+	// chats хранит подписчиков чатов шарда по chatID
+	chats map[int64]*chatSubscribers
+}
 
-	// subscribers хранит подписчиков по chatID и userID
-	subscribers map[int64]map[int64]Subscriber
+type chatSubscribers struct {
+	// streams - подписчики чата, меняются под блокировкой шарда
+	streams map[Subscriber]struct{}
+	// snapshot - снимок streams для рассылки, nil после изменения состава
+	snapshot atomic.Pointer[[]subscriberEntry]
+}
+
+type subscriberEntry struct {
+	userID     int64
+	subscriber Subscriber
 }
 
 // NewPublisher создает новый Publisher
 func NewPublisher(log *slog.Logger) *Publisher {
-	return &Publisher{
-		log:         log,
-		subscribers: make(map[int64]map[int64]Subscriber),
+	p := &Publisher{
+		log:    log,
+		fanout: make(chan struct{}, runtime.GOMAXPROCS(0)),
+	}
+	for i := range p.shards {
+		p.shards[i].chats = make(map[int64]*chatSubscribers)
 	}
+	return p
+}
+
+func (p *Publisher) shard(chatID int64) *publisherShard {
+	return &p.shards[uint64(chatID)%publisherShards]
 }
 
 // Register добавляет подписчика в чат
 func (p *Publisher) Register(chatID int64, subscriber Subscriber) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	userID := subscriber.ID()
+	shard := p.shard(chatID)
 
-	if _, ok := p.subscribers[chatID]; !ok {
-		p.subscribers[chatID] = make(map[int64]Subscriber)
+	shard.mu.Lock()
+	chat, ok := shard.chats[chatID]
+	if !ok {
+		chat = &chatSubscribers{streams: make(map[Subscriber]struct{})}
+		shard.chats[chatID] = chat
 	}
+	chat.streams[subscriber] = struct{}{}
+	chat.snapshot.Store(nil)
+	shard.mu.Unlock()
 
-	p.subscribers[chatID][userID] = subscriber
+	p.log.Info("subscriber registered in publisher", slog.Int64("user_id", subscriber.ID()), slog.Int64("chat_id", chatID))
+}
+
+// Unregister закрывает подписчика и удаляет его из чата. Другие стримы того же
+// пользователя не затрагиваются; уже удаленный подписчик повторно не закрывается.
+func (p *Publisher) Unregister(chatID int64, subscriber Subscriber) {
+	p.remove(chatID, func(s Subscriber) bool { return s == subscriber })
 
-	p.log.Info("subscriber registered in publisher", slog.Int64("user_id", userID), slog.Int64("chat_id", chatID))
+	p.log.Info("subscriber unregistered from publisher", slog.Int64("user_id", subscriber.ID()), slog.Int64("chat_id", chatID))
 }
 
-// Unregister удаляет подписчика из чата
-func (p *Publisher) Unregister(chatID, userID int64) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// RemoveUser закрывает и удаляет из чата все стримы пользователя.
+func (p *Publisher) RemoveUser(chatID, userID int64) {
+	removed := p.remove(chatID, func(s Subscriber) bool { return s.ID() == userID })
+
+	p.log.Info("user removed from publisher", slog.Int64("user_id", userID), slog.Int64("chat_id", chatID), slog.Int("streams", removed))
+}
 
-	if chatSubscribers, ok := p.subscribers[chatID]; ok {
-		if subscriber, ok := chatSubscribers[userID]; ok {
+// remove закрывает и удаляет подписчиков чата, для которых match вернул true.
+func (p *Publisher) remove(chatID int64, match func(Subscriber) bool) int {
+	shard := p.shard(chatID)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	chat, ok := shard.chats[chatID]
+	if !ok {
+		return 0
+	}
+
+	removed := 0
+	for subscriber := range chat.streams {
+		if match(subscriber) {
 			subscriber.Close()
-			delete(p.subscribers[chatID], userID)
-		}
-		// Если чат пустой, удаляем его из карты
-		if len(p.subscribers[chatID]) == 0 {
-			delete(p.subscribers, chatID)
+			delete(chat.streams, subscriber)
+			removed++
 		}
 	}
-
-	p.log.Info("subscriber unregistered from publisher", slog.Int64("user_id", userID), slog.Int64("chat_id", chatID))
+	if removed > 0 {
+		chat.snapshot.Store(nil)
+	}
+	// Если чат пустой, удаляем его из карты
+	if len(chat.streams) == 0 {
+		delete(shard.chats, chatID)
+	}
+	return removed
 }
 
-// Broadcast рассылает сообщение всем подписчикам чата кроме отправителя
-func (p *Publisher) Broadcast(msg *chatpb.Message, senderID int64) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-
+// Broadcast рассылает сообщение всем подписчикам чата кроме стрима отправителя
+// (except; nil - всем, в том числе другим устройствам отправителя).
+// Блокировка шарда берется только на время получения снимка, уведомления
+// отправляются без нее. Большие чаты делятся на порции по fanoutChunk,
+// которые рассылаются параллельно. Broadcast возвращается, когда все
+// подписчики уведомлены.
+func (p *Publisher) Broadcast(msg *chatpb.Message, except Subscriber) {
 	chatID := msg.GetChatId()
 
-	if chatSubscribers, ok := p.subscribers[chatID]; ok {
+	subscribers := p.snapshot(chatID)
+	if len(subscribers) == 0 {
+		return
+	}
+
+	// Проверка уровня заранее: аргументы логирования иначе выделяют память на каждую рассылку
+	if p.log.Enabled(context.Background(), slog.LevelDebug) {
 		p.log.Debug("broadcasting message",
 			slog.Int64("chat_id", chatID),
-			slog.Int64("sender_id", senderID),
-			slog.Int("subscribers_in_chat", len(chatSubscribers)),
+			slog.Int("subscribers_in_chat", len(subscribers)),
 		)
+	}
+
+	if len(subscribers) <= fanoutChunk {
+		notifyAll(subscribers, msg, except)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(subscribers); start += fanoutChunk {
+		chunk := subscribers[start:min(start+fanoutChunk, len(subscribers))]
+
+		p.fanout <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-p.fanout }()
+			notifyAll(chunk, msg, except)
+		}()
+	}
+	wg.Wait()
+}
+
+// NotifyUser отправляет сообщение во все стримы пользователя в чате, если он подключен.
+func (p *Publisher) NotifyUser(chatID, userID int64, msg *chatpb.Message) {
+	for _, entry := range p.snapshot(chatID) {
+		if entry.userID == userID {
+			entry.subscriber.Notify(msg)
+		}
+	}
+}
+
+// snapshot возвращает неизменяемый список подписчиков чата, при необходимости пересобирая его.
+func (p *Publisher) snapshot(chatID int64) []subscriberEntry {
+	shard := p.shard(chatID)
 
-		for userID, subscriber := range chatSubscribers {
-			if userID == senderID {
-				continue
-			}
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	chat, ok := shard.chats[chatID]
+	if !ok {
+		return nil
+	}
+	if snap := chat.snapshot.Load(); snap != nil {
+		return *snap
+	}
+
+	// Под RLock состав чата не меняется, поэтому параллельные сборки дают одинаковый
+	// результат; сохраняется любая из них
+	entries := make([]subscriberEntry, 0, len(chat.streams))
+	for subscriber := range chat.streams {
+		entries = append(entries, subscriberEntry{userID: subscriber.ID(), subscriber: subscriber})
+	}
+	chat.snapshot.CompareAndSwap(nil, &entries)
+
+	return entries
+}
+
+// subscriberCount возвращает число подписчиков чата.
+func (p *Publisher) subscriberCount(chatID int64) int {
+	shard := p.shard(chatID)
+
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	if chat, ok := shard.chats[chatID]; ok {
+		return len(chat.streams)
+	}
+	return 0
+}
 
-			subscriber.Notify(msg)
+func notifyAll(subscribers []subscriberEntry, msg *chatpb.Message, except Subscriber) {
+	for _, entry := range subscribers {
+		if entry.subscriber == except {
+			continue
 		}
+		entry.subscriber.Notify(msg)
 	}
 }
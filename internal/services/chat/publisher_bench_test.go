@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"sync/atomic"
+	"testing"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+)
+
+// newBenchPublisher registers perChat subscribers in each of chats chats.
+func newBenchPublisher(b *testing.B, chats, perChat int) *Publisher {
+	b.Helper()
+	p := NewPublisher(testLogger())
+	for c := 0; c < chats; c++ {
+		for u := 0; u < perChat; u++ {
+			p.Register(int64(c), &countingSubscriber{id: int64(c*perChat + u)})
+		}
+	}
+	return p
+}
+
+// 10k chats with 10 subscribers each (100k subscribers), broadcasting from all CPUs.
+func BenchmarkPublisherBroadcast10kChats(b *testing.B) {
+	const chats = 10_000
+	p := newBenchPublisher(b, chats, 10)
+	msgs := make([]*chatpb.Message, chats)
+	for i := range msgs {
+		msgs[i] = &chatpb.Message{ChatId: int64(i)}
+	}
+
+	var next atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := next.Add(1) % chats
+			p.Broadcast(msgs[i], nil)
+		}
+	})
+}
+
+// One channel with 100k subscribers.
+func BenchmarkPublisherBroadcastLargeChannel(b *testing.B) {
+	p := newBenchPublisher(b, 1, 100_000)
+	msg := &chatpb.Message{ChatId: 0}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Broadcast(msg, nil)
+	}
+}
+
+// Subscribers joining and leaving while other chats are being broadcast to.
+func BenchmarkPublisherChurnDuringBroadcast(b *testing.B) {
+	const chats = 10_000
+	p := newBenchPublisher(b, chats, 10)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		msg := &chatpb.Message{ChatId: 0}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				msg.ChatId = (msg.ChatId + 1) % chats
+				p.Broadcast(&chatpb.Message{ChatId: msg.ChatId}, nil)
+			}
+		}
+	}()
+
+	var next atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := next.Add(1)
+			chatID := i % chats
+			userID := 1_000_000 + i
+			sub := &countingSubscriber{id: userID}
+			p.Register(chatID, sub)
+			p.Unregister(chatID, sub)
+		}
+	})
+}
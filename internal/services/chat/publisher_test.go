@@ -1,7 +1,10 @@
 package chat
 
 import (
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
 )
@@ -30,34 +33,72 @@ func TestPublisherRegisterUnregister(t *testing.T) {
 
 	p.Register(1, sub)
 
-	if len(p.subscribers[1]) != 1 {
-		t.Fatalf("expected 1 subscriber, got %d", len(p.subscribers[1]))
+	if n := p.subscriberCount(1); n != 1 {
+		t.Fatalf("expected 1 subscriber, got %d", n)
 	}
 
-	p.Unregister(1, 10)
+	p.Unregister(1, sub)
 
 	if !sub.closed {
 		t.Fatal("expected subscriber to be closed")
 	}
 
-	if _, ok := p.subscribers[1]; ok {
+	if _, ok := p.shard(1).chats[1]; ok {
 		t.Fatal("expected chat to be removed from subscribers map")
 	}
 }
 
+func TestPublisherMultipleDevices(t *testing.T) {
+	p := NewPublisher(testLogger())
+	phone := &mockSubscriber{id: 1}
+	laptop := &mockSubscriber{id: 1}
+	other := &mockSubscriber{id: 2}
+	p.Register(1, phone)
+	p.Register(1, laptop)
+	p.Register(1, other)
+
+	// A second device does not replace the first one
+	if n := p.subscriberCount(1); n != 3 {
+		t.Fatalf("expected 3 subscribers, got %d", n)
+	}
+
+	p.NotifyUser(1, 1, &chatpb.Message{ChatId: 1, Text: "muted"})
+	if len(phone.received) != 1 || len(laptop.received) != 1 || len(other.received) != 0 {
+		t.Fatalf("notice must reach every device of the user only")
+	}
+
+	// Closing one stream keeps the other device subscribed
+	p.Unregister(1, phone)
+	if !phone.closed || laptop.closed {
+		t.Fatalf("only the ended stream must be closed")
+	}
+	p.Unregister(1, phone)
+
+	p.RemoveUser(1, 1)
+	if !laptop.closed || other.closed || p.subscriberCount(1) != 1 {
+		t.Fatalf("RemoveUser must close all streams of the user only")
+	}
+}
+
 func TestPublisherBroadcast(t *testing.T) {
 	p := NewPublisher(testLogger())
 	sub1 := &mockSubscriber{id: 1}
 	sub2 := &mockSubscriber{id: 2}
+	// Another device of the sender
+	sub1Tablet := &mockSubscriber{id: 1}
 
 	p.Register(1, sub1)
 	p.Register(1, sub2)
+	p.Register(1, sub1Tablet)
 
 	msg := &chatpb.Message{ChatId: 1, Text: "Hello"}
-	p.Broadcast(msg, 1)
+	p.Broadcast(msg, sub1)
 
 	if len(sub1.received) != 0 {
-		t.Fatal("sender should not receive own message")
+		t.Fatal("sending stream should not receive own message")
+	}
+	if len(sub1Tablet.received) != 1 {
+		t.Fatal("sender's other device should receive the message")
 	}
 
 	if len(sub2.received) != 1 {
@@ -68,3 +109,176 @@ func TestPublisherBroadcast(t *testing.T) {
 		t.Fatalf("expected 'Hello', got '%s'", sub2.received[0].Text)
 	}
 }
+
+func TestPublisherBroadcastLargeChat(t *testing.T) {
+	p := NewPublisher(testLogger())
+	n := 3*fanoutChunk + 7
+	subs := make([]*mockSubscriber, n)
+	for i := range subs {
+		subs[i] = &mockSubscriber{id: int64(i + 1)}
+		p.Register(1, subs[i])
+	}
+
+	p.Broadcast(&chatpb.Message{ChatId: 1, Text: "news"}, subs[0])
+
+	// Broadcast waits for all chunks, so results are visible here
+	for i, sub := range subs {
+		want := 1
+		if i == 0 {
+			want = 0 // sender
+		}
+		if len(sub.received) != want {
+			t.Fatalf("subscriber %d received %d messages, want %d", sub.id, len(sub.received), want)
+		}
+	}
+}
+
+// unsubscribingSubscriber leaves the chat from inside Notify, which deadlocks
+// if Broadcast holds the publisher lock while notifying.
+type unsubscribingSubscriber struct {
+	mockSubscriber
+	p      *Publisher
+	chatID int64
+}
+
+func (u *unsubscribingSubscriber) Notify(msg *chatpb.Message) {
+	u.mockSubscriber.Notify(msg)
+	u.p.Unregister(u.chatID, u)
+}
+
+func TestPublisherBroadcastDoesNotHoldLock(t *testing.T) {
+	p := NewPublisher(testLogger())
+	sub := &unsubscribingSubscriber{mockSubscriber: mockSubscriber{id: 2}, p: p, chatID: 1}
+	p.Register(1, sub)
+
+	done := make(chan struct{})
+	go func() {
+		p.Broadcast(&chatpb.Message{ChatId: 1, Text: "bye"}, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Broadcast holds the publisher lock while notifying subscribers")
+	}
+	if len(sub.received) != 1 || !sub.closed {
+		t.Fatalf("expected one message and unsubscribe, got %d %v", len(sub.received), sub.closed)
+	}
+}
+
+// countingSubscriber is safe for concurrent use.
+type countingSubscriber struct {
+	id       int64
+	received atomic.Int64
+	closed   atomic.Bool
+}
+
+func (c *countingSubscriber) Notify(msg *chatpb.Message) { c.received.Add(1) }
+func (c *countingSubscriber) ID() int64                  { return c.id }
+func (c *countingSubscriber) Close()                     { c.closed.Store(true) }
+
+func TestPublisherSnapshotFollowsMembership(t *testing.T) {
+	p := NewPublisher(testLogger())
+	a, b := &countingSubscriber{id: 1}, &countingSubscriber{id: 2}
+
+	p.Register(1, a)
+	p.Broadcast(&chatpb.Message{ChatId: 1}, nil)
+
+	// The cached snapshot must be invalidated by Register and Unregister
+	p.Register(1, b)
+	p.Broadcast(&chatpb.Message{ChatId: 1}, nil)
+	p.Unregister(1, a)
+	p.Broadcast(&chatpb.Message{ChatId: 1}, nil)
+
+	if a.received.Load() != 2 || b.received.Load() != 2 {
+		t.Fatalf("unexpected deliveries: a=%d b=%d", a.received.Load(), b.received.Load())
+	}
+}
+
+// blockingSubscriber blocks in Notify until released.
+type blockingSubscriber struct {
+	mockSubscriber
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingSubscriber) Notify(msg *chatpb.Message) {
+	close(b.entered)
+	<-b.release
+}
+
+func TestPublisherRegisterNotBlockedByBroadcast(t *testing.T) {
+	p := NewPublisher(testLogger())
+	slow := &blockingSubscriber{mockSubscriber: mockSubscriber{id: 1}, entered: make(chan struct{}), release: make(chan struct{})}
+	p.Register(1, slow)
+
+	go p.Broadcast(&chatpb.Message{ChatId: 1}, nil)
+	<-slow.entered
+
+	done := make(chan struct{})
+	go func() {
+		// Same shard and same chat as the busy broadcast
+		sub := &countingSubscriber{id: 2}
+		p.Register(1, sub)
+		p.Register(1+publisherShards, &countingSubscriber{id: 3})
+		p.Unregister(1, sub)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Register blocked behind a broadcast")
+	}
+	close(slow.release)
+}
+
+func TestPublisherConcurrentStress(t *testing.T) {
+	p := NewPublisher(testLogger())
+	const (
+		workers = 16
+		chats   = 32
+		rounds  = 500
+	)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				chatID := int64((w + i) % chats)
+				userID := int64(w*rounds + i)
+				sub := &countingSubscriber{id: userID}
+				p.Register(chatID, sub)
+				p.Broadcast(&chatpb.Message{ChatId: chatID}, sub)
+				p.Broadcast(&chatpb.Message{ChatId: int64(i % chats)}, nil)
+				p.Unregister(chatID, sub)
+			}
+		}(w)
+	}
+
+	// A large chat exercises the parallel fan-out concurrently with the churn above
+	big := make([]*countingSubscriber, 2*fanoutChunk)
+	for i := range big {
+		big[i] = &countingSubscriber{id: int64(1_000_000 + i)}
+		p.Register(chats+1, big[i])
+	}
+	for i := 0; i < 50; i++ {
+		p.Broadcast(&chatpb.Message{ChatId: chats + 1}, nil)
+	}
+
+	wg.Wait()
+
+	for _, sub := range big {
+		if sub.received.Load() != 50 {
+			t.Fatalf("subscriber %d received %d messages, want 50", sub.id, sub.received.Load())
+		}
+	}
+	for chatID := int64(0); chatID < chats; chatID++ {
+		if n := p.subscriberCount(chatID); n != 0 {
+			t.Fatalf("chat %d still has %d subscribers", chatID, n)
+		}
+	}
+}
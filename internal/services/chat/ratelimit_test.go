@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+	"github.com/grigory222/go-chat-server/internal/lib/ratelimit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServiceSendMessageRateLimits(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{
+		PerUser: ratelimit.New(1, 2),
+		PerChat: ratelimit.New(1, 3),
+	})
+	alice := context.WithValue(context.Background(), interceptors.UserIDKey, int64(1))
+	bob := context.WithValue(context.Background(), interceptors.UserIDKey, int64(2))
+	carol := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	for i := 0; i < 2; i++ {
+		if _, err := svc.SendMessage(alice, 1, "hi", "", nil, 0); err != nil {
+			t.Fatalf("send %d error: %v", i, err)
+		}
+	}
+
+	_, err := svc.SendMessage(alice, 1, "spam", "", nil, 0)
+	var limitErr *models.RateLimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, models.ErrRateLimited) || limitErr.RetryAfter <= 0 {
+		t.Fatalf("expected user rate limit error, got %v", err)
+	}
+
+	// The user limit does not consume the chat budget, so Bob gets its last token
+	if _, err := svc.SendMessage(bob, 1, "hello", "", nil, 0); err != nil {
+		t.Fatalf("bob send error: %v", err)
+	}
+	if _, err := svc.SendMessage(bob, 1, "again", "", nil, 0); !errors.Is(err, models.ErrRateLimited) {
+		t.Fatalf("expected chat rate limit error, got %v", err)
+	}
+	// Other chats have their own budget
+	if _, err := svc.SendMessage(carol, 2, "elsewhere", "", nil, 0); err != nil {
+		t.Fatalf("send to other chat error: %v", err)
+	}
+
+	if len(st.savedMessages) != 4 {
+		t.Fatalf("rejected messages must not be saved: %d saved", len(st.savedMessages))
+	}
+}
+
+func TestServiceJoinChatRateLimitClosesStream(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{PerUser: ratelimit.New(0.5, 1)})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(7))
+	stream := &fakeJoinStream{ctx: ctx, recvQueue: []*chatpb.JoinChatRequest{
+		{ChatId: 55},
+		{ChatId: 55, Text: "one"},
+		{ChatId: 55, Text: "two"},
+		{ChatId: 55, Text: "three"},
+	}}
+
+	err := svc.JoinChat(stream)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+	if got := stream.trailer.Get(interceptors.RetryAfterKey); len(got) != 1 || got[0] != "2" {
+		t.Fatalf("unexpected retry-after trailer: %v", got)
+	}
+	if len(st.savedMessages) != 1 {
+		t.Fatalf("expected only the first message to be saved, got %d", len(st.savedMessages))
+	}
+}
+
+func TestSchedulerIgnoresSendLimits(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{PerUser: ratelimit.New(1, 1)})
+	scheduler := NewScheduler(testLogger(), svc, time.Hour, 10)
+
+	// Messages were accepted when scheduled and are delivered regardless of the send limits
+	for i := 0; i < 3; i++ {
+		st.SaveScheduledMessage(context.Background(), 1, 3, "later", time.Now().Add(-time.Second))
+	}
+	if n := scheduler.deliverDue(); n != 3 || len(st.savedMessages) != 3 {
+		t.Fatalf("expected all scheduled messages to be delivered, got %d", len(st.savedMessages))
+	}
+}
@@ -0,0 +1,297 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+// reportClaimTTL - через сколько захват жалобы считается брошенным и ее может взять другой модератор
+const reportClaimTTL = 30 * time.Minute
+
+// ReportMessage отправляет жалобу на сообщение в очередь модерации. Пожаловаться
+// может любой участник чата, один раз на сообщение.
+func (s *Service) ReportMessage(ctx context.Context, messageID int64, reason string) (*chatpb.Report, error) {
+	const op = "services.chat.ReportMessage"
+	log := s.log.With(slog.String("op", op), slog.Int64("message_id", messageID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	msg, err := s.storage.MessageByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	inChat, err := s.storage.IsUserInChat(ctx, userID, msg.ChatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !inChat {
+		log.Warn("access denied: user is not member of chat", slog.Int64("user_id", userID), slog.Int64("chat_id", msg.ChatID))
+		return nil, models.ErrAccessDenied
+	}
+
+	report, err := s.storage.CreateReport(ctx, messageID, userID, reason)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("message reported", slog.Int64("report_id", report.ID), slog.Int64("user_id", userID))
+
+	return toProtoReport(report), nil
+}
+
+// ListReports возвращает очередь модерации, старые жалобы первыми. Администратор сервера
+// видит жалобы всех чатов, владельцы и администраторы чатов - только своих.
+// chatID = 0 - все доступные чаты; пустой status - нерешенные жалобы.
+func (s *Service) ListReports(ctx context.Context, chatID int64, status models.ReportStatus, limit, offset uint64) ([]*chatpb.Report, error) {
+	const op = "services.chat.ListReports"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	filter := models.ReportFilter{ChatID: chatID, Status: status}
+	admin, err := s.storage.IsServerAdmin(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !admin {
+		if chatID != 0 {
+			if err := s.requireManager(ctx, chatID, userID); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		filter.ModeratorID = userID
+	}
+
+	reports, err := s.storage.Reports(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	protoReports := make([]*chatpb.Report, len(reports))
+	for i, report := range reports {
+		protoReports[i] = toProtoReport(report)
+	}
+
+	return protoReports, nil
+}
+
+// ClaimReport закрепляет жалобу за модератором, чтобы ее не разбирали двое одновременно.
+// Захват, не закрытый за reportClaimTTL, может перехватить другой модератор.
+func (s *Service) ClaimReport(ctx context.Context, reportID int64) (*chatpb.Report, error) {
+	const op = "services.chat.ClaimReport"
+	log := s.log.With(slog.String("op", op), slog.Int64("report_id", reportID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	report, err := s.storage.ReportByID(ctx, reportID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := s.requireModerator(ctx, report.ChatID, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	claimed, err := s.storage.ClaimReport(ctx, reportID, userID, reportClaimTTL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("report claimed", slog.Int64("user_id", userID))
+
+	return toProtoReport(claimed), nil
+}
+
+// ResolveReport закрывает жалобу решением модератора. Для ResolutionMuteUser автор
+// не сможет писать в чат в течение muteFor, для ResolutionBanUser он исключается из чата
+// и его стрим закрывается. Модератор чата может наказать только участника ниже себя по роли,
+// администратор сервера - любого.
+func (s *Service) ResolveReport(ctx context.Context, reportID int64, resolution models.Resolution, muteFor time.Duration) (*chatpb.Report, error) {
+	const op = "services.chat.ResolveReport"
+	log := s.log.With(slog.String("op", op), slog.Int64("report_id", reportID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	report, err := s.storage.ReportByID(ctx, reportID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	admin, err := s.requireModerator(ctx, report.ChatID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res := &models.ReportResolution{
+		ReportID:    reportID,
+		ModeratorID: userID,
+		Resolution:  resolution,
+		ClaimTTL:    reportClaimTTL,
+	}
+	if resolution == models.ResolutionMuteUser || resolution == models.ResolutionBanUser {
+		// Автор удалил аккаунт - наказывать некого
+		if report.AuthorID == 0 {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+		}
+		if !admin {
+			if err := s.requireOutranks(ctx, report.ChatID, userID, report.AuthorID); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+	if resolution == models.ResolutionMuteUser {
+		res.MuteUntil = time.Now().Add(muteFor).Truncate(time.Second)
+	}
+
+	resolved, err := s.storage.ResolveReport(ctx, res)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Заблокированный пользователь перестает получать сообщения сразу,
+	// заглушенный узнает о муте так же, как после MuteMember
+	switch resolution {
+	case models.ResolutionBanUser:
+		s.publisher.RemoveUser(report.ChatID, report.AuthorID)
+	case models.ResolutionMuteUser:
+		s.publisher.NotifyUser(report.ChatID, report.AuthorID, mutedNotice(report.ChatID, res.MuteUntil))
+	}
+
+	log.Info("report resolved", slog.Int64("user_id", userID), slog.String("resolution", string(resolution)))
+
+	return toProtoReport(resolved), nil
+}
+
+// ListModerationAudit возвращает журнал модерации чата, новые записи первыми.
+// Журнал всех чатов (chatID = 0) доступен только администраторам сервера.
+func (s *Service) ListModerationAudit(ctx context.Context, chatID int64, limit, offset uint64) ([]*chatpb.AuditEntry, error) {
+	const op = "services.chat.ListModerationAudit"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	if chatID == 0 {
+		admin, err := s.storage.IsServerAdmin(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if !admin {
+			log.Warn("access denied: user is not server admin", slog.Int64("user_id", userID))
+			return nil, models.ErrAccessDenied
+		}
+	} else if _, err := s.requireModerator(ctx, chatID, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	entries, err := s.storage.ModerationAudit(ctx, chatID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	protoEntries := make([]*chatpb.AuditEntry, len(entries))
+	for i, entry := range entries {
+		protoEntries[i] = toProtoAuditEntry(entry)
+	}
+
+	return protoEntries, nil
+}
+
+// requireModerator проверяет, что пользователь может модерировать чат: он администратор
+// сервера, владелец или администратор чата. Возвращает, является ли он администратором сервера.
+func (s *Service) requireModerator(ctx context.Context, chatID, userID int64) (bool, error) {
+	admin, err := s.storage.IsServerAdmin(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if admin {
+		return true, nil
+	}
+	return false, s.requireManager(ctx, chatID, userID)
+}
+
+// requireOutranks проверяет, что роль модератора в чате выше роли цели. Бывший участник
+// чата считается обычным участником.
+func (s *Service) requireOutranks(ctx context.Context, chatID, moderatorID, targetID int64) error {
+	moderatorRole, err := s.storage.ChatMemberRole(ctx, chatID, moderatorID)
+	if err != nil {
+		return err
+	}
+	targetRole, err := s.storage.ChatMemberRole(ctx, chatID, targetID)
+	if err != nil {
+		if !errors.Is(err, models.ErrNotChatMember) {
+			return err
+		}
+		targetRole = models.RoleMember
+	}
+
+	if !moderatorRole.Outranks(targetRole) {
+		s.log.Warn("access denied: target role is not lower than moderator role",
+			slog.Int64("chat_id", chatID), slog.Int64("user_id", moderatorID), slog.Int64("target_id", targetID))
+		return models.ErrAccessDenied
+	}
+	return nil
+}
+
+func toProtoReport(report *models.Report) *chatpb.Report {
+	protoReport := &chatpb.Report{
+		Id:          report.ID,
+		MessageId:   report.MessageID,
+		ChatId:      report.ChatID,
+		ReporterId:  report.ReporterID,
+		AuthorId:    report.AuthorID,
+		Reason:      report.Reason,
+		MessageText: report.MessageText,
+		Status:      string(report.Status),
+		ClaimedBy:   report.ClaimedBy,
+		Resolution:  string(report.Resolution),
+		ResolvedBy:  report.ResolvedBy,
+		CreatedAt:   report.CreatedAt.Unix(),
+	}
+	if report.ClaimedAt != nil {
+		protoReport.ClaimedAt = report.ClaimedAt.Unix()
+	}
+	if report.ResolvedAt != nil {
+		protoReport.ResolvedAt = report.ResolvedAt.Unix()
+	}
+	return protoReport
+}
+
+func toProtoAuditEntry(entry *models.AuditEntry) *chatpb.AuditEntry {
+	return &chatpb.AuditEntry{
+		Id:           entry.ID,
+		ActorId:      entry.ActorID,
+		ChatId:       entry.ChatID,
+		ReportId:     entry.ReportID,
+		TargetUserId: entry.TargetUserID,
+		MessageId:    entry.MessageID,
+		Action:       entry.Action,
+		Details:      entry.Details,
+		CreatedAt:    entry.CreatedAt.Unix(),
+	}
+}
@@ -0,0 +1,220 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func withUser(userID int64) context.Context {
+	return context.WithValue(context.Background(), interceptors.UserIDKey, userID)
+}
+
+// reportFixture: user 10 posts a message in chat 1, user 11 reports it.
+// User 2 is a chat admin, user 1 is the owner.
+func reportFixture(t *testing.T) (*Service, *mockChatStorage, *Publisher) {
+	t.Helper()
+	st := &mockChatStorage{
+		isUserInChat: true,
+		roles:        map[int64]models.ChatRole{1: models.RoleOwner, 2: models.RoleAdmin, 3: models.RoleAdmin},
+	}
+	pub := NewPublisher(testLogger())
+	svc := New(testLogger(), st, pub, 10, SendLimits{})
+	if _, err := svc.SendMessage(withUser(10), 1, "buy cheap pills", "", nil, 0); err != nil {
+		t.Fatalf("send message error: %v", err)
+	}
+	return svc, st, pub
+}
+
+func TestServiceReportMessage(t *testing.T) {
+	svc, st, _ := reportFixture(t)
+
+	report, err := svc.ReportMessage(withUser(11), 1, "spam")
+	if err != nil || report.AuthorId != 10 || report.ReporterId != 11 || report.Status != string(models.ReportOpen) {
+		t.Fatalf("unexpected report: %+v %v", report, err)
+	}
+	if _, err := svc.ReportMessage(withUser(11), 1, "spam again"); !errors.Is(err, models.ErrReportExists) {
+		t.Fatalf("expected duplicate report to fail, got %v", err)
+	}
+	if _, err := svc.ReportMessage(withUser(11), 42, "spam"); !errors.Is(err, models.ErrMessageNotFound) {
+		t.Fatalf("expected message not found, got %v", err)
+	}
+	if _, err := svc.ReportMessage(context.Background(), 1, "spam"); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+
+	st.isUserInChat = false
+	if _, err := svc.ReportMessage(withUser(12), 1, "spam"); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for non-member, got %v", err)
+	}
+}
+
+func TestServiceListReports(t *testing.T) {
+	svc, st, _ := reportFixture(t)
+	if _, err := svc.ReportMessage(withUser(11), 1, "spam"); err != nil {
+		t.Fatalf("report error: %v", err)
+	}
+
+	if _, err := svc.ListReports(withUser(11), 1, "", 50, 0); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for member, got %v", err)
+	}
+
+	reports, err := svc.ListReports(withUser(2), 1, "", 50, 0)
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("unexpected reports: %v %v", reports, err)
+	}
+	if st.lastReportFilter.ModeratorID != 2 {
+		t.Fatalf("chat moderator must only see own chats: %+v", st.lastReportFilter)
+	}
+
+	st.admins = map[int64]bool{99: true}
+	if _, err := svc.ListReports(withUser(99), 0, models.ReportOpen, 50, 0); err != nil || st.lastReportFilter.ModeratorID != 0 {
+		t.Fatalf("server admin must see all chats: %+v %v", st.lastReportFilter, err)
+	}
+}
+
+func TestServiceClaimAndResolveReport(t *testing.T) {
+	svc, st, _ := reportFixture(t)
+	if _, err := svc.ReportMessage(withUser(11), 1, "spam"); err != nil {
+		t.Fatalf("report error: %v", err)
+	}
+
+	if _, err := svc.ClaimReport(withUser(11), 1); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for member, got %v", err)
+	}
+	if report, err := svc.ClaimReport(withUser(2), 1); err != nil || report.ClaimedBy != 2 {
+		t.Fatalf("unexpected claim: %+v %v", report, err)
+	}
+	if _, err := svc.ClaimReport(withUser(3), 1); !errors.Is(err, models.ErrReportClaimed) {
+		t.Fatalf("expected report claimed by another moderator, got %v", err)
+	}
+	if _, err := svc.ResolveReport(withUser(3), 1, models.ResolutionDismiss, 0); !errors.Is(err, models.ErrReportClaimed) {
+		t.Fatalf("expected report claimed by another moderator, got %v", err)
+	}
+
+	report, err := svc.ResolveReport(withUser(2), 1, models.ResolutionMuteUser, time.Hour)
+	if err != nil || report.Status != string(models.ReportResolved) || report.Resolution != string(models.ResolutionMuteUser) {
+		t.Fatalf("unexpected resolve: %+v %v", report, err)
+	}
+	if until := st.mutedUntil[[2]int64{1, 10}]; time.Until(until) < 59*time.Minute {
+		t.Fatalf("expected author muted for an hour, got %v", until)
+	}
+	_, err = svc.SendMessage(withUser(10), 1, "hello", "", nil, 0)
+	var muted *models.MutedError
+	if !errors.As(err, &muted) {
+		t.Fatalf("expected muted author to be rejected, got %v", err)
+	}
+	if _, err := svc.ResolveReport(withUser(2), 1, models.ResolutionDismiss, 0); !errors.Is(err, models.ErrReportResolved) {
+		t.Fatalf("expected report already resolved, got %v", err)
+	}
+
+	entries, err := svc.ListModerationAudit(withUser(2), 1, 50, 0)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("expected 3 audit entries, got %d %v", len(entries), err)
+	}
+	if entries[2].Action != models.AuditReportResolved || entries[2].TargetUserId != 10 {
+		t.Fatalf("unexpected audit entry: %+v", entries[2])
+	}
+}
+
+func TestServiceResolveReportDeleteAndBan(t *testing.T) {
+	svc, st, pub := reportFixture(t)
+	if _, err := svc.SendMessage(withUser(10), 1, "more spam", "", nil, 0); err != nil {
+		t.Fatalf("send message error: %v", err)
+	}
+	for _, id := range []int64{1, 2} {
+		if _, err := svc.ReportMessage(withUser(11), id, "spam"); err != nil {
+			t.Fatalf("report error: %v", err)
+		}
+	}
+
+	if _, err := svc.ResolveReport(withUser(2), 1, models.ResolutionDeleteMessage, 0); err != nil {
+		t.Fatalf("resolve error: %v", err)
+	}
+	if st.savedMessages[0].ExpiresAt == nil {
+		t.Fatalf("deleted message must be expired for the janitor")
+	}
+
+	sub := &mockSubscriber{id: 10}
+	pub.Register(1, sub)
+	if _, err := svc.ResolveReport(withUser(2), 2, models.ResolutionBanUser, 0); err != nil {
+		t.Fatalf("resolve error: %v", err)
+	}
+	if !sub.closed {
+		t.Fatalf("banned user's stream must be closed")
+	}
+	if _, err := svc.SendMessage(withUser(10), 1, "hello", "", nil, 0); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected banned user to be rejected, got %v", err)
+	}
+}
+
+func TestServiceResolveReportBanClosesStream(t *testing.T) {
+	svc, _, pub := reportFixture(t)
+	if _, err := svc.ReportMessage(withUser(11), 1, "spam"); err != nil {
+		t.Fatalf("report error: %v", err)
+	}
+
+	stream := &blockingJoinStream{fakeJoinStream: fakeJoinStream{ctx: withUser(10)}, initial: make(chan *chatpb.JoinChatRequest, 1), release: make(chan struct{})}
+	defer close(stream.release)
+	stream.initial <- &chatpb.JoinChatRequest{ChatId: 1}
+	close(stream.initial)
+
+	result := make(chan error, 1)
+	go func() { result <- svc.JoinChat(stream) }()
+	for pub.subscriberCount(1) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The banned author's open stream ends without waiting for them to send anything
+	if _, err := svc.ResolveReport(withUser(2), 1, models.ResolutionBanUser, 0); err != nil {
+		t.Fatalf("resolve error: %v", err)
+	}
+	select {
+	case err := <-result:
+		if status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("expected permission denied, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("JoinChat stayed open after the ban")
+	}
+}
+
+func TestServiceResolveReportRoleHierarchy(t *testing.T) {
+	svc, st, pub := reportFixture(t)
+	if _, err := svc.SendMessage(withUser(3), 1, "admin message", "", nil, 0); err != nil {
+		t.Fatalf("send message error: %v", err)
+	}
+	if _, err := svc.ReportMessage(withUser(11), 2, "rude"); err != nil {
+		t.Fatalf("report error: %v", err)
+	}
+
+	// An admin cannot punish another admin, but the owner can.
+	if _, err := svc.ResolveReport(withUser(2), 1, models.ResolutionMuteUser, time.Hour); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for admin muting admin, got %v", err)
+	}
+	target := &mockSubscriber{id: 3}
+	pub.Register(1, target)
+	if _, err := svc.ResolveReport(withUser(1), 1, models.ResolutionMuteUser, time.Hour); err != nil {
+		t.Fatalf("owner should mute admin: %v", err)
+	}
+	// The muted author learns about it right away, as with MuteMember
+	if len(target.received) != 1 || target.received[0].Event != chatpb.MessageEvent_MESSAGE_EVENT_MUTED || target.received[0].RetryAt <= time.Now().Unix() {
+		t.Fatalf("expected mute notice, got %+v", target.received)
+	}
+
+	// Server-wide audit is only for server admins.
+	if _, err := svc.ListModerationAudit(withUser(1), 0, 50, 0); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for global audit, got %v", err)
+	}
+	st.admins = map[int64]bool{99: true}
+	if entries, err := svc.ListModerationAudit(withUser(99), 0, 50, 0); err != nil || len(entries) != 2 {
+		t.Fatalf("unexpected global audit: %d %v", len(entries), err)
+	}
+}
@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+// GetRetentionPolicy возвращает срок хранения сообщений чата. Доступно участникам чата.
+func (s *Service) GetRetentionPolicy(ctx context.Context, chatID int64) (*chatpb.RetentionPolicy, error) {
+	const op = "services.chat.GetRetentionPolicy"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	inChat, err := s.storage.IsUserInChat(ctx, userID, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !inChat {
+		log.Warn("access denied: user is not member of chat", slog.Int64("user_id", userID))
+		return nil, models.ErrAccessDenied
+	}
+
+	policy, err := s.storage.RetentionPolicy(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return toProtoRetention(policy), nil
+}
+
+// SetRetentionPolicy меняет срок хранения сообщений чата.
+// Срок задают владелец и администраторы чата, legal hold включают и снимают только
+// администраторы сервера; им же доступен и срок.
+func (s *Service) SetRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) (*chatpb.RetentionPolicy, error) {
+	const op = "services.chat.SetRetentionPolicy"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", policy.ChatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	serverAdmin, err := s.requireModerator(ctx, policy.ChatID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	current, err := s.storage.RetentionPolicy(ctx, policy.ChatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if current.LegalHold != policy.LegalHold && !serverAdmin {
+		log.Warn("access denied: only server admins can change legal hold", slog.Int64("user_id", userID))
+		return nil, models.ErrAccessDenied
+	}
+
+	if err := s.storage.SetRetentionPolicy(ctx, policy, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("retention policy changed",
+		slog.Int64("user_id", userID),
+		slog.Int("retention_days", policy.RetentionDays),
+		slog.Bool("legal_hold", policy.LegalHold),
+	)
+
+	return toProtoRetention(policy), nil
+}
+
+func toProtoRetention(policy *models.RetentionPolicy) *chatpb.RetentionPolicy {
+	return &chatpb.RetentionPolicy{
+		ChatId:        policy.ChatID,
+		RetentionDays: int32(policy.RetentionDays),
+		LegalHold:     policy.LegalHold,
+	}
+}
@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+func TestServiceRetentionPolicy(t *testing.T) {
+	st := &mockChatStorage{}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	if _, err := svc.GetRetentionPolicy(ctx, 1); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for non-member, got %v", err)
+	}
+
+	st.isUserInChat = true
+	if _, err := svc.SetRetentionPolicy(ctx, &models.RetentionPolicy{ChatID: 1, RetentionDays: 30}); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for member, got %v", err)
+	}
+
+	// Chat admins and the owner set the retention period but not legal hold
+	st.role = models.RoleAdmin
+	if _, err := svc.SetRetentionPolicy(ctx, &models.RetentionPolicy{ChatID: 1, RetentionDays: 30}); err != nil {
+		t.Fatalf("set retention error: %v", err)
+	}
+	for _, role := range []models.ChatRole{models.RoleAdmin, models.RoleOwner} {
+		st.role = role
+		if _, err := svc.SetRetentionPolicy(ctx, &models.RetentionPolicy{ChatID: 1, RetentionDays: 30, LegalHold: true}); !errors.Is(err, models.ErrAccessDenied) {
+			t.Fatalf("expected access denied for legal hold by %s, got %v", role, err)
+		}
+	}
+
+	// Server admins change legal hold without being chat members, and it is audited
+	st.isUserInChat = false
+	st.admins = map[int64]bool{3: true}
+	if _, err := svc.SetRetentionPolicy(ctx, &models.RetentionPolicy{ChatID: 1, RetentionDays: 30, LegalHold: true}); err != nil {
+		t.Fatalf("set legal hold error: %v", err)
+	}
+	if len(st.audit) != 1 || st.audit[0].Action != models.AuditLegalHoldSet || st.audit[0].ActorID != 3 || st.audit[0].ChatID != 1 {
+		t.Fatalf("legal hold must be audited: %+v", st.audit)
+	}
+
+	st.isUserInChat = true
+	policy, err := svc.GetRetentionPolicy(ctx, 1)
+	if err != nil || policy.RetentionDays != 30 || !policy.LegalHold {
+		t.Fatalf("unexpected policy: %v %+v", err, policy)
+	}
+}
+
+func TestJanitorPurge(t *testing.T) {
+	st := &mockChatStorage{
+		policies: map[int64]*models.RetentionPolicy{
+			1: {ChatID: 1, RetentionDays: 30},
+			2: {ChatID: 2, RetentionDays: 30, LegalHold: true},
+		},
+		purgeBatches: []*models.PurgeBatch{
+			{Messages: 2, Attachments: 1, OrphanBlobs: []string{"a", "c"}},
+			{Messages: 1},
+		},
+		// A new upload referenced "c" after the purge transaction picked it
+		attachments: map[int64]*models.Attachment{7: {ID: 7, ChatID: 1, SHA256: "c"}},
+	}
+	blobs := newMemBlobStore()
+	blobs.blobs["a"] = []byte("data")
+	blobs.blobs["b"] = []byte("shared")
+	blobs.blobs["c"] = []byte("reused")
+
+	janitor := NewJanitor(testLogger(), st, blobs, NewPublisher(testLogger()), time.Hour, time.Hour, 2)
+	janitor.purge()
+
+	if len(st.purgeRuns) != 1 {
+		t.Fatalf("expected one purge run, got %d", len(st.purgeRuns))
+	}
+	run := st.purgeRuns[0]
+	if run.ChatID != 1 || run.RetentionDays != 30 || run.MessagesDeleted != 3 || run.AttachmentsDeleted != 1 || run.BlobsDeleted != 1 {
+		t.Fatalf("unexpected purge run: %+v", run)
+	}
+	if run.FinishedAt.Before(run.StartedAt) {
+		t.Fatalf("unexpected run timing: %+v", run)
+	}
+	if _, ok := blobs.blobs["a"]; ok {
+		t.Fatalf("orphan blob must be deleted")
+	}
+	if _, ok := blobs.blobs["b"]; !ok {
+		t.Fatalf("referenced blob must be kept")
+	}
+	if _, ok := blobs.blobs["c"]; !ok {
+		t.Fatalf("blob referenced again must be kept")
+	}
+
+	// Nothing left to delete - no audit record
+	janitor.purge()
+	if len(st.purgeRuns) != 1 {
+		t.Fatalf("empty pass must not be recorded, got %d runs", len(st.purgeRuns))
+	}
+
+	// Errors are recorded
+	st.purgeErr = errors.New("db")
+	janitor.purge()
+	if len(st.purgeRuns) != 2 || st.purgeRuns[1].Error == "" {
+		t.Fatalf("expected failed run to be recorded: %+v", st.purgeRuns)
+	}
+}
+
+func TestJanitorStartStop(t *testing.T) {
+	st := &mockChatStorage{
+		policies:     map[int64]*models.RetentionPolicy{1: {ChatID: 1, RetentionDays: 1}},
+		purgeBatches: []*models.PurgeBatch{{Messages: 1}},
+	}
+	janitor := NewJanitor(testLogger(), st, newMemBlobStore(), NewPublisher(testLogger()), time.Hour, time.Hour, 10)
+
+	// The first pass runs immediately on start
+	janitor.Start()
+	time.Sleep(50 * time.Millisecond)
+	janitor.Stop()
+	janitor.Stop()
+
+	if len(st.purgeRuns) != 1 {
+		t.Fatalf("expected a purge run on start, got %d", len(st.purgeRuns))
+	}
+}
@@ -0,0 +1,49 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+// SetMemberRole назначает участника администратором чата или возвращает ему обычную роль.
+// Доступно только владельцу чата; передать владение этим вызовом нельзя.
+func (s *Service) SetMemberRole(ctx context.Context, chatID, targetID int64, role models.ChatRole) error {
+	const op = "services.chat.SetMemberRole"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID), slog.Int64("target_id", targetID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return models.ErrInvalidCredentials
+	}
+
+	if role != models.RoleAdmin && role != models.RoleMember {
+		log.Warn("access denied: role cannot be granted", slog.String("role", string(role)))
+		return models.ErrAccessDenied
+	}
+
+	ownerRole, err := s.storage.ChatMemberRole(ctx, chatID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotChatMember) {
+			return models.ErrAccessDenied
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if ownerRole != models.RoleOwner || targetID == userID {
+		log.Warn("access denied: only the owner can change roles of other members", slog.Int64("user_id", userID))
+		return models.ErrAccessDenied
+	}
+
+	if err := s.storage.SetMemberRole(ctx, chatID, targetID, userID, role); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("member role changed", slog.Int64("user_id", userID), slog.String("role", string(role)))
+
+	return nil
+}
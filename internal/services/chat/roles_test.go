@@ -0,0 +1,47 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+)
+
+func TestServiceSetMemberRole(t *testing.T) {
+	st := &mockChatStorage{
+		isUserInChat: true,
+		roles:        map[int64]models.ChatRole{1: models.RoleOwner, 2: models.RoleAdmin},
+	}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+
+	// Only the owner changes roles, and only of other members
+	if err := svc.SetMemberRole(withUser(2), 1, 10, models.RoleAdmin); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for admin, got %v", err)
+	}
+	if err := svc.SetMemberRole(withUser(1), 1, 1, models.RoleMember); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("owner must not demote themselves, got %v", err)
+	}
+	if err := svc.SetMemberRole(withUser(1), 1, 10, models.RoleOwner); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("ownership must not be granted, got %v", err)
+	}
+
+	// A promoted member moderates the chat
+	if err := svc.SetMemberRole(withUser(1), 1, 10, models.RoleAdmin); err != nil {
+		t.Fatalf("SetMemberRole error: %v", err)
+	}
+	if _, err := svc.MuteMember(withUser(10), 1, 11, time.Minute); err != nil {
+		t.Fatalf("new admin must mute members: %v", err)
+	}
+
+	if err := svc.SetMemberRole(withUser(1), 1, 10, models.RoleMember); err != nil {
+		t.Fatalf("SetMemberRole error: %v", err)
+	}
+	if _, err := svc.MuteMember(withUser(10), 1, 11, time.Minute); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("demoted member must not mute, got %v", err)
+	}
+
+	if len(st.audit) != 3 || st.audit[0].Action != models.AuditMemberRoleChanged || st.audit[0].ActorID != 1 || st.audit[0].TargetUserID != 10 {
+		t.Fatalf("unexpected audit: %+v", st.audit)
+	}
+}
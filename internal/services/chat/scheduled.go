@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+// ScheduleMessage откладывает отправку сообщения в чат до sendAt.
+func (s *Service) ScheduleMessage(ctx context.Context, chatID int64, text string, sendAt time.Time) (*chatpb.ScheduledMessage, error) {
+	const op = "services.chat.ScheduleMessage"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	// Проверяем заранее, чтобы не принять сообщение, которое планировщик не сможет отправить
+	if _, err := s.checkPoster(ctx, chatID, userID); err != nil {
+		log.Warn("user cannot post to chat", slog.Int64("user_id", userID), slog.Any("err", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	msg, err := s.storage.SaveScheduledMessage(ctx, chatID, userID, text, sendAt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return toProtoScheduled(msg), nil
+}
+
+// ListScheduledMessages возвращает ожидающие отправки сообщения пользователя.
+// chatID = 0 означает все чаты.
+func (s *Service) ListScheduledMessages(ctx context.Context, chatID int64) ([]*chatpb.ScheduledMessage, error) {
+	const op = "services.chat.ListScheduledMessages"
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		s.log.With(slog.String("op", op)).Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	messages, err := s.storage.ScheduledMessages(ctx, userID, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res := make([]*chatpb.ScheduledMessage, len(messages))
+	for i, msg := range messages {
+		res[i] = toProtoScheduled(msg)
+	}
+
+	return res, nil
+}
+
+// UpdateScheduledMessage меняет текст и время отправки ожидающего сообщения.
+func (s *Service) UpdateScheduledMessage(ctx context.Context, id int64, text string, sendAt time.Time) (*chatpb.ScheduledMessage, error) {
+	const op = "services.chat.UpdateScheduledMessage"
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		s.log.With(slog.String("op", op)).Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	msg, err := s.storage.UpdateScheduledMessage(ctx, id, userID, text, sendAt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return toProtoScheduled(msg), nil
+}
+
+// CancelScheduledMessage отменяет ожидающее сообщение.
+func (s *Service) CancelScheduledMessage(ctx context.Context, id int64) error {
+	const op = "services.chat.CancelScheduledMessage"
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		s.log.With(slog.String("op", op)).Warn("missing user id in context")
+		return models.ErrInvalidCredentials
+	}
+
+	if err := s.storage.DeleteScheduledMessage(ctx, id, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func toProtoScheduled(msg *models.ScheduledMessage) *chatpb.ScheduledMessage {
+	return &chatpb.ScheduledMessage{
+		Id:        msg.ID,
+		ChatId:    msg.ChatID,
+		Text:      msg.Text,
+		SendAt:    msg.SendAt.Unix(),
+		CreatedAt: msg.CreatedAt.Unix(),
+	}
+}
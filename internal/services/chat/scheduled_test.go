@@ -0,0 +1,158 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+func TestServiceScheduledMessages(t *testing.T) {
+	st := &mockChatStorage{}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+	sendAt := time.Now().Add(time.Hour)
+
+	if _, err := svc.ScheduleMessage(ctx, 1, "later", sendAt); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+
+	st.isUserInChat = true
+	scheduled, err := svc.ScheduleMessage(ctx, 1, "later", sendAt)
+	if err != nil || scheduled.Text != "later" || scheduled.SendAt != sendAt.Unix() {
+		t.Fatalf("unexpected schedule result: %v %+v", err, scheduled)
+	}
+
+	updated, err := svc.UpdateScheduledMessage(ctx, scheduled.Id, "much later", sendAt.Add(time.Hour))
+	if err != nil || updated.Text != "much later" {
+		t.Fatalf("unexpected update result: %v %+v", err, updated)
+	}
+
+	// Other users cannot see or change the message
+	other := context.WithValue(context.Background(), interceptors.UserIDKey, int64(4))
+	if list, _ := svc.ListScheduledMessages(other, 0); len(list) != 0 {
+		t.Fatalf("expected no scheduled messages for another user, got %+v", list)
+	}
+	if err := svc.CancelScheduledMessage(other, scheduled.Id); !errors.Is(err, models.ErrScheduledNotFound) {
+		t.Fatalf("expected not found for another user, got %v", err)
+	}
+
+	if list, _ := svc.ListScheduledMessages(ctx, 1); len(list) != 1 {
+		t.Fatalf("expected one scheduled message, got %+v", list)
+	}
+	if err := svc.CancelScheduledMessage(ctx, scheduled.Id); err != nil {
+		t.Fatalf("cancel error: %v", err)
+	}
+	if list, _ := svc.ListScheduledMessages(ctx, 0); len(list) != 0 {
+		t.Fatalf("expected empty list after cancel, got %+v", list)
+	}
+}
+
+func TestSchedulerDeliversDueMessages(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	publisher := NewPublisher(testLogger())
+	listener := &mockSubscriber{id: 2}
+	publisher.Register(1, listener)
+	svc := New(testLogger(), st, publisher, 10, SendLimits{})
+	scheduler := NewScheduler(testLogger(), svc, time.Hour, 10)
+
+	due, _ := st.SaveScheduledMessage(context.Background(), 1, 3, "now", time.Now().Add(-time.Second))
+	future, _ := st.SaveScheduledMessage(context.Background(), 1, 3, "later", time.Now().Add(time.Hour))
+
+	if n := scheduler.deliverDue(); n != 1 {
+		t.Fatalf("expected one due message, got %d", n)
+	}
+	if len(st.savedMessages) != 1 || st.savedMessages[0].Text != "now" || len(listener.received) != 1 {
+		t.Fatalf("due message not delivered: %+v", st.savedMessages)
+	}
+	if st.finished[due.ID] != st.savedMessages[0].ID {
+		t.Fatalf("scheduled message not marked as sent: %+v", st.finished)
+	}
+	if _, ok := st.finished[future.ID]; ok {
+		t.Fatalf("future message must not be delivered")
+	}
+
+	// A retry after a crash between SaveMessage and Finish reuses the saved message
+	delete(st.finished, due.ID)
+	scheduler.deliverDue()
+	if len(st.savedMessages) != 1 || len(listener.received) != 1 {
+		t.Fatalf("retry must not duplicate the message: %d saved, %d broadcast", len(st.savedMessages), len(listener.received))
+	}
+}
+
+func TestSchedulerAuthorLeftChat(t *testing.T) {
+	st := &mockChatStorage{}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	scheduler := NewScheduler(testLogger(), svc, time.Hour, 10)
+
+	msg, _ := st.SaveScheduledMessage(context.Background(), 1, 3, "now", time.Now().Add(-time.Second))
+	scheduler.deliverDue()
+
+	if id, ok := st.finished[msg.ID]; !ok || id != 0 {
+		t.Fatalf("expected scheduled message to fail, got %v %v", id, ok)
+	}
+	if len(st.savedMessages) != 0 {
+		t.Fatalf("message must not be saved")
+	}
+}
+
+func TestSchedulerAuthorCannotPostToChannel(t *testing.T) {
+	st := &mockChatStorage{
+		isUserInChat: true,
+		roles:        map[int64]models.ChatRole{3: models.RoleAdmin},
+		chatTypes:    map[int64]string{1: models.ChatTypeChannel},
+	}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	scheduler := NewScheduler(testLogger(), svc, time.Hour, 10)
+
+	msg, _ := st.SaveScheduledMessage(context.Background(), 1, 3, "announcement", time.Now().Add(-time.Second))
+	// The author was demoted after scheduling; members cannot post to channels
+	st.roles[3] = models.RoleMember
+	scheduler.deliverDue()
+
+	if id, ok := st.finished[msg.ID]; !ok || id != 0 {
+		t.Fatalf("expected scheduled message to fail, got %v %v", id, ok)
+	}
+	if len(st.savedMessages) != 0 {
+		t.Fatalf("message must not be saved")
+	}
+}
+
+func TestSchedulerMessageRejectedByFilters(t *testing.T) {
+	st := &mockChatStorage{
+		isUserInChat: true,
+		moderation:   map[int64]*models.ModerationSettings{1: {ChatID: 1, MaxLength: 3}},
+	}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	scheduler := NewScheduler(testLogger(), svc, time.Hour, 10)
+
+	msg, _ := st.SaveScheduledMessage(context.Background(), 1, 3, "too long", time.Now().Add(-time.Second))
+	scheduler.deliverDue()
+
+	// Filters are checked at delivery time; a rejected message is not retried
+	if id, ok := st.finished[msg.ID]; !ok || id != 0 {
+		t.Fatalf("expected scheduled message to fail, got %v %v", id, ok)
+	}
+	if len(st.savedMessages) != 0 {
+		t.Fatalf("message must not be saved")
+	}
+}
+
+func TestSchedulerStartStop(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	scheduler := NewScheduler(testLogger(), svc, 10*time.Millisecond, 10)
+
+	st.SaveScheduledMessage(context.Background(), 1, 3, "now", time.Now().Add(-time.Second))
+	scheduler.Start()
+	time.Sleep(50 * time.Millisecond)
+	scheduler.Stop()
+
+	if len(st.savedMessages) != 1 {
+		t.Fatalf("scheduler did not deliver the message")
+	}
+	scheduler.Stop() // repeated Stop is safe
+}
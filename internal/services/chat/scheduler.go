@@ -0,0 +1,130 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+)
+
+// scheduledLease - время, на которое инстанс захватывает сообщение для отправки.
+// Если инстанс упадет, сообщение после истечения аренды подхватит другой.
+const scheduledLease = time.Minute
+
+// Scheduler периодически забирает из хранилища созревшие отложенные сообщения и
+// отправляет их обычным путем (SaveMessage + Broadcast). Состояние очереди хранится
+// в Postgres, поэтому отложенные сообщения переживают перезапуск сервера.
+type Scheduler struct {
+	log      *slog.Logger
+	chat     *Service
+	interval time.Duration
+	batch    int
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewScheduler(log *slog.Logger, chat *Service, interval time.Duration, batch int) *Scheduler {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &Scheduler{
+		log:      log,
+		chat:     chat,
+		interval: interval,
+		batch:    max(1, batch),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start запускает цикл опроса.
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				// Полный пакет - вероятно, есть еще созревшие сообщения, забираем сразу
+				for s.deliverDue() == s.batch {
+					select {
+					case <-s.stop:
+						return
+					default:
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop останавливает цикл и дожидается завершения текущего пакета.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.wg.Wait()
+}
+
+// deliverDue отправляет один пакет созревших сообщений и возвращает его размер.
+func (s *Scheduler) deliverDue() int {
+	const op = "services.chat.Scheduler.deliverDue"
+	log := s.log.With(slog.String("op", op))
+
+	ctx, cancel := context.WithTimeout(context.Background(), scheduledLease)
+	defer cancel()
+
+	due, err := s.chat.storage.ClaimDueScheduledMessages(ctx, scheduledLease, s.batch)
+	if err != nil {
+		log.Error("failed to claim scheduled messages", slog.Any("err", err))
+		return 0
+	}
+
+	for _, msg := range due {
+		if err := s.deliver(ctx, msg); err != nil {
+			// Сообщение остается захваченным и будет повторено после истечения аренды
+			log.Error("failed to deliver scheduled message", slog.Int64("scheduled_id", msg.ID), slog.Any("err", err))
+		}
+	}
+
+	return len(due)
+}
+
+func (s *Scheduler) deliver(ctx context.Context, msg *models.ScheduledMessage) error {
+	const op = "services.chat.Scheduler.deliver"
+
+	// Ключ идемпотентности защищает от дубля, если предыдущая попытка сохранила
+	// сообщение, но не успела отметить отложенное как отправленное
+	key := fmt.Sprintf("scheduled:%d", msg.ID)
+
+	sent, err := s.chat.send(ctx, outgoing{userID: msg.UserID, chatID: msg.ChatID, text: msg.Text, idempotencyKey: key})
+	if err != nil {
+		if !errors.Is(err, models.ErrAccessDenied) && !errors.Is(err, models.ErrReadOnlyChat) &&
+			!errors.Is(err, models.ErrMessageRejected) && !errors.Is(err, models.ErrMuted) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		// Автор больше не состоит в чате или не может в него писать, заглушен
+		// или сообщение не прошло фильтры - повторять бессмысленно
+		s.log.Warn("scheduled message cannot be delivered",
+			slog.Int64("scheduled_id", msg.ID), slog.Int64("user_id", msg.UserID), slog.Any("err", err))
+		if err := s.chat.storage.FinishScheduledMessage(ctx, msg.ID, 0); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return nil
+	}
+
+	if err := s.chat.storage.FinishScheduledMessage(ctx, msg.ID, sent.GetId()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
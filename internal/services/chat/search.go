@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+// SearchMessages выполняет полнотекстовый поиск по чатам, в которых состоит пользователь.
+func (s *Service) SearchMessages(ctx context.Context, query string, filter models.SearchFilter, limit, offset uint64) ([]*chatpb.SearchResult, error) {
+	const op = "services.chat.SearchMessages"
+	log := s.log.With(slog.String("op", op))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return nil, models.ErrInvalidCredentials
+	}
+
+	// Поиск и так ограничен чатами пользователя, но явный фильтр по чужому чату - это ошибка доступа
+	if filter.ChatID != 0 {
+		inChat, err := s.storage.IsUserInChat(ctx, userID, filter.ChatID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if !inChat {
+			log.Warn("access denied: user is not member of chat", slog.Int64("user_id", userID), slog.Int64("chat_id", filter.ChatID))
+			return nil, models.ErrAccessDenied
+		}
+	}
+
+	results, err := s.storage.SearchMessages(ctx, userID, query, filter, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	protoResults := make([]*chatpb.SearchResult, len(results))
+	for i, res := range results {
+		protoResults[i] = &chatpb.SearchResult{
+			Message: toProtoMessage(res.Message),
+			Rank:    res.Rank,
+			Snippet: res.Snippet,
+		}
+	}
+
+	return protoResults, nil
+}
@@ -0,0 +1,52 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+func TestServiceSearchMessages(t *testing.T) {
+	st := &mockChatStorage{}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+
+	// Missing user id
+	if _, err := svc.SearchMessages(context.Background(), "hello", models.SearchFilter{}, 10, 0); !errors.Is(err, models.ErrInvalidCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(5))
+
+	// Chat filter on a chat the user is not a member of
+	if _, err := svc.SearchMessages(ctx, "hello", models.SearchFilter{ChatID: 3}, 10, 0); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+
+	// Storage error
+	st.searchErr = errors.New("db error")
+	if _, err := svc.SearchMessages(ctx, "hello", models.SearchFilter{}, 10, 0); err == nil {
+		t.Fatalf("expected storage error")
+	}
+
+	// Success across all chats of the user
+	st.searchErr = nil
+	st.searchResults = []*models.SearchResult{{
+		Message: &models.Message{ID: 1, ChatID: 3, UserID: 5, Text: "hello world", CreatedAt: time.Unix(100, 0)},
+		Rank:    0.5,
+		Snippet: "<b>hello</b> world",
+	}}
+	res, err := svc.SearchMessages(ctx, "hello", models.SearchFilter{AuthorID: 5}, 10, 0)
+	if err != nil || len(res) != 1 {
+		t.Fatalf("unexpected result: %v %+v", err, res)
+	}
+	if res[0].Snippet != "<b>hello</b> world" || res[0].Message.Id != 1 || res[0].Rank != 0.5 {
+		t.Fatalf("unexpected search result: %+v", res[0])
+	}
+	if st.lastFilter.AuthorID != 5 {
+		t.Fatalf("filter not passed to storage: %+v", st.lastFilter)
+	}
+}
@@ -0,0 +1,65 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+// GetSlowMode возвращает интервал медленного режима чата. Доступно участникам чата.
+func (s *Service) GetSlowMode(ctx context.Context, chatID int64) (time.Duration, error) {
+	const op = "services.chat.GetSlowMode"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return 0, models.ErrInvalidCredentials
+	}
+
+	inChat, err := s.storage.IsUserInChat(ctx, userID, chatID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if !inChat {
+		log.Warn("access denied: user is not member of chat", slog.Int64("user_id", userID))
+		return 0, models.ErrAccessDenied
+	}
+
+	interval, err := s.storage.SlowMode(ctx, chatID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return interval, nil
+}
+
+// SetSlowMode включает медленный режим: участник может отправлять не больше одного
+// сообщения за interval. Нулевой interval выключает режим. Доступно владельцу и администраторам,
+// на них самих ограничение не распространяется.
+func (s *Service) SetSlowMode(ctx context.Context, chatID int64, interval time.Duration) error {
+	const op = "services.chat.SetSlowMode"
+	log := s.log.With(slog.String("op", op), slog.Int64("chat_id", chatID))
+
+	userID, ok := ctx.Value(interceptors.UserIDKey).(int64)
+	if !ok {
+		log.Warn("missing user id in context")
+		return models.ErrInvalidCredentials
+	}
+
+	if err := s.requireManager(ctx, chatID, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.storage.SetSlowMode(ctx, chatID, interval); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("slow mode changed", slog.Int64("user_id", userID), slog.Duration("interval", interval))
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+func TestServiceSetSlowMode(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true, role: models.RoleMember}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	if err := svc.SetSlowMode(ctx, 1, time.Minute); !errors.Is(err, models.ErrAccessDenied) {
+		t.Fatalf("expected access denied for member, got %v", err)
+	}
+
+	st.role = models.RoleAdmin
+	if err := svc.SetSlowMode(ctx, 1, time.Minute); err != nil {
+		t.Fatalf("set slow mode error: %v", err)
+	}
+	interval, err := svc.GetSlowMode(ctx, 1)
+	if err != nil || interval != time.Minute {
+		t.Fatalf("unexpected slow mode: %v %v", interval, err)
+	}
+}
+
+func TestServiceSendMessageSlowMode(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true, role: models.RoleMember, slowMode: map[int64]time.Duration{1: time.Minute}}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	if _, err := svc.SendMessage(ctx, 1, "first", "key-1", nil, 0); err != nil {
+		t.Fatalf("first send error: %v", err)
+	}
+	// A retry of the same request is not a new message
+	if _, err := svc.SendMessage(ctx, 1, "first", "key-1", nil, 0); err != nil {
+		t.Fatalf("idempotent retry must not be rejected: %v", err)
+	}
+
+	_, err := svc.SendMessage(ctx, 1, "second", "", nil, 0)
+	var slowErr *models.SlowModeError
+	if !errors.As(err, &slowErr) || time.Until(slowErr.RetryAt) <= 0 {
+		t.Fatalf("expected slow mode error, got %v", err)
+	}
+
+	// Other chats are not affected
+	if _, err := svc.SendMessage(ctx, 2, "elsewhere", "", nil, 0); err != nil {
+		t.Fatalf("send to other chat error: %v", err)
+	}
+
+	// Admins are exempt
+	st.role = models.RoleAdmin
+	for i := 0; i < 2; i++ {
+		if _, err := svc.SendMessage(ctx, 1, "admin", "", nil, 0); err != nil {
+			t.Fatalf("admin send %d error: %v", i, err)
+		}
+	}
+}
+
+func TestServiceSendMessageSlowModeSlot(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true, role: models.RoleMember}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	// Without slow mode no slot is claimed
+	if _, err := svc.SendMessage(ctx, 1, "free", "", nil, 0); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	if st.slotClaims != 0 {
+		t.Fatalf("slot claimed with slow mode off: %d", st.slotClaims)
+	}
+
+	// A message that was not saved does not use up the slot
+	st.slowMode = map[int64]time.Duration{1: time.Minute}
+	st.saveMsgErr = errors.New("db down")
+	if _, err := svc.SendMessage(ctx, 1, "lost", "", nil, 0); err == nil {
+		t.Fatal("expected save error")
+	}
+	st.saveMsgErr = nil
+	if _, err := svc.SendMessage(ctx, 1, "retry", "", nil, 0); err != nil {
+		t.Fatalf("send after failed save must pass slow mode: %v", err)
+	}
+
+	// Exempt senders do not claim slots either
+	claims := st.slotClaims
+	st.role = models.RoleAdmin
+	if _, err := svc.SendMessage(ctx, 1, "admin", "", nil, 0); err != nil {
+		t.Fatalf("admin send error: %v", err)
+	}
+	if st.slotClaims != claims {
+		t.Fatalf("slot claimed for exempt sender")
+	}
+}
+
+func TestServiceJoinChatSlowModeNotice(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true, role: models.RoleMember, slowMode: map[int64]time.Duration{55: time.Minute}}
+	svc := New(testLogger(), st, NewPublisher(testLogger()), 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(7))
+	stream := &fakeJoinStream{ctx: ctx, recvQueue: []*chatpb.JoinChatRequest{
+		{ChatId: 55},
+		{ChatId: 55, Text: "one"},
+		{ChatId: 55, Text: "two"},
+	}}
+
+	// The stream stays open: the early message is rejected, not the connection
+	if err := svc.JoinChat(stream); err != nil {
+		t.Fatalf("JoinChat error: %v", err)
+	}
+	if len(st.savedMessages) != 1 {
+		t.Fatalf("expected only the first message to be saved, got %d", len(st.savedMessages))
+	}
+
+	notice := slowModeNotice(55, &models.SlowModeError{RetryAt: time.Now().Add(time.Minute)})
+	if notice.Event != chatpb.MessageEvent_MESSAGE_EVENT_REJECTED || notice.RetryAt == 0 || notice.Text != "slow mode is enabled: you can post again in 1m0s" {
+		t.Fatalf("unexpected notice: %+v", notice)
+	}
+}
@@ -8,7 +8,8 @@ import (
 
 // Subscriber получает уведомления о новых сообщениях в чате
 type Subscriber interface {
-	// Notify отправляет сообщение подписчику
+	// Notify отправляет сообщение подписчику. Не должен блокироваться; может быть вызван
+	// параллельно с Close, т.к. рассылка идет без блокировки Publisher
 	Notify(msg *chatpb.Message)
 
 	// ID возвращает user ID подписчика
@@ -24,6 +25,8 @@ type chatSubscriber struct {
 	stream    chatpb.ChatService_JoinChatServer
 	messageCh chan *chatpb.Message
 	doneCh    chan struct{}
+	// stoppedCh закрывается, когда writer-горутина больше не обращается к стриму
+	stoppedCh chan struct{}
 	log       *slog.Logger
 }
 
@@ -34,6 +37,7 @@ func newChatSubscriber(userID int64, stream chatpb.ChatService_JoinChatServer, l
 		stream:    stream,
 		messageCh: make(chan *chatpb.Message, 10),
 		doneCh:    make(chan struct{}),
+		stoppedCh: make(chan struct{}),
 		log:       log,
 	}
 
@@ -43,8 +47,10 @@ func newChatSubscriber(userID int64, stream chatpb.ChatService_JoinChatServer, l
 	return sub
 }
 
-// writerLoop читает из канала и отправляет сообщения клиенту
+// writerLoop читает из канала и отправляет сообщения клиенту, пока подписчик не закрыт
+// или не завершен стрим
 func (s *chatSubscriber) writerLoop() {
+	defer close(s.stoppedCh)
 	for {
 		select {
 		case msg := <-s.messageCh:
@@ -57,6 +63,9 @@ func (s *chatSubscriber) writerLoop() {
 		case <-s.doneCh:
 			s.log.Debug("writer loop terminated", slog.Int64("user_id", s.userID))
 			return
+		case <-s.stream.Context().Done():
+			s.log.Debug("writer loop terminated: stream context done", slog.Int64("user_id", s.userID))
+			return
 		}
 	}
 }
@@ -80,7 +89,18 @@ func (s *chatSubscriber) ID() int64 {
 	return s.userID
 }
 
-// Close останавливает writer goroutine
+// Close останавливает writer goroutine. Не ждет ее: вызывается под блокировкой Publisher
 func (s *chatSubscriber) Close() {
 	close(s.doneCh)
 }
+
+// Done закрывается, когда подписчика закрыли: обработчик стрима по нему узнает,
+// что пользователя исключили из чата
+func (s *chatSubscriber) Done() <-chan struct{} {
+	return s.doneCh
+}
+
+// Wait дожидается остановки writer goroutine после Close или завершения стрима
+func (s *chatSubscriber) Wait() {
+	<-s.stoppedCh
+}
@@ -0,0 +1,237 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/grigory222/go-chat-server/internal/lib/imaging"
+	"github.com/grigory222/go-chat-server/internal/storage"
+)
+
+const thumbnailJobTimeout = 30 * time.Second
+
+type thumbnailJob struct {
+	attachmentID int64
+	key          string
+}
+
+// Thumbnailer строит превью изображений в ограниченном пуле фоновых воркеров,
+// чтобы загрузка файла не ждала обработки. Когда превью готовы, а вложение уже
+// прикреплено к сообщению, подписчикам чата уходит обновленное сообщение.
+type Thumbnailer struct {
+	log       *slog.Logger
+	storage   storage.Storage
+	blobs     storage.BlobStore
+	publisher *Publisher
+	sizes     []int
+	maxPixels int64
+	workers   int
+
+	mu     sync.RWMutex
+	closed bool
+	jobs   chan thumbnailJob
+	wg     sync.WaitGroup
+}
+
+func NewThumbnailer(
+	log *slog.Logger,
+	storage storage.Storage,
+	blobs storage.BlobStore,
+	publisher *Publisher,
+	sizes []int,
+	maxPixels int64,
+	workers int,
+	queueSize int,
+) *Thumbnailer {
+	return &Thumbnailer{
+		log:       log,
+		storage:   storage,
+		blobs:     blobs,
+		publisher: publisher,
+		sizes:     sizes,
+		maxPixels: maxPixels,
+		workers:   max(1, workers),
+		jobs:      make(chan thumbnailJob, max(0, queueSize)),
+	}
+}
+
+// Start запускает воркеры.
+func (t *Thumbnailer) Start() {
+	for range t.workers {
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			for job := range t.jobs {
+				t.process(job)
+			}
+		}()
+	}
+}
+
+// Stop перестает принимать задачи и дожидается обработки уже поставленных в очередь.
+func (t *Thumbnailer) Stop() {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.jobs)
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+}
+
+// Fits сообщает, можно ли строить превью изображения таких размеров. Декодированное
+// изображение занимает в памяти порядка 4 байт на пиксель, поэтому маленький файл
+// с огромными заявленными размерами не должен попадать в очередь.
+func (t *Thumbnailer) Fits(width, height int) bool {
+	return t.maxPixels <= 0 || int64(width)*int64(height) <= t.maxPixels
+}
+
+// Enqueue ставит вложение в очередь без блокировки. Возвращает false, если очередь переполнена.
+func (t *Thumbnailer) Enqueue(attachmentID int64, key string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return false
+	}
+
+	select {
+	case t.jobs <- thumbnailJob{attachmentID: attachmentID, key: key}:
+		return true
+	default:
+		t.log.Warn("thumbnail queue is full, skipping attachment", slog.Int64("attachment_id", attachmentID))
+		return false
+	}
+}
+
+func (t *Thumbnailer) process(job thumbnailJob) {
+	const op = "services.chat.Thumbnailer.process"
+	log := t.log.With(slog.String("op", op), slog.Int64("attachment_id", job.attachmentID))
+
+	ctx, cancel := context.WithTimeout(context.Background(), thumbnailJobTimeout)
+	defer cancel()
+
+	if err := t.generate(ctx, job); err != nil {
+		log.Error("failed to generate thumbnails", slog.Any("err", err))
+		return
+	}
+
+	// Если вложение уже в сообщении - рассылаем обновление, иначе превью подтянутся при отправке
+	attachment, err := t.storage.AttachmentByID(ctx, job.attachmentID)
+	if err != nil {
+		// Сообщение с вложением уже исчезло - рассылать нечего
+		if errors.Is(err, models.ErrAttachmentNotFound) {
+			return
+		}
+		log.Error("failed to load attachment", slog.Any("err", err))
+		return
+	}
+	if attachment.MessageID == 0 {
+		return
+	}
+
+	msg, err := t.storage.MessageByID(ctx, attachment.MessageID)
+	if err != nil {
+		log.Error("failed to load message", slog.Any("err", err))
+		return
+	}
+
+	protoMsg := toProtoMessage(msg)
+	protoMsg.Event = chatpb.MessageEvent_MESSAGE_EVENT_UPDATED
+	// Обновление получают все подписчики, включая автора
+	t.publisher.Broadcast(protoMsg, nil)
+}
+
+func (t *Thumbnailer) generate(ctx context.Context, job thumbnailJob) error {
+	rc, err := t.blobs.Get(ctx, job.key)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	// Размеры из заголовка проверяем до декодирования, которое выделит память под все пиксели
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode image config: %w", err)
+	}
+	if !t.Fits(cfg.Width, cfg.Height) {
+		return fmt.Errorf("image %dx%d exceeds %d pixels", cfg.Width, cfg.Height, t.maxPixels)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	for _, size := range t.sizes {
+		thumb := imaging.Thumbnail(img, size)
+		// Изображение уже не больше этого размера - превью не нужно
+		if thumb.Bounds().Size() == bounds.Size() {
+			continue
+		}
+
+		var buf bytes.Buffer
+		mimeType := "image/png"
+		if format == "jpeg" {
+			mimeType = "image/jpeg"
+			err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+		} else {
+			err = png.Encode(&buf, thumb)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode thumbnail: %w", err)
+		}
+
+		sum := sha256.Sum256(buf.Bytes())
+		key := hex.EncodeToString(sum[:])
+		size := int64(buf.Len())
+
+		if err := t.blobs.Put(ctx, key, bytes.NewReader(buf.Bytes())); err != nil {
+			return err
+		}
+
+		err = t.storage.SaveThumbnail(ctx, &models.Thumbnail{
+			AttachmentID: job.attachmentID,
+			Width:        thumb.Bounds().Dx(),
+			Height:       thumb.Bounds().Dy(),
+			MimeType:     mimeType,
+			Size:         size,
+			SHA256:       key,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Такое же превью другого вложения могло быть удалено уборщиком до сохранения ссылки
+		exists, err := t.blobs.Exists(ctx, key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := t.blobs.Put(ctx, key, bytes.NewReader(buf.Bytes())); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
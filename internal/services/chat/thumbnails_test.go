@@ -0,0 +1,145 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	chatpb "github.com/grigory222/go-chat-proto/gen/go/proto"
+	"github.com/grigory222/go-chat-server/internal/grpc/interceptors"
+)
+
+func pngBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestThumbnailerGeneratesAndNotifies(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	blobs := newMemBlobStore()
+	publisher := NewPublisher(testLogger())
+	listener := &mockSubscriber{id: 2}
+	publisher.Register(1, listener)
+
+	thumbnailer := NewThumbnailer(testLogger(), st, blobs, publisher, []int{64, 1000}, 0, 1, 4)
+	attachments := NewAttachmentService(testLogger(), st, blobs, 1<<20, thumbnailer)
+	svc := New(testLogger(), st, publisher, 10, SendLimits{})
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	uploaded, err := attachments.Upload(ctx, 1, "pic.png", "", bytes.NewReader(pngBytes(t, 300, 150)))
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+	if uploaded.Width != 300 || uploaded.Height != 150 || uploaded.MimeType != "image/png" {
+		t.Fatalf("unexpected image metadata: %+v", uploaded)
+	}
+
+	if _, err := svc.SendMessage(ctx, 1, "look", "", []int64{uploaded.Id}, 0); err != nil {
+		t.Fatalf("send error: %v", err)
+	}
+	received := len(listener.received)
+
+	// Workers start after the message is sent; Stop drains the queue
+	thumbnailer.Start()
+	thumbnailer.Stop()
+
+	stored := st.attachments[uploaded.Id]
+	// Only the 64px thumbnail: the image is already smaller than 1000px
+	if len(stored.Thumbnails) != 1 || stored.Thumbnails[0].Width != 64 || stored.Thumbnails[0].Height != 32 {
+		t.Fatalf("unexpected thumbnails: %+v", stored.Thumbnails)
+	}
+
+	if len(listener.received) != received+1 {
+		t.Fatalf("expected an update broadcast, got %d messages", len(listener.received)-received)
+	}
+	update := listener.received[len(listener.received)-1]
+	if update.Event != chatpb.MessageEvent_MESSAGE_EVENT_UPDATED || len(update.Attachments[0].Thumbnails) != 1 {
+		t.Fatalf("unexpected update event: %+v", update)
+	}
+
+	// The thumbnail can be downloaded through the attachment
+	_, rc, err := attachments.Open(ctx, uploaded.Id, stored.Thumbnails[0].ID)
+	if err != nil {
+		t.Fatalf("open thumbnail error: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width != 64 {
+		t.Fatalf("unexpected thumbnail content: %v %+v", err, cfg)
+	}
+
+	if _, _, err := attachments.Open(ctx, uploaded.Id, 12345); err == nil {
+		t.Fatalf("expected error for unknown thumbnail")
+	}
+}
+
+func TestThumbnailerEnqueue(t *testing.T) {
+	thumbnailer := NewThumbnailer(testLogger(), &mockChatStorage{}, newMemBlobStore(), NewPublisher(testLogger()), []int{64}, 0, 1, 1)
+
+	if !thumbnailer.Enqueue(1, "a") {
+		t.Fatalf("first job must be queued")
+	}
+	// Queue is full and workers are not running
+	if thumbnailer.Enqueue(2, "b") {
+		t.Fatalf("expected job to be dropped when queue is full")
+	}
+
+	thumbnailer.Start()
+	thumbnailer.Stop()
+	if thumbnailer.Enqueue(3, "c") {
+		t.Fatalf("stopped thumbnailer must not accept jobs")
+	}
+	// Stop is idempotent
+	thumbnailer.Stop()
+}
+
+// pngBomb returns a tiny PNG whose header declares w x h pixels.
+func pngBomb(t *testing.T, w, h uint32) []byte {
+	t.Helper()
+	data := pngBytes(t, 1, 1)
+	// IHDR data starts after the 8-byte signature, chunk length and type
+	binary.BigEndian.PutUint32(data[16:], w)
+	binary.BigEndian.PutUint32(data[20:], h)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestThumbnailerSkipsHugeImages(t *testing.T) {
+	st := &mockChatStorage{isUserInChat: true}
+	blobs := newMemBlobStore()
+	thumbnailer := NewThumbnailer(testLogger(), st, blobs, NewPublisher(testLogger()), []int{64}, 1_000_000, 1, 1)
+	attachments := NewAttachmentService(testLogger(), st, blobs, 1<<20, thumbnailer)
+	ctx := context.WithValue(context.Background(), interceptors.UserIDKey, int64(3))
+
+	uploaded, err := attachments.Upload(ctx, 1, "bomb.png", "", bytes.NewReader(pngBomb(t, 50000, 50000)))
+	if err != nil {
+		t.Fatalf("upload error: %v", err)
+	}
+	if uploaded.Width != 50000 || uploaded.Height != 50000 {
+		t.Fatalf("unexpected image metadata: %+v", uploaded)
+	}
+	// The image was not queued: the single queue slot is still free
+	if !thumbnailer.Enqueue(99, "x") {
+		t.Fatalf("huge image must not be queued")
+	}
+
+	// A job that bypassed the check is rejected before decoding
+	err = thumbnailer.generate(context.Background(), thumbnailJob{attachmentID: uploaded.Id, key: uploaded.Sha256})
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("expected size error, got %v", err)
+	}
+	if len(st.attachments[uploaded.Id].Thumbnails) != 0 {
+		t.Fatalf("no thumbnails expected")
+	}
+}
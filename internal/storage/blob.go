@@ -0,0 +1,15 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// BlobStore хранит содержимое вложений по ключу (hex SHA-256 содержимого).
+// Реализации должны быть идемпотентны: повторный Put того же ключа не ошибка.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+}
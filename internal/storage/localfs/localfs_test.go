@@ -0,0 +1,86 @@
+package localfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+)
+
+func key(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestStorePutGetDelete(t *testing.T) {
+	st, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	ctx := context.Background()
+	k := key("hello")
+
+	if ok, err := st.Exists(ctx, k); err != nil || ok {
+		t.Fatalf("expected missing blob: %v %v", ok, err)
+	}
+
+	if err := st.Put(ctx, k, strings.NewReader("hello")); err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+	// Repeated Put of the same key is a no-op
+	if err := st.Put(ctx, k, strings.NewReader("hello")); err != nil {
+		t.Fatalf("second Put error: %v", err)
+	}
+
+	if ok, err := st.Exists(ctx, k); err != nil || !ok {
+		t.Fatalf("expected existing blob: %v %v", ok, err)
+	}
+
+	rc, err := st.Get(ctx, k)
+	if err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "hello" {
+		t.Fatalf("unexpected content %q", data)
+	}
+
+	if err := st.Delete(ctx, k); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if _, err := st.Get(ctx, k); !errors.Is(err, models.ErrBlobNotFound) {
+		t.Fatalf("expected ErrBlobNotFound, got %v", err)
+	}
+	// Deleting a missing blob is not an error
+	if err := st.Delete(ctx, k); err != nil {
+		t.Fatalf("Delete of missing blob: %v", err)
+	}
+}
+
+func TestStoreRejectsInvalidKeys(t *testing.T) {
+	st, _ := New(t.TempDir())
+	for _, k := range []string{"", "../../etc/passwd", strings.Repeat("A", 64)} {
+		if err := st.Put(context.Background(), k, strings.NewReader("x")); err == nil {
+			t.Fatalf("expected error for key %q", k)
+		}
+	}
+}
+
+func TestStorePutCanceledContext(t *testing.T) {
+	st, _ := New(t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	k := key("data")
+	if err := st.Put(ctx, k, strings.NewReader("data")); err == nil {
+		t.Fatalf("expected error for canceled context")
+	}
+	if ok, _ := st.Exists(context.Background(), k); ok {
+		t.Fatalf("blob must not be stored after failed Put")
+	}
+}
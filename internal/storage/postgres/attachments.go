@@ -0,0 +1,280 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const attachmentColumns = `id, chat_id, uploader_id, COALESCE(message_id, 0), name, mime_type, size, sha256, width, height, created_at`
+
+// querier - общий интерфейс пула и транзакции для вспомогательных выборок.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// SaveAttachment сохраняет метаданные загруженного файла и возвращает его ID.
+// Ссылка на blob появляется под блокировкой ключа (см. DeleteOrphanBlob).
+func (s *Storage) SaveAttachment(ctx context.Context, a *models.Attachment) (int64, error) {
+	const op = "storage.postgres.SaveAttachment"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	if err := lockBlob(ctx, tx, a.SHA256); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `INSERT INTO attachments (chat_id, uploader_id, sha256, name, mime_type, size, width, height) 
+	          VALUES (@chatID, @uploaderID, @sha256, @name, @mimeType, @size, @width, @height) 
+	          RETURNING id`
+	args := pgx.NamedArgs{
+		"chatID":     a.ChatID,
+		"uploaderID": a.UploaderID,
+		"sha256":     a.SHA256,
+		"name":       a.Name,
+		"mimeType":   a.MimeType,
+		"size":       a.Size,
+		"width":      a.Width,
+		"height":     a.Height,
+	}
+
+	var id int64
+	if err := tx.QueryRow(ctx, query, args).Scan(&id); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// AttachmentByID возвращает метаданные вложения вместе с готовыми превью.
+// Вложения исчезнувших сообщений не отдаются, даже если уборщик еще не удалил их.
+func (s *Storage) AttachmentByID(ctx context.Context, id int64) (*models.Attachment, error) {
+	const op = "storage.postgres.AttachmentByID"
+
+	query := `SELECT ` + attachmentColumns + ` FROM attachments 
+	          WHERE id = @id AND (message_id IS NULL 
+	            OR EXISTS (SELECT 1 FROM messages m WHERE m.id = attachments.message_id AND ` + notExpired + `))`
+
+	a, err := scanAttachment(s.pool.QueryRow(ctx, query, pgx.NamedArgs{"id": id}))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrAttachmentNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := fillThumbnails(ctx, s.pool, []*models.Attachment{a}); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return a, nil
+}
+
+// SaveThumbnail сохраняет превью вложения. Повторное сохранение того же размера игнорируется.
+func (s *Storage) SaveThumbnail(ctx context.Context, t *models.Thumbnail) error {
+	const op = "storage.postgres.SaveThumbnail"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	if err := lockBlob(ctx, tx, t.SHA256); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `INSERT INTO attachment_thumbnails (attachment_id, width, height, mime_type, size, sha256) 
+	          VALUES (@attachmentID, @width, @height, @mimeType, @size, @sha256) 
+	          ON CONFLICT (attachment_id, width, height) DO NOTHING`
+	args := pgx.NamedArgs{
+		"attachmentID": t.AttachmentID,
+		"width":        t.Width,
+		"height":       t.Height,
+		"mimeType":     t.MimeType,
+		"size":         t.Size,
+		"sha256":       t.SHA256,
+	}
+
+	if _, err := tx.Exec(ctx, query, args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteOrphanBlob удаляет blob через deleteBlob, если на него не ссылается ни одно вложение
+// или превью, и сообщает, был ли он удален. Проверка и удаление идут под блокировкой ключа,
+// которую берут и SaveAttachment/SaveThumbnail: новая ссылка либо уже видна проверке,
+// либо появится после удаления, и тогда загрузивший заново запишет blob.
+func (s *Storage) DeleteOrphanBlob(ctx context.Context, key string, deleteBlob func(context.Context, string) error) (bool, error) {
+	const op = "storage.postgres.DeleteOrphanBlob"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	if err := lockBlob(ctx, tx, key); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var referenced bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM attachments WHERE sha256 = @key) 
+	          OR EXISTS (SELECT 1 FROM attachment_thumbnails WHERE sha256 = @key)`,
+		pgx.NamedArgs{"key": key}).Scan(&referenced)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if referenced {
+		return false, nil
+	}
+
+	if err := deleteBlob(ctx, key); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+// lockBlob берет транзакционную advisory-блокировку ключа blob-а.
+func lockBlob(ctx context.Context, tx pgx.Tx, key string) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended(@key, 0))`, pgx.NamedArgs{"key": key})
+	return err
+}
+
+// linkAttachments прикрепляет вложения к сообщению внутри транзакции SaveMessage.
+// Если хотя бы одно вложение не подходит, возвращается ErrAttachmentNotFound и транзакция откатывается.
+func linkAttachments(ctx context.Context, tx pgx.Tx, messageID, chatID, userID int64, ids []int64) ([]*models.Attachment, error) {
+	// Повтор id в запросе - не ошибка: вложение прикрепляется один раз
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	query := `UPDATE attachments SET message_id = @messageID 
+	          WHERE id = ANY(@ids) AND chat_id = @chatID AND uploader_id = @userID AND message_id IS NULL 
+	          RETURNING ` + attachmentColumns
+	args := pgx.NamedArgs{"messageID": messageID, "ids": ids, "chatID": chatID, "userID": userID}
+
+	rows, err := tx.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.Attachment, error) {
+		return scanAttachment(row)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(attachments) != len(ids) {
+		return nil, models.ErrAttachmentNotFound
+	}
+
+	if err := fillThumbnails(ctx, tx, attachments); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// fillAttachments одним запросом подгружает вложения (и их превью) для списка сообщений.
+func (s *Storage) fillAttachments(ctx context.Context, messages []*models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*models.Message, len(messages))
+	ids := make([]int64, 0, len(messages))
+	for _, msg := range messages {
+		byID[msg.ID] = msg
+		ids = append(ids, msg.ID)
+	}
+
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE message_id = ANY(@ids) ORDER BY id`
+
+	rows, err := s.pool.Query(ctx, query, pgx.NamedArgs{"ids": ids})
+	if err != nil {
+		return fmt.Errorf("failed to load attachments: %w", err)
+	}
+
+	attachments, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.Attachment, error) {
+		return scanAttachment(row)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load attachments: %w", err)
+	}
+
+	for _, a := range attachments {
+		if msg, ok := byID[a.MessageID]; ok {
+			msg.Attachments = append(msg.Attachments, a)
+		}
+	}
+
+	return fillThumbnails(ctx, s.pool, attachments)
+}
+
+// fillThumbnails подгружает готовые превью для списка вложений.
+func fillThumbnails(ctx context.Context, q querier, attachments []*models.Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*models.Attachment, len(attachments))
+	ids := make([]int64, 0, len(attachments))
+	for _, a := range attachments {
+		byID[a.ID] = a
+		ids = append(ids, a.ID)
+	}
+
+	query := `SELECT id, attachment_id, width, height, mime_type, size, sha256 
+	          FROM attachment_thumbnails WHERE attachment_id = ANY(@ids) ORDER BY width`
+
+	rows, err := q.Query(ctx, query, pgx.NamedArgs{"ids": ids})
+	if err != nil {
+		return fmt.Errorf("failed to load thumbnails: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.Thumbnail
+		if err := rows.Scan(&t.ID, &t.AttachmentID, &t.Width, &t.Height, &t.MimeType, &t.Size, &t.SHA256); err != nil {
+			return fmt.Errorf("failed to load thumbnails: %w", err)
+		}
+		if a, ok := byID[t.AttachmentID]; ok {
+			a.Thumbnails = append(a.Thumbnails, &t)
+		}
+	}
+
+	return rows.Err()
+}
+
+func scanAttachment(row pgx.Row) (*models.Attachment, error) {
+	var a models.Attachment
+	if err := row.Scan(&a.ID, &a.ChatID, &a.UploaderID, &a.MessageID, &a.Name, &a.MimeType, &a.Size, &a.SHA256, &a.Width, &a.Height, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
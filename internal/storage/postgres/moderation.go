@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// filterRule - правило модерации в колонке chat_moderation.rules.
+type filterRule struct {
+	Pattern     string              `json:"pattern"`
+	Action      models.FilterAction `json:"action"`
+	Replacement string              `json:"replacement,omitempty"`
+}
+
+// ModerationSettings возвращает настройки фильтров чата. Для чата без настроек
+// возвращаются пустые настройки.
+func (s *Storage) ModerationSettings(ctx context.Context, chatID int64) (*models.ModerationSettings, error) {
+	const op = "storage.postgres.ModerationSettings"
+
+	query := `SELECT c.id, COALESCE(m.banned_words, '{}'), COALESCE(m.banned_words_action, 'reject'), 
+	                 COALESCE(m.rules, '[]'), COALESCE(m.block_links, FALSE), COALESCE(m.max_length, 0) 
+	          FROM chats c LEFT JOIN chat_moderation m ON m.chat_id = c.id 
+	          WHERE c.id = @chatID`
+
+	var (
+		settings models.ModerationSettings
+		rules    []byte
+	)
+	err := s.pool.QueryRow(ctx, query, pgx.NamedArgs{"chatID": chatID}).Scan(
+		&settings.ChatID, &settings.BannedWords, &settings.BannedWordsAction, &rules, &settings.BlockLinks, &settings.MaxLength)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrChatNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var stored []filterRule
+	if err := json.Unmarshal(rules, &stored); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, rule := range stored {
+		settings.Rules = append(settings.Rules, models.FilterRule(rule))
+	}
+
+	return &settings, nil
+}
+
+// SetModerationSettings сохраняет настройки фильтров чата целиком.
+func (s *Storage) SetModerationSettings(ctx context.Context, settings *models.ModerationSettings) error {
+	const op = "storage.postgres.SetModerationSettings"
+
+	stored := make([]filterRule, 0, len(settings.Rules))
+	for _, rule := range settings.Rules {
+		stored = append(stored, filterRule(rule))
+	}
+	rules, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	bannedWords := settings.BannedWords
+	if bannedWords == nil {
+		bannedWords = []string{}
+	}
+	action := settings.BannedWordsAction
+	if action == "" {
+		action = models.FilterReject
+	}
+
+	query := `INSERT INTO chat_moderation (chat_id, banned_words, banned_words_action, rules, block_links, max_length) 
+	          VALUES (@chatID, @bannedWords, @action, @rules, @blockLinks, @maxLength) 
+	          ON CONFLICT (chat_id) DO UPDATE SET 
+	              banned_words = EXCLUDED.banned_words, 
+	              banned_words_action = EXCLUDED.banned_words_action, 
+	              rules = EXCLUDED.rules, 
+	              block_links = EXCLUDED.block_links, 
+	              max_length = EXCLUDED.max_length, 
+	              updated_at = NOW()`
+	args := pgx.NamedArgs{
+		"chatID":      settings.ChatID,
+		"bannedWords": bannedWords,
+		"action":      string(action),
+		"rules":       string(rules),
+		"blockLinks":  settings.BlockLinks,
+		"maxLength":   settings.MaxLength,
+	}
+
+	if _, err := s.pool.Exec(ctx, query, args); err != nil {
+		var pgErr *pgconn.PgError
+		// Код '23503' - foreign_key_violation: чата не существует
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return fmt.Errorf("%s: %w", op, models.ErrChatNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// SetMemberMute глушит участника чата до until (nil снимает мут) и записывает
+// действие модератора в журнал модерации.
+func (s *Storage) SetMemberMute(ctx context.Context, chatID, userID, moderatorID int64, until *time.Time) error {
+	const op = "storage.postgres.SetMemberMute"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	query := `UPDATE chat_users SET muted_until = @until WHERE chat_id = @chatID AND user_id = @userID`
+	args := pgx.NamedArgs{"chatID": chatID, "userID": userID, "until": until}
+
+	tag, err := tx.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrNotChatMember)
+	}
+
+	entry := &models.AuditEntry{
+		ActorID:      moderatorID,
+		ChatID:       chatID,
+		TargetUserID: userID,
+		Action:       models.AuditMemberUnmuted,
+	}
+	if until != nil {
+		entry.Action = models.AuditMemberMuted
+		entry.Details = "until " + until.UTC().Format(time.RFC3339)
+	}
+	if err := insertAudit(ctx, tx, entry); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
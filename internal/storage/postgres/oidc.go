@@ -0,0 +1,170 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CreateOIDCState сохраняет начатый вход через OpenID провайдера. Заодно удаляются
+// истекшие входы, до которых пользователи так и не дошли.
+func (s *Storage) CreateOIDCState(ctx context.Context, state *models.OIDCState) error {
+	const op = "storage.postgres.CreateOIDCState"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	if _, err := tx.Exec(ctx, `DELETE FROM oidc_login_states WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO oidc_login_states (state_hash, code_challenge, nonce, expires_at)
+	          VALUES (@stateHash, @codeChallenge, @nonce, @expiresAt)`, pgx.NamedArgs{
+		"stateHash":     state.StateHash,
+		"codeChallenge": state.CodeChallenge,
+		"nonce":         state.Nonce,
+		"expiresAt":     state.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeOIDCState погашает начатый вход. Неизвестный, истекший или уже использованный
+// state - ErrOIDCStateInvalid.
+func (s *Storage) ConsumeOIDCState(ctx context.Context, stateHash string) (*models.OIDCState, error) {
+	const op = "storage.postgres.ConsumeOIDCState"
+
+	query := `DELETE FROM oidc_login_states
+	          WHERE state_hash = @stateHash AND expires_at > NOW()
+	          RETURNING state_hash, code_challenge, nonce, expires_at`
+
+	var state models.OIDCState
+	err := s.pool.QueryRow(ctx, query, pgx.NamedArgs{"stateHash": stateHash}).
+		Scan(&state.StateHash, &state.CodeChallenge, &state.Nonce, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrOIDCStateInvalid)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &state, nil
+}
+
+// UserByIdentity возвращает пользователя, связанного с учетной записью subject у провайдера
+// issuer; если связи нет - ErrUserNotFound.
+func (s *Storage) UserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	const op = "storage.postgres.UserByIdentity"
+
+	query := `SELECT u.id, u.name, u.email, u.password_hash, u.email_verified
+	          FROM user_identities i JOIN users u ON u.id = i.user_id
+	          WHERE i.issuer = @issuer AND i.subject = @subject`
+
+	var user models.User
+	err := s.pool.QueryRow(ctx, query, pgx.NamedArgs{"issuer": issuer, "subject": subject}).
+		Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.EmailVerified)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &user, nil
+}
+
+// LinkIdentity связывает учетную запись у провайдера с существующим пользователем и помечает
+// его email подтвержденным. Если email не был подтвержден, аккаунт мог зарегистрировать
+// не владелец адреса: его пароль сбрасывается, а сессии отзываются. Возвращает ID
+// отозванных сессий.
+func (s *Storage) LinkIdentity(ctx context.Context, userID int64, issuer, subject string) ([]string, error) {
+	const op = "storage.postgres.LinkIdentity"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	args := pgx.NamedArgs{"userID": userID, "issuer": issuer, "subject": subject}
+
+	var verified bool
+	err = tx.QueryRow(ctx, `SELECT email_verified FROM users WHERE id = @userID FOR UPDATE`, args).Scan(&verified)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO user_identities (issuer, subject, user_id)
+	          VALUES (@issuer, @subject, @userID) ON CONFLICT (issuer, subject) DO NOTHING`, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var revoked []string
+	if !verified {
+		if _, err := tx.Exec(ctx, `UPDATE users SET email_verified = TRUE, password_hash = '' WHERE id = @userID`, args); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if revoked, err = revokeUserSessions(ctx, tx, userID, ""); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revoked, nil
+}
+
+// SaveOIDCUser создает пользователя без пароля с подтвержденным провайдером email
+// и связывает его с учетной записью у провайдера. Email уже занят - ErrUserExists.
+func (s *Storage) SaveOIDCUser(ctx context.Context, name, email, issuer, subject string) (int64, error) {
+	const op = "storage.postgres.SaveOIDCUser"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	args := pgx.NamedArgs{"name": name, "email": email, "issuer": issuer, "subject": subject}
+
+	var id int64
+	err = tx.QueryRow(ctx, `INSERT INTO users (name, email, password_hash, email_verified)
+	          VALUES (@name, @email, '', TRUE) RETURNING id`, args).Scan(&id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, fmt.Errorf("%s: %w", op, models.ErrUserExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	args["userID"] = id
+
+	if _, err := tx.Exec(ctx, `INSERT INTO user_identities (issuer, subject, user_id) VALUES (@issuer, @subject, @userID)`, args); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ChangePassword меняет хэш пароля и отзывает все сессии пользователя, кроме keepSessionID.
+// Возвращает ID отозванных сессий.
+func (s *Storage) ChangePassword(ctx context.Context, userID int64, passHash, keepSessionID string) ([]string, error) {
+	const op = "storage.postgres.ChangePassword"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	tag, err := tx.Exec(ctx, `UPDATE users SET password_hash = @passHash WHERE id = @userID`,
+		pgx.NamedArgs{"userID": userID, "passHash": passHash})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+	}
+
+	revoked, err := revokeUserSessions(ctx, tx, userID, keepSessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revoked, nil
+}
+
+// UpdatePasswordHash заменяет хэш того же пароля на пересчитанный. Если пароль успели
+// сменить (хэш уже не oldHash), ничего не делает.
+func (s *Storage) UpdatePasswordHash(ctx context.Context, userID int64, oldHash, newHash string) error {
+	const op = "storage.postgres.UpdatePasswordHash"
+
+	query := `UPDATE users SET password_hash = @newHash WHERE id = @userID AND password_hash = @oldHash`
+
+	_, err := s.pool.Exec(ctx, query, pgx.NamedArgs{"userID": userID, "oldHash": oldHash, "newHash": newHash})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// CreatePasswordResetToken сохраняет хэш нового токена сброса. Прежние неиспользованные
+// токены пользователя удаляются: действует только последнее письмо.
+func (s *Storage) CreatePasswordResetToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	const op = "storage.postgres.CreatePasswordResetToken"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	args := pgx.NamedArgs{"userID": userID, "tokenHash": tokenHash, "expiresAt": expiresAt}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM password_reset_tokens WHERE user_id = @userID AND used_at IS NULL`, args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO password_reset_tokens (token_hash, user_id, expires_at)
+	          VALUES (@tokenHash, @userID, @expiresAt)`, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PasswordResetSentAt возвращает время выдачи последнего токена сброса пароля
+// или нулевое время, если писем не было.
+func (s *Storage) PasswordResetSentAt(ctx context.Context, userID int64) (time.Time, error) {
+	const op = "storage.postgres.PasswordResetSentAt"
+
+	query := `SELECT MAX(created_at) FROM password_reset_tokens WHERE user_id = @userID`
+
+	var sentAt *time.Time
+	if err := s.pool.QueryRow(ctx, query, pgx.NamedArgs{"userID": userID}).Scan(&sentAt); err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if sentAt == nil {
+		return time.Time{}, nil
+	}
+
+	return *sentAt, nil
+}
+
+// ResetPassword погашает токен сброса, меняет хэш пароля и отзывает все сессии пользователя.
+// Использованный, истекший или неизвестный токен - ErrResetTokenInvalid.
+func (s *Storage) ResetPassword(ctx context.Context, tokenHash, passHash string) (int64, []string, error) {
+	const op = "storage.postgres.ResetPassword"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	args := pgx.NamedArgs{"tokenHash": tokenHash, "passHash": passHash}
+
+	// Условие в UPDATE гасит токен атомарно: из двух параллельных запросов пройдет один
+	query := `UPDATE password_reset_tokens SET used_at = NOW()
+	          WHERE token_hash = @tokenHash AND used_at IS NULL AND expires_at > NOW()
+	          RETURNING user_id`
+
+	var userID int64
+	if err := tx.QueryRow(ctx, query, args).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, fmt.Errorf("%s: %w", op, models.ErrResetTokenInvalid)
+		}
+		return 0, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	args["userID"] = userID
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET password_hash = @passHash WHERE id = @userID`, args); err != nil {
+		return 0, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	revoked, err := revokeUserSessions(ctx, tx, userID, "")
+	if err != nil {
+		return 0, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, revoked, nil
+}
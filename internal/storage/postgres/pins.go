@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// PinMessage закрепляет сообщение чата. Возвращает false, если оно уже было закреплено.
+// Строка чата блокируется на время транзакции, чтобы параллельные закрепы
+// не превысили maxPins. Исчезнувшие закрепленные сообщения в лимите не учитываются.
+func (s *Storage) PinMessage(ctx context.Context, chatID, messageID, pinnedBy int64, maxPins int) (bool, error) {
+	const op = "storage.postgres.PinMessage"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	var tmp int
+	err = tx.QueryRow(ctx, `SELECT 1 FROM chats WHERE id = @chatID FOR UPDATE`, pgx.NamedArgs{"chatID": chatID}).Scan(&tmp)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, fmt.Errorf("%s: %w", op, models.ErrChatNotFound)
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `SELECT EXISTS (SELECT 1 FROM pinned_messages WHERE message_id = m.id),
+	                 (SELECT COUNT(*) FROM pinned_messages p 
+	                  JOIN messages m ON m.id = p.message_id 
+	                  WHERE p.chat_id = @chatID AND ` + notExpired + `)
+	          FROM messages m 
+	          WHERE m.id = @messageID AND m.chat_id = @chatID AND ` + notExpired
+	args := pgx.NamedArgs{"chatID": chatID, "messageID": messageID}
+
+	var (
+		pinned bool
+		count  int
+	)
+	if err := tx.QueryRow(ctx, query, args).Scan(&pinned, &count); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, fmt.Errorf("%s: %w", op, models.ErrMessageNotFound)
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if pinned {
+		return false, nil
+	}
+	if count >= maxPins {
+		return false, fmt.Errorf("%s: %w", op, models.ErrPinLimitReached)
+	}
+
+	insert := `INSERT INTO pinned_messages (message_id, chat_id, pinned_by) VALUES (@messageID, @chatID, @pinnedBy)`
+	args["pinnedBy"] = pinnedBy
+	if _, err := tx.Exec(ctx, insert, args); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return true, nil
+}
+
+// UnpinMessage открепляет сообщение чата. Возвращает false, если оно не было закреплено.
+func (s *Storage) UnpinMessage(ctx context.Context, chatID, messageID int64) (bool, error) {
+	const op = "storage.postgres.UnpinMessage"
+
+	query := `DELETE FROM pinned_messages WHERE message_id = @messageID AND chat_id = @chatID`
+	args := pgx.NamedArgs{"chatID": chatID, "messageID": messageID}
+
+	tag, err := s.pool.Exec(ctx, query, args)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// PinnedMessages возвращает закрепленные сообщения чата, последние закрепленные первыми.
+func (s *Storage) PinnedMessages(ctx context.Context, chatID int64) ([]*models.Message, error) {
+	const op = "storage.postgres.PinnedMessages"
+
+	query := `SELECT m.id, m.chat_id, m.user_id, u.name, m.text, m.created_at, m.expires_at 
+	          FROM pinned_messages p 
+	          JOIN messages m ON m.id = p.message_id 
+	          JOIN users u ON m.user_id = u.id 
+	          WHERE p.chat_id = @chatID AND ` + notExpired + ` 
+	          ORDER BY p.pinned_at DESC, p.message_id DESC`
+
+	rows, err := s.pool.Query(ctx, query, pgx.NamedArgs{"chatID": chatID})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var messages []*models.Message
+	for rows.Next() {
+		msg := models.Message{Pinned: true}
+		if err := rows.Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.UserName, &msg.Text, &msg.CreatedAt, &msg.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		messages = append(messages, &msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.fillAttachments(ctx, messages); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return messages, nil
+}
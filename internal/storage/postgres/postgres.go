@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/grigory222/go-chat-server/internal/config"
 	"github.com/grigory222/go-chat-server/internal/domain/models"
@@ -13,6 +14,10 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// notExpired отсекает исчезнувшие сообщения прямо в запросе, чтобы они не отдавались,
+// даже если уборщик еще не успел их удалить.
+const notExpired = `(m.expires_at IS NULL OR m.expires_at > NOW())`
+
 type Storage struct {
 	pool *pgxpool.Pool
 	log  *slog.Logger
@@ -22,7 +27,7 @@ func New(ctx context.Context, cfg config.Postgres, log *slog.Logger) (*Storage,
 	const op = "storage.postgres.New"
 
 	connStr := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName, cfg.SSLMode)
+		cfg.User, string(cfg.Password), cfg.Host, cfg.Port, cfg.DBName, cfg.SSLMode)
 
 	poolConfig, err := pgxpool.ParseConfig(connStr)
 	if err != nil {
@@ -43,6 +48,10 @@ func New(ctx context.Context, cfg config.Postgres, log *slog.Logger) (*Storage,
 	poolConfig.MaxConns = cfg.MaxConns
 	poolConfig.MinConns = cfg.MinConns
 	poolConfig.ConnConfig.ConnectTimeout = cfg.ConnectTimeout
+	// Язык полнотекстового поиска читается триггером и запросами через chat_search_config()
+	if cfg.SearchConfig != "" {
+		poolConfig.ConnConfig.RuntimeParams["chat.search_config"] = cfg.SearchConfig
+	}
 
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
@@ -53,6 +62,14 @@ func New(ctx context.Context, cfg config.Postgres, log *slog.Logger) (*Storage,
 		return nil, fmt.Errorf("%s: failed to ping postgres: %w", op, err)
 	}
 
+	// Неизвестная конфигурация поиска сломала бы каждую вставку сообщения - проверяем сразу
+	if cfg.SearchConfig != "" {
+		if _, err = pool.Exec(ctx, `SELECT $1::regconfig`, cfg.SearchConfig); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("%s: invalid search config %q: %w", op, cfg.SearchConfig, err)
+		}
+	}
+
 	log.Info("connected to PostgreSQL", slog.String("db_name", cfg.DBName))
 
 	return &Storage{pool: pool, log: log}, nil
@@ -95,13 +112,13 @@ func (s *Storage) SaveUser(ctx context.Context, name, email, passHash string) (i
 func (s *Storage) UserByEmail(ctx context.Context, email string) (*models.User, error) {
 	const op = "storage.postgres.UserByEmail"
 
-	query := `SELECT id, name, email, password_hash FROM users WHERE email = @email`
+	query := `SELECT id, name, email, password_hash, email_verified FROM users WHERE email = @email`
 	args := pgx.NamedArgs{
 		"email": email,
 	}
 
 	var user models.User
-	err := s.pool.QueryRow(ctx, query, args).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash)
+	err := s.pool.QueryRow(ctx, query, args).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.EmailVerified)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
@@ -115,11 +132,11 @@ func (s *Storage) UserByEmail(ctx context.Context, email string) (*models.User,
 func (s *Storage) UserByID(ctx context.Context, id int64) (*models.User, error) {
 	const op = "storage.postgres.UserByID"
 
-	query := `SELECT id, name, email, password_hash FROM users WHERE id = @id`
+	query := `SELECT id, name, email, password_hash, email_verified FROM users WHERE id = @id`
 	args := pgx.NamedArgs{"id": id}
 
 	var user models.User
-	err := s.pool.QueryRow(ctx, query, args).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash)
+	err := s.pool.QueryRow(ctx, query, args).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.EmailVerified)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
@@ -130,12 +147,12 @@ func (s *Storage) UserByID(ctx context.Context, id int64) (*models.User, error)
 	return &user, nil
 }
 
-// CreateChat создает новый чат и возвращает его ID.
-func (s *Storage) CreateChat(ctx context.Context, name string) (int64, error) {
+// CreateChat создает новый чат указанного типа и возвращает его ID.
+func (s *Storage) CreateChat(ctx context.Context, name, chatType string) (int64, error) {
 	const op = "storage.postgres.CreateChat"
 
-	query := `INSERT INTO chats (name, type) VALUES (@name, 'public') RETURNING id` // Пока все чаты публичные
-	args := pgx.NamedArgs{"name": name}
+	query := `INSERT INTO chats (name, type) VALUES (@name, @type) RETURNING id`
+	args := pgx.NamedArgs{"name": name, "type": chatType}
 
 	var id int64
 	if err := s.pool.QueryRow(ctx, query, args).Scan(&id); err != nil {
@@ -145,14 +162,118 @@ func (s *Storage) CreateChat(ctx context.Context, name string) (int64, error) {
 	return id, nil
 }
 
-// AddUserToChat добавляет пользователя в чат.
-func (s *Storage) AddUserToChat(ctx context.Context, chatID, userID int64) error {
+// ChatByID возвращает чат по ID.
+func (s *Storage) ChatByID(ctx context.Context, chatID int64) (*models.Chat, error) {
+	const op = "storage.postgres.ChatByID"
+
+	query := `SELECT id, name, type, created_at FROM chats WHERE id = @chatID`
+
+	var chat models.Chat
+	err := s.pool.QueryRow(ctx, query, pgx.NamedArgs{"chatID": chatID}).Scan(&chat.ID, &chat.Name, &chat.Type, &chat.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrChatNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &chat, nil
+}
+
+// AddUserToChat добавляет пользователя в чат с указанной ролью.
+// Роль уже состоящего в чате пользователя не меняется.
+func (s *Storage) AddUserToChat(ctx context.Context, chatID, userID int64, role models.ChatRole) error {
 	const op = "storage.postgres.AddUserToChat"
 
-	query := `INSERT INTO chat_users (chat_id, user_id) VALUES (@chatID, @userID) ON CONFLICT DO NOTHING`
+	// Заблокированный в чате пользователь не добавляется
+	query := `INSERT INTO chat_users (chat_id, user_id, role) 
+	          SELECT @chatID, @userID, @role 
+	          WHERE NOT EXISTS (SELECT 1 FROM chat_bans WHERE chat_id = @chatID AND user_id = @userID) 
+	          ON CONFLICT DO NOTHING`
+	args := pgx.NamedArgs{"chatID": chatID, "userID": userID, "role": string(role)}
+
+	tag, err := s.pool.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil
+	}
+
+	// Ничего не вставлено: пользователь уже в чате или заблокирован
+	var banned bool
+	err = s.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM chat_bans WHERE chat_id = @chatID AND user_id = @userID)`, args).Scan(&banned)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if banned {
+		return fmt.Errorf("%s: %w", op, models.ErrBannedFromChat)
+	}
+
+	return nil
+}
+
+// ChatMemberRole возвращает роль пользователя в чате.
+func (s *Storage) ChatMemberRole(ctx context.Context, chatID, userID int64) (models.ChatRole, error) {
+	const op = "storage.postgres.ChatMemberRole"
+
+	query := `SELECT role FROM chat_users WHERE chat_id = @chatID AND user_id = @userID`
 	args := pgx.NamedArgs{"chatID": chatID, "userID": userID}
 
-	if _, err := s.pool.Exec(ctx, query, args); err != nil {
+	var role string
+	if err := s.pool.QueryRow(ctx, query, args).Scan(&role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", op, models.ErrNotChatMember)
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return models.ChatRole(role), nil
+}
+
+// SetMemberRole меняет роль участника чата и записывает действие владельца в журнал модерации.
+// Роль владельца не меняется: для него возвращается ErrAccessDenied.
+func (s *Storage) SetMemberRole(ctx context.Context, chatID, userID, ownerID int64, role models.ChatRole) error {
+	const op = "storage.postgres.SetMemberRole"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	query := `UPDATE chat_users SET role = @role WHERE chat_id = @chatID AND user_id = @userID AND role <> 'owner'`
+	args := pgx.NamedArgs{"chatID": chatID, "userID": userID, "role": string(role)}
+
+	tag, err := tx.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		// Ничего не обновлено: пользователь не в чате или он владелец
+		var member bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM chat_users WHERE chat_id = @chatID AND user_id = @userID)`, args).Scan(&member)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if member {
+			return fmt.Errorf("%s: %w", op, models.ErrAccessDenied)
+		}
+		return fmt.Errorf("%s: %w", op, models.ErrNotChatMember)
+	}
+
+	entry := &models.AuditEntry{
+		ActorID:      ownerID,
+		ChatID:       chatID,
+		TargetUserID: userID,
+		Action:       models.AuditMemberRoleChanged,
+		Details:      "role " + string(role),
+	}
+	if err := insertAudit(ctx, tx, entry); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -160,29 +281,124 @@ func (s *Storage) AddUserToChat(ctx context.Context, chatID, userID int64) error
 }
 
 // SaveMessage сохраняет новое сообщение в БД и возвращает его полную модель.
-func (s *Storage) SaveMessage(ctx context.Context, chatID, userID int64, text string) (*models.Message, error) {
+// Пустой idempotencyKey означает, что сообщение не дедуплицируется,
+// нулевой ttl - что сообщение не исчезает.
+// Вложения прикрепляются в той же транзакции: каждое должно быть загружено этим
+// пользователем в этот чат и еще не прикреплено к другому сообщению.
+// С claimSlowModeSlot сообщение сохраняется, только если медленный режим чата
+// позволяет участнику писать, иначе возвращается SlowModeError.
+func (s *Storage) SaveMessage(ctx context.Context, chatID, userID int64, text, idempotencyKey string, attachmentIDs []int64, ttl time.Duration, claimSlowModeSlot bool) (*models.Message, error) {
 	const op = "storage.postgres.SaveMessage"
 
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	// Слот медленного режима занимается в той же транзакции: если сообщение не сохранится,
+	// слот освободится вместе с откатом
+	if claimSlowModeSlot {
+		retryAt, err := claimSlot(ctx, tx, chatID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if !retryAt.IsZero() {
+			return nil, fmt.Errorf("%s: %w", op, &models.SlowModeError{RetryAt: retryAt})
+		}
+	}
+
 	// Сначала вставляем сообщение
-	query := `INSERT INTO messages (chat_id, user_id, text) VALUES (@chatID, @userID, @text) 
-	          RETURNING id, created_at`
-	args := pgx.NamedArgs{"chatID": chatID, "userID": userID, "text": text}
+	query := `INSERT INTO messages (chat_id, user_id, text, idempotency_key, expires_at) 
+	          VALUES (@chatID, @userID, @text, NULLIF(@idempotencyKey, ''), 
+	                  CASE WHEN @ttl > 0 THEN NOW() + make_interval(secs => @ttl) END) 
+	          RETURNING id, created_at, expires_at`
+	args := pgx.NamedArgs{"chatID": chatID, "userID": userID, "text": text, "idempotencyKey": idempotencyKey, "ttl": ttl.Seconds()}
 
 	var msg models.Message
 	msg.ChatID = chatID
 	msg.UserID = userID
 	msg.Text = text
 
-	if err := s.pool.QueryRow(ctx, query, args).Scan(&msg.ID, &msg.CreatedAt); err != nil {
+	if err := tx.QueryRow(ctx, query, args).Scan(&msg.ID, &msg.CreatedAt, &msg.ExpiresAt); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrMessageExists)
+		}
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	// Затем получаем имя пользователя
 	userQuery := `SELECT name FROM users WHERE id = @userID`
-	if err := s.pool.QueryRow(ctx, userQuery, pgx.NamedArgs{"userID": userID}).Scan(&msg.UserName); err != nil {
+	if err := tx.QueryRow(ctx, userQuery, pgx.NamedArgs{"userID": userID}).Scan(&msg.UserName); err != nil {
 		return nil, fmt.Errorf("%s: failed to get user name: %w", op, err)
 	}
 
+	if len(attachmentIDs) > 0 {
+		msg.Attachments, err = linkAttachments(ctx, tx, msg.ID, chatID, userID, attachmentIDs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &msg, nil
+}
+
+// MessageByID возвращает сообщение вместе с вложениями.
+func (s *Storage) MessageByID(ctx context.Context, id int64) (*models.Message, error) {
+	const op = "storage.postgres.MessageByID"
+
+	query := `SELECT m.id, m.chat_id, m.user_id, u.name, m.text, m.created_at, m.expires_at,
+	                 EXISTS (SELECT 1 FROM pinned_messages p WHERE p.message_id = m.id)
+	          FROM messages m 
+	          JOIN users u ON m.user_id = u.id 
+	          WHERE m.id = @id AND ` + notExpired
+
+	var msg models.Message
+	err := s.pool.QueryRow(ctx, query, pgx.NamedArgs{"id": id}).Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.UserName, &msg.Text, &msg.CreatedAt, &msg.ExpiresAt, &msg.Pinned)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrMessageNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.fillAttachments(ctx, []*models.Message{&msg}); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &msg, nil
+}
+
+// MessageByIdempotencyKey ищет сообщение, ранее отправленное пользователем в чат с тем же ключом.
+// Исчезнувшее сообщение не отдается, даже если уборщик его еще не удалил.
+func (s *Storage) MessageByIdempotencyKey(ctx context.Context, chatID, userID int64, idempotencyKey string) (*models.Message, error) {
+	const op = "storage.postgres.MessageByIdempotencyKey"
+
+	query := `SELECT m.id, m.chat_id, m.user_id, u.name, m.text, m.created_at, m.expires_at 
+	          FROM messages m 
+	          JOIN users u ON m.user_id = u.id 
+	          WHERE m.chat_id = @chatID AND m.user_id = @userID AND m.idempotency_key = @idempotencyKey 
+	            AND ` + notExpired
+	args := pgx.NamedArgs{"chatID": chatID, "userID": userID, "idempotencyKey": idempotencyKey}
+
+	var msg models.Message
+	err := s.pool.QueryRow(ctx, query, args).Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.UserName, &msg.Text, &msg.CreatedAt, &msg.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrMessageNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.fillAttachments(ctx, []*models.Message{&msg}); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return &msg, nil
 }
 
@@ -190,10 +406,11 @@ func (s *Storage) SaveMessage(ctx context.Context, chatID, userID int64, text st
 func (s *Storage) GetChatHistory(ctx context.Context, chatID int64, limit, offset uint64) ([]*models.Message, error) {
 	const op = "storage.postgres.GetChatHistory"
 
-	query := `SELECT m.id, m.chat_id, m.user_id, u.name, m.text, m.created_at 
+	query := `SELECT m.id, m.chat_id, m.user_id, u.name, m.text, m.created_at, m.expires_at,
+	                 EXISTS (SELECT 1 FROM pinned_messages p WHERE p.message_id = m.id)
 	          FROM messages m 
 	          JOIN users u ON m.user_id = u.id 
-	          WHERE m.chat_id = @chatID 
+	          WHERE m.chat_id = @chatID AND ` + notExpired + ` 
 	          ORDER BY m.created_at DESC LIMIT @limit OFFSET @offset`
 	args := pgx.NamedArgs{"chatID": chatID, "limit": limit, "offset": offset}
 
@@ -206,7 +423,7 @@ func (s *Storage) GetChatHistory(ctx context.Context, chatID int64, limit, offse
 	var messages []*models.Message
 	for rows.Next() {
 		var msg models.Message
-		if err := rows.Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.UserName, &msg.Text, &msg.CreatedAt); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.UserName, &msg.Text, &msg.CreatedAt, &msg.ExpiresAt, &msg.Pinned); err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 		messages = append(messages, &msg)
@@ -216,6 +433,10 @@ func (s *Storage) GetChatHistory(ctx context.Context, chatID int64, limit, offse
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := s.fillAttachments(ctx, messages); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return messages, nil
 }
 
@@ -237,3 +458,34 @@ func (s *Storage) IsUserInChat(ctx context.Context, userID, chatID int64) (bool,
 
 	return true, nil
 }
+
+// ChatMember возвращает роль пользователя в чате вместе с типом чата.
+func (s *Storage) ChatMember(ctx context.Context, chatID, userID int64) (*models.ChatMember, error) {
+	const op = "storage.postgres.ChatMember"
+
+	query := `SELECT cu.role, c.type, cu.muted_until, c.slow_mode_seconds FROM chat_users cu JOIN chats c ON c.id = cu.chat_id 
+	          WHERE cu.chat_id = @chatID AND cu.user_id = @userID`
+	args := pgx.NamedArgs{"chatID": chatID, "userID": userID}
+
+	member := models.ChatMember{ChatID: chatID, UserID: userID}
+	var role string
+	var slowModeSeconds int
+	if err := s.pool.QueryRow(ctx, query, args).Scan(&role, &member.ChatType, &member.MutedUntil, &slowModeSeconds); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrNotChatMember)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	member.Role = models.ChatRole(role)
+	member.SlowMode = time.Duration(slowModeSeconds) * time.Second
+
+	return &member, nil
+}
+
+// nullTime превращает нулевое время в NULL для необязательных фильтров.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,328 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const reportColumns = `r.id, COALESCE(r.message_id, 0), r.chat_id, COALESCE(r.reporter_id, 0), COALESCE(r.author_id, 0),
+	       r.reason, r.message_text, r.status, COALESCE(r.claimed_by, 0), r.claimed_at,
+	       COALESCE(r.resolution, ''), COALESCE(r.resolved_by, 0), r.resolved_at, r.created_at`
+
+func scanReport(row pgx.Row) (*models.Report, error) {
+	var report models.Report
+	err := row.Scan(&report.ID, &report.MessageID, &report.ChatID, &report.ReporterID, &report.AuthorID,
+		&report.Reason, &report.MessageText, &report.Status, &report.ClaimedBy, &report.ClaimedAt,
+		&report.Resolution, &report.ResolvedBy, &report.ResolvedAt, &report.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// IsServerAdmin сообщает, является ли пользователь администратором сервера.
+func (s *Storage) IsServerAdmin(ctx context.Context, userID int64) (bool, error) {
+	const op = "storage.postgres.IsServerAdmin"
+
+	var admin bool
+	err := s.pool.QueryRow(ctx, `SELECT is_admin FROM users WHERE id = @userID`, pgx.NamedArgs{"userID": userID}).Scan(&admin)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, fmt.Errorf("%s: %w", op, models.ErrUserNotFound)
+		}
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return admin, nil
+}
+
+// CreateReport сохраняет жалобу на сообщение вместе с копией его текста и автора
+// и записывает ее в журнал модерации.
+func (s *Storage) CreateReport(ctx context.Context, messageID, reporterID int64, reason string) (*models.Report, error) {
+	const op = "storage.postgres.CreateReport"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	query := `INSERT INTO message_reports AS r (message_id, chat_id, reporter_id, author_id, reason, message_text)
+	          SELECT m.id, m.chat_id, @reporterID, m.user_id, @reason, m.text
+	          FROM messages m WHERE m.id = @messageID AND ` + notExpired + `
+	          RETURNING ` + reportColumns
+	args := pgx.NamedArgs{"messageID": messageID, "reporterID": reporterID, "reason": reason}
+
+	report, err := scanReport(tx.QueryRow(ctx, query, args))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrMessageNotFound)
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrReportExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = insertAudit(ctx, tx, &models.AuditEntry{
+		ActorID:      reporterID,
+		ChatID:       report.ChatID,
+		ReportID:     report.ID,
+		TargetUserID: report.AuthorID,
+		MessageID:    report.MessageID,
+		Action:       models.AuditReportCreated,
+		Details:      reason,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return report, nil
+}
+
+// ReportByID возвращает жалобу по ID.
+func (s *Storage) ReportByID(ctx context.Context, id int64) (*models.Report, error) {
+	const op = "storage.postgres.ReportByID"
+
+	report, err := scanReport(s.pool.QueryRow(ctx, `SELECT `+reportColumns+` FROM message_reports r WHERE r.id = @id`,
+		pgx.NamedArgs{"id": id}))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrReportNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return report, nil
+}
+
+// Reports возвращает жалобы по фильтру, старые первыми.
+func (s *Storage) Reports(ctx context.Context, filter models.ReportFilter, limit, offset uint64) ([]*models.Report, error) {
+	const op = "storage.postgres.Reports"
+
+	query := `SELECT ` + reportColumns + ` FROM message_reports r
+	          WHERE (@chatID = 0 OR r.chat_id = @chatID)
+	            AND ((@status = '' AND r.status <> 'resolved') OR r.status = @status)
+	            AND (@moderatorID = 0 OR r.chat_id IN (
+	                SELECT chat_id FROM chat_users WHERE user_id = @moderatorID AND role IN ('owner', 'admin')))
+	          ORDER BY r.created_at, r.id
+	          LIMIT @limit OFFSET @offset`
+	args := pgx.NamedArgs{
+		"chatID":      filter.ChatID,
+		"status":      string(filter.Status),
+		"moderatorID": filter.ModeratorID,
+		"limit":       limit,
+		"offset":      offset,
+	}
+
+	rows, err := s.pool.Query(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	reports, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.Report, error) {
+		return scanReport(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return reports, nil
+}
+
+// ClaimReport закрепляет жалобу за модератором. Жалобу, захваченную другим модератором
+// больше claimTTL назад, можно перехватить.
+func (s *Storage) ClaimReport(ctx context.Context, id, moderatorID int64, claimTTL time.Duration) (*models.Report, error) {
+	const op = "storage.postgres.ClaimReport"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	query := `UPDATE message_reports r SET status = 'claimed', claimed_by = @moderatorID, claimed_at = NOW()
+	          WHERE r.id = @id AND ` + claimable + `
+	          RETURNING ` + reportColumns
+	args := pgx.NamedArgs{"id": id, "moderatorID": moderatorID, "claimTTL": claimTTL.Seconds()}
+
+	report, err := scanReport(tx.QueryRow(ctx, query, args))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, unclaimableReason(ctx, tx, id))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = insertAudit(ctx, tx, &models.AuditEntry{
+		ActorID:  moderatorID,
+		ChatID:   report.ChatID,
+		ReportID: report.ID,
+		Action:   models.AuditReportClaimed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return report, nil
+}
+
+// ResolveReport закрывает жалобу и в той же транзакции применяет решение:
+// скрывает сообщение, глушит или блокирует автора и пишет запись в журнал.
+// Удаленное сообщение перестает отдаваться сразу, а физически его вместе с вложениями
+// удаляет уборщик исчезающих сообщений, он же рассылает событие DELETED.
+func (s *Storage) ResolveReport(ctx context.Context, res *models.ReportResolution) (*models.Report, error) {
+	const op = "storage.postgres.ResolveReport"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	query := `UPDATE message_reports r
+	          SET status = 'resolved', resolution = @resolution, resolved_by = @moderatorID, resolved_at = NOW()
+	          WHERE r.id = @id AND ` + claimable + `
+	          RETURNING ` + reportColumns
+	args := pgx.NamedArgs{
+		"id":          res.ReportID,
+		"moderatorID": res.ModeratorID,
+		"resolution":  string(res.Resolution),
+		"claimTTL":    res.ClaimTTL.Seconds(),
+	}
+
+	report, err := scanReport(tx.QueryRow(ctx, query, args))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, unclaimableReason(ctx, tx, res.ReportID))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	details := string(res.Resolution)
+	target := pgx.NamedArgs{"chatID": report.ChatID, "userID": report.AuthorID, "messageID": report.MessageID}
+	switch res.Resolution {
+	case models.ResolutionDeleteMessage:
+		// Сообщение могло быть уже удалено - тогда делать нечего
+		_, err = tx.Exec(ctx, `UPDATE messages SET expires_at = NOW()
+		          WHERE id = @messageID AND (expires_at IS NULL OR expires_at > NOW())`, target)
+	case models.ResolutionMuteUser:
+		details += " until " + res.MuteUntil.UTC().Format(time.RFC3339)
+		target["until"] = res.MuteUntil
+		var tag pgconn.CommandTag
+		tag, err = tx.Exec(ctx, `UPDATE chat_users SET muted_until = @until WHERE chat_id = @chatID AND user_id = @userID`, target)
+		if err == nil && tag.RowsAffected() == 0 {
+			err = models.ErrNotChatMember
+		}
+	case models.ResolutionBanUser:
+		target["bannedBy"] = res.ModeratorID
+		if _, err = tx.Exec(ctx, `DELETE FROM chat_users WHERE chat_id = @chatID AND user_id = @userID`, target); err == nil {
+			_, err = tx.Exec(ctx, `INSERT INTO chat_bans (chat_id, user_id, banned_by) VALUES (@chatID, @userID, @bannedBy)
+			          ON CONFLICT DO NOTHING`, target)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = insertAudit(ctx, tx, &models.AuditEntry{
+		ActorID:      res.ModeratorID,
+		ChatID:       report.ChatID,
+		ReportID:     report.ID,
+		TargetUserID: report.AuthorID,
+		MessageID:    report.MessageID,
+		Action:       models.AuditReportResolved,
+		Details:      details,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return report, nil
+}
+
+// ModerationAudit возвращает журнал модерации чата (все чаты при chatID = 0), новые записи первыми.
+func (s *Storage) ModerationAudit(ctx context.Context, chatID int64, limit, offset uint64) ([]*models.AuditEntry, error) {
+	const op = "storage.postgres.ModerationAudit"
+
+	query := `SELECT id, COALESCE(actor_id, 0), COALESCE(chat_id, 0), COALESCE(report_id, 0),
+	                 COALESCE(target_user_id, 0), COALESCE(message_id, 0), action, details, created_at
+	          FROM moderation_audit
+	          WHERE (@chatID = 0 OR chat_id = @chatID)
+	          ORDER BY created_at DESC, id DESC
+	          LIMIT @limit OFFSET @offset`
+	args := pgx.NamedArgs{"chatID": chatID, "limit": limit, "offset": offset}
+
+	rows, err := s.pool.Query(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.AuditEntry, error) {
+		var entry models.AuditEntry
+		err := row.Scan(&entry.ID, &entry.ActorID, &entry.ChatID, &entry.ReportID,
+			&entry.TargetUserID, &entry.MessageID, &entry.Action, &entry.Details, &entry.CreatedAt)
+		return &entry, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return entries, nil
+}
+
+// claimable - условие, при котором модератор @moderatorID может захватить или закрыть жалобу:
+// она не решена и не захвачена другим модератором (или захват устарел).
+const claimable = `r.status <> 'resolved' AND (r.status = 'open' OR r.claimed_by IS NULL OR r.claimed_by = @moderatorID
+	               OR r.claimed_at <= NOW() - make_interval(secs => @claimTTL))`
+
+// unclaimableReason объясняет, почему жалобу не удалось захватить или закрыть.
+func unclaimableReason(ctx context.Context, tx pgx.Tx, id int64) error {
+	var status string
+	err := tx.QueryRow(ctx, `SELECT status FROM message_reports WHERE id = @id`, pgx.NamedArgs{"id": id}).Scan(&status)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return models.ErrReportNotFound
+	case err != nil:
+		return err
+	case status == string(models.ReportResolved):
+		return models.ErrReportResolved
+	}
+	return models.ErrReportClaimed
+}
+
+// insertAudit добавляет запись в журнал модерации в транзакции вызывающего.
+func insertAudit(ctx context.Context, tx pgx.Tx, entry *models.AuditEntry) error {
+	query := `INSERT INTO moderation_audit (actor_id, chat_id, report_id, target_user_id, message_id, action, details)
+	          VALUES (NULLIF(@actorID, 0), NULLIF(@chatID, 0), NULLIF(@reportID, 0),
+	                  NULLIF(@targetUserID, 0), NULLIF(@messageID, 0), @action, @details)`
+	args := pgx.NamedArgs{
+		"actorID":      entry.ActorID,
+		"chatID":       entry.ChatID,
+		"reportID":     entry.ReportID,
+		"targetUserID": entry.TargetUserID,
+		"messageID":    entry.MessageID,
+		"action":       entry.Action,
+		"details":      entry.Details,
+	}
+
+	_, err := tx.Exec(ctx, query, args)
+	return err
+}
@@ -0,0 +1,330 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// RetentionPolicy возвращает срок хранения сообщений чата.
+func (s *Storage) RetentionPolicy(ctx context.Context, chatID int64) (*models.RetentionPolicy, error) {
+	const op = "storage.postgres.RetentionPolicy"
+
+	query := `SELECT id, COALESCE(retention_days, 0), legal_hold FROM chats WHERE id = @chatID`
+
+	var policy models.RetentionPolicy
+	err := s.pool.QueryRow(ctx, query, pgx.NamedArgs{"chatID": chatID}).Scan(&policy.ChatID, &policy.RetentionDays, &policy.LegalHold)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrChatNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &policy, nil
+}
+
+// SetRetentionPolicy сохраняет срок хранения и флаг legal hold чата. Включение и снятие
+// legal hold записываются в журнал модерации от имени actorID.
+func (s *Storage) SetRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy, actorID int64) error {
+	const op = "storage.postgres.SetRetentionPolicy"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	// Прежнее значение legal hold берется под блокировкой строки чата
+	query := `UPDATE chats c SET retention_days = NULLIF(@retentionDays, 0), legal_hold = @legalHold 
+	          FROM (SELECT id, legal_hold FROM chats WHERE id = @chatID FOR UPDATE) old 
+	          WHERE c.id = old.id 
+	          RETURNING old.legal_hold`
+	args := pgx.NamedArgs{"chatID": policy.ChatID, "retentionDays": policy.RetentionDays, "legalHold": policy.LegalHold}
+
+	var wasHeld bool
+	if err := tx.QueryRow(ctx, query, args).Scan(&wasHeld); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, models.ErrChatNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if wasHeld != policy.LegalHold {
+		entry := &models.AuditEntry{ActorID: actorID, ChatID: policy.ChatID, Action: models.AuditLegalHoldReleased}
+		if policy.LegalHold {
+			entry.Action = models.AuditLegalHoldSet
+		}
+		if err := insertAudit(ctx, tx, entry); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ActiveRetentionPolicies возвращает чаты, в которых сейчас нужно удалять устаревшие сообщения.
+func (s *Storage) ActiveRetentionPolicies(ctx context.Context) ([]*models.RetentionPolicy, error) {
+	const op = "storage.postgres.ActiveRetentionPolicies"
+
+	query := `SELECT id, retention_days, legal_hold FROM chats 
+	          WHERE retention_days IS NOT NULL AND NOT legal_hold 
+	          ORDER BY id`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var policies []*models.RetentionPolicy
+	for rows.Next() {
+		var policy models.RetentionPolicy
+		if err := rows.Scan(&policy.ChatID, &policy.RetentionDays, &policy.LegalHold); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		policies = append(policies, &policy)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return policies, nil
+}
+
+// PurgeExpiredMessages удаляет до limit сообщений чата старше срока хранения вместе с их
+// вложениями и превью, а также неприкрепленные вложения того же возраста.
+// Каждая порция - отдельная короткая транзакция; строки, занятые другими транзакциями,
+// пропускаются (SKIP LOCKED) и будут удалены следующим проходом.
+// Политика перечитывается под блокировкой строки чата, поэтому включенный legal hold
+// останавливает удаление сразу.
+func (s *Storage) PurgeExpiredMessages(ctx context.Context, chatID int64, limit int) (*models.PurgeBatch, error) {
+	const op = "storage.postgres.PurgeExpiredMessages"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	var (
+		retentionDays *int
+		legalHold     bool
+	)
+	err = tx.QueryRow(ctx, `SELECT retention_days, legal_hold FROM chats WHERE id = @chatID FOR SHARE`,
+		pgx.NamedArgs{"chatID": chatID}).Scan(&retentionDays, &legalHold)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrChatNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if retentionDays == nil || legalHold {
+		return &models.PurgeBatch{}, nil
+	}
+
+	args := pgx.NamedArgs{"chatID": chatID, "days": *retentionDays, "limit": limit}
+
+	messageIDs, err := collectIDs(ctx, tx, `SELECT id FROM messages 
+	          WHERE chat_id = @chatID AND created_at < NOW() - make_interval(days => @days) 
+	          ORDER BY created_at LIMIT @limit 
+	          FOR UPDATE SKIP LOCKED`, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Давно загруженные, но так и не отправленные вложения
+	unlinkedIDs, err := collectIDs(ctx, tx, `SELECT id FROM attachments 
+	          WHERE chat_id = @chatID AND message_id IS NULL AND created_at < NOW() - make_interval(days => @days) 
+	          LIMIT @limit 
+	          FOR UPDATE SKIP LOCKED`, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	batch, err := deleteMessages(ctx, tx, messageIDs, unlinkedIDs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return batch, nil
+}
+
+// SavePurgeRun записывает в журнал результат удаления по сроку хранения.
+func (s *Storage) SavePurgeRun(ctx context.Context, run *models.PurgeRun) error {
+	const op = "storage.postgres.SavePurgeRun"
+
+	query := `INSERT INTO purge_runs (chat_id, retention_days, started_at, finished_at, 
+	                                  messages_deleted, attachments_deleted, blobs_deleted, error) 
+	          VALUES (@chatID, @retentionDays, @startedAt, @finishedAt, 
+	                  @messages, @attachments, @blobs, NULLIF(@error, ''))`
+	args := pgx.NamedArgs{
+		"chatID":        run.ChatID,
+		"retentionDays": run.RetentionDays,
+		"startedAt":     run.StartedAt,
+		"finishedAt":    run.FinishedAt,
+		"messages":      run.MessagesDeleted,
+		"attachments":   run.AttachmentsDeleted,
+		"blobs":         run.BlobsDeleted,
+		"error":         run.Error,
+	}
+
+	if _, err := s.pool.Exec(ctx, query, args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredMessages удаляет до limit исчезнувших сообщений вместе с вложениями.
+// В Deleted возвращаются ID и чаты удаленных сообщений для рассылки событий удаления.
+// В чатах под legal hold сообщения не удаляются, а только помечаются deleted_notified:
+// событие удаления по ним рассылается один раз, и повторно они не выбираются.
+func (s *Storage) DeleteExpiredMessages(ctx context.Context, limit int) (*models.PurgeBatch, error) {
+	const op = "storage.postgres.DeleteExpiredMessages"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	// Строка чата блокируется на чтение, как и в PurgeExpiredMessages: legal hold,
+	// включенный параллельно, дождется фиксации этой порции
+	rows, err := tx.Query(ctx, `SELECT m.id, m.chat_id, c.legal_hold FROM messages m 
+	          JOIN chats c ON c.id = m.chat_id 
+	          WHERE m.expires_at <= NOW() AND (NOT c.legal_hold OR NOT m.deleted_notified) 
+	          ORDER BY m.expires_at LIMIT @limit 
+	          FOR UPDATE OF m SKIP LOCKED 
+	          FOR SHARE OF c SKIP LOCKED`, pgx.NamedArgs{"limit": limit})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var expired []*models.Message
+	var messageIDs, heldIDs []int64
+	for rows.Next() {
+		var msg models.Message
+		var held bool
+		if err := rows.Scan(&msg.ID, &msg.ChatID, &held); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		expired = append(expired, &msg)
+		if held {
+			heldIDs = append(heldIDs, msg.ID)
+		} else {
+			messageIDs = append(messageIDs, msg.ID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(heldIDs) > 0 {
+		_, err := tx.Exec(ctx, `UPDATE messages SET deleted_notified = TRUE WHERE id = ANY(@ids)`,
+			pgx.NamedArgs{"ids": heldIDs})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	batch, err := deleteMessages(ctx, tx, messageIDs, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	batch.Deleted = expired
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return batch, nil
+}
+
+// deleteMessages удаляет заблокированные вызывающим сообщения, их вложения с превью и
+// дополнительные вложения extraAttachmentIDs. Возвращает blob-ы, оставшиеся без ссылок.
+func deleteMessages(ctx context.Context, tx pgx.Tx, messageIDs, extraAttachmentIDs []int64) (*models.PurgeBatch, error) {
+	batch := &models.PurgeBatch{}
+	if len(messageIDs) == 0 && len(extraAttachmentIDs) == 0 {
+		return batch, nil
+	}
+
+	// Сами сообщения уже заблокированы, а прикрепленные вложения больше никто не меняет
+	attachmentIDs, err := collectIDs(ctx, tx, `SELECT id FROM attachments WHERE message_id = ANY(@messageIDs)`,
+		pgx.NamedArgs{"messageIDs": messageIDs})
+	if err != nil {
+		return nil, err
+	}
+	attachmentIDs = append(attachmentIDs, extraAttachmentIDs...)
+	args := pgx.NamedArgs{"messageIDs": messageIDs, "attachmentIDs": attachmentIDs}
+
+	var keys []string
+	if len(attachmentIDs) > 0 {
+		rows, err := tx.Query(ctx, `SELECT sha256 FROM attachment_thumbnails WHERE attachment_id = ANY(@attachmentIDs) 
+		          UNION 
+		          SELECT sha256 FROM attachments WHERE id = ANY(@attachmentIDs)`, args)
+		if err != nil {
+			return nil, err
+		}
+		keys, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, err
+		}
+
+		// Превью удаляются каскадно
+		tag, err := tx.Exec(ctx, `DELETE FROM attachments WHERE id = ANY(@attachmentIDs)`, args)
+		if err != nil {
+			return nil, err
+		}
+		batch.Attachments = int(tag.RowsAffected())
+	}
+
+	if len(messageIDs) > 0 {
+		tag, err := tx.Exec(ctx, `DELETE FROM messages WHERE id = ANY(@messageIDs)`, args)
+		if err != nil {
+			return nil, err
+		}
+		batch.Messages = int(tag.RowsAffected())
+	}
+
+	// Одинаковое содержимое хранится один раз - blob можно удалять, только если
+	// на него не ссылается ни одно оставшееся вложение или превью. Это предварительный
+	// отбор: перед удалением ссылки перепроверяются в DeleteOrphanBlob
+	if len(keys) > 0 {
+		rows, err := tx.Query(ctx, `SELECT k FROM unnest(@keys::text[]) AS k 
+		          WHERE NOT EXISTS (SELECT 1 FROM attachments WHERE sha256 = k) 
+		            AND NOT EXISTS (SELECT 1 FROM attachment_thumbnails WHERE sha256 = k)`,
+			pgx.NamedArgs{"keys": keys})
+		if err != nil {
+			return nil, err
+		}
+		batch.OrphanBlobs, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return batch, nil
+}
+
+func collectIDs(ctx context.Context, tx pgx.Tx, query string, args pgx.NamedArgs) ([]int64, error) {
+	rows, err := tx.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
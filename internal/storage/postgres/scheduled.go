@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const scheduledColumns = `id, chat_id, user_id, text, send_at, created_at`
+
+// notClaimed - строка не захвачена планировщиком (или аренда истекла).
+// Такие отложенные сообщения еще можно менять и отменять.
+const notClaimed = `(claimed_until IS NULL OR claimed_until < NOW())`
+
+// SaveScheduledMessage сохраняет отложенное сообщение.
+func (s *Storage) SaveScheduledMessage(ctx context.Context, chatID, userID int64, text string, sendAt time.Time) (*models.ScheduledMessage, error) {
+	const op = "storage.postgres.SaveScheduledMessage"
+
+	query := `INSERT INTO scheduled_messages (chat_id, user_id, text, send_at) 
+	          VALUES (@chatID, @userID, @text, @sendAt) 
+	          RETURNING ` + scheduledColumns
+	args := pgx.NamedArgs{"chatID": chatID, "userID": userID, "text": text, "sendAt": sendAt}
+
+	msg, err := scanScheduled(s.pool.QueryRow(ctx, query, args))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return msg, nil
+}
+
+// ScheduledMessages возвращает ожидающие отправки сообщения пользователя.
+// chatID = 0 означает все чаты.
+func (s *Storage) ScheduledMessages(ctx context.Context, userID, chatID int64) ([]*models.ScheduledMessage, error) {
+	const op = "storage.postgres.ScheduledMessages"
+
+	query := `SELECT ` + scheduledColumns + ` 
+	          FROM scheduled_messages 
+	          WHERE user_id = @userID AND status = 'pending' AND (@chatID = 0 OR chat_id = @chatID) 
+	          ORDER BY send_at, id`
+	args := pgx.NamedArgs{"userID": userID, "chatID": chatID}
+
+	rows, err := s.pool.Query(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var messages []*models.ScheduledMessage
+	for rows.Next() {
+		msg, err := scanScheduled(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return messages, nil
+}
+
+// UpdateScheduledMessage меняет текст и время отправки ожидающего сообщения пользователя.
+// Сообщение, которое планировщик уже отправляет, изменить нельзя.
+func (s *Storage) UpdateScheduledMessage(ctx context.Context, id, userID int64, text string, sendAt time.Time) (*models.ScheduledMessage, error) {
+	const op = "storage.postgres.UpdateScheduledMessage"
+
+	query := `UPDATE scheduled_messages SET text = @text, send_at = @sendAt 
+	          WHERE id = @id AND user_id = @userID AND status = 'pending' AND ` + notClaimed + ` 
+	          RETURNING ` + scheduledColumns
+	args := pgx.NamedArgs{"id": id, "userID": userID, "text": text, "sendAt": sendAt}
+
+	msg, err := scanScheduled(s.pool.QueryRow(ctx, query, args))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrScheduledNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return msg, nil
+}
+
+// DeleteScheduledMessage отменяет ожидающее сообщение пользователя.
+func (s *Storage) DeleteScheduledMessage(ctx context.Context, id, userID int64) error {
+	const op = "storage.postgres.DeleteScheduledMessage"
+
+	query := `DELETE FROM scheduled_messages 
+	          WHERE id = @id AND user_id = @userID AND status = 'pending' AND ` + notClaimed
+	args := pgx.NamedArgs{"id": id, "userID": userID}
+
+	tag, err := s.pool.Exec(ctx, query, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrScheduledNotFound)
+	}
+
+	return nil
+}
+
+// ClaimDueScheduledMessages захватывает до limit созревших сообщений на время lease.
+// SKIP LOCKED позволяет нескольким инстансам разбирать очередь параллельно, не блокируя
+// друг друга. Если инстанс упал, не завершив отправку, после истечения аренды сообщение
+// захватит другой.
+func (s *Storage) ClaimDueScheduledMessages(ctx context.Context, lease time.Duration, limit int) ([]*models.ScheduledMessage, error) {
+	const op = "storage.postgres.ClaimDueScheduledMessages"
+
+	query := `WITH due AS (
+	              SELECT id FROM scheduled_messages 
+	              WHERE status = 'pending' AND send_at <= NOW() AND ` + notClaimed + ` 
+	              ORDER BY send_at 
+	              LIMIT @limit 
+	              FOR UPDATE SKIP LOCKED
+	          )
+	          UPDATE scheduled_messages s SET claimed_until = NOW() + make_interval(secs => @lease) 
+	          FROM due WHERE s.id = due.id 
+	          RETURNING s.id, s.chat_id, s.user_id, s.text, s.send_at, s.created_at`
+	args := pgx.NamedArgs{"limit": limit, "lease": lease.Seconds()}
+
+	rows, err := s.pool.Query(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var messages []*models.ScheduledMessage
+	for rows.Next() {
+		msg, err := scanScheduled(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return messages, nil
+}
+
+// FinishScheduledMessage завершает обработку захваченного сообщения.
+// messageID = 0 означает, что отправка невозможна (например, автор покинул чат).
+func (s *Storage) FinishScheduledMessage(ctx context.Context, id, messageID int64) error {
+	const op = "storage.postgres.FinishScheduledMessage"
+
+	query := `UPDATE scheduled_messages 
+	          SET status = CASE WHEN @messageID = 0 THEN 'failed' ELSE 'sent' END, 
+	              message_id = NULLIF(@messageID, 0), 
+	              claimed_until = NULL 
+	          WHERE id = @id`
+	args := pgx.NamedArgs{"id": id, "messageID": messageID}
+
+	if _, err := s.pool.Exec(ctx, query, args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func scanScheduled(row pgx.Row) (*models.ScheduledMessage, error) {
+	var msg models.ScheduledMessage
+	if err := row.Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.Text, &msg.SendAt, &msg.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
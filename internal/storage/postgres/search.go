@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// SearchMessages ищет сообщения по тексту в чатах, где состоит userID.
+// Результаты отсортированы по релевантности. Snippet - безопасный HTML: текст сообщения
+// экранирован, совпадения выделены тегами <b></b>.
+func (s *Storage) SearchMessages(ctx context.Context, userID int64, query string, filter models.SearchFilter, limit, offset uint64) ([]*models.SearchResult, error) {
+	const op = "storage.postgres.SearchMessages"
+
+	sqlQuery := `SELECT m.id, m.chat_id, m.user_id, u.name, m.text, m.created_at, m.expires_at,
+	                    ts_rank_cd(m.search_vector, q) AS rank,
+	                    ts_headline(chat_search_config(), m.text, q,
+	                                'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=2, MaxWords=20, MinWords=5') AS snippet
+	             FROM messages m
+	             JOIN users u ON m.user_id = u.id
+	             JOIN chat_users cu ON cu.chat_id = m.chat_id AND cu.user_id = @userID,
+	                  websearch_to_tsquery(chat_search_config(), @query) q
+	             WHERE m.search_vector @@ q
+	               AND ` + notExpired + `
+	               AND (@chatID = 0 OR m.chat_id = @chatID)
+	               AND (@authorID = 0 OR m.user_id = @authorID)
+	               AND (@from::timestamp IS NULL OR m.created_at >= @from)
+	               AND (@to::timestamp IS NULL OR m.created_at <= @to)
+	             ORDER BY rank DESC, m.created_at DESC
+	             LIMIT @limit OFFSET @offset`
+	args := pgx.NamedArgs{
+		"userID":   userID,
+		"query":    query,
+		"chatID":   filter.ChatID,
+		"authorID": filter.AuthorID,
+		"from":     nullTime(filter.From),
+		"to":       nullTime(filter.To),
+		"limit":    limit,
+		"offset":   offset,
+	}
+
+	rows, err := s.pool.Query(ctx, sqlQuery, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var results []*models.SearchResult
+	for rows.Next() {
+		var msg models.Message
+		res := models.SearchResult{Message: &msg}
+		if err := rows.Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.UserName, &msg.Text, &msg.CreatedAt, &msg.ExpiresAt, &res.Rank, &res.Snippet); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		res.Snippet = snippetHTML(res.Snippet)
+		results = append(results, &res)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	messages := make([]*models.Message, len(results))
+	for i, res := range results {
+		messages[i] = res.Message
+	}
+	if err := s.fillAttachments(ctx, messages); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return results, nil
+}
+
+// Маркеры совпадений, которые ts_headline ставит вместо HTML-тегов: сам текст
+// сообщения может содержать разметку, поэтому теги добавляются только после экранирования
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+// snippetReplacer экранирует текст фрагмента и заменяет маркеры совпадений на теги.
+var snippetReplacer = strings.NewReplacer(
+	"&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&#34;", "'", "&#39;",
+	snippetStart, "<b>", snippetStop, "</b>",
+)
+
+// snippetHTML превращает результат ts_headline в HTML, безопасный для вывода клиентом.
+func snippetHTML(snippet string) string {
+	return snippetReplacer.Replace(snippet)
+}
@@ -0,0 +1,199 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateSession сохраняет новую сессию входа вместе с ее первым refresh токеном.
+// Заодно удаляются истекшие сессии пользователя.
+func (s *Storage) CreateSession(ctx context.Context, session *models.Session, refreshID string) error {
+	const op = "storage.postgres.CreateSession"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	args := pgx.NamedArgs{
+		"id":        session.ID,
+		"userID":    session.UserID,
+		"userAgent": session.UserAgent,
+		"ip":        session.IP,
+		"expiresAt": session.ExpiresAt,
+		"jti":       refreshID,
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM auth_sessions WHERE user_id = @userID AND expires_at <= NOW()`, args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO auth_sessions (id, user_id, user_agent, ip, expires_at)
+	          VALUES (@id, @userID, @userAgent, @ip, @expiresAt)`, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO refresh_tokens (jti, session_id, expires_at) VALUES (@jti, @id, @expiresAt)`, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken помечает refresh токен oldID использованным и выдает сессии новый токен newID.
+// Если oldID уже был использован, сессия отзывается целиком и возвращается ErrRefreshTokenReused.
+// Неизвестный токен, истекшая или отозванная сессия - ErrSessionNotFound.
+func (s *Storage) RotateRefreshToken(ctx context.Context, sessionID, oldID, newID string, expiresAt time.Time) error {
+	const op = "storage.postgres.RotateRefreshToken"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	args := pgx.NamedArgs{"sessionID": sessionID, "oldID": oldID, "newID": newID, "expiresAt": expiresAt}
+
+	// Блокировка сессии упорядочивает параллельные обновления: второй запрос с тем же
+	// токеном увидит его использованным
+	query := `SELECT t.used_at IS NOT NULL, t.expires_at > NOW()
+	          FROM auth_sessions s JOIN refresh_tokens t ON t.session_id = s.id
+	          WHERE s.id = @sessionID AND t.jti = @oldID AND s.revoked_at IS NULL AND s.expires_at > NOW()
+	          FOR UPDATE OF s`
+
+	var used, active bool
+	if err := tx.QueryRow(ctx, query, args).Scan(&used, &active); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, models.ErrSessionNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if used {
+		if _, err := tx.Exec(ctx, `UPDATE auth_sessions SET revoked_at = NOW() WHERE id = @sessionID`, args); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		return fmt.Errorf("%s: %w", op, models.ErrRefreshTokenReused)
+	}
+	if !active {
+		return fmt.Errorf("%s: %w", op, models.ErrSessionNotFound)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE jti = @oldID`, args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO refresh_tokens (jti, session_id, expires_at) VALUES (@newID, @sessionID, @expiresAt)`, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.Exec(ctx, `UPDATE auth_sessions SET last_used_at = NOW(), expires_at = @expiresAt WHERE id = @sessionID`, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// activeSession - условие действующей сессии: не отозвана и не истекла.
+const activeSession = `revoked_at IS NULL AND expires_at > NOW()`
+
+// Sessions возвращает действующие сессии пользователя, недавно использованные первыми.
+func (s *Storage) Sessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	const op = "storage.postgres.Sessions"
+
+	query := `SELECT id, user_id, user_agent, ip, created_at, last_used_at, expires_at, revoked_at
+	          FROM auth_sessions
+	          WHERE user_id = @userID AND ` + activeSession + `
+	          ORDER BY last_used_at DESC`
+
+	rows, err := s.pool.Query(ctx, query, pgx.NamedArgs{"userID": userID})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.Session, error) {
+		var session models.Session
+		err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt)
+		return &session, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// SessionActive сообщает, действует ли сессия. Неизвестная сессия считается недействующей.
+func (s *Storage) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	const op = "storage.postgres.SessionActive"
+
+	query := `SELECT EXISTS (SELECT 1 FROM auth_sessions WHERE id = @id AND ` + activeSession + `)`
+
+	var active bool
+	if err := s.pool.QueryRow(ctx, query, pgx.NamedArgs{"id": sessionID}).Scan(&active); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return active, nil
+}
+
+// RevokeSession отзывает действующую сессию пользователя. Чужая, истекшая
+// или уже отозванная сессия - ErrSessionNotFound.
+func (s *Storage) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	const op = "storage.postgres.RevokeSession"
+
+	query := `UPDATE auth_sessions SET revoked_at = NOW()
+	          WHERE id = @id AND user_id = @userID AND ` + activeSession
+
+	tag, err := s.pool.Exec(ctx, query, pgx.NamedArgs{"id": sessionID, "userID": userID})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrSessionNotFound)
+	}
+
+	return nil
+}
+
+// RevokeUserSessions отзывает все действующие сессии пользователя и возвращает их ID.
+func (s *Storage) RevokeUserSessions(ctx context.Context, userID int64) ([]string, error) {
+	const op = "storage.postgres.RevokeUserSessions"
+
+	ids, err := revokeUserSessions(ctx, s.pool, userID, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return ids, nil
+}
+
+// revokeUserSessions отзывает действующие сессии пользователя, кроме exceptSessionID, и возвращает их ID.
+func revokeUserSessions(ctx context.Context, q querier, userID int64, exceptSessionID string) ([]string, error) {
+	query := `UPDATE auth_sessions SET revoked_at = NOW()
+	          WHERE user_id = @userID AND id <> @except AND ` + activeSession + `
+	          RETURNING id`
+
+	rows, err := q.Query(ctx, query, pgx.NamedArgs{"userID": userID, "except": exceptSessionID})
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// SlowMode возвращает минимальный интервал между сообщениями участника чата (0 - выключен).
+func (s *Storage) SlowMode(ctx context.Context, chatID int64) (time.Duration, error) {
+	const op = "storage.postgres.SlowMode"
+
+	var seconds int
+	err := s.pool.QueryRow(ctx, `SELECT slow_mode_seconds FROM chats WHERE id = @chatID`,
+		pgx.NamedArgs{"chatID": chatID}).Scan(&seconds)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, models.ErrChatNotFound)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// SetSlowMode задает интервал медленного режима чата, 0 выключает его.
+func (s *Storage) SetSlowMode(ctx context.Context, chatID int64, interval time.Duration) error {
+	const op = "storage.postgres.SetSlowMode"
+
+	tag, err := s.pool.Exec(ctx, `UPDATE chats SET slow_mode_seconds = @seconds WHERE id = @chatID`,
+		pgx.NamedArgs{"chatID": chatID, "seconds": int(interval / time.Second)})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrChatNotFound)
+	}
+
+	return nil
+}
+
+// claimSlot занимает в транзакции tx право участника отправить сообщение.
+// Возвращает нулевое время, если отправить можно (медленный режим выключен, пользователь -
+// владелец или администратор чата, либо интервал с прошлого сообщения истек), иначе -
+// момент, когда будет можно. Строка участника остается заблокированной до конца
+// транзакции, поэтому одновременные отправки с нескольких инстансов не проходят обе.
+func claimSlot(ctx context.Context, tx pgx.Tx, chatID, userID int64) (time.Time, error) {
+	args := pgx.NamedArgs{"chatID": chatID, "userID": userID}
+
+	// Условие на роль совпадает с models.ChatRole.CanManage
+	tag, err := tx.Exec(ctx, `UPDATE chat_users cu SET last_message_at = NOW() 
+	          FROM chats c 
+	          WHERE c.id = cu.chat_id AND cu.chat_id = @chatID AND cu.user_id = @userID 
+	            AND (c.slow_mode_seconds = 0 
+	                 OR cu.role IN ('owner', 'admin') 
+	                 OR cu.last_message_at IS NULL 
+	                 OR cu.last_message_at <= NOW() - make_interval(secs => c.slow_mode_seconds))`, args)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if tag.RowsAffected() == 1 {
+		return time.Time{}, nil
+	}
+
+	var retryAt time.Time
+	err = tx.QueryRow(ctx, `SELECT cu.last_message_at + make_interval(secs => c.slow_mode_seconds) 
+	          FROM chat_users cu JOIN chats c ON c.id = cu.chat_id 
+	          WHERE cu.chat_id = @chatID AND cu.user_id = @userID`, args).Scan(&retryAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, models.ErrNotChatMember
+		}
+		return time.Time{}, err
+	}
+
+	return retryAt, nil
+}
@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveTOTPSecret сохраняет новый, еще не подтвержденный секрет TOTP вместо прежнего.
+// Если 2FA уже включена - ErrTOTPAlreadyEnabled.
+func (s *Storage) SaveTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	const op = "storage.postgres.SaveTOTPSecret"
+
+	query := `INSERT INTO user_totp (user_id, secret) VALUES (@userID, @secret)
+	          ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_step = 0, created_at = NOW()
+	          WHERE user_totp.enabled_at IS NULL`
+
+	tag, err := s.pool.Exec(ctx, query, pgx.NamedArgs{"userID": userID, "secret": secret})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrTOTPAlreadyEnabled)
+	}
+
+	return nil
+}
+
+// TOTPByUserID возвращает второй фактор пользователя; если секрет не выдавался - ErrTOTPNotFound.
+func (s *Storage) TOTPByUserID(ctx context.Context, userID int64) (*models.TOTP, error) {
+	const op = "storage.postgres.TOTPByUserID"
+
+	query := `SELECT user_id, secret, enabled_at IS NOT NULL, last_step FROM user_totp WHERE user_id = @userID`
+
+	var totp models.TOTP
+	err := s.pool.QueryRow(ctx, query, pgx.NamedArgs{"userID": userID}).
+		Scan(&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", op, models.ErrTOTPNotFound)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &totp, nil
+}
+
+// EnableTOTP включает 2FA после проверки первого кода с шагом step и заменяет коды
+// восстановления пользователя хэшами recoveryHashes.
+func (s *Storage) EnableTOTP(ctx context.Context, userID, step int64, recoveryHashes []string) error {
+	const op = "storage.postgres.EnableTOTP"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	args := pgx.NamedArgs{"userID": userID, "step": step, "hashes": recoveryHashes}
+
+	tag, err := tx.Exec(ctx, `UPDATE user_totp SET enabled_at = NOW(), last_step = @step
+	          WHERE user_id = @userID AND enabled_at IS NULL`, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrTOTPAlreadyEnabled)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = @userID`, args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO totp_recovery_codes (user_id, code_hash)
+	          SELECT @userID, unnest(@hashes::text[])`, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep запоминает шаг принятого кода. Код того же или более раннего шага уже
+// использован - ErrTOTPCodeInvalid.
+func (s *Storage) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	const op = "storage.postgres.UseTOTPStep"
+
+	// Условие в UPDATE атомарно: из двух параллельных запросов с одним кодом пройдет один
+	query := `UPDATE user_totp SET last_step = @step
+	          WHERE user_id = @userID AND enabled_at IS NOT NULL AND last_step < @step`
+
+	tag, err := s.pool.Exec(ctx, query, pgx.NamedArgs{"userID": userID, "step": step})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrTOTPCodeInvalid)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode погашает код восстановления. Неизвестный или использованный код - ErrTOTPCodeInvalid.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	const op = "storage.postgres.UseRecoveryCode"
+
+	query := `UPDATE totp_recovery_codes SET used_at = NOW()
+	          WHERE user_id = @userID AND code_hash = @codeHash AND used_at IS NULL`
+
+	tag, err := s.pool.Exec(ctx, query, pgx.NamedArgs{"userID": userID, "codeHash": codeHash})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, models.ErrTOTPCodeInvalid)
+	}
+
+	return nil
+}
+
+// DisableTOTP удаляет секрет и коды восстановления пользователя.
+func (s *Storage) DisableTOTP(ctx context.Context, userID int64) error {
+	const op = "storage.postgres.DisableTOTP"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	args := pgx.NamedArgs{"userID": userID}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = @userID`, args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = @userID`, args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
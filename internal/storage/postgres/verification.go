@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grigory222/go-chat-server/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateEmailVerificationToken сохраняет хэш нового токена подтверждения email
+// вместо прежних токенов пользователя.
+func (s *Storage) CreateEmailVerificationToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	const op = "storage.postgres.CreateEmailVerificationToken"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	args := pgx.NamedArgs{"userID": userID, "tokenHash": tokenHash, "expiresAt": expiresAt}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM email_verification_tokens WHERE user_id = @userID`, args); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO email_verification_tokens (token_hash, user_id, expires_at)
+	          VALUES (@tokenHash, @userID, @expiresAt)`, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// EmailVerificationSentAt возвращает время выдачи последнего токена подтверждения
+// или нулевое время, если писем не было.
+func (s *Storage) EmailVerificationSentAt(ctx context.Context, userID int64) (time.Time, error) {
+	const op = "storage.postgres.EmailVerificationSentAt"
+
+	query := `SELECT MAX(created_at) FROM email_verification_tokens WHERE user_id = @userID`
+
+	var sentAt *time.Time
+	if err := s.pool.QueryRow(ctx, query, pgx.NamedArgs{"userID": userID}).Scan(&sentAt); err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if sentAt == nil {
+		return time.Time{}, nil
+	}
+
+	return *sentAt, nil
+}
+
+// VerifyEmail погашает токен и помечает email пользователя подтвержденным.
+// Неизвестный или истекший токен - ErrVerifyTokenInvalid.
+func (s *Storage) VerifyEmail(ctx context.Context, tokenHash string) (int64, error) {
+	const op = "storage.postgres.VerifyEmail"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx) // no-op после Commit
+
+	args := pgx.NamedArgs{"tokenHash": tokenHash}
+
+	query := `DELETE FROM email_verification_tokens
+	          WHERE token_hash = @tokenHash AND expires_at > NOW()
+	          RETURNING user_id`
+
+	var userID int64
+	if err := tx.QueryRow(ctx, query, args).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, models.ErrVerifyTokenInvalid)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	args["userID"] = userID
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET email_verified = TRUE WHERE id = @userID`, args); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/grigory222/go-chat-server/internal/domain/models"
 )
@@ -10,12 +11,83 @@ type Storage interface {
 	SaveUser(ctx context.Context, name, email, passHash string) (int64, error)
 	UserByEmail(ctx context.Context, email string) (*models.User, error)
 	UserByID(ctx context.Context, id int64) (*models.User, error)
+	ChangePassword(ctx context.Context, userID int64, passHash, keepSessionID string) ([]string, error)
+	UpdatePasswordHash(ctx context.Context, userID int64, oldHash, newHash string) error
+	CreatePasswordResetToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error
+	PasswordResetSentAt(ctx context.Context, userID int64) (time.Time, error)
+	ResetPassword(ctx context.Context, tokenHash, passHash string) (int64, []string, error)
+	CreateEmailVerificationToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error
+	EmailVerificationSentAt(ctx context.Context, userID int64) (time.Time, error)
+	VerifyEmail(ctx context.Context, tokenHash string) (int64, error)
+	SaveTOTPSecret(ctx context.Context, userID int64, secret string) error
+	TOTPByUserID(ctx context.Context, userID int64) (*models.TOTP, error)
+	EnableTOTP(ctx context.Context, userID, step int64, recoveryHashes []string) error
+	UseTOTPStep(ctx context.Context, userID, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error
+	DisableTOTP(ctx context.Context, userID int64) error
+	CreateOIDCState(ctx context.Context, state *models.OIDCState) error
+	ConsumeOIDCState(ctx context.Context, stateHash string) (*models.OIDCState, error)
+	UserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error)
+	LinkIdentity(ctx context.Context, userID int64, issuer, subject string) ([]string, error)
+	SaveOIDCUser(ctx context.Context, name, email, issuer, subject string) (int64, error)
 
-	CreateChat(ctx context.Context, name string) (int64, error)
-	AddUserToChat(ctx context.Context, chatID, userID int64) error
-	SaveMessage(ctx context.Context, chatID, userID int64, text string) (*models.Message, error)
+	CreateSession(ctx context.Context, session *models.Session, refreshID string) error
+	RotateRefreshToken(ctx context.Context, sessionID, oldID, newID string, expiresAt time.Time) error
+	Sessions(ctx context.Context, userID int64) ([]*models.Session, error)
+	SessionActive(ctx context.Context, sessionID string) (bool, error)
+	RevokeSession(ctx context.Context, userID int64, sessionID string) error
+	RevokeUserSessions(ctx context.Context, userID int64) ([]string, error)
+
+	CreateChat(ctx context.Context, name, chatType string) (int64, error)
+	ChatByID(ctx context.Context, chatID int64) (*models.Chat, error)
+	AddUserToChat(ctx context.Context, chatID, userID int64, role models.ChatRole) error
+	ChatMemberRole(ctx context.Context, chatID, userID int64) (models.ChatRole, error)
+	SetMemberRole(ctx context.Context, chatID, userID, ownerID int64, role models.ChatRole) error
+	SaveMessage(ctx context.Context, chatID, userID int64, text, idempotencyKey string, attachmentIDs []int64, ttl time.Duration, claimSlowModeSlot bool) (*models.Message, error)
+	MessageByID(ctx context.Context, id int64) (*models.Message, error)
+	MessageByIdempotencyKey(ctx context.Context, chatID, userID int64, idempotencyKey string) (*models.Message, error)
 	GetChatHistory(ctx context.Context, chatID int64, limit, offset uint64) ([]*models.Message, error)
+	SearchMessages(ctx context.Context, userID int64, query string, filter models.SearchFilter, limit, offset uint64) ([]*models.SearchResult, error)
+
+	PinMessage(ctx context.Context, chatID, messageID, pinnedBy int64, maxPins int) (bool, error)
+	UnpinMessage(ctx context.Context, chatID, messageID int64) (bool, error)
+	PinnedMessages(ctx context.Context, chatID int64) ([]*models.Message, error)
+
+	SaveScheduledMessage(ctx context.Context, chatID, userID int64, text string, sendAt time.Time) (*models.ScheduledMessage, error)
+	ScheduledMessages(ctx context.Context, userID, chatID int64) ([]*models.ScheduledMessage, error)
+	UpdateScheduledMessage(ctx context.Context, id, userID int64, text string, sendAt time.Time) (*models.ScheduledMessage, error)
+	DeleteScheduledMessage(ctx context.Context, id, userID int64) error
+	ClaimDueScheduledMessages(ctx context.Context, lease time.Duration, limit int) ([]*models.ScheduledMessage, error)
+	FinishScheduledMessage(ctx context.Context, id, messageID int64) error
+
+	RetentionPolicy(ctx context.Context, chatID int64) (*models.RetentionPolicy, error)
+	SetRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy, actorID int64) error
+	ActiveRetentionPolicies(ctx context.Context) ([]*models.RetentionPolicy, error)
+	PurgeExpiredMessages(ctx context.Context, chatID int64, limit int) (*models.PurgeBatch, error)
+	DeleteExpiredMessages(ctx context.Context, limit int) (*models.PurgeBatch, error)
+	DeleteOrphanBlob(ctx context.Context, key string, deleteBlob func(context.Context, string) error) (bool, error)
+	SavePurgeRun(ctx context.Context, run *models.PurgeRun) error
+
+	SlowMode(ctx context.Context, chatID int64) (time.Duration, error)
+	SetSlowMode(ctx context.Context, chatID int64, interval time.Duration) error
+
+	ModerationSettings(ctx context.Context, chatID int64) (*models.ModerationSettings, error)
+	SetModerationSettings(ctx context.Context, settings *models.ModerationSettings) error
+
+	IsServerAdmin(ctx context.Context, userID int64) (bool, error)
+	CreateReport(ctx context.Context, messageID, reporterID int64, reason string) (*models.Report, error)
+	ReportByID(ctx context.Context, id int64) (*models.Report, error)
+	Reports(ctx context.Context, filter models.ReportFilter, limit, offset uint64) ([]*models.Report, error)
+	ClaimReport(ctx context.Context, id, moderatorID int64, claimTTL time.Duration) (*models.Report, error)
+	ResolveReport(ctx context.Context, res *models.ReportResolution) (*models.Report, error)
+	ModerationAudit(ctx context.Context, chatID int64, limit, offset uint64) ([]*models.AuditEntry, error)
+	SetMemberMute(ctx context.Context, chatID, userID, moderatorID int64, until *time.Time) error
+
+	SaveAttachment(ctx context.Context, attachment *models.Attachment) (int64, error)
+	AttachmentByID(ctx context.Context, id int64) (*models.Attachment, error)
+	SaveThumbnail(ctx context.Context, thumbnail *models.Thumbnail) error
 
 	IsUserInChat(ctx context.Context, userID, chatID int64) (bool, error)
+	ChatMember(ctx context.Context, chatID, userID int64) (*models.ChatMember, error)
 	Close()
 }
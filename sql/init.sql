@@ -4,6 +4,10 @@ CREATE TABLE users (
                        name TEXT NOT NULL,
                        email TEXT UNIQUE NOT NULL,
                        password_hash TEXT NOT NULL,
+                       -- Администратор сервера: модерирует жалобы во всех чатах
+                       is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+                       -- Email подтвержден переходом по ссылке из письма
+                       email_verified BOOLEAN NOT NULL DEFAULT FALSE,
                        created_at TIMESTAMP DEFAULT NOW()
 );
 
@@ -11,7 +15,14 @@ CREATE TABLE users (
 CREATE TABLE chats (
                        id SERIAL PRIMARY KEY,
                        name TEXT NOT NULL,
-                       type TEXT NOT NULL CHECK (type IN ('public', 'private')),
+                       -- channel - канал объявлений: пишут только owner и admin, остальные читают
+                       type TEXT NOT NULL CHECK (type IN ('public', 'private', 'channel')),
+                       -- NULL - хранить сообщения бессрочно
+                       retention_days INT CHECK (retention_days > 0),
+                       -- legal hold приостанавливает удаление по сроку хранения
+                       legal_hold BOOLEAN NOT NULL DEFAULT FALSE,
+                       -- Медленный режим: участник может писать не чаще раза в N секунд, 0 - выключен
+                       slow_mode_seconds INT NOT NULL DEFAULT 0 CHECK (slow_mode_seconds >= 0),
                        created_at TIMESTAMP DEFAULT NOW()
 );
 
@@ -21,13 +32,280 @@ CREATE TABLE messages (
                           chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
                           user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
                           text TEXT NOT NULL,
+                          idempotency_key TEXT,
+                          search_vector TSVECTOR,
+                          -- Исчезающие сообщения: после expires_at не отдаются и удаляются уборщиком
+                          expires_at TIMESTAMPTZ,
+                          -- Подписчики уже получили событие удаления, а строка осталась из-за legal hold
+                          deleted_notified BOOLEAN NOT NULL DEFAULT FALSE,
                           created_at TIMESTAMP DEFAULT NOW()
 );
 
+-- Повторная отправка с тем же ключом не должна создавать дубликат
+CREATE UNIQUE INDEX messages_idempotency_key_idx
+    ON messages (chat_id, user_id, idempotency_key)
+    WHERE idempotency_key IS NOT NULL;
+
+-- Полнотекстовый поиск по сообщениям.
+-- Конфигурация языка задается на деплой через параметр сессии chat.search_config
+-- (сервер выставляет его при подключении из postgres.search_config).
+CREATE FUNCTION chat_search_config() RETURNS regconfig AS $$
+    SELECT COALESCE(NULLIF(current_setting('chat.search_config', true), ''), 'simple')::regconfig
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION messages_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := to_tsvector(chat_search_config(), NEW.text);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER messages_search_vector_trg
+    BEFORE INSERT OR UPDATE OF text ON messages
+    FOR EACH ROW EXECUTE FUNCTION messages_search_vector_update();
+
+CREATE INDEX messages_search_vector_idx ON messages USING GIN (search_vector);
+-- История чата и удаление по сроку хранения
+CREATE INDEX messages_chat_created_idx ON messages (chat_id, created_at);
+CREATE INDEX messages_expires_at_idx ON messages (expires_at) WHERE expires_at IS NOT NULL;
+
+-- Вложения. Содержимое хранится в blob-хранилище по SHA-256,
+-- одинаковые файлы физически хранятся один раз.
+CREATE TABLE attachments (
+                             id SERIAL PRIMARY KEY,
+                             chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+                             uploader_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                             message_id INT REFERENCES messages(id) ON DELETE CASCADE,
+                             sha256 TEXT NOT NULL,
+                             name TEXT NOT NULL,
+                             mime_type TEXT NOT NULL,
+                             size BIGINT NOT NULL,
+                             -- Размеры изображения, 0 для прочих файлов
+                             width INT NOT NULL DEFAULT 0,
+                             height INT NOT NULL DEFAULT 0,
+                             created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX attachments_message_id_idx ON attachments (message_id);
+CREATE INDEX attachments_sha256_idx ON attachments (sha256);
+CREATE INDEX attachments_chat_id_idx ON attachments (chat_id, created_at) WHERE message_id IS NULL;
+
+-- Превью изображений, генерируются в фоне после загрузки
+CREATE TABLE attachment_thumbnails (
+                                       id SERIAL PRIMARY KEY,
+                                       attachment_id INT NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+                                       width INT NOT NULL,
+                                       height INT NOT NULL,
+                                       mime_type TEXT NOT NULL,
+                                       size BIGINT NOT NULL,
+                                       sha256 TEXT NOT NULL,
+                                       created_at TIMESTAMP DEFAULT NOW(),
+                                       UNIQUE (attachment_id, width, height)
+);
+
+-- Проверка, ссылается ли еще что-то на blob, перед его удалением
+CREATE INDEX attachment_thumbnails_sha256_idx ON attachment_thumbnails (sha256);
+
 -- Связь пользователей и чатов
 CREATE TABLE chat_users (
                             chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
                             user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                            -- owner - создатель чата; owner и admin управляют чатом (закрепы и т.п.)
+                            role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
+                            -- Время последнего сообщения для медленного режима
+                            last_message_at TIMESTAMPTZ,
+                            -- Мут: до этого момента участник читает чат, но не может писать
+                            muted_until TIMESTAMPTZ,
                             joined_at TIMESTAMP DEFAULT NOW(),
                             PRIMARY KEY (chat_id, user_id)
 );
+
+-- Настройки фильтров сообщений чата. Нет строки - работает только проверка на пустой текст
+CREATE TABLE chat_moderation (
+                                 chat_id INT PRIMARY KEY REFERENCES chats(id) ON DELETE CASCADE,
+                                 banned_words TEXT[] NOT NULL DEFAULT '{}',
+                                 banned_words_action TEXT NOT NULL DEFAULT 'reject' CHECK (banned_words_action IN ('reject', 'replace')),
+                                 -- Правила по регулярным выражениям: [{"pattern": ..., "action": ..., "replacement": ...}]
+                                 rules JSONB NOT NULL DEFAULT '[]',
+                                 block_links BOOLEAN NOT NULL DEFAULT FALSE,
+                                 -- 0 - длина не ограничена
+                                 max_length INT NOT NULL DEFAULT 0 CHECK (max_length >= 0),
+                                 updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Закрепленные сообщения. Число закрепов в чате ограничивается сервисом
+CREATE TABLE pinned_messages (
+                                 message_id INT PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+                                 chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+                                 pinned_by INT REFERENCES users(id) ON DELETE SET NULL,
+                                 pinned_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX pinned_messages_chat_id_idx ON pinned_messages (chat_id, pinned_at DESC);
+
+-- Отложенные сообщения. Планировщик забирает созревшие строки через FOR UPDATE SKIP LOCKED
+-- и помечает их арендой claimed_until, поэтому несколько инстансов не отправят одно сообщение дважды
+CREATE TABLE scheduled_messages (
+                                    id SERIAL PRIMARY KEY,
+                                    chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+                                    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                    text TEXT NOT NULL,
+                                    send_at TIMESTAMPTZ NOT NULL,
+                                    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+                                    claimed_until TIMESTAMPTZ,
+                                    message_id INT REFERENCES messages(id) ON DELETE SET NULL,
+                                    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX scheduled_messages_due_idx ON scheduled_messages (send_at) WHERE status = 'pending';
+CREATE INDEX scheduled_messages_user_idx ON scheduled_messages (user_id, send_at) WHERE status = 'pending';
+
+-- Журнал удалений по сроку хранения: одна запись на чат за проход уборщика
+CREATE TABLE purge_runs (
+                            id SERIAL PRIMARY KEY,
+                            chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+                            retention_days INT NOT NULL,
+                            started_at TIMESTAMPTZ NOT NULL,
+                            finished_at TIMESTAMPTZ NOT NULL,
+                            messages_deleted INT NOT NULL DEFAULT 0,
+                            attachments_deleted INT NOT NULL DEFAULT 0,
+                            blobs_deleted INT NOT NULL DEFAULT 0,
+                            error TEXT
+);
+
+CREATE INDEX purge_runs_chat_id_idx ON purge_runs (chat_id, started_at DESC);
+
+-- Заблокированные в чате пользователи: исключены из chat_users и не могут вернуться
+CREATE TABLE chat_bans (
+                           chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+                           user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                           banned_by INT REFERENCES users(id) ON DELETE SET NULL,
+                           created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+                           PRIMARY KEY (chat_id, user_id)
+);
+
+-- Жалобы на сообщения. Текст и автор копируются, чтобы жалоба пережила удаление сообщения
+CREATE TABLE message_reports (
+                                 id SERIAL PRIMARY KEY,
+                                 message_id INT REFERENCES messages(id) ON DELETE SET NULL,
+                                 chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+                                 reporter_id INT REFERENCES users(id) ON DELETE SET NULL,
+                                 author_id INT REFERENCES users(id) ON DELETE SET NULL,
+                                 reason TEXT NOT NULL,
+                                 message_text TEXT NOT NULL,
+                                 status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'claimed', 'resolved')),
+                                 claimed_by INT REFERENCES users(id) ON DELETE SET NULL,
+                                 claimed_at TIMESTAMPTZ,
+                                 resolution TEXT CHECK (resolution IN ('dismiss', 'delete_message', 'mute_user', 'ban_user')),
+                                 resolved_by INT REFERENCES users(id) ON DELETE SET NULL,
+                                 resolved_at TIMESTAMPTZ,
+                                 created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Один пользователь жалуется на сообщение один раз
+CREATE UNIQUE INDEX message_reports_reporter_idx ON message_reports (message_id, reporter_id);
+-- Очередь модерации: нерешенные жалобы чата, старые первыми
+CREATE INDEX message_reports_queue_idx ON message_reports (chat_id, created_at) WHERE status <> 'resolved';
+
+-- Журнал модерации: жалобы, захваты и решения. Записи не удаляются вместе с сообщениями и пользователями
+CREATE TABLE moderation_audit (
+                                  id SERIAL PRIMARY KEY,
+                                  actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+                                  chat_id INT REFERENCES chats(id) ON DELETE CASCADE,
+                                  report_id INT REFERENCES message_reports(id) ON DELETE SET NULL,
+                                  target_user_id INT,
+                                  message_id INT,
+                                  action TEXT NOT NULL,
+                                  details TEXT NOT NULL DEFAULT '',
+                                  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX moderation_audit_chat_id_idx ON moderation_audit (chat_id, created_at DESC);
+
+-- Сессии входа: каждое семейство refresh токенов, начатое одним Login
+CREATE TABLE auth_sessions (
+                               id TEXT PRIMARY KEY,
+                               user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                               -- Устройство, с которого выполнен вход
+                               user_agent TEXT NOT NULL DEFAULT '',
+                               ip TEXT NOT NULL DEFAULT '',
+                               created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+                               last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+                               expires_at TIMESTAMPTZ NOT NULL,
+                               -- Отозванная сессия: ни один ее refresh токен больше не принимается
+                               revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX auth_sessions_user_id_idx ON auth_sessions (user_id);
+
+-- Выданные refresh токены. Использованный токен остается в таблице: его повторное
+-- предъявление означает кражу, и вся сессия отзывается
+CREATE TABLE refresh_tokens (
+                                jti TEXT PRIMARY KEY,
+                                session_id TEXT NOT NULL REFERENCES auth_sessions(id) ON DELETE CASCADE,
+                                expires_at TIMESTAMPTZ NOT NULL,
+                                used_at TIMESTAMPTZ,
+                                created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX refresh_tokens_session_id_idx ON refresh_tokens (session_id);
+
+-- Токены сброса пароля. Хранится только SHA-256 токена: утечка таблицы не дает сбросить пароль
+CREATE TABLE password_reset_tokens (
+                                       token_hash TEXT PRIMARY KEY,
+                                       user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                       expires_at TIMESTAMPTZ NOT NULL,
+                                       used_at TIMESTAMPTZ,
+                                       created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);
+
+-- Токены подтверждения email (SHA-256). У пользователя действует только последний токен;
+-- created_at ограничивает частоту повторной отправки письма
+CREATE TABLE email_verification_tokens (
+                                           token_hash TEXT PRIMARY KEY,
+                                           user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                           expires_at TIMESTAMPTZ NOT NULL,
+                                           created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX email_verification_tokens_user_id_idx ON email_verification_tokens (user_id);
+
+-- TOTP (RFC 6238). Пока enabled_at IS NULL, секрет ожидает подтверждения первым кодом.
+-- last_step - шаг последнего принятого кода, защищает от повторного использования кода
+CREATE TABLE user_totp (
+                           user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+                           secret TEXT NOT NULL,
+                           enabled_at TIMESTAMPTZ,
+                           last_step BIGINT NOT NULL DEFAULT 0,
+                           created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Одноразовые коды восстановления 2FA (SHA-256)
+CREATE TABLE totp_recovery_codes (
+                                     user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     code_hash TEXT NOT NULL,
+                                     used_at TIMESTAMPTZ,
+                                     PRIMARY KEY (user_id, code_hash)
+);
+
+-- Учетные записи у OpenID провайдеров: пользователь у провайдера определяется парой
+-- (issuer, subject), email у провайдера может меняться
+CREATE TABLE user_identities (
+                                 issuer TEXT NOT NULL,
+                                 subject TEXT NOT NULL,
+                                 user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                 created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+                                 PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+-- Начатые входы через OpenID провайдера (state хранится как SHA-256)
+CREATE TABLE oidc_login_states (
+                                   state_hash TEXT PRIMARY KEY,
+                                   code_challenge TEXT NOT NULL,
+                                   nonce TEXT NOT NULL,
+                                   expires_at TIMESTAMPTZ NOT NULL
+);